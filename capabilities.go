@@ -64,6 +64,11 @@ type Capabilities struct {
 	// command execution via [Client.ExecInteractive].
 	// Free: determined by a local interface check with no remote round-trip.
 	InteractiveExec bool
+
+	// InteractiveSession lists the [protocol.SessionOptions] that
+	// [Client.ExecInteractive] can honor on the connection.
+	// Free: reported by the connection without a remote round-trip.
+	InteractiveSession protocol.SessionSupport
 }
 
 // sudoAvailable returns (true, nil) when runner is non-nil and err is nil,
@@ -195,6 +200,9 @@ func (c *Client) Capabilities() Capabilities {
 
 	if c.connection != nil {
 		_, caps.InteractiveExec = c.connection.(protocol.InteractiveExecer)
+		if conn, ok := c.connection.(protocol.SessionExecer); ok {
+			caps.InteractiveSession = conn.SessionSupport()
+		}
 	}
 
 	return caps
@@ -22,6 +22,9 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"maps"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -69,6 +72,9 @@ type Client struct {
 
 	sudoOnce  sync.Once
 	sudoClone *Client
+
+	asMu     sync.Mutex
+	asClones map[string]*Client
 }
 
 // ClientWithConfig is a [Client] that is suitable for embedding into
@@ -229,10 +235,12 @@ func (c *Client) setup(opts ...ClientOption) error {
 		c.Runner = c.options.GetRunner(c.connection)
 		log.InjectLogger(logger, c.Runner)
 		c.injectCommandGate(c.Runner)
+		c.injectTracer(c.Runner)
+		c.injectEnv(c.Runner)
 
 		c.SudoProvider = c.options.GetSudoProvider(c.Runner)
 		c.InitSystemProvider = c.options.GetInitSystemProvider(c.Runner)
-		c.RemoteFSProvider = c.options.GetRemoteFSProvider(c.Runner)
+		c.RemoteFSProvider = c.remoteFSProvider()
 		c.PackageManagerProvider = c.options.GetPackageManagerProvider(c.Runner)
 		c.OSReleaseProvider = c.options.GetOSReleaseProvider(c.Runner)
 	})
@@ -257,6 +265,57 @@ func (c *Client) injectCommandGate(runner cmd.Runner) {
 	setter.SetCommandGate(c.options.commandGate)
 }
 
+// injectTracer installs the configured [cmd.Tracer] onto the given runner the
+// same way as [Client.injectCommandGate]. Unlike the gate, a runner's own
+// tracer is left in place when none is configured.
+func (c *Client) injectTracer(runner cmd.Runner) {
+	if c.options.tracer == nil {
+		return
+	}
+	setter, ok := runner.(cmd.TracerSetter)
+	if !ok {
+		c.Log().Warn("tracer configured but the runner does not support it; commands will not be traced",
+			"runner", fmt.Sprintf("%T", runner))
+		return
+	}
+	setter.SetTracer(c.options.tracer)
+}
+
+// remoteFSProvider returns the filesystem provider for the client. When the
+// configured tracer is a [TransferTracer], the filesystems it provides report
+// the bytes they transfer to it.
+func (c *Client) remoteFSProvider() *remotefs.Provider {
+	tt, ok := c.options.tracer.(TransferTracer)
+	if !ok {
+		return c.options.GetRemoteFSProvider(c.Runner)
+	}
+	get := c.options.remoteFSProviderConfig.provider
+	host := c.String()
+	return remotefs.NewRemoteFSProvider(func(runner cmd.Runner) (remotefs.FS, error) {
+		fsys, err := get(runner)
+		if err != nil {
+			return nil, err
+		}
+		return remotefs.ObserveTransfers(fsys, func(dir remotefs.TransferDirection, n int64) {
+			tt.BytesTransferred(host, dir, n)
+		}), nil
+	}, c.Runner)
+}
+
+// injectEnv sets the configured default environment variables on the given
+// runner when the runner supports it, the same way as [Client.injectCommandGate].
+func (c *Client) injectEnv(runner cmd.Runner) {
+	setter, ok := runner.(cmd.EnvSetter)
+	if !ok {
+		if len(c.options.env) > 0 {
+			c.Log().Warn("environment variables configured but the runner does not support them; commands will run without them",
+				"runner", fmt.Sprintf("%T", runner))
+		}
+		return
+	}
+	setter.SetEnv(c.options.env)
+}
+
 // Service returns a manager for a named service on the remote host using
 // the host's init system if one can be detected. This can be used to
 // start, stop, restart, and check the status of services.
@@ -329,6 +388,57 @@ func (c *Client) Sudo() *Client {
 	return c.sudoClone
 }
 
+// As returns a copy of the connection with a Runner that runs commands as the
+// given user, using sudo -u, doas -u, runuser or su, whichever the host
+// supports (see [sudo.RegisterUserDefaults]). The filesystem, service and
+// package manager of the copy operate as that user too. The copies are cached
+// per user.
+//
+// On POSIX hosts, unless the client sets it already, the XDG_RUNTIME_DIR
+// environment variable is set to /run/user/<uid> of the user, which is what
+// tools like systemctl --user need to reach the user's service manager.
+//
+// When no method works, the commands of the returned client fail with an error
+// wrapping [sudo.ErrNoUserSwitch].
+func (c *Client) As(user string) *Client {
+	c.asMu.Lock()
+	defer c.asMu.Unlock()
+	if clone, ok := c.asClones[user]; ok {
+		return clone
+	}
+
+	env := c.options.env
+	userRunner, err := c.options.GetUserRunner(c.Runner, user)
+	if err != nil {
+		userRunner = cmd.NewErrorExecutor(fmt.Errorf("run as %s: %w", user, err))
+	} else if _, ok := env["XDG_RUNTIME_DIR"]; !ok && !userRunner.IsWindows() {
+		if uid, err := userRunner.ExecOutput("id -u", cmd.Ungated()); err == nil && isNumeric(uid) {
+			env = maps.Clone(env)
+			if env == nil {
+				env = make(map[string]string, 1)
+			}
+			env["XDG_RUNTIME_DIR"] = "/run/user/" + uid
+		}
+	}
+
+	clone := c.Clone(
+		WithRunner(userRunner),
+		WithConnection(c.connection),
+		WithLogger(log.WithAttrs(c.Log(), log.KeyRunAs, user)),
+		WithEnv(env),
+	)
+	if c.asClones == nil {
+		c.asClones = make(map[string]*Client)
+	}
+	c.asClones[user] = clone
+	return clone
+}
+
+func isNumeric(s string) bool {
+	_, err := strconv.Atoi(s)
+	return err == nil
+}
+
 func (c *Client) connect(ctx context.Context) error {
 	if conn, ok := c.connection.(protocol.Connector); ok {
 		return conn.Connect(ctx) //nolint:wrapcheck // done below
@@ -336,6 +446,21 @@ func (c *Client) connect(ctx context.Context) error {
 	return nil
 }
 
+// connectAttempt makes a connection attempt, traced when the configured tracer
+// is a [ConnectTracer].
+func (c *Client) connectAttempt(ctx context.Context, attempt int) error {
+	ct, ok := c.options.tracer.(ConnectTracer)
+	if !ok {
+		return c.connect(ctx)
+	}
+	ctx, trace := ct.TraceConnect(ctx, ConnectInfo{Host: c.String(), Protocol: c.Protocol(), Attempt: attempt})
+	err := c.connect(ctx)
+	if trace != nil {
+		trace.Finished(err)
+	}
+	return err
+}
+
 // Connect to the host. The connection is attempted until the context is done or the
 // protocol implementation returns an error indicating that the connection can't be
 // established by retrying. If a context without a deadline is used, a 10 second
@@ -355,14 +480,16 @@ func (c *Client) Connect(ctx context.Context) error {
 	}
 
 	if !c.options.ShouldRetry() {
-		if err := c.connect(ctx); err != nil {
+		if err := c.connectAttempt(ctx, 1); err != nil {
 			return fmt.Errorf("client connect: %w", err)
 		}
 		return nil
 	}
 
+	var attempt int
 	err := retry.DoWithContext(ctx, func(ctx context.Context) error {
-		return c.connect(ctx)
+		attempt++
+		return c.connectAttempt(ctx, attempt)
 	}, retry.If(
 		func(err error) bool { return !errors.Is(err, protocol.ErrNonRetryable) },
 	))
@@ -391,12 +518,20 @@ var errInteractiveNotSupported = errors.New("the connection does not provide int
 // ExecInteractive executes a command on the host and passes stdin/stdout/stderr as-is to the session.
 // The session is terminated when ctx is cancelled or its deadline is exceeded.
 //
+// The session options configure the pseudo terminal, resize events and signal
+// delivery. Each protocol honors them as far as it can, see
+// [protocol.SessionSupport] and docs/pty-tty-semantics.md. Options the
+// connection does not support are logged as a warning and ignored, or fail
+// with [protocol.ErrUnsupportedSessionOption] when [protocol.WithStrictSession]
+// is given.
+//
 // A configured [cmd.CommandGate] is consulted for the command before the
 // session starts. Because interactive exec runs directly on the connection
 // rather than through the runner, the gate sees the raw command as given here,
 // without sudo/shell decoration or secret redaction, and commands typed inside
-// the interactive session are not gated.
-func (c *Client) ExecInteractive(ctx context.Context, command string, stdin io.Reader, stdout, stderr io.Writer) error {
+// the interactive session are not gated. The same goes for a tracer installed
+// with [WithTracer] that implements [cmd.InteractiveTracer].
+func (c *Client) ExecInteractive(ctx context.Context, command string, stdin io.Reader, stdout, stderr io.Writer, opts ...protocol.SessionOption) error {
 	conn, ok := c.connection.(protocol.InteractiveExecer)
 	if !ok {
 		return errInteractiveNotSupported
@@ -407,6 +542,18 @@ func (c *Client) ExecInteractive(ctx context.Context, command string, stdin io.R
 	if err := ctx.Err(); err != nil {
 		return fmt.Errorf("exec interactive: %w", err)
 	}
+	options := protocol.NewSessionOptions(opts...)
+	sessionConn, hasSession := conn.(protocol.SessionExecer)
+	var support protocol.SessionSupport
+	if hasSession {
+		support = sessionConn.SessionSupport()
+	}
+	if unsupported := support.Unsupported(options); len(unsupported) > 0 {
+		if options.Strict {
+			return fmt.Errorf("exec interactive: %w: %s", protocol.ErrUnsupportedSessionOption, strings.Join(unsupported, ", "))
+		}
+		c.Log().Warn("interactive session options not supported by the connection are ignored", log.HostAttr(c), "unsupported", strings.Join(unsupported, ", "))
+	}
 	if gate := c.options.commandGate; gate != nil {
 		if err := gate.AllowCommand(ctx, c.String(), command); err != nil {
 			// A context cancellation/deadline is not a rejection: wrap it
@@ -418,12 +565,38 @@ func (c *Client) ExecInteractive(ctx context.Context, command string, stdin io.R
 			return fmt.Errorf("exec interactive: %w: %w", cmd.ErrCommandRejected, err)
 		}
 	}
-	if err := conn.ExecInteractive(ctx, command, stdin, stdout, stderr); err != nil {
+	var trace cmd.InteractiveTrace
+	if it, ok := c.options.tracer.(cmd.InteractiveTracer); ok {
+		trace = it.TraceInteractive(c.String(), command, options.Size)
+	}
+	if trace != nil {
+		stdout = teeInteractive(stdout, trace)
+		stderr = teeInteractive(stderr, trace)
+	}
+	var err error
+	if hasSession {
+		err = sessionConn.ExecInteractiveSession(ctx, command, stdin, stdout, stderr, options)
+	} else {
+		err = conn.ExecInteractive(ctx, command, stdin, stdout, stderr)
+	}
+	if trace != nil {
+		trace.Finished(err)
+	}
+	if err != nil {
 		return fmt.Errorf("exec interactive: %w", err)
 	}
 	return nil
 }
 
+// teeInteractive returns a writer that writes to both w and the trace of an
+// interactive session. w may be nil.
+func teeInteractive(w io.Writer, trace cmd.InteractiveTrace) io.Writer {
+	if w == nil {
+		return trace
+	}
+	return io.MultiWriter(w, trace)
+}
+
 // The provider Getters would be available and working via the embedding already, but the
 // accessors are provided here directly on the Client mainly for discoverability in docs.
 
@@ -1,20 +1,24 @@
 package rig_test
 
 import (
+	"bufio"
 	"context"
 	"errors"
 	"io"
+	"slices"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/k0sproject/rig/v2"
 	"github.com/k0sproject/rig/v2/cmd"
 	"github.com/k0sproject/rig/v2/os"
-	"github.com/k0sproject/rig/v2/protocol"
 	"github.com/k0sproject/rig/v2/packagemanager"
+	"github.com/k0sproject/rig/v2/protocol"
 	"github.com/k0sproject/rig/v2/remotefs"
 	"github.com/k0sproject/rig/v2/rigtest"
+	"github.com/k0sproject/rig/v2/sudo"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"gopkg.in/yaml.v2"
@@ -407,6 +411,59 @@ func TestClientExecInteractiveNotSupported(t *testing.T) {
 	require.ErrorContains(t, err, "interactive")
 }
 
+// sessionConn additionally implements protocol.SessionExecer.
+type sessionConn struct {
+	interactiveConn
+	support      protocol.SessionSupport
+	receivedOpts protocol.SessionOptions
+}
+
+func (c *sessionConn) SessionSupport() protocol.SessionSupport {
+	return c.support
+}
+
+func (c *sessionConn) ExecInteractiveSession(ctx context.Context, cmd string, stdin io.Reader, stdout, stderr io.Writer, opts protocol.SessionOptions) error {
+	c.receivedOpts = opts
+	return c.ExecInteractive(ctx, cmd, stdin, stdout, stderr)
+}
+
+func TestClientExecInteractiveSessionOptions(t *testing.T) {
+	conn := &sessionConn{
+		interactiveConn: interactiveConn{MockConnection: rigtest.NewMockConnection()},
+		support:         protocol.SessionSupport{PTY: true, Term: true},
+	}
+	client, err := rig.NewClient(rig.WithConnection(conn))
+	require.NoError(t, err)
+	require.NoError(t, client.Connect(context.Background()))
+
+	require.NoError(t, client.ExecInteractive(context.Background(), "top", nil, nil, nil,
+		protocol.WithPTY(protocol.PTYForce), protocol.WithTerm("vt100"), protocol.WithWindowSize(120, 40)),
+		"unsupported options are ignored unless strict")
+	require.Equal(t, protocol.PTYForce, conn.receivedOpts.PTY)
+	require.Equal(t, "vt100", conn.receivedOpts.Term)
+	require.Equal(t, protocol.WindowSize{Width: 120, Height: 40}, conn.receivedOpts.Size)
+
+	conn.receivedCmd = ""
+	err = client.ExecInteractive(context.Background(), "top", nil, nil, nil,
+		protocol.WithWindowSize(120, 40), protocol.WithStrictSession())
+	require.ErrorIs(t, err, protocol.ErrUnsupportedSessionOption)
+	require.ErrorContains(t, err, "window size")
+	require.Empty(t, conn.receivedCmd, "the session is not started")
+
+	require.Equal(t, conn.support, client.Capabilities().InteractiveSession)
+}
+
+func TestClientExecInteractiveStrictWithoutSessionSupport(t *testing.T) {
+	conn := &interactiveConn{MockConnection: rigtest.NewMockConnection()}
+	client, err := rig.NewClient(rig.WithConnection(conn))
+	require.NoError(t, err)
+	require.NoError(t, client.Connect(context.Background()))
+
+	require.NoError(t, client.ExecInteractive(context.Background(), "top", nil, nil, nil, protocol.WithStrictSession()))
+	err = client.ExecInteractive(context.Background(), "top", nil, nil, nil, protocol.WithPTY(protocol.PTYForce), protocol.WithStrictSession())
+	require.ErrorIs(t, err, protocol.ErrUnsupportedSessionOption)
+}
+
 // TestPosixShellImposed guards the fix for k0sproject/k0sctl#1135: rig's commands
 // are POSIX, the remote user's login shell is not necessarily POSIX (fish, csh),
 // and sshd runs commands through that login shell. Every command a client sends
@@ -652,3 +709,235 @@ func TestConfirmFuncGatesFilesystemOps(t *testing.T) {
 	}
 	assert.True(t, sawSudoWrapped, "filesystem operations on a sudo client must be gated, got %v", rec.commands())
 }
+
+func TestWithEnv(t *testing.T) {
+	conn := rigtest.NewMockConnection()
+	forceSudo(conn)
+	client, err := rig.NewClient(rig.WithConnection(conn), rig.WithEnv(map[string]string{"K0S_DEBUG": "1"}))
+	require.NoError(t, err)
+	require.NoError(t, client.Connect(context.Background()))
+
+	require.NoError(t, client.Exec("k0s status"))
+	rigtest.ReceivedContains(t, conn, "'env K0S_DEBUG=1 /bin/sh -c -- ")
+
+	require.NoError(t, client.Sudo().Exec("k0s status", cmd.Env(map[string]string{"LANG": "C"})))
+	rigtest.ReceivedContains(t, conn, "'sudo -n -- /bin/sh -c -- '\"'\"'env K0S_DEBUG=1 LANG=C ", "the client environment applies inside sudo")
+}
+
+func TestAs(t *testing.T) {
+	conn := rigtest.NewMockConnection()
+	conn.ErrDefault = errNotRoot
+	conn.AddCommand(rigtest.Contains("id -un"), func(_ *rigtest.A) error { return errNotRoot })
+	conn.AddCommandOutput(rigtest.Match(`sudo -n -u k0s .*id -u`), "1001\n")
+	conn.AddCommandSuccess(rigtest.Contains("sudo -n -u k0s"))
+
+	client, err := rig.NewClient(rig.WithConnection(conn))
+	require.NoError(t, err)
+	require.NoError(t, client.Connect(context.Background()))
+
+	k0s := client.As("k0s")
+	require.Same(t, k0s, client.As("k0s"), "the clone is cached")
+	require.NoError(t, k0s.Exec("systemctl --user restart app"))
+	rigtest.ReceivedContains(t, conn, "sudo -n -u k0s -- /bin/sh -c -- '\"'\"'env XDG_RUNTIME_DIR=/run/user/1001 ")
+
+	err = client.As("nobody").Exec("true")
+	require.ErrorIs(t, err, sudo.ErrNoUserSwitch)
+}
+
+func TestWithSudoPassword(t *testing.T) {
+	conn := rigtest.NewMockConnection()
+	conn.ErrDefault = errNotRoot
+	conn.AddCommand(rigtest.Contains("sudo -S -p"), func(a *rigtest.A) error {
+		line, err := bufio.NewReader(a.Stdin).ReadString('\n')
+		if err != nil || line != "s3cret\n" {
+			return errNotRoot
+		}
+		return nil
+	})
+
+	client, err := rig.NewClient(rig.WithConnection(conn), rig.WithSudoPassword(sudo.StaticPassword("s3cret")))
+	require.NoError(t, err)
+	require.NoError(t, client.Connect(context.Background()))
+
+	require.NoError(t, client.Sudo().Exec("systemctl restart k0s"))
+	rigtest.ReceivedContains(t, conn, "sudo -n -- /bin/sh -c -- '\"'\"'\"'\"'\"'\"'\"'\"'systemctl restart k0s")
+}
+
+func TestWithSudoMethod(t *testing.T) {
+	conn := rigtest.NewMockConnection()
+	conn.AddCommandSuccess(rigtest.Contains("run0 "))
+
+	client, err := rig.NewClient(rig.WithConnection(conn), rig.WithSudoMethod(sudo.RegisterRun0))
+	require.NoError(t, err)
+	require.NoError(t, client.Connect(context.Background()))
+
+	require.NoError(t, client.Sudo().Exec("systemctl restart k0s"))
+	rigtest.ReceivedContains(t, conn, "run0 --no-ask-password -- ")
+	rigtest.NotReceivedContains(t, conn, "sudo -n", "the default methods are not tried")
+}
+
+func TestWithDryRun(t *testing.T) {
+	conn := rigtest.NewMockConnection()
+	dryRun := cmd.NewDryRunRunner(cmd.DryRunHost("node-1"))
+	dryRun.AddResponse(func(command string) bool { return strings.Contains(command, `"$(id -u)" = 0`) }, cmd.DryRunResponse{ExitCode: 1})
+
+	client, err := rig.NewClient(rig.WithConnection(conn), rig.WithDryRun(dryRun))
+	require.NoError(t, err)
+	require.NoError(t, client.Connect(context.Background()))
+	require.Equal(t, "node-1", client.String())
+
+	require.NoError(t, client.Sudo().Exec("systemctl restart k0s"))
+	require.NoError(t, client.Sudo().FS().WriteFile("/etc/k0s.yaml", []byte("config"), 0o600))
+
+	require.Empty(t, conn.Commands(), "nothing is run on the connection")
+	var planned []string
+	for _, c := range dryRun.Commands() {
+		planned = append(planned, c.Command)
+	}
+	require.True(t, slices.ContainsFunc(planned, func(c string) bool {
+		return strings.Contains(c, "sudo -n -- ") && strings.Contains(c, "systemctl restart k0s")
+	}), "the plan has the sudo-wrapped command: %v", planned)
+	require.True(t, slices.ContainsFunc(planned, func(c string) bool {
+		return strings.Contains(c, "sudo -n -- ") && strings.Contains(c, "cat >/etc/k0s.yaml")
+	}), "the plan has the file upload: %v", planned)
+}
+
+// interactiveTracer records the commands and interactive sessions it sees.
+type interactiveTracer struct {
+	mu       sync.Mutex
+	commands []string
+	sessions []string
+	output   strings.Builder
+	err      error
+}
+
+func (r *interactiveTracer) CommandFormatted(_, formatted string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.commands = append(r.commands, formatted)
+}
+
+func (r *interactiveTracer) ProcessStarted(string, string)                        {}
+func (r *interactiveTracer) ProcessFinished(string, string, time.Duration, error) {}
+
+func (r *interactiveTracer) TraceInteractive(host, command string, _ protocol.WindowSize) cmd.InteractiveTrace {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sessions = append(r.sessions, host+": "+command)
+	return r
+}
+
+func (r *interactiveTracer) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.output.Write(p)
+}
+
+func (r *interactiveTracer) Finished(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.err = err
+}
+
+// outputConn is an interactive connection that writes a greeting on stdout.
+type outputConn struct {
+	*rigtest.MockConnection
+}
+
+func (c *outputConn) ExecInteractive(_ context.Context, _ string, _ io.Reader, stdout io.Writer, _ io.Writer) error {
+	_, err := io.WriteString(stdout, "hello\r\n")
+	return err
+}
+
+func TestWithTracer(t *testing.T) {
+	conn := &outputConn{MockConnection: rigtest.NewMockConnection()}
+	conn.AddCommandFailure(rigtest.Contains("id -u"), errNotRoot)
+	conn.AddCommandSuccess(rigtest.Match("."))
+	tracer := &interactiveTracer{}
+
+	client, err := rig.NewClient(rig.WithConnection(conn), rig.WithTracer(tracer))
+	require.NoError(t, err)
+	require.NoError(t, client.Connect(context.Background()))
+
+	require.NoError(t, client.Exec("hostname"))
+	require.NoError(t, client.Sudo().Exec("whoami"))
+	require.Contains(t, tracer.commands, "/bin/sh -c -- hostname")
+	require.True(t, slices.ContainsFunc(tracer.commands, func(c string) bool {
+		return strings.Contains(c, "sudo -n") && strings.Contains(c, "whoami")
+	}), "the sudo runner is traced too: %v", tracer.commands)
+
+	stdout := &strings.Builder{}
+	require.NoError(t, client.ExecInteractive(context.Background(), "bash", nil, stdout, nil))
+	require.Equal(t, "hello\r\n", stdout.String())
+	require.Equal(t, []string{"mockclient: bash"}, tracer.sessions)
+	require.Equal(t, "hello\r\n", tracer.output.String())
+	require.NoError(t, tracer.err)
+}
+
+type connectRecorder struct {
+	interactiveTracer
+	attempts []rig.ConnectInfo
+	results  []error
+	uploaded int64
+}
+
+type connectCtxKey struct{}
+
+type connectTraceFunc func(err error)
+
+func (f connectTraceFunc) Finished(err error) { f(err) }
+
+func (r *connectRecorder) TraceConnect(ctx context.Context, info rig.ConnectInfo) (context.Context, rig.ConnectTrace) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.attempts = append(r.attempts, info)
+	return context.WithValue(ctx, connectCtxKey{}, info.Attempt), connectTraceFunc(func(err error) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.results = append(r.results, err)
+	})
+}
+
+func (r *connectRecorder) BytesTransferred(_ string, dir remotefs.TransferDirection, n int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if dir == remotefs.TransferUpload {
+		r.uploaded += n
+	}
+}
+
+type failingConn struct {
+	*rigtest.MockConnection
+	ctxValue any
+}
+
+var errConnRefused = errors.New("connection refused")
+
+func (c *failingConn) Connect(ctx context.Context) error {
+	c.ctxValue = ctx.Value(connectCtxKey{})
+	return errConnRefused
+}
+
+func TestConnectTracer(t *testing.T) {
+	conn := rigtest.NewMockConnection()
+	conn.AddCommandSuccess(rigtest.Match("."))
+	tracer := &connectRecorder{}
+
+	client, err := rig.NewClient(rig.WithConnection(conn), rig.WithTracer(tracer))
+	require.NoError(t, err)
+	require.NoError(t, client.Connect(context.Background()))
+	require.Equal(t, []rig.ConnectInfo{{Host: "mockclient", Protocol: "mock", Attempt: 1}}, tracer.attempts)
+	require.Equal(t, []error{nil}, tracer.results)
+
+	require.NoError(t, client.FS().WriteFile("/tmp/greeting", []byte("hello"), 0o644))
+	require.Equal(t, int64(5), tracer.uploaded)
+
+	failing := &failingConn{MockConnection: rigtest.NewMockConnection()}
+	tracer = &connectRecorder{}
+	client, err = rig.NewClient(rig.WithConnection(failing), rig.WithTracer(tracer), rig.WithRetry(false))
+	require.NoError(t, err)
+	require.ErrorIs(t, client.Connect(context.Background()), errConnRefused)
+	require.Len(t, tracer.results, 1)
+	require.ErrorIs(t, tracer.results[0], errConnRefused)
+	require.Equal(t, 1, failing.ctxValue, "the attempt is made with the context from the tracer")
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"maps"
 
 	"github.com/k0sproject/rig/v2/cmd"
 	"github.com/k0sproject/rig/v2/initsystem"
@@ -39,6 +40,8 @@ type ClientOptions struct {
 	connectionFactory ConnectionFactory
 	runner            cmd.Runner
 	commandGate       cmd.CommandGate
+	tracer            cmd.Tracer
+	env               map[string]string
 	retryConnection   bool
 	providersContainer
 }
@@ -49,6 +52,7 @@ type providersContainer struct {
 	remoteFSProviderConfig
 	osReleaseProviderConfig
 	sudoProviderConfig
+	userRunnerProviderConfig
 }
 
 type packageManagerProviderConfig struct {
@@ -109,6 +113,14 @@ func (p *sudoProviderConfig) GetSudoProvider(runner cmd.Runner) *sudo.Provider {
 	return sudo.NewSudoProvider(p.provider, runner)
 }
 
+type userRunnerProviderConfig struct {
+	provider sudo.UserRunnerProvider
+}
+
+func (p *userRunnerProviderConfig) GetUserRunner(runner cmd.Runner, user string) (cmd.Runner, error) {
+	return p.provider(runner, user)
+}
+
 func defaultProviders() providersContainer {
 	return providersContainer{
 		packageManagerProviderConfig: packageManagerProviderConfig{provider: packagemanager.DefaultRegistry().Get},
@@ -116,6 +128,7 @@ func defaultProviders() providersContainer {
 		remoteFSProviderConfig:       remoteFSProviderConfig{provider: remotefs.DefaultRegistry().Get},
 		osReleaseProviderConfig:      osReleaseProviderConfig{provider: os.DefaultRegistry().Get},
 		sudoProviderConfig:           sudoProviderConfig{provider: sudo.DefaultRegistry().Get},
+		userRunnerProviderConfig:     userRunnerProviderConfig{provider: sudo.GetUserRunner},
 	}
 }
 
@@ -142,6 +155,8 @@ func (o *ClientOptions) Clone() *ClientOptions {
 		connectionFactory:  o.connectionFactory,
 		runner:             o.runner,
 		commandGate:        o.commandGate,
+		tracer:             o.tracer,
+		env:                o.env,
 		retryConnection:    o.retryConnection,
 		providersContainer: o.providersContainer,
 	}
@@ -217,6 +232,33 @@ func WithRunner(runner cmd.Runner) ClientOption {
 	}
 }
 
+// WithTracer is a functional option that installs a [cmd.Tracer] on the
+// runners of the client and all of its derived runners (sudo, filesystem,
+// services), replacing any tracer a runner given with [WithRunner] has. A tracer
+// that implements [cmd.InteractiveTracer] also gets the sessions started with
+// [Client.ExecInteractive], a [ConnectTracer] the attempts of [Client.Connect]
+// and a [TransferTracer] the bytes moved through [Client.FS]. See the
+// transcript package for a tracer that keeps an auditable record of the
+// commands and the rigotel module for one that emits OpenTelemetry spans and
+// metrics.
+func WithTracer(tracer cmd.Tracer) ClientOption {
+	return func(o *ClientOptions) {
+		o.tracer = tracer
+	}
+}
+
+// WithDryRun is a functional option that makes the client record the commands
+// it would run in runner instead of running them, see [cmd.DryRunRunner]. The
+// runner is used as the connection of the client too, so nothing is sent to a
+// host, not even when connecting, and the ones given with [WithConnection] or
+// [WithConnectionFactory] are not used.
+func WithDryRun(runner *cmd.DryRunRunner) ClientOption {
+	return func(o *ClientOptions) {
+		o.connection = runner
+		o.runner = runner
+	}
+}
+
 // WithCommandGate installs a [cmd.CommandGate] that is consulted before
 // commands run on the client and all of its derived runners (sudo, filesystem,
 // services). Returning a non-nil error from the gate aborts the command,
@@ -264,6 +306,21 @@ func WithConfirmFunc(fn func(host, command string) bool) ClientOption {
 	return WithCommandGate(gate)
 }
 
+// WithEnv sets default environment variables for every command run on the
+// client and all of its derived runners (sudo, filesystem, services).
+// Variables set for a single command via [cmd.Env] take precedence. See
+// [cmd.Env] for how the variables reach the command.
+//
+// The variables reach a runner only if that runner implements
+// [cmd.EnvSetter]. The default runner does; a custom runner supplied via
+// [WithRunner] that does not implement it runs commands without them, and the
+// client logs a warning during setup.
+func WithEnv(env map[string]string) ClientOption {
+	return func(o *ClientOptions) {
+		o.env = maps.Clone(env)
+	}
+}
+
 // WithConnectionFactory is a functional option that sets the connection factory to use for connecting.
 func WithConnectionFactory(factory ConnectionFactory) ClientOption {
 	return func(o *ClientOptions) {
@@ -318,6 +375,43 @@ func WithSudoProvider(provider sudo.RunnerProvider) ClientOption {
 	}
 }
 
+// WithSudoPassword is a functional option that makes the connection's sudo
+// fall back to sudo with the password from provider on hosts where none of
+// the default methods work without one. Use [sudo.ConnectionPassword] to use
+// the password the connection logged in with. See [sudo.RegisterSudoPassword].
+func WithSudoPassword(provider sudo.PasswordProvider) ClientOption {
+	return func(o *ClientOptions) {
+		registry := sudo.NewRegistry()
+		sudo.RegisterDefaults(registry)
+		sudo.RegisterSudoPassword(registry, provider)
+		o.sudoProviderConfig = sudoProviderConfig{provider: registry.Get}
+	}
+}
+
+// WithSudoMethod is a functional option that makes the connection's sudo use
+// the methods the register function registers, instead of trying the default
+// ones in order. For example, to only ever use run0:
+//
+//	rig.WithSudoMethod(sudo.RegisterRun0)
+//
+// The method is still probed, and [Client.Sudo] fails with [sudo.ErrNoSudo]
+// when the host does not support it.
+func WithSudoMethod(register func(*sudo.Registry)) ClientOption {
+	return func(o *ClientOptions) {
+		registry := sudo.NewRegistry()
+		register(registry)
+		o.sudoProviderConfig = sudoProviderConfig{provider: registry.Get}
+	}
+}
+
+// WithUserRunnerProvider is a functional option that sets the provider of the
+// runners used by [Client.As] to run commands as another user.
+func WithUserRunnerProvider(provider sudo.UserRunnerProvider) ClientOption {
+	return func(o *ClientOptions) {
+		o.userRunnerProviderConfig = userRunnerProviderConfig{provider: provider}
+	}
+}
+
 // WithRetry is a functional option that toggles the connection retry feature. Default is true.
 func WithRetry(retry bool) ClientOption {
 	return func(o *ClientOptions) {
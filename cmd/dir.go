@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/k0sproject/rig/v2/powershell"
+	"github.com/k0sproject/rig/v2/sh/shellescape"
+)
+
+// validateDir checks that the working directory can be passed in a command
+// for the host. Windows commands that don't run through PowerShell are run by
+// cmd.exe, which has no way to quote a double quote or a percent sign.
+func validateDir(dir string, isWindows, ps bool) error {
+	if strings.ContainsRune(dir, 0) {
+		return fmt.Errorf("%w: working directory contains a null byte", ErrInvalidCommand)
+	}
+	if isWindows && !ps && strings.ContainsAny(dir, "\"%\r\n") {
+		return fmt.Errorf("%w: working directory %q can't be used with cmd.exe, use PS()", ErrInvalidCommand, dir)
+	}
+	return nil
+}
+
+// dirCommand prefixes cmd with the command that changes to dir and only runs
+// cmd if that succeeds. On POSIX hosts cmd must already be a single simple
+// command, such as an explicit shell invocation, so that && applies to all of
+// it. On windows the directory is changed with Set-Location for PowerShell
+// scripts and with cd /d for cmd.exe.
+func dirCommand(cmd, dir string, isWindows, ps bool) string {
+	switch {
+	case !isWindows:
+		return "cd -- " + shellescape.QuoteForLoginShell(dir) + " && " + cmd
+	case ps:
+		return "Set-Location -LiteralPath " + powershell.SingleQuote(dir) + " -ErrorAction Stop; " + cmd
+	default:
+		return `cd /d "` + dir + `" && ` + cmd
+	}
+}
@@ -0,0 +1,58 @@
+package cmd_test
+
+import (
+	"testing"
+
+	"github.com/k0sproject/rig/v2/cmd"
+	"github.com/k0sproject/rig/v2/powershell"
+	"github.com/k0sproject/rig/v2/rigtest"
+	"github.com/k0sproject/rig/v2/sh"
+	"github.com/k0sproject/rig/v2/sudo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirGolden(t *testing.T) {
+	tests := []struct {
+		name    string
+		windows bool
+		opts    []cmd.ExecOption
+		want    string
+	}{
+		{name: "posix", want: `cd -- /var/lib/k0s && /bin/sh -c -- 'k0s status; echo done'`},
+		{name: "posix with env", opts: []cmd.ExecOption{cmd.Env(map[string]string{"A": "1"})}, want: `cd -- /var/lib/k0s && env A=1 /bin/sh -c -- 'k0s status; echo done'`},
+		{name: "windows cmd", windows: true, want: `cmd.exe /C cd /d "/var/lib/k0s" && k0s status; echo done`},
+		{name: "windows powershell", windows: true, opts: []cmd.ExecOption{cmd.PS()}, want: powershell.Cmd(`Set-Location -LiteralPath '/var/lib/k0s' -ErrorAction Stop; k0s status; echo done`)},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mr := rigtest.NewMockRunner()
+			mr.Windows = tc.windows
+			require.NoError(t, mr.Exec("k0s status; echo done", append(tc.opts, cmd.Dir("/var/lib/k0s"))...))
+			rigtest.ReceivedEqual(t, mr, tc.want)
+		})
+	}
+}
+
+func TestDirQuoting(t *testing.T) {
+	mr := rigtest.NewMockRunner()
+	require.NoError(t, mr.Exec("ls", cmd.Dir("/tmp/it's here")))
+	rigtest.ReceivedEqual(t, mr, `cd -- '/tmp/it'"'"'s here' && /bin/sh -c -- ls`)
+}
+
+func TestDirInsideDecorators(t *testing.T) {
+	for _, decorator := range []cmd.DecorateFunc{sudo.Sudo, sudo.Doas, sh.Shell} {
+		conn := rigtest.NewMockConnection()
+		runner := cmd.NewExecutor(conn, decorator)
+		require.NoError(t, runner.Exec("ls", cmd.Dir("/root")))
+		rigtest.ReceivedEqual(t, conn, decorator(`cd -- /root && /bin/sh -c -- ls`), "the directory is changed by the decorated command")
+	}
+}
+
+func TestDirInvalid(t *testing.T) {
+	mr := rigtest.NewMockRunner()
+	mr.Windows = true
+	err := mr.Exec("dir", cmd.Dir(`C:\100%`))
+	require.ErrorIs(t, err, cmd.ErrInvalidCommand)
+	require.NoError(t, mr.Exec("dir", cmd.PS(), cmd.Dir(`C:\100%`)))
+	require.Len(t, mr.Commands(), 1, "nothing runs with an invalid directory")
+}
@@ -0,0 +1,213 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/k0sproject/rig/v2/protocol"
+	"github.com/k0sproject/rig/v2/sh"
+)
+
+var (
+	_ Runner                = (*DryRunRunner)(nil)
+	_ protocol.Connection   = (*DryRunRunner)(nil)
+	_ protocol.ExitStatuser = (*dryRunProcess)(nil)
+)
+
+var errDryRunExit = errors.New("dry run: command exited with a non-zero status")
+
+// PlannedCommand is a command a [DryRunRunner] was asked to run.
+type PlannedCommand struct {
+	// Host is the host the command was planned for.
+	Host string
+	// Command is the command as it would have been logged: fully decorated,
+	// with secrets redacted and PowerShell encoding decoded. It is the same
+	// string a [CommandGate] gets and [Result.Command] reports.
+	Command string
+}
+
+// DryRunResponse is the fake outcome a [DryRunRunner] gives for a command.
+type DryRunResponse struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+}
+
+type dryRunResponder struct {
+	match    func(command string) bool
+	response DryRunResponse
+}
+
+// DryRunOption is a functional option for a [DryRunRunner].
+type DryRunOption func(*DryRunRunner)
+
+// DryRunHost sets the name the runner reports as its host. The default is
+// "dry-run".
+func DryRunHost(name string) DryRunOption {
+	return func(r *DryRunRunner) {
+		r.host = name
+	}
+}
+
+// DryRunWindows makes the runner act as if the host was running Windows, so
+// that the commands are formatted for Windows.
+func DryRunWindows() DryRunOption {
+	return func(r *DryRunRunner) {
+		r.windows = true
+	}
+}
+
+// DryRunRunner is a [Runner] that records the commands it is asked to run
+// instead of running them. The commands go through the same formatting,
+// redaction and [CommandGate] as on an [Executor], and are then recorded as a
+// [PlannedCommand] and answered with a fake [DryRunResponse]. Commands that
+// no response has been added for succeed without output. Any input given to
+// a command is read and discarded.
+//
+// Combined with responses for the commands the remotefs, initsystem and
+// packagemanager packages use to inspect the host, this can be used to preview
+// what an operation would do before running it for real. See
+// [github.com/k0sproject/rig/v2.WithDryRun] for using one with a client.
+//
+// The runner is also the connection underneath itself, so it can be used as a
+// [protocol.Connection] for a client.
+type DryRunRunner struct {
+	*Executor
+	host       string
+	windows    bool
+	mu         sync.Mutex
+	planned    []PlannedCommand
+	responders []dryRunResponder
+}
+
+// NewDryRunRunner returns a new DryRunRunner. Like the default runner of a
+// client, it imposes [sh.DefaultShell] on the commands (see
+// [Executor.SetShell]), so that the recorded commands are the ones a client
+// would run.
+func NewDryRunRunner(opts ...DryRunOption) *DryRunRunner {
+	r := &DryRunRunner{host: "dry-run"}
+	for _, opt := range opts {
+		opt(r)
+	}
+	r.Executor = NewExecutor(dryRunConnection{r})
+	r.SetShell(sh.DefaultShell)
+	return r
+}
+
+// AddResponse makes the runner answer the commands that match reports true
+// for with response. The function gets the command in the form of
+// [PlannedCommand.Command]. The responses are consulted in the order they were
+// added.
+func (r *DryRunRunner) AddResponse(match func(command string) bool, response DryRunResponse) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.responders = append(r.responders, dryRunResponder{match: match, response: response})
+}
+
+// AddOutput makes the runner answer the commands that contain substring with
+// stdout and a successful exit.
+func (r *DryRunRunner) AddOutput(substring, stdout string) {
+	r.AddResponse(func(command string) bool { return strings.Contains(command, substring) }, DryRunResponse{Stdout: stdout})
+}
+
+// Commands returns the commands the runner has been asked to run so far, in
+// the order they were started.
+func (r *DryRunRunner) Commands() []PlannedCommand {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.planned)
+}
+
+// Reset forgets the recorded commands. The responses are kept.
+func (r *DryRunRunner) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.planned = nil
+}
+
+// Protocol returns "DryRun".
+func (r *DryRunRunner) Protocol() string { return "DryRun" }
+
+// ProtocolName returns "DryRun".
+func (r *DryRunRunner) ProtocolName() string { return "DryRun" }
+
+// IsConnected returns true.
+func (r *DryRunRunner) IsConnected() bool { return true }
+
+// IPAddress returns the name of the host set with [DryRunHost].
+func (r *DryRunRunner) IPAddress() string { return r.host }
+
+// executor returns the executor of the runner, which lets runners chained on
+// top of it format their commands through it like through an [Executor].
+func (r *DryRunRunner) executor() *Executor { return r.Executor }
+
+// plan records a command and returns the response for it.
+func (r *DryRunRunner) plan(command string) DryRunResponse {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.planned = append(r.planned, PlannedCommand{Host: r.host, Command: command})
+	for _, responder := range r.responders {
+		if responder.match(command) {
+			return responder.response
+		}
+	}
+	return DryRunResponse{}
+}
+
+// dryRunConnection is the connection underneath a [DryRunRunner]'s executor.
+// It is a separate type so that commands the executor hands it are not
+// formatted a second time by the runner's own StartProcess.
+type dryRunConnection struct {
+	runner *DryRunRunner
+}
+
+func (c dryRunConnection) String() string  { return c.runner.host }
+func (c dryRunConnection) IsWindows() bool { return c.runner.windows }
+
+// StartProcess records the command with PowerShell encoding decoded but
+// without redaction. Commands started through the executor go to
+// startLogged instead.
+func (c dryRunConnection) StartProcess(ctx context.Context, command string, stdin io.Reader, stdout, stderr io.Writer) (protocol.Waiter, error) {
+	return c.startLogged(ctx, decodeEncoded(command), command, stdin, stdout, stderr)
+}
+
+// startLogged records the logged form of the command, which [Executor.Start]
+// passes along, and plays back the response for it.
+func (c dryRunConnection) startLogged(_ context.Context, logged, _ string, stdin io.Reader, stdout, stderr io.Writer) (protocol.Waiter, error) {
+	response := c.runner.plan(logged)
+	proc := &dryRunProcess{done: make(chan struct{}), exitCode: response.ExitCode}
+	go func() {
+		defer close(proc.done)
+		if stdin != nil {
+			_, _ = io.Copy(io.Discard, stdin)
+		}
+		if stdout != nil && response.Stdout != "" {
+			_, _ = io.WriteString(stdout, response.Stdout)
+		}
+		if stderr != nil && response.Stderr != "" {
+			_, _ = io.WriteString(stderr, response.Stderr)
+		}
+	}()
+	return proc, nil
+}
+
+type dryRunProcess struct {
+	done     chan struct{}
+	exitCode int
+}
+
+func (p *dryRunProcess) Wait() error {
+	<-p.done
+	if p.exitCode != 0 {
+		return fmt.Errorf("%w: %d", errDryRunExit, p.exitCode)
+	}
+	return nil
+}
+
+func (p *dryRunProcess) ExitCode() int               { return p.exitCode }
+func (p *dryRunProcess) ExitSignal() protocol.Signal { return "" }
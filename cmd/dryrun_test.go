@@ -0,0 +1,92 @@
+package cmd_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/k0sproject/rig/v2/cmd"
+	"github.com/k0sproject/rig/v2/powershell"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDryRunRecordsCommands(t *testing.T) {
+	runner := cmd.NewDryRunRunner(cmd.DryRunHost("node-1"))
+	require.NoError(t, runner.Exec("systemctl restart foo"))
+	require.NoError(t, runner.Exec("echo secret", cmd.Redact("secret")))
+	require.Equal(t, []cmd.PlannedCommand{
+		{Host: "node-1", Command: `/bin/sh -c -- 'systemctl restart foo'`},
+		{Host: "node-1", Command: `/bin/sh -c -- 'echo [REDACTED]'`},
+	}, runner.Commands())
+
+	runner.Reset()
+	require.Empty(t, runner.Commands())
+}
+
+func TestDryRunResponses(t *testing.T) {
+	runner := cmd.NewDryRunRunner()
+	runner.AddOutput("hostname", "node-1")
+	runner.AddResponse(func(command string) bool { return strings.Contains(command, "systemctl is-active") }, cmd.DryRunResponse{
+		Stdout:   "inactive",
+		Stderr:   "not running",
+		ExitCode: 3,
+	})
+
+	out, err := runner.ExecOutput("hostname")
+	require.NoError(t, err)
+	require.Equal(t, "node-1", out)
+
+	out, err = runner.ExecOutput("uname -r")
+	require.NoError(t, err, "commands without a response succeed")
+	require.Empty(t, out)
+
+	res, err := runner.Run(context.Background(), "systemctl is-active foo")
+	require.Error(t, err)
+	require.Equal(t, 3, res.ExitCode)
+	require.Equal(t, "inactive", res.Stdout)
+	require.Equal(t, "not running", res.Stderr)
+
+	res, err = runner.Run(context.Background(), "systemctl is-active foo", cmd.AcceptExitCodes(0, 3))
+	require.NoError(t, err)
+	require.Equal(t, 3, res.ExitCode)
+}
+
+func TestDryRunDiscardsStdin(t *testing.T) {
+	runner := cmd.NewDryRunRunner()
+	require.NoError(t, runner.Exec("cat > /tmp/foo", cmd.Stdin(strings.NewReader("content"))))
+	require.Len(t, runner.Commands(), 1)
+}
+
+func TestDryRunWindows(t *testing.T) {
+	runner := cmd.NewDryRunRunner(cmd.DryRunWindows())
+	require.True(t, runner.IsWindows())
+	require.NoError(t, runner.Exec(powershell.Cmd("Get-Item C:\\")))
+	planned := runner.Commands()
+	require.Len(t, planned, 1)
+	require.Contains(t, planned[0].Command, "Get-Item C:\\", "the encoded command is recorded decoded")
+}
+
+func TestDryRunChained(t *testing.T) {
+	runner := cmd.NewDryRunRunner()
+	sudo := cmd.NewExecutor(runner, func(c string) string { return "sudo -n -- " + c })
+	require.NoError(t, sudo.Exec("id -u", cmd.Redact("id")))
+	planned := runner.Commands()
+	require.Len(t, planned, 1)
+	require.Equal(t, `/bin/sh -c -- 'sudo -n -- [REDACTED] -u'`, planned[0].Command,
+		"a runner chained on top formats through the dry run runner and passes its redacted form")
+	conn, direct := sudo.Connection()
+	require.False(t, direct)
+	require.NotNil(t, conn)
+}
+
+func TestDryRunGate(t *testing.T) {
+	runner := cmd.NewDryRunRunner()
+	var gated []string
+	runner.SetCommandGate(cmd.CommandGateFunc(func(_ context.Context, _, command string) error {
+		gated = append(gated, command)
+		return nil
+	}))
+	require.NoError(t, runner.Exec("true"))
+	require.Equal(t, []string{`/bin/sh -c -- true`}, gated)
+	require.Equal(t, gated[0], runner.Commands()[0].Command)
+}
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/k0sproject/rig/v2/powershell"
+	"github.com/k0sproject/rig/v2/sh"
+	"github.com/k0sproject/rig/v2/sh/shellescape"
+)
+
+var envNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// EnvSetter is implemented by runners that support default environment
+// variables for every command they run. [Executor] implements it, allowing
+// the environment configured on a [github.com/k0sproject/rig/v2.Client] to be
+// propagated to every runner the client derives.
+type EnvSetter interface {
+	SetEnv(env map[string]string)
+}
+
+// validateEnv checks that the variables can be passed in a command for the
+// host. Windows commands that don't run through PowerShell are run by cmd.exe,
+// which has no way to quote a double quote or a percent sign.
+func validateEnv(env map[string]string, isWindows, ps bool) error {
+	for name, value := range env {
+		if !envNameRe.MatchString(name) {
+			return fmt.Errorf("%w: invalid environment variable name %q", ErrInvalidCommand, name)
+		}
+		if isWindows && !ps && strings.ContainsAny(value, "\"%\r\n") {
+			return fmt.Errorf("%w: environment variable %s has a value cmd.exe can't set, use PS()", ErrInvalidCommand, name)
+		}
+	}
+	return nil
+}
+
+// envCommand prefixes cmd with the commands that set env for it. On POSIX
+// hosts cmd is run by env in an explicit shell, so that the variables apply
+// to all of a compound command. On windows the variables are set with
+// $env: for PowerShell scripts and with set for cmd.exe.
+func envCommand(cmd string, env map[string]string, isWindows, ps bool) string {
+	names := slices.Sorted(maps.Keys(env))
+	var b strings.Builder
+	switch {
+	case !isWindows:
+		b.WriteString("env")
+		for _, name := range names {
+			b.WriteString(" " + shellescape.QuoteForLoginShell(name+"="+env[name]))
+		}
+		b.WriteString(" " + sh.Shell(cmd))
+		return b.String()
+	case ps:
+		for _, name := range names {
+			b.WriteString("$env:" + name + " = " + powershell.SingleQuote(env[name]) + "; ")
+		}
+	default:
+		for _, name := range names {
+			b.WriteString(`set "` + name + "=" + env[name] + `" && `)
+		}
+	}
+	b.WriteString(cmd)
+	return b.String()
+}
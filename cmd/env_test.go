@@ -0,0 +1,94 @@
+package cmd_test
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/k0sproject/rig/v2/cmd"
+	"github.com/k0sproject/rig/v2/powershell"
+	"github.com/k0sproject/rig/v2/protocol"
+	"github.com/k0sproject/rig/v2/rigtest"
+	"github.com/k0sproject/rig/v2/sudo"
+	"github.com/stretchr/testify/require"
+)
+
+// envConnection is a mock connection that sets environment variables through
+// the protocol for the names it accepts.
+type envConnection struct {
+	*rigtest.MockConnection
+	accept map[string]bool
+	env    map[string]string
+}
+
+func (c *envConnection) AcceptsEnv(_ context.Context, names []string) bool {
+	for _, name := range names {
+		if !c.accept[name] {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *envConnection) StartProcessEnv(ctx context.Context, command string, env map[string]string, stdin io.Reader, stdout, stderr io.Writer) (protocol.Waiter, error) {
+	c.env = env
+	return c.StartProcess(ctx, command, stdin, stdout, stderr)
+}
+
+func TestEnvGolden(t *testing.T) {
+	env := cmd.Env(map[string]string{"K0S_DEBUG": "it's on", "A": "1"})
+	tests := []struct {
+		name    string
+		windows bool
+		opts    []cmd.ExecOption
+		want    string
+	}{
+		{name: "posix", want: `env A=1 'K0S_DEBUG=it'"'"'s on' /bin/sh -c -- 'k0s status'`},
+		{name: "windows cmd", windows: true, want: `cmd.exe /C set "A=1" && set "K0S_DEBUG=it's on" && k0s status`},
+		{name: "windows powershell", windows: true, opts: []cmd.ExecOption{cmd.PS()}, want: powershell.Cmd(`$env:A = '1'; $env:K0S_DEBUG = 'it` + "`" + `'s on'; k0s status`)},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mr := rigtest.NewMockRunner()
+			mr.Windows = tc.windows
+			require.NoError(t, mr.Exec("k0s status", append(tc.opts, env)...))
+			rigtest.ReceivedEqual(t, mr, tc.want)
+		})
+	}
+}
+
+func TestEnvInsideSudo(t *testing.T) {
+	conn := &envConnection{MockConnection: rigtest.NewMockConnection(), accept: map[string]bool{"A": true}}
+	runner := cmd.NewExecutor(cmd.NewExecutor(conn), sudo.Sudo)
+	require.NoError(t, runner.Exec("k0s status", cmd.Env(map[string]string{"A": "1"})))
+	rigtest.ReceivedEqual(t, conn, sudo.Sudo(`env A=1 /bin/sh -c -- 'k0s status'`), "the variables are set inside sudo")
+	require.Nil(t, conn.env, "sudo would not pass on variables set by the connection")
+}
+
+func TestEnvViaConnection(t *testing.T) {
+	conn := &envConnection{MockConnection: rigtest.NewMockConnection(), accept: map[string]bool{"LANG": true}}
+	runner := cmd.NewExecutor(conn)
+	runner.SetEnv(map[string]string{"LANG": "C", "TZ": "UTC"})
+
+	require.NoError(t, runner.Exec("date", cmd.Env(map[string]string{"TZ": "EET"})))
+	rigtest.ReceivedEqual(t, conn, `env LANG=C TZ=EET /bin/sh -c -- date`, "the command overrides the runner default, TZ is not accepted")
+	require.Nil(t, conn.env)
+
+	runner.SetEnv(nil)
+	require.NoError(t, runner.Exec("date", cmd.Env(map[string]string{"LANG": "C"})))
+	rigtest.ReceivedEqual(t, conn, "date")
+	require.Equal(t, map[string]string{"LANG": "C"}, conn.env)
+}
+
+func TestEnvInvalid(t *testing.T) {
+	mr := rigtest.NewMockRunner()
+	err := mr.Exec("true", cmd.Env(map[string]string{"NOT-VALID": "1"}))
+	require.ErrorIs(t, err, cmd.ErrInvalidCommand)
+
+	mr = rigtest.NewMockRunner()
+	mr.Windows = true
+	err = mr.Exec("ver", cmd.Env(map[string]string{"PATH": "%PATH%;C:\\bin"}))
+	require.ErrorIs(t, err, cmd.ErrInvalidCommand)
+	require.NoError(t, mr.Exec("ver", cmd.PS(), cmd.Env(map[string]string{"PATH": "%PATH%;C:\\bin"})))
+	require.Len(t, mr.Commands(), 1, "nothing runs with an invalid variable")
+}
@@ -60,12 +60,17 @@ func (r *ErrorExecutor) IsWindows() bool { return false }
 func (r *ErrorExecutor) String() string { return "error-executor" }
 
 // Start returns the given error.
-func (r *ErrorExecutor) Start(_ context.Context, _ string, _ ...ExecOption) (protocol.Waiter, error) {
+func (r *ErrorExecutor) Start(_ context.Context, _ string, _ ...ExecOption) (*Process, error) {
+	return nil, r.Err
+}
+
+// Run returns the given error and a nil result.
+func (r *ErrorExecutor) Run(_ context.Context, _ string, _ ...ExecOption) (*Result, error) {
 	return nil, r.Err
 }
 
 // StartBackground returns the given error.
-func (r *ErrorExecutor) StartBackground(_ string, _ ...ExecOption) (protocol.Waiter, error) {
+func (r *ErrorExecutor) StartBackground(_ string, _ ...ExecOption) (*Process, error) {
 	return nil, r.Err
 }
 
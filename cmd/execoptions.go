@@ -6,13 +6,17 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"os"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/k0sproject/rig/v2/iostream"
 	"github.com/k0sproject/rig/v2/log"
 	"github.com/k0sproject/rig/v2/powershell"
 	"github.com/k0sproject/rig/v2/redact"
+	"github.com/k0sproject/rig/v2/sh"
 )
 
 // DefaultRedactMask is the string that will be used to replace redacted text in the logs.
@@ -30,6 +34,7 @@ type ExecOptions struct {
 	errOut io.Writer
 
 	errBuf *bytes.Buffer
+	outBuf *bytes.Buffer
 
 	allowWinStderr bool
 
@@ -43,6 +48,9 @@ type ExecOptions struct {
 	streamOutput bool
 	trimOutput   bool
 
+	stdinPrefix   string
+	stdinRejected error
+
 	redactStrings []string
 	decorateFuncs []DecorateFunc
 	redactMask    string
@@ -53,6 +61,18 @@ type ExecOptions struct {
 	outputClosers []io.Closer
 
 	skipGate bool
+	trackPID bool
+
+	env              map[string]string
+	envViaConnection bool
+	dir              string
+	powershell       bool
+	decorated        bool
+
+	timeout   time.Duration
+	killGrace time.Duration
+
+	acceptExitCodes []int
 }
 
 // Format returns the command string with all per-call decorators applied.
@@ -94,11 +114,97 @@ func (o *ExecOptions) LogCommand() bool {
 	return o.logCommand
 }
 
+// outputHidden reports whether the output of the command is kept out of the
+// logs with [HideOutput] or [Sensitive].
+func (o *ExecOptions) outputHidden() bool {
+	return !o.logOutput || !o.logDebug
+}
+
 // SkipGate returns true if the [CommandGate] should not be consulted for this command.
 func (o *ExecOptions) SkipGate() bool {
 	return o.skipGate
 }
 
+// TrackPID returns true if the command should report its process id.
+func (o *ExecOptions) TrackPID() bool {
+	return o.trackPID
+}
+
+// Env returns the environment variables set for the command.
+func (o *ExecOptions) Env() map[string]string {
+	return o.env
+}
+
+// inheritEnv adds the variables of defaults that are not set for the command.
+func (o *ExecOptions) inheritEnv(defaults map[string]string) {
+	if len(defaults) == 0 {
+		return
+	}
+	env := maps.Clone(defaults)
+	maps.Copy(env, o.env)
+	o.env = env
+}
+
+// Timeout returns the time the command is allowed to run, zero for no limit.
+func (o *ExecOptions) Timeout() time.Duration {
+	return o.timeout
+}
+
+// KillGrace returns the time a command that ran out of time is given to exit
+// after the polite signal before it is killed.
+func (o *ExecOptions) KillGrace() time.Duration {
+	if o.killGrace <= 0 {
+		return DefaultKillGrace
+	}
+	return o.killGrace
+}
+
+// acceptExitCode returns the error a command that exited with code should
+// finish with, given waitErr from the connection. Without [AcceptExitCodes],
+// waitErr is returned as is.
+func (o *ExecOptions) acceptExitCode(code int, waitErr error) error {
+	if len(o.acceptExitCodes) == 0 || code < 0 {
+		return waitErr
+	}
+	if slices.Contains(o.acceptExitCodes, code) {
+		return nil
+	}
+	if waitErr == nil {
+		return fmt.Errorf("%w: %d", ErrUnacceptedExitCode, code)
+	}
+	return waitErr
+}
+
+// Dir returns the working directory set for the command.
+func (o *ExecOptions) Dir() string {
+	return o.dir
+}
+
+// withPrelude prefixes cmd with the commands that set the environment
+// variables, unless the connection sets them, and change the working
+// directory.
+func (o *ExecOptions) withPrelude(cmd string, isWindows bool) string {
+	switch {
+	case len(o.env) > 0 && !o.envViaConnection:
+		cmd = envCommand(cmd, o.env, isWindows, o.powershell)
+	case o.dir != "" && !isWindows:
+		cmd = sh.Shell(cmd)
+	}
+	if o.dir != "" {
+		cmd = dirCommand(cmd, o.dir, isWindows, o.powershell)
+	}
+	return cmd
+}
+
+// withPIDTracking wraps cmd with [trackPIDCommand] when the option is set and
+// the host is not windows.
+func (o *ExecOptions) withPIDTracking(cmd string, isWindows bool) string {
+	if !o.trackPID || isWindows {
+		return cmd
+	}
+	return trackPIDCommand(cmd)
+}
+
 var (
 	errCharDevice    = errors.New("reader is a character device")
 	errUnknownReader = errors.New("unknown type of reader")
@@ -145,23 +251,35 @@ func (o *ExecOptions) Redact(s string) string {
 }
 
 // Stdin returns the Stdin reader. If input logging is enabled, it will be a TeeReader that writes to the log.
+// Data set with [StdinPrefix] is read before the input set with [Stdin].
 func (o *ExecOptions) Stdin() io.Reader {
-	if o.in == nil {
-		return nil
+	in := o.in
+	if in != nil {
+		size, err := getReaderSize(in)
+		if err == nil && size > 0 {
+			log.Trace(context.Background(), "using data from reader as command input", log.KeyBytes, size)
+		} else {
+			log.Trace(context.Background(), "using data from reader as command input")
+		}
 	}
 
-	size, err := getReaderSize(o.in)
-	if err == nil && size > 0 {
-		log.Trace(context.Background(), "using data from reader as command input", log.KeyBytes, size)
-	} else {
-		log.Trace(context.Background(), "using data from reader as command input")
+	switch {
+	case o.stdinPrefix == "":
+	case in == nil:
+		in = strings.NewReader(o.stdinPrefix)
+	default:
+		in = io.MultiReader(strings.NewReader(o.stdinPrefix), in)
+	}
+
+	if in == nil {
+		return nil
 	}
 
 	if o.logInput {
-		return io.TeeReader(o.in, redact.Writer(logWriter{fn: o.Log().Debug}, DefaultRedactMask, o.redactStrings...))
+		return io.TeeReader(in, redact.Writer(logWriter{fn: o.Log().Debug}, DefaultRedactMask, o.redactStrings...))
 	}
 
-	return o.in
+	return in
 }
 
 func (o *ExecOptions) logWriter(stream string, logFn func(msg string, keysAndValues ...any)) io.WriteCloser {
@@ -194,6 +312,9 @@ func (o *ExecOptions) Stdout() io.Writer {
 	if o.traceOut != nil {
 		writers = append(writers, o.traceOut)
 	}
+	if o.timeout > 0 {
+		writers = append(writers, o.outBuf)
+	}
 	return io.MultiWriter(writers...)
 }
 
@@ -254,6 +375,17 @@ func Stdin(r io.Reader) ExecOption {
 	}
 }
 
+// StdinPrefix exec option for sending data to the command through stdin before
+// the input set with [Stdin] or [StdinString], or as the only input when there
+// is none. Set it with [Executor.SetOptions] to prepend a secret, such as the
+// password sudo reads, to the input of every command a runner starts, along
+// with [Redact] to keep the secret out of the input log.
+func StdinPrefix(data string) ExecOption {
+	return func(o *ExecOptions) {
+		o.stdinPrefix += data
+	}
+}
+
 // StdinString exec option for sending string data to the command through stdin.
 func StdinString(s string) ExecOption {
 	return func(o *ExecOptions) {
@@ -261,6 +393,26 @@ func StdinString(s string) ExecOption {
 	}
 }
 
+// RejectStdin exec option for making commands that are given input with
+// [Stdin] or [StdinString] fail with err instead of starting. Set it with
+// [Executor.SetOptions] on a runner whose commands can't read their input, so
+// that they don't run with none. Data set with [StdinPrefix] is not rejected,
+// it is for the runner's decorators to read.
+func RejectStdin(err error) ExecOption {
+	return func(o *ExecOptions) {
+		o.stdinRejected = err
+	}
+}
+
+// validateStdin returns the error set with [RejectStdin] when the command is
+// given input.
+func (o *ExecOptions) validateStdin() error {
+	if o.stdinRejected != nil && o.in != nil {
+		return o.stdinRejected
+	}
+	return nil
+}
+
 // Stdout exec option for sending command stdout to an io.Writer.
 func Stdout(w io.Writer) ExecOption {
 	return func(o *ExecOptions) {
@@ -339,6 +491,7 @@ func TrimOutput(v bool) ExecOption {
 func PS() ExecOption {
 	return func(o *ExecOptions) {
 		o.decorateFuncs = append(o.decorateFuncs, powershell.Cmd)
+		o.powershell = true
 	}
 }
 
@@ -348,6 +501,7 @@ func PS() ExecOption {
 func PSCompressed() ExecOption {
 	return func(o *ExecOptions) {
 		o.decorateFuncs = append(o.decorateFuncs, powershell.CompressedCmd)
+		o.powershell = true
 	}
 }
 
@@ -355,6 +509,7 @@ func PSCompressed() ExecOption {
 func Decorate(decorator DecorateFunc) ExecOption {
 	return func(o *ExecOptions) {
 		o.decorateFuncs = append(o.decorateFuncs, decorator)
+		o.decorated = true
 	}
 }
 
@@ -374,6 +529,99 @@ func Ungated() ExecOption {
 	}
 }
 
+// TrackPID exec option for making a started command report its process id on
+// the host, for connections that can't tell it otherwise. The command is run
+// through an explicit shell that writes the id to stderr before it execs the
+// command, the line is removed from the output. This makes [Process.PID]
+// available and lets [Process.Signal] fall back to running kill. It has no
+// effect on windows hosts.
+func TrackPID() ExecOption {
+	return func(o *ExecOptions) {
+		o.trackPID = true
+	}
+}
+
+// Env exec option for setting environment variables for the command. Variables
+// from multiple Env options are merged and take precedence over the defaults
+// set on the runner.
+//
+// When nothing decorates the command and the connection can set variables
+// without modifying it, as the native SSH protocol can for the names the server
+// accepts via AcceptEnv, the variables are passed that way. Otherwise the
+// command is prefixed with the commands that set them: on POSIX hosts the
+// command is run by env in an explicit shell, on windows the variables are set
+// with $env: when the command runs through [PS] and with cmd.exe's set
+// otherwise. The prefix goes inside the runner's decorators, so the variables
+// survive sudo resetting the environment.
+//
+// Variable names must be valid shell identifiers. Values containing double
+// quotes, percent signs or line breaks can only be set on windows with [PS].
+func Env(env map[string]string) ExecOption {
+	return func(o *ExecOptions) {
+		if o.env == nil {
+			o.env = make(map[string]string, len(env))
+		}
+		maps.Copy(o.env, env)
+	}
+}
+
+// Dir exec option for running the command in the given directory on the host.
+//
+// The command is prefixed with a change of directory and only runs if that
+// succeeds: on POSIX hosts the command is run in an explicit shell after cd,
+// on windows the directory is changed with Set-Location when the command runs
+// through [PS] and with cmd.exe's cd /d otherwise. Like [Env], the prefix goes
+// inside the runner's decorators, so the directory applies to the command run
+// by sudo or doas.
+//
+// Directories containing double quotes or percent signs can only be used on
+// windows with [PS].
+func Dir(path string) ExecOption {
+	return func(o *ExecOptions) {
+		o.dir = path
+	}
+}
+
+// Timeout exec option for limiting the time the command is allowed to run.
+//
+// When the time runs out, the command is sent SIGTERM and given the [KillGrace]
+// period to exit, after which it is sent SIGKILL and the connection's session
+// for it is dropped. When the connection can't deliver
+// SIGTERM, for example over the OpenSSH protocol without [TrackPID], the
+// session is dropped right away. Wait then returns an error wrapping a
+// [*TimeoutError], which tells whether the command was killed and carries
+// what it wrote to stdout and stderr before it stopped. The error matches
+// [ErrTimeout] with errors.Is.
+//
+// Unlike a deadline on the context passed to Start, which drops the session
+// abruptly, Timeout gives the command a chance to clean up.
+func Timeout(d time.Duration) ExecOption {
+	return func(o *ExecOptions) {
+		o.timeout = d
+	}
+}
+
+// KillGrace exec option for setting the time a command that ran out of time
+// set by [Timeout] is given to exit after the polite signal before it is
+// killed. The default is [DefaultKillGrace].
+func KillGrace(d time.Duration) ExecOption {
+	return func(o *ExecOptions) {
+		o.killGrace = d
+	}
+}
+
+// AcceptExitCodes exec option for setting the exit codes that count as a
+// successful run, for commands like grep or systemctl is-active that report
+// a result through a non-zero exit code. Exit code 0 only counts as success
+// when it is listed, a command exiting with it otherwise fails with
+// [ErrUnacceptedExitCode]. Commands terminated by a signal, or whose exit code
+// the connection can't tell, are not affected.
+func AcceptExitCodes(codes ...int) ExecOption {
+	return func(o *ExecOptions) {
+		o.acceptExitCodes = append(o.acceptExitCodes, codes...)
+	}
+}
+
 // Trace exec option for attaching a [Tracer] to a single command execution.
 // If the Tracer also implements [OutputTracer], per-line stdout and stderr
 // hooks are enabled automatically.
@@ -396,6 +644,7 @@ func Build(opts ...ExecOption) *ExecOptions {
 		trimOutput:   true,
 		redactMask:   DefaultRedactMask,
 		errBuf:       bytes.NewBuffer(nil),
+		outBuf:       bytes.NewBuffer(nil),
 	}
 
 	options.Apply(opts...)
@@ -8,7 +8,9 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"regexp"
+	"slices"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -53,6 +55,8 @@ type Executor struct {
 	tracer     Tracer
 	gate       CommandGate
 	shell      string
+	env        map[string]string
+	options    []ExecOption
 }
 
 func isWinFunc(conn protocol.ProcessStarter) func() bool {
@@ -117,6 +121,51 @@ func (r *Executor) SetShell(shell string) {
 	r.shell = shell
 }
 
+// SetEnv sets the default environment variables for every command the runner
+// starts. Variables set for a command via [Env] take precedence. See [Env] for
+// how the variables are passed. SetEnv must not be called concurrently with
+// Start, Exec, or any other command-execution method.
+func (r *Executor) SetEnv(env map[string]string) {
+	r.env = maps.Clone(env)
+}
+
+// SetOptions sets default exec options for every command the runner starts.
+// They are applied before the options given for a command, which can override
+// them. SetOptions must not be called concurrently with Start, Exec, or any
+// other command-execution method.
+func (r *Executor) SetOptions(opts ...ExecOption) {
+	r.options = slices.Clone(opts)
+}
+
+// buildOptions builds the exec options for a command from the runner's
+// defaults and opts.
+func (r *Executor) buildOptions(opts []ExecOption) *ExecOptions {
+	if len(r.options) == 0 {
+		return Build(opts...)
+	}
+	return Build(append(slices.Clone(r.options), opts...)...)
+}
+
+// envStarter returns the connection to pass the command's environment
+// variables to, if they can be set without modifying the command. That
+// requires a connection that accepts the names and no decorators between the
+// command and the connection, as a decorator such as sudo would run the
+// command in an environment of its own.
+func (r *Executor) envStarter(ctx context.Context, execOpts *ExecOptions) (protocol.EnvStarter, bool) {
+	if len(execOpts.env) == 0 || execOpts.decorated {
+		return nil, false
+	}
+	conn, undecorated := r.Connection()
+	if !undecorated {
+		return nil, false
+	}
+	starter, ok := conn.(protocol.EnvStarter)
+	if !ok || !starter.AcceptsEnv(ctx, slices.Collect(maps.Keys(execOpts.env))) {
+		return nil, false
+	}
+	return starter, true
+}
+
 // windowsShellPrefix runs a command that is not an executable through cmd.exe on
 // Windows hosts. We don't know whether the default shell there is cmd or
 // powershell, so non-prefixed commands consistently go through cmd.exe.
@@ -142,7 +191,8 @@ func applyDecorators(cmd string, decorators []DecorateFunc, mask func(string) st
 }
 
 func (r *Executor) formatCommandForOS(command string, execOpts *ExecOptions, isWindows bool) string {
-	return windowsShellPrefix(r.Format(execOpts.Format(command)), isWindows)
+	cmd := execOpts.Format(execOpts.withPrelude(command, isWindows))
+	return windowsShellPrefix(r.Format(execOpts.withPIDTracking(cmd, isWindows)), isWindows)
 }
 
 // parentFormat applies the formatting that every parent runner contributes,
@@ -155,12 +205,30 @@ func (r *Executor) formatCommandForOS(command string, execOpts *ExecOptions, isW
 // for a command and the string reported to logs, tracers and a [CommandGate] is
 // the very one that gets sent.
 func (r *Executor) parentFormat(cmd string, mask func(string) string) string {
-	for parent, ok := r.connection.(*Executor); ok; parent, ok = parent.connection.(*Executor) {
+	for parent, ok := asExecutor(r.connection); ok; parent, ok = asExecutor(parent.connection) {
 		cmd = parent.format(cmd, mask)
 	}
 	return cmd
 }
 
+// wrappedExecutor is implemented by runners that do their work through an
+// [Executor] of their own, like [DryRunRunner]. Runners chained on top of them
+// treat them as that Executor.
+type wrappedExecutor interface {
+	executor() *Executor
+}
+
+// asExecutor returns conn as an [Executor] when it is one or wraps one.
+func asExecutor(conn protocol.ProcessStarter) (*Executor, bool) {
+	switch c := conn.(type) {
+	case *Executor:
+		return c, true
+	case wrappedExecutor:
+		return c.executor(), true
+	}
+	return nil, false
+}
+
 // baseConnection returns the first connection in the chain that is not an
 // [Executor], which is the one Start hands a fully formatted command to. Every
 // Executor in between has already contributed its formatting via parentFormat;
@@ -168,7 +236,7 @@ func (r *Executor) parentFormat(cmd string, mask func(string) string) string {
 func (r *Executor) baseConnection() protocol.ProcessStarter {
 	conn := r.connection
 	for {
-		parent, ok := conn.(*Executor)
+		parent, ok := asExecutor(conn)
 		if !ok {
 			return conn
 		}
@@ -176,6 +244,20 @@ func (r *Executor) baseConnection() protocol.ProcessStarter {
 	}
 }
 
+// Connection returns the protocol connection underneath the runner chain.
+// The boolean is false when a runner in the chain decorates the commands,
+// like the ones from the sudo package do: a facility that talks to the
+// connection directly instead of running commands, such as an SFTP
+// subsystem, would then act as a different user than the commands run as.
+func (r *Executor) Connection() (protocol.ProcessStarter, bool) {
+	for runner, ok := r, true; ok; runner, ok = asExecutor(runner.connection) {
+		if len(runner.decorators) > 0 {
+			return runner.baseConnection(), false
+		}
+	}
+	return r.baseConnection(), true
+}
+
 // formatCommand returns the fully decorated command string.
 func (r *Executor) formatCommand(command string, execOpts *ExecOptions) string {
 	return r.formatCommandForOS(command, execOpts, r.IsWindows())
@@ -218,7 +300,8 @@ func (r *Executor) redactedForm(command, formatted string, execOpts *ExecOptions
 	if !execOpts.needsMaskedReplay() {
 		return mask(decodeEncoded(formatted))
 	}
-	cmd := execOpts.formatMasked(mask(command), mask)
+	cmd := execOpts.formatMasked(mask(execOpts.withPrelude(command, isWindows)), mask)
+	cmd = execOpts.withPIDTracking(cmd, isWindows)
 	cmd = r.format(cmd, mask)
 	cmd = r.parentFormat(windowsShellPrefix(cmd, isWindows), mask)
 	return mask(decodeEncoded(cmd))
@@ -230,7 +313,8 @@ func (r *Executor) redactedForm(command, formatted string, execOpts *ExecOptions
 // to determine OS-specific wrapping; wrapping is included only when the OS
 // has already been determined (see OSWrappingKnown in the returned Explanation).
 func (r *Executor) Explain(command string, opts ...ExecOption) Explanation {
-	execOpts := Build(opts...)
+	execOpts := r.buildOptions(opts)
+	execOpts.inheritEnv(r.env)
 	ownFormatted, osWrappingKnown := r.explainCommand(command, execOpts)
 	// What the host receives includes the formatting the parent runners add.
 	formatted := r.parentFormat(ownFormatted, nil)
@@ -336,17 +420,6 @@ func findPrintfError(s string) error {
 	return err
 }
 
-type waiterWrapper struct {
-	waiter       protocol.Waiter
-	opts         *ExecOptions
-	isWindows    bool
-	tracer       Tracer
-	host         string
-	formatted    string
-	started      time.Time
-	traceClosers []io.Closer
-}
-
 var xmlTagRe = regexp.MustCompile(`<.+?>`)
 
 // cleanStderr collapses a command's stderr into a single line and strips the
@@ -366,29 +439,6 @@ func cleanStderr(stderr string, isWindows bool) string {
 	return stderr
 }
 
-// Wait waits for the command to finish and returns an error if it fails or if it wrote to stderr.
-func (w *waiterWrapper) Wait() error {
-	waitErr := w.waiter.Wait()
-
-	// flush per-line trace writers before reading errBuf so all output is delivered
-	for _, c := range w.traceClosers {
-		_ = c.Close()
-	}
-
-	stderr := cleanStderr(w.opts.ErrString(), w.isWindows)
-	if waitErr == nil && w.isWindows && !w.opts.AllowWinStderr() && len(stderr) > 0 {
-		waitErr = ErrWroteStderr
-	}
-	var result error
-	if waitErr != nil {
-		result = &ProcessError{err: waitErr, stderr: stderr}
-	}
-	if w.tracer != nil {
-		w.tracer.ProcessFinished(w.host, w.formatted, time.Since(w.started), result)
-	}
-	return result
-}
-
 func isExe(cmd string) bool {
 	firstWord, _, found := strings.Cut(cmd, " ")
 	if !found {
@@ -458,8 +508,8 @@ func (r *Executor) gateCommand(ctx context.Context, execOpts *ExecOptions, redac
 	return fmt.Errorf("%w: %w", ErrCommandRejected, err)
 }
 
-// Start starts the command and returns a Waiter.
-func (r *Executor) Start(ctx context.Context, command string, opts ...ExecOption) (protocol.Waiter, error) {
+// Start starts the command and returns a [Process] for it.
+func (r *Executor) Start(ctx context.Context, command string, opts ...ExecOption) (*Process, error) {
 	if ctx.Err() != nil {
 		return nil, fmt.Errorf("runner context error: %w", ctx.Err())
 	}
@@ -467,9 +517,22 @@ func (r *Executor) Start(ctx context.Context, command string, opts ...ExecOption
 		return nil, fmt.Errorf("refusing to run a command containing printf-style %%!(..) errors: %w", err)
 	}
 
-	execOpts := Build(opts...)
+	execOpts := r.buildOptions(opts)
 	r.InjectLoggerTo(execOpts) //nolint:contextcheck // uses trace logger which takes context
 
+	execOpts.inheritEnv(r.env)
+	if err := validateEnv(execOpts.env, r.IsWindows(), execOpts.powershell); err != nil {
+		return nil, err
+	}
+	if err := validateDir(execOpts.dir, r.IsWindows(), execOpts.powershell); err != nil {
+		return nil, err
+	}
+	if err := execOpts.validateStdin(); err != nil {
+		return nil, err
+	}
+	envStarter, envViaConnection := r.envStarter(ctx, execOpts)
+	execOpts.envViaConnection = envViaConnection
+
 	// resolve active tracer: per-call overrides runner-wide
 	tracer := execOpts.tracer
 	if tracer == nil {
@@ -522,19 +585,58 @@ func (r *Executor) Start(ctx context.Context, command string, opts ...ExecOption
 		tracer.CommandFormatted(r.String(), fullCmd)
 	}
 
+	var cmdTrace CommandTrace
+	if ct, ok := tracer.(CommandTracer); ok {
+		cmdTrace, traceClosers = r.traceCommand(ctx, ct, execOpts, redactedCmd, traceClosers)
+	}
+
 	stdout := execOpts.Stdout()
 	stderr := execOpts.Stderr()
 	traceClosers = append(traceClosers, execOpts.OutputClosers()...)
 
-	waiter, err := r.baseConnection().StartProcess(ctx, fullCmd, execOpts.Stdin(), stdout, stderr) //nolint:contextcheck // Stdin() uses trace logger which takes context
+	var pid *pidWriter
+	if execOpts.TrackPID() && !r.IsWindows() {
+		pid = newPIDWriter(stderr)
+		stderr = pid
+	}
+
+	// the process is started with a context of its own so that a command
+	// that ignores the signals sent when it runs out of time can be stopped
+	// by dropping the session.
+	var cancel context.CancelFunc
+	if execOpts.Timeout() > 0 {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+
+	var waiter protocol.Waiter
+	var err error
+	if envViaConnection {
+		waiter, err = envStarter.StartProcessEnv(ctx, fullCmd, execOpts.env, execOpts.Stdin(), stdout, stderr) //nolint:contextcheck // Stdin() uses trace logger which takes context
+	} else if ls, ok := r.baseConnection().(loggedStarter); ok {
+		waiter, err = ls.startLogged(ctx, redactedCmd, fullCmd, execOpts.Stdin(), stdout, stderr) //nolint:contextcheck // Stdin() uses trace logger which takes context
+	} else {
+		waiter, err = r.baseConnection().StartProcess(ctx, fullCmd, execOpts.Stdin(), stdout, stderr) //nolint:contextcheck // Stdin() uses trace logger which takes context
+	}
 	if err != nil {
+		if cancel != nil {
+			cancel()
+		}
 		closeAll(traceClosers)
+		if cmdTrace != nil {
+			cmdTrace.Finished(-1, "", 0, traceError(err, execOpts))
+		}
 		log.Trace(ctx, "start process failed", log.HostAttr(r), log.KeyCommand, redactedCmd, log.KeyError, err)
 		return nil, fmt.Errorf("runner start command: %w", err)
 	}
 
 	if waiter == nil {
+		if cancel != nil {
+			cancel()
+		}
 		closeAll(traceClosers)
+		if cmdTrace != nil {
+			cmdTrace.Finished(-1, "", 0, errInternal)
+		}
 		log.Trace(ctx, "start process returned nil waiter", log.HostAttr(r), log.KeyCommand, redactedCmd, log.KeyError, errInternal)
 		return nil, fmt.Errorf("%w: connection returned no error but a nil waiter", errInternal)
 	}
@@ -544,20 +646,101 @@ func (r *Executor) Start(ctx context.Context, command string, opts ...ExecOption
 		tracer.ProcessStarted(r.String(), fullCmd)
 	}
 
-	return &waiterWrapper{
+	proc := &Process{
 		waiter:       waiter,
+		runner:       r,
 		opts:         execOpts,
 		isWindows:    r.IsWindows(),
 		tracer:       tracer,
+		cmdTrace:     cmdTrace,
 		host:         r.String(),
 		formatted:    fullCmd,
+		logged:       redactedCmd,
 		started:      started,
 		traceClosers: traceClosers,
-	}, nil
+		pid:          pid,
+		cancel:       cancel,
+		done:         make(chan struct{}),
+		exitCode:     -1,
+	}
+	if cancel != nil {
+		go proc.enforceTimeout(execOpts.Timeout(), execOpts.KillGrace(), cancel)
+	}
+	return proc, nil
+}
+
+// traceCommand starts the [CommandTrace] of a command and wires the output of
+// the command to it, unless the output is hidden. The scan writers it creates
+// are appended to closers, which is returned.
+func (r *Executor) traceCommand(ctx context.Context, ct CommandTracer, execOpts *ExecOptions, redactedCmd string, closers []io.Closer) (CommandTrace, []io.Closer) {
+	info := CommandInfo{
+		Host:          r.String(),
+		Protocol:      connectionProtocol(r.baseConnection()),
+		Started:       time.Now(),
+		CommandHidden: !execOpts.LogCommand(),
+		OutputHidden:  execOpts.outputHidden(),
+	}
+	if !info.CommandHidden {
+		info.Command = redactedCmd
+	}
+	trace := ct.TraceCommand(ctx, info)
+	if trace == nil || info.OutputHidden {
+		return trace, closers
+	}
+	redactLine := func(line string) string { return line }
+	if execOpts.hasRedaction() {
+		redactLine = execOpts.Redacter().Redact
+	}
+	outSW := iostream.NewScanWriter(func(line string) { trace.StdoutLine(redactLine(line)) })
+	errSW := iostream.NewScanWriter(func(line string) { trace.StderrLine(redactLine(line)) })
+	execOpts.traceOut = joinWriters(execOpts.traceOut, outSW)
+	execOpts.traceErr = joinWriters(execOpts.traceErr, errSW)
+	return trace, append(closers, outSW, errSW)
+}
+
+// traceError returns err as a [CommandTrace] gets to see it: the error the
+// command finished with, without the output a [ProcessError] carries in its
+// message or a [TimeoutError] keeps, and with the secrets registered via
+// [Redact] masked.
+func traceError(err error, execOpts *ExecOptions) error {
+	if err == nil {
+		return nil
+	}
+	if procErr, ok := errors.AsType[*ProcessError](err); ok && procErr.err != nil {
+		err = procErr.err
+	}
+	msg := err.Error()
+	if execOpts.hasRedaction() {
+		msg = execOpts.Redact(msg)
+	}
+	return errors.New(msg) //nolint:err113 // a copy of the message only, the error may carry output
+}
+
+// loggedStarter is implemented by connections that take the logged form of a
+// command along with the command to run, such as the one of a [DryRunRunner].
+type loggedStarter interface {
+	startLogged(ctx context.Context, logged, command string, stdin io.Reader, stdout, stderr io.Writer) (protocol.Waiter, error)
+}
+
+// connectionProtocol returns the protocol family of conn, such as "SSH", or
+// an empty string when the connection does not tell.
+func connectionProtocol(conn protocol.ProcessStarter) string {
+	if p, ok := conn.(interface{ Protocol() string }); ok {
+		return p.Protocol()
+	}
+	return ""
+}
+
+// joinWriters returns a writer that writes to both a and b, a may be nil.
+func joinWriters(a, b io.Writer) io.Writer {
+	if a == nil {
+		return b
+	}
+	return io.MultiWriter(a, b)
 }
 
-// StartBackground starts the command and returns a Waiter.
-func (r *Executor) StartBackground(command string, opts ...ExecOption) (protocol.Waiter, error) {
+// StartBackground starts the command and returns a [Process] for it.
+func (r *Executor) StartBackground(command string, opts ...ExecOption) (*Process, error) {
 	return r.Start(context.Background(), command, opts...)
 }
 
@@ -574,6 +757,37 @@ func (r *Executor) ExecContext(ctx context.Context, command string, opts ...Exec
 	return nil
 }
 
+// Run executes the command and returns a [Result] with its output, exit status
+// and timing. Stdout and stderr are captured separately and trimmed unless
+// [TrimOutput] is disabled. When the command fails, the Result is returned
+// along with the error, unless the command could not be started. Use
+// [AcceptExitCodes] to have commands that report a result through their exit
+// code succeed. The output is still written to the writers given with
+// [Stdout] and [Stderr].
+func (r *Executor) Run(ctx context.Context, command string, opts ...ExecOption) (*Result, error) {
+	out := &bytes.Buffer{}
+	capture := func(o *ExecOptions) {
+		o.out = joinWriters(o.out, out)
+	}
+	proc, err := r.Start(ctx, command, append(opts, capture)...)
+	if err != nil {
+		return nil, fmt.Errorf("start command: %w", err)
+	}
+	waitErr := proc.Wait()
+	result := &Result{
+		Command:  proc.logged,
+		Stdout:   proc.opts.FormatOutput(out.String()),
+		Stderr:   proc.opts.FormatOutput(proc.opts.ErrString()),
+		ExitCode: proc.ExitCode(),
+		Signal:   proc.ExitSignal(),
+		Duration: proc.duration,
+	}
+	if waitErr != nil {
+		return result, fmt.Errorf("command result: %w", waitErr)
+	}
+	return result, nil
+}
+
 // Exec executes the command and returns an error if unsuccessful.
 func (r *Executor) Exec(command string, opts ...ExecOption) error {
 	return r.ExecContext(context.Background(), command, opts...)
@@ -610,7 +824,7 @@ func (r *Executor) ExecOutputContext(ctx context.Context, command string, opts .
 	}
 
 	log.Trace(ctx, "command finished", log.HostAttr(r))
-	return Build(opts...).FormatOutput(out.String()), nil
+	return r.buildOptions(opts).FormatOutput(out.String()), nil
 }
 
 // ExecOutput executes the command and returns the stdout output or an error.
@@ -339,6 +339,28 @@ func TestStdinInput(t *testing.T) {
 	require.Equal(t, 6, int(readN))
 }
 
+func TestSetOptionsStdinPrefix(t *testing.T) {
+	conn := rigtest.NewMockConnection()
+	conn.AddCommand(rigtest.Equal("foo"), func(a *rigtest.A) error {
+		_, err := io.Copy(a.Stdout, a.Stdin)
+		return err
+	})
+	runner := cmd.NewExecutor(conn)
+	runner.SetOptions(cmd.StdinPrefix("secret\n"), cmd.TrimOutput(false))
+
+	out, err := runner.ExecOutput("foo")
+	require.NoError(t, err)
+	require.Equal(t, "secret\n", out, "the prefix is the only input")
+
+	out, err = runner.ExecOutput("foo", cmd.StdinString("barbar"))
+	require.NoError(t, err)
+	require.Equal(t, "secret\nbarbar", out, "the prefix comes before the input of the command")
+
+	out, err = runner.ExecOutput("foo", cmd.StdinString("barbar\n"), cmd.TrimOutput(true))
+	require.NoError(t, err)
+	require.Equal(t, "secret\nbarbar", out, "the options of the command override the defaults")
+}
+
 func TestBackground(t *testing.T) {
 	mr := rigtest.NewMockRunner()
 	mr.AddCommand(rigtest.Equal("foo"), func(_ *rigtest.A) error {
@@ -350,3 +372,25 @@ func TestBackground(t *testing.T) {
 	require.ErrorContains(t, cmd.Wait(), "error from mock wait")
 
 }
+
+func TestExecutorConnection(t *testing.T) {
+	conn := rigtest.NewMockConnection()
+	base := cmd.NewExecutor(conn)
+	got, direct := base.Connection()
+	require.Same(t, conn, got)
+	require.True(t, direct)
+
+	chained := cmd.NewExecutor(base)
+	got, direct = chained.Connection()
+	require.Same(t, conn, got)
+	require.True(t, direct, "a chain without decorators reaches the connection as is")
+
+	decorated := cmd.NewExecutor(base, func(s string) string { return "sudo -- " + s })
+	got, direct = decorated.Connection()
+	require.Same(t, conn, got)
+	require.False(t, direct)
+
+	got, direct = cmd.NewExecutor(decorated).Connection()
+	require.Same(t, conn, got)
+	require.False(t, direct, "a decorated parent decorates the commands of the chain")
+}
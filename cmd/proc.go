@@ -3,8 +3,6 @@ package cmd
 import (
 	"context"
 	"io"
-
-	"github.com/k0sproject/rig/v2/protocol"
 )
 
 // Proc is a command bound to a runner. Set Stdin, Stdout, and Stderr as needed,
@@ -32,8 +30,8 @@ func (p *Proc) ioOpts(extra []ExecOption) []ExecOption {
 	return append(opts, extra...)
 }
 
-// Start starts the command and returns a Waiter.
-func (p *Proc) Start(ctx context.Context, opts ...ExecOption) (protocol.Waiter, error) {
+// Start starts the command and returns a [Process] for it.
+func (p *Proc) Start(ctx context.Context, opts ...ExecOption) (*Process, error) {
 	return p.runner.Start(ctx, p.command, p.ioOpts(opts)...) //nolint:wrapcheck // transparent delegation
 }
 
@@ -0,0 +1,270 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/k0sproject/rig/v2/protocol"
+	"github.com/k0sproject/rig/v2/sh"
+)
+
+var _ protocol.Waiter = (*Process)(nil)
+
+// Process is a command started by a [Runner]. It is a [protocol.Waiter] that
+// can additionally be sent signals, have its stdin closed and report its exit
+// status, as far as the connection allows.
+type Process struct {
+	waiter       protocol.Waiter
+	runner       *Executor
+	opts         *ExecOptions
+	isWindows    bool
+	tracer       Tracer
+	cmdTrace     CommandTrace
+	host         string
+	formatted    string
+	logged       string
+	started      time.Time
+	duration     time.Duration
+	traceClosers []io.Closer
+	pid          *pidWriter
+
+	cancel       context.CancelFunc
+	done         chan struct{}
+	waitOnce     sync.Once
+	result       error
+	mu           sync.Mutex
+	exitCode     int
+	exitSignal   protocol.Signal
+	timeoutState timeoutState
+}
+
+// Wait waits for the command to finish and returns an error if it fails or if it wrote to stderr.
+// Calling Wait again returns the result of the first call.
+func (p *Process) Wait() error {
+	p.waitOnce.Do(func() { p.result = p.wait() })
+	return p.result
+}
+
+func (p *Process) wait() error {
+	waitErr := p.waiter.Wait()
+	p.duration = time.Since(p.started)
+
+	if p.pid != nil {
+		p.pid.finish()
+	}
+
+	// flush per-line trace writers before reading errBuf so all output is delivered
+	for _, c := range p.traceClosers {
+		_ = c.Close()
+	}
+
+	p.setExitStatus(waitErr)
+	if p.cancel != nil {
+		p.cancel()
+	}
+	if timeoutErr := p.timeoutError(waitErr); timeoutErr != nil {
+		waitErr = timeoutErr
+	} else {
+		waitErr = p.opts.acceptExitCode(p.ExitCode(), waitErr)
+	}
+
+	stderr := cleanStderr(p.opts.ErrString(), p.isWindows)
+	if waitErr == nil && p.isWindows && !p.opts.AllowWinStderr() && len(stderr) > 0 {
+		waitErr = ErrWroteStderr
+	}
+	var result error
+	if waitErr != nil {
+		result = &ProcessError{err: waitErr, stderr: stderr}
+	}
+	if p.tracer != nil {
+		p.tracer.ProcessFinished(p.host, p.formatted, p.duration, result)
+	}
+	if p.cmdTrace != nil {
+		p.cmdTrace.Finished(p.ExitCode(), p.ExitSignal(), p.duration, traceError(result, p.opts))
+	}
+	return result
+}
+
+func (p *Process) setExitStatus(waitErr error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	defer close(p.done)
+	if es, ok := p.waiter.(protocol.ExitStatuser); ok {
+		p.exitCode = es.ExitCode()
+		p.exitSignal = es.ExitSignal()
+		return
+	}
+	if waitErr == nil {
+		p.exitCode = 0
+		return
+	}
+	var withCode exitCoder
+	if errors.As(waitErr, &withCode) {
+		p.exitCode = withCode.ExitCode()
+	}
+}
+
+// exitCoder is satisfied by errors that carry the exit code of a process, such
+// as *exec.ExitError. It is consulted for connections whose processes don't
+// report their exit status themselves.
+type exitCoder interface{ ExitCode() int }
+
+// ExitCode returns the exit code of the command, or -1 if it has not finished,
+// was terminated by a signal or the connection could not tell.
+func (p *Process) ExitCode() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.exitCode
+}
+
+// ExitSignal returns the signal that terminated the command, or an empty string
+// if it exited normally, has not finished or the connection could not tell.
+func (p *Process) ExitSignal() protocol.Signal {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.exitSignal
+}
+
+// PID returns the process id of the command on the host. The boolean is false
+// when the id is not known. Only the localhost connection reports it natively,
+// for other connections it is available when the command was started with
+// [TrackPID], in which case PID waits for the host to report it.
+func (p *Process) PID() (int, bool) {
+	if p.pid != nil {
+		if pid, ok := p.pid.wait(p.done); ok {
+			return pid, true
+		}
+	}
+	if r, ok := p.waiter.(protocol.PIDReporter); ok {
+		return r.PID(), true
+	}
+	return 0, false
+}
+
+// Signal sends sig to the command. The signal is delivered through the
+// connection where the protocol supports it, such as the SSH signal channel.
+// Otherwise, when the command was started with [TrackPID], it is delivered by
+// running kill on the host through the same runner, so a command started via
+// sudo is signaled via sudo. An error wrapping [protocol.ErrUnsupported] is
+// returned when neither is possible.
+//
+// Use Signal to stop a long running command gracefully, for example with
+// [protocol.SIGTERM], and Wait for it to finish.
+func (p *Process) Signal(sig protocol.Signal) error {
+	if s, ok := p.waiter.(protocol.Signaler); ok {
+		err := s.Signal(sig)
+		if !errors.Is(err, protocol.ErrUnsupported) {
+			return err //nolint:wrapcheck // the protocol error describes the signal
+		}
+	}
+	if p.pid == nil || p.isWindows {
+		return fmt.Errorf("%w: signal %s", protocol.ErrUnsupported, sig)
+	}
+	pid, ok := p.pid.wait(p.done)
+	if !ok {
+		return fmt.Errorf("%w: signal %s: process id not known", protocol.ErrUnsupported, sig)
+	}
+	if err := p.runner.ExecContext(context.Background(), sh.Command("kill", "-s", string(sig), strconv.Itoa(pid))); err != nil {
+		return fmt.Errorf("signal %s: %w", sig, err)
+	}
+	return nil
+}
+
+// CloseStdin closes the command's stdin, telling it that there is no more
+// input, without waiting for the stdin reader to be exhausted.
+func (p *Process) CloseStdin() error {
+	sc, ok := p.waiter.(protocol.StdinCloser)
+	if !ok {
+		return fmt.Errorf("%w: close stdin", protocol.ErrUnsupported)
+	}
+	return sc.CloseStdin() //nolint:wrapcheck // the protocol error describes the operation
+}
+
+// pidMarker prefixes the line a command started with [TrackPID] writes its
+// process id on.
+const pidMarker = "rig-pid:"
+
+// trackPIDCommand wraps cmd so that the shell running it reports its process
+// id on stderr before replacing itself with cmd. The outer shell is explicit
+// because $$ is not portable to every login shell.
+func trackPIDCommand(cmd string) string {
+	return sh.Shell("echo " + pidMarker + "$$ >&2; exec " + sh.Shell(cmd))
+}
+
+// pidWriter picks the process id reported by [trackPIDCommand] from the start
+// of stderr and passes everything after it to w.
+type pidWriter struct {
+	w     io.Writer
+	mu    sync.Mutex
+	buf   []byte
+	done  bool
+	pid   int
+	ready chan struct{}
+}
+
+func newPIDWriter(w io.Writer) *pidWriter {
+	return &pidWriter{w: w, ready: make(chan struct{})}
+}
+
+// Write implements io.Writer.
+func (p *pidWriter) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.done {
+		return p.w.Write(b) //nolint:wrapcheck // passthrough
+	}
+	p.buf = append(p.buf, b...)
+	line, rest, found := bytes.Cut(p.buf, []byte("\n"))
+	if !found {
+		if len(p.buf) <= len(pidMarker)+20 && (bytes.HasPrefix(p.buf, []byte(pidMarker)) || bytes.HasPrefix([]byte(pidMarker), p.buf)) {
+			return len(b), nil
+		}
+		return len(b), p.flush(p.buf)
+	}
+	if pid, err := strconv.Atoi(string(bytes.TrimPrefix(line, []byte(pidMarker)))); err == nil && bytes.HasPrefix(line, []byte(pidMarker)) {
+		p.pid = pid
+		return len(b), p.flush(rest)
+	}
+	return len(b), p.flush(p.buf)
+}
+
+// flush marks the process id as settled and writes out to w. Must be called
+// with mu held.
+func (p *pidWriter) flush(out []byte) error {
+	p.done = true
+	p.buf = nil
+	close(p.ready)
+	if len(out) == 0 {
+		return nil
+	}
+	if _, err := p.w.Write(out); err != nil {
+		return fmt.Errorf("write stderr: %w", err)
+	}
+	return nil
+}
+
+// finish writes out anything still buffered once the process has exited.
+func (p *pidWriter) finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.done {
+		_ = p.flush(p.buf)
+	}
+}
+
+// wait waits until the process id has been reported or exited is closed.
+func (p *pidWriter) wait(exited <-chan struct{}) (int, bool) {
+	select {
+	case <-p.ready:
+	case <-exited:
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.pid, p.pid > 0
+}
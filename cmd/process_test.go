@@ -0,0 +1,82 @@
+package cmd_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/k0sproject/rig/v2/cmd"
+	"github.com/k0sproject/rig/v2/protocol"
+	"github.com/k0sproject/rig/v2/rigtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessTrackPID(t *testing.T) {
+	mr := rigtest.NewMockRunner()
+	mr.AddCommand(rigtest.Contains("backup"), func(a *rigtest.A) error {
+		_, _ = fmt.Fprint(a.Stderr, "rig-pid:")
+		_, _ = fmt.Fprint(a.Stderr, "1234\nbacking up\n")
+		return nil
+	})
+	mr.AddCommandSuccess(rigtest.HasPrefix("kill"))
+
+	stderr := &bytes.Buffer{}
+	proc, err := mr.Start(context.Background(), "k0s etcd backup", cmd.TrackPID(), cmd.Stderr(stderr))
+	require.NoError(t, err)
+	rigtest.ReceivedEqual(t, mr, `/bin/sh -c -- 'echo rig-pid:$$ >&2; exec /bin/sh -c -- '"'"'k0s etcd backup'"'"''`)
+	require.Equal(t, -1, proc.ExitCode(), "no exit code before wait")
+	require.NoError(t, proc.Wait())
+	require.Equal(t, "backing up\n", stderr.String(), "the pid line is removed from stderr")
+	require.Equal(t, 0, proc.ExitCode())
+
+	pid, ok := proc.PID()
+	require.True(t, ok)
+	require.Equal(t, 1234, pid)
+
+	require.NoError(t, proc.Signal(protocol.SIGTERM))
+	rigtest.ReceivedEqual(t, mr, "kill -s TERM 1234", "the signal falls back to kill")
+}
+
+func TestProcessWithoutPID(t *testing.T) {
+	mr := rigtest.NewMockRunner()
+	mr.AddCommand(rigtest.Equal("whoami"), func(a *rigtest.A) error {
+		_, _ = fmt.Fprint(a.Stderr, "rig-pid is not a pid\n")
+		return errors.New("failed")
+	})
+
+	stderr := &bytes.Buffer{}
+	proc, err := mr.Start(context.Background(), "whoami", cmd.Stderr(stderr))
+	require.NoError(t, err)
+	require.Error(t, proc.Wait())
+	require.Equal(t, "rig-pid is not a pid\n", stderr.String())
+	require.Equal(t, -1, proc.ExitCode())
+
+	_, ok := proc.PID()
+	require.False(t, ok)
+	require.ErrorIs(t, proc.Signal(protocol.SIGTERM), protocol.ErrUnsupported)
+	require.ErrorIs(t, proc.CloseStdin(), protocol.ErrUnsupported)
+}
+
+func TestProcessWaitTwice(t *testing.T) {
+	mr := rigtest.NewMockRunner()
+	mr.AddCommandFailure(rigtest.Equal("false"), errors.New("exit status 1"))
+	tracer := &tracerRecorder{}
+
+	proc, err := mr.Start(context.Background(), "false", cmd.Trace(tracer))
+	require.NoError(t, err)
+	first := proc.Wait()
+	require.Error(t, first)
+	require.Same(t, first, proc.Wait(), "the second wait returns the result of the first")
+	require.Len(t, tracer.events, 3, "the process is finished once: %v", tracer.events)
+}
+
+func TestProcessTrackPIDWindows(t *testing.T) {
+	mr := rigtest.NewMockRunner()
+	mr.Windows = true
+	proc, err := mr.Start(context.Background(), "backup.exe", cmd.TrackPID())
+	require.NoError(t, err)
+	require.NoError(t, proc.Wait())
+	rigtest.ReceivedEqual(t, mr, "backup.exe", "pid tracking is not applied on windows")
+}
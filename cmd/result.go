@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/k0sproject/rig/v2/protocol"
+)
+
+// Result describes a command run with [Executor.Run].
+type Result struct {
+	// Command is the command as it was logged: fully decorated, with secrets
+	// redacted and PowerShell encoding decoded.
+	Command string
+	// Stdout is what the command wrote to its standard output.
+	Stdout string
+	// Stderr is what the command wrote to its standard error.
+	Stderr string
+	// ExitCode is the exit code of the command, or -1 if it was terminated by
+	// a signal or the connection could not tell.
+	ExitCode int
+	// Signal is the signal that terminated the command, empty if it exited
+	// normally or the connection could not tell.
+	Signal protocol.Signal
+	// Duration is the time from starting the command to it exiting.
+	Duration time.Duration
+}
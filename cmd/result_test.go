@@ -0,0 +1,93 @@
+package cmd_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/k0sproject/rig/v2/cmd"
+	"github.com/k0sproject/rig/v2/rigtest"
+	"github.com/stretchr/testify/require"
+)
+
+// exitError is an error carrying an exit code, like *exec.ExitError.
+type exitError int
+
+func (e exitError) Error() string { return fmt.Sprintf("exit status %d", int(e)) }
+func (e exitError) ExitCode() int { return int(e) }
+
+func TestRun(t *testing.T) {
+	mr := rigtest.NewMockRunner()
+	mr.AddCommand(rigtest.Contains("login"), func(a *rigtest.A) error {
+		_, _ = fmt.Fprintln(a.Stdout, "logged in")
+		_, _ = fmt.Fprintln(a.Stderr, "warning: password on the command line")
+		return nil
+	})
+
+	result, err := mr.Run(context.Background(), "login --password hunter2", cmd.Redact("hunter2"))
+	require.NoError(t, err)
+	require.Equal(t, "logged in", result.Stdout)
+	require.Equal(t, "warning: password on the command line", result.Stderr)
+	require.Equal(t, 0, result.ExitCode)
+	require.Empty(t, result.Signal)
+	require.Equal(t, "login --password [REDACTED]", result.Command)
+}
+
+func TestRunStdout(t *testing.T) {
+	mr := rigtest.NewMockRunner()
+	mr.AddCommand(rigtest.Contains("login"), func(a *rigtest.A) error {
+		_, _ = fmt.Fprintln(a.Stdout, "logged in")
+		_, _ = fmt.Fprintln(a.Stderr, "warning")
+		return nil
+	})
+
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	result, err := mr.Run(context.Background(), "login", cmd.Stdout(stdout), cmd.Stderr(stderr))
+	require.NoError(t, err)
+	require.Equal(t, "logged in", result.Stdout)
+	require.Equal(t, "logged in\n", stdout.String(), "the caller's writer gets the output too")
+	require.Equal(t, "warning", result.Stderr)
+	require.Equal(t, "warning\n", stderr.String())
+}
+
+func TestRunFailure(t *testing.T) {
+	mr := rigtest.NewMockRunner()
+	mr.AddCommand(rigtest.Contains("is-active"), func(a *rigtest.A) error {
+		_, _ = fmt.Fprintln(a.Stdout, "inactive")
+		return exitError(3)
+	})
+
+	result, err := mr.Run(context.Background(), "systemctl is-active k0scontroller")
+	require.Error(t, err)
+	var withCode exitError
+	require.ErrorAs(t, err, &withCode)
+	require.NotNil(t, result, "the result is returned with the error")
+	require.Equal(t, 3, result.ExitCode)
+	require.Equal(t, "inactive", result.Stdout)
+
+	result, err = mr.Run(context.Background(), "systemctl is-active k0scontroller", cmd.AcceptExitCodes(0, 3))
+	require.NoError(t, err)
+	require.Equal(t, 3, result.ExitCode)
+}
+
+func TestAcceptExitCodes(t *testing.T) {
+	mr := rigtest.NewMockRunner()
+	mr.AddCommandFailure(rigtest.HasPrefix("grep"), exitError(1))
+	mr.AddCommandFailure(rigtest.HasPrefix("false"), errors.New("no exit code"))
+	mr.AddCommandSuccess(rigtest.HasPrefix("true"))
+
+	require.NoError(t, mr.Exec("grep -q k0s /etc/hosts", cmd.AcceptExitCodes(0, 1)))
+	require.Error(t, mr.Exec("grep -q k0s /etc/hosts", cmd.AcceptExitCodes(0, 2)))
+	require.Error(t, mr.Exec("false", cmd.AcceptExitCodes(0, 1)), "an unknown exit code is not accepted")
+	require.ErrorIs(t, mr.Exec("true", cmd.AcceptExitCodes(1)), cmd.ErrUnacceptedExitCode)
+}
+
+func TestRunErrorExecutor(t *testing.T) {
+	errFoo := errors.New("foo")
+	result, err := cmd.NewErrorExecutor(errFoo).Run(context.Background(), "true")
+	require.ErrorIs(t, err, errFoo)
+	require.Nil(t, result)
+}
@@ -20,6 +20,10 @@ var (
 
 	// ErrCommandRejected is returned when a [CommandGate] refuses to allow a command to run.
 	ErrCommandRejected = errors.New("command rejected")
+
+	// ErrUnacceptedExitCode is returned when a command run with [AcceptExitCodes] exits
+	// successfully but exit code 0 is not one of the accepted codes.
+	ErrUnacceptedExitCode = errors.New("exit code not accepted")
 )
 
 // DecorateFunc is a function that takes a string and returns a decorated string.
@@ -51,7 +55,7 @@ type SimpleRunner interface {
 	ExecOutput(command string, opts ...ExecOption) (string, error)
 	ExecReader(command string, opts ...ExecOption) io.Reader
 	ExecScanner(command string, opts ...ExecOption) *bufio.Scanner
-	StartBackground(command string, opts ...ExecOption) (protocol.Waiter, error)
+	StartBackground(command string, opts ...ExecOption) (*Process, error)
 }
 
 // ContextRunner is a command runner that can run commands with a context.
@@ -61,7 +65,8 @@ type ContextRunner interface {
 	ExecContext(ctx context.Context, command string, opts ...ExecOption) error
 	ExecOutputContext(ctx context.Context, command string, opts ...ExecOption) (string, error)
 	ExecReaderContext(ctx context.Context, command string, opts ...ExecOption) io.Reader
-	Start(ctx context.Context, command string, opts ...ExecOption) (protocol.Waiter, error)
+	Start(ctx context.Context, command string, opts ...ExecOption) (*Process, error)
+	Run(ctx context.Context, command string, opts ...ExecOption) (*Result, error)
 }
 
 // Runner is a full featured command runner for clients.
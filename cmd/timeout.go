@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/k0sproject/rig/v2/log"
+	"github.com/k0sproject/rig/v2/protocol"
+)
+
+// DefaultKillGrace is the time a command that ran out of time set by [Timeout]
+// is given to exit after SIGTERM before it is killed.
+const DefaultKillGrace = 5 * time.Second
+
+// ErrTimeout is returned when a command runs out of the time set by [Timeout].
+var ErrTimeout = errors.New("command timed out")
+
+// TimeoutError is returned when a command runs out of the time set by
+// [Timeout]. It tells how the command was stopped and carries what it wrote
+// before that.
+type TimeoutError struct {
+	timeout time.Duration
+	grace   time.Duration
+	killed  bool
+	stdout  string
+	stderr  string
+	err     error
+}
+
+// Error describes the timeout and how the command was stopped.
+func (e *TimeoutError) Error() string {
+	if e.killed {
+		return fmt.Sprintf("%v after %s: killed after not exiting within %s of SIGTERM", ErrTimeout, e.timeout, e.grace)
+	}
+	return fmt.Sprintf("%v after %s: terminated with SIGTERM", ErrTimeout, e.timeout)
+}
+
+// Unwrap returns [ErrTimeout] and the error the command finished with, if any.
+func (e *TimeoutError) Unwrap() []error {
+	if e.err == nil {
+		return []error{ErrTimeout}
+	}
+	return []error{ErrTimeout, e.err}
+}
+
+// Killed returns true if the command did not exit after SIGTERM and was
+// killed, false if it exited within the grace period.
+func (e *TimeoutError) Killed() bool {
+	return e.killed
+}
+
+// Stdout returns what the command wrote to its standard output before it
+// stopped.
+func (e *TimeoutError) Stdout() string {
+	return e.stdout
+}
+
+// Stderr returns what the command wrote to its standard error before it
+// stopped.
+func (e *TimeoutError) Stderr() string {
+	return e.stderr
+}
+
+// timeoutState records how far enforceTimeout got.
+type timeoutState int
+
+const (
+	timeoutPending timeoutState = iota
+	timeoutTerminated
+	timeoutKilled
+)
+
+// enforceTimeout stops the process if it has not exited when timeout runs
+// out: first politely with SIGTERM, then after grace with SIGKILL and by
+// cancelling the context the process was started with, which makes the
+// connection drop its session. Without SIGTERM support it goes straight to
+// the second step.
+func (p *Process) enforceTimeout(timeout, grace time.Duration, cancel context.CancelFunc) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-p.done:
+		return
+	case <-timer.C:
+	}
+
+	p.setTimeoutState(timeoutTerminated)
+	log.Trace(context.Background(), "command timed out, terminating", log.HostAttr(p.runner), "timeout", timeout)
+	if err := p.Signal(protocol.SIGTERM); err == nil {
+		timer.Reset(grace)
+		select {
+		case <-p.done:
+			return
+		case <-timer.C:
+		}
+	} else {
+		log.Trace(context.Background(), "can't terminate timed out command", log.HostAttr(p.runner), log.KeyError, err)
+	}
+
+	p.setTimeoutState(timeoutKilled)
+	log.Trace(context.Background(), "killing timed out command", log.HostAttr(p.runner))
+	if err := p.Signal(protocol.SIGKILL); err != nil {
+		log.Trace(context.Background(), "can't kill timed out command", log.HostAttr(p.runner), log.KeyError, err)
+	}
+	cancel()
+}
+
+func (p *Process) setTimeoutState(state timeoutState) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.timeoutState = state
+}
+
+// timeoutError returns a [*TimeoutError] wrapping waitErr if the process was
+// stopped for running out of time, nil otherwise.
+func (p *Process) timeoutError(waitErr error) error {
+	p.mu.Lock()
+	state := p.timeoutState
+	p.mu.Unlock()
+	if state == timeoutPending {
+		return nil
+	}
+	return &TimeoutError{
+		timeout: p.opts.Timeout(),
+		grace:   p.opts.KillGrace(),
+		killed:  state == timeoutKilled,
+		stdout:  p.opts.outBuf.String(),
+		stderr:  p.opts.ErrString(),
+		err:     waitErr,
+	}
+}
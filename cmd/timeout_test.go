@@ -0,0 +1,39 @@
+package cmd_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/k0sproject/rig/v2/cmd"
+	"github.com/k0sproject/rig/v2/rigtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeoutWithoutSignals(t *testing.T) {
+	mr := rigtest.NewMockRunner()
+	mr.AddCommand(rigtest.Equal("k0s etcd backup"), func(a *rigtest.A) error {
+		_, _ = a.Stdout.Write([]byte("backing up\n"))
+		<-a.Ctx.Done()
+		return a.Ctx.Err()
+	})
+
+	start := time.Now()
+	err := mr.Exec("k0s etcd backup", cmd.Timeout(10*time.Millisecond), cmd.KillGrace(time.Minute))
+	require.Less(t, time.Since(start), time.Minute, "the grace period is skipped when the command can't be signaled")
+	require.ErrorIs(t, err, cmd.ErrTimeout)
+	require.ErrorIs(t, err, context.Canceled)
+	timeoutErr, ok := errors.AsType[*cmd.TimeoutError](err)
+	require.True(t, ok)
+	require.True(t, timeoutErr.Killed())
+	require.Equal(t, "backing up\n", timeoutErr.Stdout())
+}
+
+func TestTimeoutNotReached(t *testing.T) {
+	mr := rigtest.NewMockRunner()
+	mr.AddCommandOutput(rigtest.Equal("hostname"), "node1")
+	out, err := mr.ExecOutput("hostname", cmd.Timeout(time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, "node1", out)
+}
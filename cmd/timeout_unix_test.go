@@ -0,0 +1,49 @@
+//go:build !windows
+
+package cmd_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/k0sproject/rig/v2/cmd"
+	"github.com/k0sproject/rig/v2/protocol/localhost"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeoutTerminates(t *testing.T) {
+	conn, err := localhost.NewConnection()
+	require.NoError(t, err)
+	runner := cmd.NewExecutor(conn)
+
+	t.Run("exits after SIGTERM", func(t *testing.T) {
+		err := runner.Exec(
+			"trap 'echo cleaning up >&2; exit 0' TERM; echo started; while true; do sleep 0.1; done",
+			cmd.Timeout(500*time.Millisecond),
+			cmd.KillGrace(time.Minute),
+		)
+		require.ErrorIs(t, err, cmd.ErrTimeout)
+		require.ErrorContains(t, err, "terminated with SIGTERM")
+		timeoutErr, ok := errors.AsType[*cmd.TimeoutError](err)
+		require.True(t, ok)
+		require.False(t, timeoutErr.Killed())
+		require.Equal(t, "started\n", timeoutErr.Stdout())
+		require.Equal(t, "cleaning up\n", timeoutErr.Stderr())
+		require.Equal(t, "cleaning up", cmd.StderrOf(err))
+	})
+
+	t.Run("killed after the grace period", func(t *testing.T) {
+		err := runner.Exec(
+			"trap '' TERM; echo started; while true; do sleep 0.1; done",
+			cmd.Timeout(500*time.Millisecond),
+			cmd.KillGrace(200*time.Millisecond),
+		)
+		require.ErrorIs(t, err, cmd.ErrTimeout)
+		require.ErrorContains(t, err, "killed after not exiting within 200ms of SIGTERM")
+		timeoutErr, ok := errors.AsType[*cmd.TimeoutError](err)
+		require.True(t, ok)
+		require.True(t, timeoutErr.Killed())
+		require.Equal(t, "started\n", timeoutErr.Stdout())
+	})
+}
@@ -1,6 +1,12 @@
 package cmd
 
-import "time"
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/k0sproject/rig/v2/protocol"
+)
 
 // Tracer observes command lifecycle events on an [Executor].
 // Register a Tracer via [Trace] (per-call) or [Executor.SetTracer] (runner-wide).
@@ -33,6 +39,85 @@ type OutputTracer interface {
 	StderrLine(host, line string)
 }
 
+// TracerSetter is implemented by runners that support a runner-wide [Tracer].
+// [Executor] implements it, allowing a tracer configured on a
+// [github.com/k0sproject/rig/v2.Client] to be propagated to every runner the
+// client derives.
+type TracerSetter interface {
+	SetTracer(t Tracer)
+}
+
+// CommandInfo describes a command to a [CommandTracer].
+type CommandInfo struct {
+	// Host is the host the command runs on.
+	Host string
+	// Protocol is the protocol family of the connection, such as "SSH" or
+	// "WinRM", empty when the connection does not report one.
+	Protocol string
+	// Command is the command as it is logged: fully decorated, with secrets
+	// redacted and PowerShell encoding decoded. It is empty when CommandHidden
+	// is set.
+	Command string
+	// Started is the time the command was started.
+	Started time.Time
+	// CommandHidden reports whether the command was run with [HideCommand] or
+	// [Sensitive].
+	CommandHidden bool
+	// OutputHidden reports whether the command was run with [HideOutput] or
+	// [Sensitive], in which case no output lines are delivered.
+	OutputHidden bool
+}
+
+// CommandTrace receives the events of a single command from a [CommandTracer].
+// The output lines are delivered without the trailing newline, with secrets
+// registered via [Redact] masked. StdoutLine and StderrLine may be called
+// concurrently with each other, Finished is called once after all of the
+// output has been delivered.
+type CommandTrace interface {
+	StdoutLine(line string)
+	StderrLine(line string)
+	// Finished fires after the process exits, or with a zero duration when it
+	// could not be started. exitCode is -1 when it is not known. err is nil on
+	// success. Otherwise it describes how the command failed, such as by its
+	// exit status, without the output of the command and with secrets
+	// redacted. It does not wrap the error returned to the caller.
+	Finished(exitCode int, signal protocol.Signal, duration time.Duration, err error)
+}
+
+// CommandTracer extends [Tracer] for tracers that record each command as a
+// whole, such as an audit transcript. Unlike the host-keyed hooks of
+// [OutputTracer], the [CommandTrace] it returns for a command gets the events
+// of that command only, even when commands run concurrently, and it only
+// gets to see what the logs would: the command is redacted and the flags set
+// with [HideCommand], [HideOutput] and [Sensitive] are respected.
+type CommandTracer interface {
+	Tracer
+	// TraceCommand fires when a command is about to start, after the
+	// [CommandGate] has allowed it. ctx is the context the command was
+	// started with, which lets a tracer link the command to a parent
+	// operation.
+	TraceCommand(ctx context.Context, info CommandInfo) CommandTrace
+}
+
+// InteractiveTrace receives the output of an interactive session from an
+// [InteractiveTracer]. Write gets stdout and stderr of the session as they
+// arrive and must be safe for concurrent use. Finished is called once when the
+// session has ended.
+type InteractiveTrace interface {
+	io.Writer
+	Finished(err error)
+}
+
+// InteractiveTracer extends [Tracer] for tracers that record interactive
+// sessions, such as the ones started with
+// [github.com/k0sproject/rig/v2.Client.ExecInteractive], which do not go
+// through a runner. size is the terminal size requested for the session,
+// zero when the default is used.
+type InteractiveTracer interface {
+	Tracer
+	TraceInteractive(host, command string, size protocol.WindowSize) InteractiveTrace
+}
+
 // Explanation holds the formatted representations of a command as it would
 // appear at each stage of the execution pipeline.
 type Explanation struct {
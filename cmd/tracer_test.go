@@ -292,3 +292,99 @@ func TestExplainMatchesStart(t *testing.T) {
 
 	rigtest.ReceivedEqual(t, conn, ex.Formatted)
 }
+
+// commandTracerRecorder records the events of each command separately.
+type commandTracerRecorder struct {
+	tracerRecorder
+	mu     sync.Mutex
+	traces []*commandTraceRecorder
+}
+
+func (r *commandTracerRecorder) TraceCommand(_ context.Context, info cmd.CommandInfo) cmd.CommandTrace {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	trace := &commandTraceRecorder{info: info, exitCode: -2}
+	r.traces = append(r.traces, trace)
+	return trace
+}
+
+type commandTraceRecorder struct {
+	info     cmd.CommandInfo
+	mu       sync.Mutex
+	stdout   []string
+	stderr   []string
+	exitCode int
+	err      error
+}
+
+func (c *commandTraceRecorder) StdoutLine(line string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stdout = append(c.stdout, line)
+}
+
+func (c *commandTraceRecorder) StderrLine(line string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stderr = append(c.stderr, line)
+}
+
+func (c *commandTraceRecorder) Finished(exitCode int, _ protocol.Signal, _ time.Duration, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.exitCode = exitCode
+	c.err = err
+}
+
+func TestCommandTracer(t *testing.T) {
+	mr := rigtest.NewMockRunner()
+	mr.AddCommand(rigtest.Contains("login"), func(a *rigtest.A) error {
+		fmt.Fprintln(a.Stdout, "token hunter2")
+		fmt.Fprintln(a.Stderr, "warning")
+		return nil
+	})
+	mr.AddCommand(rigtest.Equal("fail"), func(_ *rigtest.A) error { return errors.New("boom") })
+
+	tr := &commandTracerRecorder{}
+	require.NoError(t, mr.Exec("login hunter2", cmd.Trace(tr), cmd.Redact("hunter2")))
+	require.Error(t, mr.Exec("fail", cmd.Trace(tr)))
+	require.NoError(t, mr.Exec("login quiet", cmd.Trace(tr), cmd.HideOutput()))
+	require.NoError(t, mr.Exec("login secret", cmd.Trace(tr), cmd.Sensitive()))
+
+	require.Len(t, tr.traces, 4)
+	login := tr.traces[0]
+	assert.Equal(t, "login [REDACTED]", login.info.Command)
+	assert.Equal(t, "mock", login.info.Protocol)
+	assert.Equal(t, []string{"token [REDACTED]"}, login.stdout)
+	assert.Equal(t, []string{"warning"}, login.stderr)
+	assert.Equal(t, 0, login.exitCode)
+	assert.NoError(t, login.err)
+
+	fail := tr.traces[1]
+	assert.Equal(t, "fail", fail.info.Command)
+	assert.ErrorContains(t, fail.err, "boom")
+
+	quiet := tr.traces[2]
+	assert.True(t, quiet.info.OutputHidden)
+	assert.False(t, quiet.info.CommandHidden)
+	assert.Empty(t, quiet.stdout)
+	assert.Empty(t, quiet.stderr)
+
+	secret := tr.traces[3]
+	assert.True(t, secret.info.OutputHidden)
+	assert.True(t, secret.info.CommandHidden)
+	assert.Empty(t, secret.info.Command)
+	assert.Empty(t, secret.stdout)
+}
+
+func TestCommandTracerStartFailure(t *testing.T) {
+	conn := rigtest.NewMockConnection()
+	conn.ErrImmediate = true
+	conn.ErrDefault = errors.New("connection lost")
+	runner := cmd.NewExecutor(conn)
+	tr := &commandTracerRecorder{}
+	require.Error(t, runner.Exec("whoami", cmd.Trace(tr)))
+	require.Len(t, tr.traces, 1)
+	assert.Equal(t, -1, tr.traces[0].exitCode)
+	assert.Error(t, tr.traces[0].err)
+}
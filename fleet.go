@@ -0,0 +1,222 @@
+package rig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/k0sproject/rig/v2/cmd"
+)
+
+// ErrSkipped is the error of a host in the results of a [Fleet] operation when
+// the operation was not run on it because another host failed first and the
+// fleet was set to fail fast.
+var ErrSkipped = errors.New("skipped after another host failed")
+
+// FleetOptions holds the options for a [Fleet].
+type FleetOptions struct {
+	parallelism int
+	failFast    bool
+}
+
+// FleetOption is a functional option for a [Fleet].
+type FleetOption func(*FleetOptions)
+
+// WithParallelism sets the maximum number of hosts an operation runs on at the
+// same time. Zero or less means no limit, which is the default.
+func WithParallelism(n int) FleetOption {
+	return func(o *FleetOptions) {
+		o.parallelism = n
+	}
+}
+
+// WithFailFast makes the fleet stop on the first host that fails: the context
+// of the operations still running is canceled and the hosts that have not
+// been started are skipped with [ErrSkipped]. By default the operation is run
+// on every host regardless of the others failing.
+func WithFailFast() FleetOption {
+	return func(o *FleetOptions) {
+		o.failFast = true
+	}
+}
+
+// WithContinueOnError makes the fleet run an operation on every host even when
+// some of them fail. This is the default, the option exists for turning off a
+// [WithFailFast] given earlier.
+func WithContinueOnError() FleetOption {
+	return func(o *FleetOptions) {
+		o.failFast = false
+	}
+}
+
+// Fleet runs operations on a group of clients in parallel and collects the
+// results per host.
+type Fleet struct {
+	clients []*Client
+	options FleetOptions
+}
+
+// NewFleet returns a new Fleet of the given clients.
+func NewFleet(clients []*Client, opts ...FleetOption) *Fleet {
+	f := &Fleet{clients: clients}
+	for _, opt := range opts {
+		opt(&f.options)
+	}
+	return f
+}
+
+// Clients returns the clients of the fleet.
+func (f *Fleet) Clients() []*Client {
+	return f.clients
+}
+
+// HostResult is the outcome of a [Fleet] operation on one of its clients.
+type HostResult struct {
+	Client *Client
+	// Result is the result of the command for [Fleet.Exec], it is nil for the
+	// other operations and when the command could not be started.
+	Result *cmd.Result
+	// Err is the error of the operation on the host, nil when it succeeded.
+	Err error
+}
+
+// HostError is an error of a [Fleet] operation on one host.
+type HostError struct {
+	Client *Client
+	Err    error
+}
+
+// Error returns the error prefixed with the host.
+func (e *HostError) Error() string {
+	return e.Client.String() + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *HostError) Unwrap() error {
+	return e.Err
+}
+
+// FleetError is returned by [Fleet] operations that failed on one or more
+// hosts. It wraps a [HostError] for each of them, so errors.Is and errors.As
+// can be used to look for the error of any host. Hosts skipped with
+// [ErrSkipped] are not included.
+type FleetError struct {
+	Errors []*HostError
+	// Total is the number of hosts the operation was attempted on.
+	Total int
+}
+
+// Error returns a summary of the failed hosts and their errors.
+func (e *FleetError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%d of %d hosts failed: %s", len(e.Errors), e.Total, strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the errors of the failed hosts.
+func (e *FleetError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, err := range e.Errors {
+		errs[i] = err
+	}
+	return errs
+}
+
+// Connect connects all the clients. See [Client.Connect].
+func (f *Fleet) Connect(ctx context.Context) error {
+	_, err := f.Each(ctx, func(ctx context.Context, c *Client) error {
+		return c.Connect(ctx)
+	})
+	return err
+}
+
+// Disconnect disconnects all the clients.
+func (f *Fleet) Disconnect() {
+	for _, c := range f.clients {
+		c.Disconnect()
+	}
+}
+
+// Exec runs the command on all the clients and returns the per-host results in
+// the order of the clients. The error is a [*FleetError] when the command
+// failed on any of the hosts.
+func (f *Fleet) Exec(ctx context.Context, command string, opts ...cmd.ExecOption) ([]HostResult, error) {
+	return f.run(ctx, func(ctx context.Context, c *Client, res *HostResult) error {
+		result, err := c.Run(ctx, command, opts...)
+		res.Result = result
+		return err //nolint:wrapcheck // wrapped in a HostError
+	})
+}
+
+// Each calls fn for all the clients and returns the per-host results in the
+// order of the clients. The error is a [*FleetError] when fn returned an error
+// for any of them. The context passed to fn is canceled when the fleet is
+// set to fail fast and another host fails.
+func (f *Fleet) Each(ctx context.Context, fn func(ctx context.Context, c *Client) error) ([]HostResult, error) {
+	return f.run(ctx, func(ctx context.Context, c *Client, _ *HostResult) error {
+		return fn(ctx, c)
+	})
+}
+
+func (f *Fleet) run(ctx context.Context, fn func(ctx context.Context, c *Client, res *HostResult) error) ([]HostResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	limit := f.options.parallelism
+	if limit <= 0 || limit > len(f.clients) {
+		limit = len(f.clients)
+	}
+	sem := make(chan struct{}, limit)
+
+	var (
+		wg      sync.WaitGroup
+		aborted atomic.Bool
+	)
+	results := make([]HostResult, len(f.clients))
+	for i, c := range f.clients {
+		results[i].Client = c
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			if aborted.Load() {
+				results[i].Err = ErrSkipped
+			} else {
+				results[i].Err = ctx.Err()
+			}
+			continue
+		}
+		wg.Go(func() {
+			defer func() { <-sem }()
+			if err := fn(ctx, c, &results[i]); err != nil {
+				results[i].Err = err
+				if f.options.failFast && aborted.CompareAndSwap(false, true) {
+					cancel()
+				}
+			}
+		})
+	}
+	wg.Wait()
+
+	return results, fleetError(results)
+}
+
+func fleetError(results []HostResult) error {
+	var errs []*HostError
+	for _, res := range results {
+		if res.Err == nil || errors.Is(res.Err, ErrSkipped) {
+			continue
+		}
+		errs = append(errs, &HostError{Client: res.Client, Err: res.Err})
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return &FleetError{Errors: errs, Total: len(results)}
+}
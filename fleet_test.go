@@ -0,0 +1,176 @@
+package rig_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/k0sproject/rig/v2"
+	"github.com/k0sproject/rig/v2/rigtest"
+	"github.com/stretchr/testify/require"
+)
+
+func newFleetClients(t *testing.T, n int) ([]*rig.Client, []*rigtest.MockConnection) {
+	t.Helper()
+	clients := make([]*rig.Client, n)
+	conns := make([]*rigtest.MockConnection, n)
+	for i := range n {
+		conns[i] = rigtest.NewMockConnection()
+		client, err := rig.NewClient(rig.WithConnection(conns[i]))
+		require.NoError(t, err)
+		clients[i] = client
+	}
+	return clients, conns
+}
+
+func TestFleetConnect(t *testing.T) {
+	clients, _ := newFleetClients(t, 3)
+	fleet := rig.NewFleet(clients)
+	require.NoError(t, fleet.Connect(context.Background()))
+	for _, c := range clients {
+		require.True(t, c.IsConnected())
+	}
+	fleet.Disconnect()
+	for _, c := range clients {
+		require.False(t, c.IsConnected())
+	}
+}
+
+func TestFleetExec(t *testing.T) {
+	clients, conns := newFleetClients(t, 3)
+	for _, conn := range conns {
+		conn.AddCommandOutput(rigtest.Contains("echo hello"), "hello")
+	}
+	results, err := rig.NewFleet(clients).Exec(context.Background(), "echo hello")
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	for i, res := range results {
+		require.Same(t, clients[i], res.Client)
+		require.NoError(t, res.Err)
+		require.NotNil(t, res.Result)
+		require.Equal(t, "hello", res.Result.Stdout)
+	}
+}
+
+func TestFleetContinueOnError(t *testing.T) {
+	clients, conns := newFleetClients(t, 3)
+	errHost := errors.New("host failure")
+	conns[0].AddCommandSuccess(rigtest.HasSuffix(" true"))
+	conns[1].AddCommandFailure(rigtest.HasSuffix(" true"), errHost)
+	conns[2].AddCommandSuccess(rigtest.HasSuffix(" true"))
+
+	results, err := rig.NewFleet(clients).Exec(context.Background(), "true")
+	require.ErrorIs(t, err, errHost)
+	require.ErrorContains(t, err, "1 of 3 hosts failed")
+
+	var fleetErr *rig.FleetError
+	require.ErrorAs(t, err, &fleetErr)
+	require.Len(t, fleetErr.Errors, 1)
+	require.Same(t, clients[1], fleetErr.Errors[0].Client)
+
+	var hostErr *rig.HostError
+	require.ErrorAs(t, err, &hostErr)
+	require.Same(t, clients[1], hostErr.Client)
+
+	require.NoError(t, results[0].Err)
+	require.ErrorIs(t, results[1].Err, errHost)
+	require.NoError(t, results[2].Err)
+	require.NoError(t, conns[2].Received(rigtest.HasSuffix(" true")))
+}
+
+func TestFleetEachErrors(t *testing.T) {
+	clients, _ := newFleetClients(t, 2)
+	errFirst := errors.New("first")
+	errSecond := errors.New("second")
+	_, err := rig.NewFleet(clients).Each(context.Background(), func(_ context.Context, c *rig.Client) error {
+		if c == clients[0] {
+			return errFirst
+		}
+		return errSecond
+	})
+	require.ErrorIs(t, err, errFirst)
+	require.ErrorIs(t, err, errSecond)
+}
+
+func TestFleetFailFast(t *testing.T) {
+	clients, _ := newFleetClients(t, 4)
+	errHost := errors.New("host failure")
+	var calls atomic.Int32
+	fleet := rig.NewFleet(clients, rig.WithParallelism(1), rig.WithFailFast())
+	results, err := fleet.Each(context.Background(), func(_ context.Context, c *rig.Client) error {
+		calls.Add(1)
+		if c == clients[1] {
+			return errHost
+		}
+		return nil
+	})
+	require.ErrorIs(t, err, errHost)
+	require.NotErrorIs(t, err, rig.ErrSkipped)
+	require.Equal(t, int32(2), calls.Load())
+	require.NoError(t, results[0].Err)
+	require.ErrorIs(t, results[1].Err, errHost)
+	require.ErrorIs(t, results[2].Err, rig.ErrSkipped)
+	require.ErrorIs(t, results[3].Err, rig.ErrSkipped)
+}
+
+func TestFleetFailFastCancelsRunning(t *testing.T) {
+	clients, _ := newFleetClients(t, 2)
+	errHost := errors.New("host failure")
+	fleet := rig.NewFleet(clients, rig.WithFailFast())
+	results, err := fleet.Each(context.Background(), func(ctx context.Context, c *rig.Client) error {
+		if c == clients[0] {
+			return errHost
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(5 * time.Second):
+			return nil
+		}
+	})
+	require.ErrorIs(t, err, errHost)
+	require.ErrorIs(t, results[1].Err, context.Canceled)
+}
+
+func TestFleetParallelism(t *testing.T) {
+	clients, _ := newFleetClients(t, 8)
+	var (
+		mu       sync.Mutex
+		running  int
+		maxSeen  int
+		released = make(chan struct{})
+	)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		close(released)
+	}()
+	_, err := rig.NewFleet(clients, rig.WithParallelism(3)).Each(context.Background(), func(_ context.Context, _ *rig.Client) error {
+		mu.Lock()
+		running++
+		maxSeen = max(maxSeen, running)
+		mu.Unlock()
+		<-released
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3, maxSeen)
+}
+
+func TestFleetCanceledContext(t *testing.T) {
+	clients, _ := newFleetClients(t, 2)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results, err := rig.NewFleet(clients).Each(ctx, func(_ context.Context, _ *rig.Client) error {
+		return nil
+	})
+	require.ErrorIs(t, err, context.Canceled)
+	for _, res := range results {
+		require.ErrorIs(t, res.Err, context.Canceled)
+	}
+}
@@ -44,6 +44,9 @@ const (
 	// KeySudo is a boolean indicating whether a command is run with sudo.
 	KeySudo = "sudo"
 
+	// KeyRunAs is the user a command is run as.
+	KeyRunAs = "runAs"
+
 	// KeyProtocol is a network protocol.
 	KeyProtocol = "protocol"
 
@@ -46,6 +46,17 @@ type ProcessStarter interface {
 	StartProcess(ctx context.Context, cmd string, stdin io.Reader, stdout io.Writer, stderr io.Writer) (Waiter, error)
 }
 
+// EnvStarter is a connection that can set environment variables for a
+// process without modifying the command, such as through SSH "env" requests.
+type EnvStarter interface {
+	// AcceptsEnv reports whether the host accepts all of the named
+	// variables. It may probe the host the first time a name is seen.
+	AcceptsEnv(ctx context.Context, names []string) bool
+	// StartProcessEnv is like ProcessStarter.StartProcess but sets env for
+	// the process.
+	StartProcessEnv(ctx context.Context, cmd string, env map[string]string, stdin io.Reader, stdout io.Writer, stderr io.Writer) (Waiter, error)
+}
+
 // Connector is a connection that can be established.
 type Connector interface {
 	Connect(ctx context.Context) error
@@ -61,6 +72,12 @@ type WindowsChecker interface {
 	IsWindows() bool
 }
 
+// LoginPassworder is a connection that knows the password of the user it logs
+// in as, which the host may ask for again, such as sudo does.
+type LoginPassworder interface {
+	LoginPassword() (string, error)
+}
+
 // InteractiveExecer is a connection that can start an interactive session.
 //
 // All implementations guarantee:
@@ -75,6 +92,12 @@ type InteractiveExecer interface {
 	ExecInteractive(ctx context.Context, cmd string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error
 }
 
+// SubsystemOpener is a connection that can start a named subsystem on the
+// remote host, such as "sftp" on SSH, and talk to it over a stream.
+type SubsystemOpener interface {
+	OpenSubsystem(name string) (io.ReadWriteCloser, error)
+}
+
 // Connection is the minimum interface for protocol implementations.
 type Connection interface {
 	fmt.Stringer
@@ -3,16 +3,26 @@ package localhost
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"os"
 	"os/exec"
 	"runtime"
+	"slices"
+	"time"
 
 	"github.com/k0sproject/rig/v2/protocol"
 	"github.com/k0sproject/rig/v2/sh/shellescape"
 )
 
+var errEmptyCommand = errors.New("empty command")
+
+// terminateGrace is the time a process is given to exit after SIGTERM when
+// its context is cancelled, before it is killed.
+const terminateGrace = 5 * time.Second
+
 // Connection is a direct localhost connection.
 type Connection struct{}
 
@@ -61,28 +71,80 @@ func (c *Connection) IsConnected() bool {
 func (c *Connection) StartProcess(ctx context.Context, cmd string, stdin io.Reader, stdout, stderr io.Writer) (protocol.Waiter, error) {
 	command := c.command(ctx, cmd)
 
-	command.Stdin = stdin
 	command.Stdout = stdout
 	command.Stderr = stderr
 
-	if err := command.Start(); err != nil {
-		return nil, fmt.Errorf("start command: %w", err)
+	return startProcess(command, stdin)
+}
+
+// AcceptsEnv returns true, any environment variable can be set for a local
+// process.
+func (c *Connection) AcceptsEnv(context.Context, []string) bool {
+	return true
+}
+
+// StartProcessEnv is like StartProcess but adds env to the environment of the
+// process.
+func (c *Connection) StartProcessEnv(ctx context.Context, cmd string, env map[string]string, stdin io.Reader, stdout, stderr io.Writer) (protocol.Waiter, error) {
+	command := c.command(ctx, cmd)
+	command.Env = os.Environ()
+	for _, name := range slices.Sorted(maps.Keys(env)) {
+		command.Env = append(command.Env, name+"="+env[name])
 	}
 
-	return command, nil
+	command.Stdout = stdout
+	command.Stderr = stderr
+
+	return startProcess(command, stdin)
 }
 
 func (c *Connection) command(ctx context.Context, cmd string) *exec.Cmd {
+	var command *exec.Cmd
 	if c.IsWindows() {
-		return exec.CommandContext(ctx, "cmd.exe", "/c", cmd)
+		command = exec.CommandContext(ctx, "cmd.exe", "/c", cmd)
+	} else {
+		command = exec.CommandContext(ctx, "sh", "-c", "--", cmd)
 	}
+	command.Cancel = func() error { return terminate(command.Process) }
+	return command
+}
 
-	return exec.CommandContext(ctx, "sh", "-c", "--", cmd)
+// terminate asks proc to exit with SIGTERM and kills it if it is still
+// running after terminateGrace. Where SIGTERM can't be sent, as on windows,
+// proc is killed right away.
+func terminate(proc *os.Process) error {
+	sig, ok := osSignal(protocol.SIGTERM)
+	if !ok {
+		return proc.Kill() //nolint:wrapcheck // exec.Cmd inspects the error
+	}
+	time.AfterFunc(terminateGrace, func() { _ = proc.Kill() })
+	return proc.Signal(sig) //nolint:wrapcheck // exec.Cmd inspects the error
 }
 
 // ExecInteractive executes a command on the host and passes stdin/stdout/stderr as-is to the session.
-// The process is killed when ctx is cancelled. Nil streams default to os.Stdin/os.Stdout/os.Stderr.
-func (c *Connection) ExecInteractive(ctx context.Context, cmd string, stdin io.Reader, stdout, stderr io.Writer) error { //nolint:cyclop
+// The process is terminated when ctx is cancelled. Nil streams default to os.Stdin/os.Stdout/os.Stderr.
+func (c *Connection) ExecInteractive(ctx context.Context, cmd string, stdin io.Reader, stdout, stderr io.Writer) error {
+	return c.ExecInteractiveSession(ctx, cmd, stdin, stdout, stderr, protocol.SessionOptions{})
+}
+
+// SessionSupport reports the session options supported on the local host. A
+// pseudo terminal, its size and resizing are supported on POSIX systems.
+// Terminal modes are not supported.
+func (c *Connection) SessionSupport() protocol.SessionSupport {
+	return protocol.SessionSupport{
+		PTY:     ptySupported,
+		Term:    true,
+		Size:    ptySupported,
+		Resize:  ptySupported,
+		Signals: supportedSignals,
+	}
+}
+
+// ExecInteractiveSession is like ExecInteractive but configures the session
+// with opts. With PTYForce, the process runs in a new session on a local
+// pseudo terminal. Otherwise the streams are passed to the process as-is and
+// a stdin terminal is inherited. Signals are sent to the process.
+func (c *Connection) ExecInteractiveSession(ctx context.Context, cmd string, stdin io.Reader, stdout, stderr io.Writer, opts protocol.SessionOptions) error { //nolint:cyclop
 	if stdin == nil {
 		stdin = os.Stdin
 	}
@@ -105,6 +167,15 @@ func (c *Connection) ExecInteractive(ctx context.Context, cmd string, stdin io.R
 		return fmt.Errorf("failed to get current working directory: %w", err)
 	}
 
+	var env []string
+	if opts.Term != "" {
+		env = append(os.Environ(), "TERM="+opts.Term)
+	}
+
+	if opts.PTY == protocol.PTYForce && ptySupported {
+		return execPTY(ctx, cmd, cwd, env, stdin, stdout, opts)
+	}
+
 	// try to cast the streams to files, if they are not files, use pipes
 	var stdinR, stdoutW, stderrW *os.File
 	if f, ok := stdin.(*os.File); ok {
@@ -150,29 +221,31 @@ func (c *Connection) ExecInteractive(ctx context.Context, cmd string, stdin io.R
 	procAttr := &os.ProcAttr{
 		Files: []*os.File{stdinR, stdoutW, stderrW},
 		Dir:   cwd,
+		Env:   env,
 	}
 
-	parts, err := shellescape.Split(cmd)
+	path, argv, err := parseCommand(cmd)
 	if err != nil {
-		return fmt.Errorf("failed to parse command: %w", err)
+		return err
 	}
 
-	proc, err := os.StartProcess(parts[0], parts[1:], procAttr) //nolint:gosec // G702: intentional command execution from parsed arguments
+	proc, err := os.StartProcess(path, argv, procAttr) //nolint:gosec // G702: intentional command execution from parsed arguments
 	if err != nil {
 		return fmt.Errorf("failed to start process: %w", err)
 	}
 
-	// Kill the process when the context is done, but also stop watching when
-	// the function returns normally so that the goroutine does not leak.
+	// Terminate the process when the context is done, but also stop watching
+	// when the function returns normally so that the goroutine does not leak.
 	watchDone := make(chan struct{})
 	defer close(watchDone)
 	go func() {
 		select {
 		case <-ctx.Done():
-			_ = proc.Kill()
+			_ = terminate(proc)
 		case <-watchDone:
 		}
 	}()
+	go relaySignals(proc, opts.Signals, watchDone)
 
 	if _, err := proc.Wait(); err != nil {
 		if ctx.Err() != nil {
@@ -182,3 +255,40 @@ func (c *Connection) ExecInteractive(ctx context.Context, cmd string, stdin io.R
 	}
 	return nil
 }
+
+// parseCommand splits cmd into arguments and looks up the executable in PATH.
+func parseCommand(cmd string) (string, []string, error) {
+	argv, err := shellescape.Split(cmd)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to parse command: %w", err)
+	}
+	if len(argv) == 0 {
+		return "", nil, fmt.Errorf("failed to parse command: %w", errEmptyCommand)
+	}
+	path, err := exec.LookPath(argv[0])
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to find command: %w", err)
+	}
+	return path, argv, nil
+}
+
+// relaySignals sends the signals received from signals to proc until done is
+// closed. Signals the system can't deliver are dropped.
+func relaySignals(proc *os.Process, signals <-chan protocol.Signal, done <-chan struct{}) {
+	if signals == nil {
+		return
+	}
+	for {
+		select {
+		case <-done:
+			return
+		case sig, ok := <-signals:
+			if !ok {
+				return
+			}
+			if s, ok := osSignal(sig); ok {
+				_ = proc.Signal(s)
+			}
+		}
+	}
+}
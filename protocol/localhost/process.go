@@ -0,0 +1,98 @@
+package localhost
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+
+	"github.com/k0sproject/rig/v2/protocol"
+)
+
+var (
+	_ protocol.Signaler     = (*process)(nil)
+	_ protocol.StdinCloser  = (*process)(nil)
+	_ protocol.PIDReporter  = (*process)(nil)
+	_ protocol.ExitStatuser = (*process)(nil)
+)
+
+// process is a command started on the local host.
+type process struct {
+	cmd       *exec.Cmd
+	stdin     io.WriteCloser
+	closeOnce sync.Once
+}
+
+// startProcess starts cmd, copying stdin to it through a pipe that can be
+// closed with CloseStdin.
+func startProcess(cmd *exec.Cmd, stdin io.Reader) (*process, error) {
+	proc := &process{cmd: cmd}
+	if stdin != nil {
+		pipe, err := cmd.StdinPipe()
+		if err != nil {
+			return nil, fmt.Errorf("stdin pipe: %w", err)
+		}
+		proc.stdin = pipe
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start command: %w", err)
+	}
+	if stdin != nil {
+		go func() {
+			_, _ = io.Copy(proc.stdin, stdin)
+			_ = proc.CloseStdin()
+		}()
+	}
+	return proc, nil
+}
+
+// Wait waits for the process to exit.
+func (p *process) Wait() error {
+	return p.cmd.Wait() //nolint:wrapcheck // the exit error is inspected by callers
+}
+
+// PID returns the process id of the shell running the command.
+func (p *process) PID() int {
+	return p.cmd.Process.Pid
+}
+
+// Signal sends sig to the process.
+func (p *process) Signal(sig protocol.Signal) error {
+	s, ok := osSignal(sig)
+	if !ok {
+		return fmt.Errorf("%w: signal %s", protocol.ErrUnsupported, sig)
+	}
+	if err := p.cmd.Process.Signal(s); err != nil {
+		return fmt.Errorf("signal %s: %w", sig, err)
+	}
+	return nil
+}
+
+// CloseStdin closes the stdin of the process.
+func (p *process) CloseStdin() error {
+	if p.stdin == nil {
+		return nil
+	}
+	var err error
+	p.closeOnce.Do(func() { err = p.stdin.Close() })
+	if err != nil {
+		return fmt.Errorf("close stdin: %w", err)
+	}
+	return nil
+}
+
+// ExitCode returns the exit code of the process.
+func (p *process) ExitCode() int {
+	if p.cmd.ProcessState == nil {
+		return -1
+	}
+	return p.cmd.ProcessState.ExitCode()
+}
+
+// ExitSignal returns the signal that terminated the process.
+func (p *process) ExitSignal() protocol.Signal {
+	if p.cmd.ProcessState == nil {
+		return ""
+	}
+	return exitSignal(p.cmd.ProcessState)
+}
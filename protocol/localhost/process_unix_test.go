@@ -0,0 +1,68 @@
+//go:build !windows
+
+package localhost
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/k0sproject/rig/v2/protocol"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessSignal(t *testing.T) {
+	c, err := NewConnection()
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	waiter, err := c.StartProcess(ctx, "sleep 30", nil, nil, nil)
+	require.NoError(t, err)
+	proc, ok := waiter.(*process)
+	require.True(t, ok)
+	require.Positive(t, proc.PID())
+	require.NoError(t, proc.Signal(protocol.SIGTERM))
+	require.Error(t, proc.Wait())
+	require.Equal(t, -1, proc.ExitCode())
+	require.Equal(t, protocol.SIGTERM, proc.ExitSignal())
+}
+
+func TestProcessCloseStdin(t *testing.T) {
+	c, err := NewConnection()
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// the reader never reaches EOF, cat only exits when stdin is closed
+	stdinR, stdinW := io.Pipe()
+	defer stdinW.Close()
+	waiter, err := c.StartProcess(ctx, "cat; exit 3", stdinR, nil, nil)
+	require.NoError(t, err)
+	proc, ok := waiter.(*process)
+	require.True(t, ok)
+	require.NoError(t, proc.CloseStdin())
+	require.Error(t, proc.Wait())
+	require.Equal(t, 3, proc.ExitCode())
+	require.Empty(t, proc.ExitSignal())
+}
+
+func TestProcessCancelTerminates(t *testing.T) {
+	c, err := NewConnection()
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stdoutR, stdoutW := io.Pipe()
+	waiter, err := c.StartProcess(ctx, "trap 'echo cleaning up; exit 0' TERM; echo started; while true; do sleep 0.1; done", nil, stdoutW, nil)
+	require.NoError(t, err)
+	lines := bufio.NewScanner(stdoutR)
+	require.True(t, lines.Scan())
+	require.Equal(t, "started", lines.Text())
+	cancel()
+	require.True(t, lines.Scan())
+	require.Equal(t, "cleaning up", lines.Text(), "the process gets to clean up")
+	_ = waiter.Wait()
+}
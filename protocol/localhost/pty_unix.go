@@ -0,0 +1,148 @@
+//go:build !windows
+
+package localhost
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+
+	"github.com/creack/pty"
+	"github.com/k0sproject/rig/v2/protocol"
+	"golang.org/x/term"
+)
+
+const ptySupported = true
+
+var supportedSignals = protocol.AllSignals
+
+var signals = map[protocol.Signal]syscall.Signal{
+	protocol.SIGABRT: syscall.SIGABRT,
+	protocol.SIGALRM: syscall.SIGALRM,
+	protocol.SIGFPE:  syscall.SIGFPE,
+	protocol.SIGHUP:  syscall.SIGHUP,
+	protocol.SIGILL:  syscall.SIGILL,
+	protocol.SIGINT:  syscall.SIGINT,
+	protocol.SIGKILL: syscall.SIGKILL,
+	protocol.SIGPIPE: syscall.SIGPIPE,
+	protocol.SIGQUIT: syscall.SIGQUIT,
+	protocol.SIGSEGV: syscall.SIGSEGV,
+	protocol.SIGTERM: syscall.SIGTERM,
+	protocol.SIGUSR1: syscall.SIGUSR1,
+	protocol.SIGUSR2: syscall.SIGUSR2,
+}
+
+func osSignal(sig protocol.Signal) (os.Signal, bool) {
+	s, ok := signals[sig]
+	return s, ok
+}
+
+// exitSignal returns the signal that terminated a process.
+func exitSignal(state *os.ProcessState) protocol.Signal {
+	ws, ok := state.Sys().(syscall.WaitStatus)
+	if !ok || !ws.Signaled() {
+		return ""
+	}
+	for name, s := range signals {
+		if s == ws.Signal() {
+			return name
+		}
+	}
+	return ""
+}
+
+// execPTY runs cmd in a new session with a pseudo terminal as its
+// controlling terminal. Output is written to stdout, as a terminal has no
+// separate error stream. When stdin is a terminal, it is put into raw mode
+// for the duration of the session.
+func execPTY(ctx context.Context, cmd, dir string, env []string, stdin io.Reader, stdout io.Writer, opts protocol.SessionOptions) error { //nolint:cyclop
+	path, argv, err := parseCommand(cmd)
+	if err != nil {
+		return err
+	}
+
+	ptmx, tty, err := pty.Open()
+	if err != nil {
+		return fmt.Errorf("open pty: %w", err)
+	}
+	defer ptmx.Close()
+
+	size := opts.Size
+	inF, isFile := stdin.(*os.File)
+	localTerm := isFile && term.IsTerminal(int(inF.Fd()))
+	if localTerm && (size.Width <= 0 || size.Height <= 0) {
+		if width, height, err := term.GetSize(int(inF.Fd())); err == nil {
+			size = protocol.WindowSize{Width: width, Height: height}
+		}
+	}
+	if size.Width <= 0 {
+		size.Width = 80
+	}
+	if size.Height <= 0 {
+		size.Height = 24
+	}
+	resize := func(size protocol.WindowSize) {
+		_ = pty.Setsize(ptmx, &pty.Winsize{Rows: uint16(size.Height), Cols: uint16(size.Width)}) //nolint:gosec // G115: terminal sizes fit
+	}
+	resize(size)
+
+	proc, err := os.StartProcess(path, argv, &os.ProcAttr{ //nolint:gosec // G702: intentional command execution from parsed arguments
+		Dir:   dir,
+		Env:   env,
+		Files: []*os.File{tty, tty, tty},
+		Sys:   &syscall.SysProcAttr{Setsid: true, Setctty: true},
+	})
+	_ = tty.Close()
+	if err != nil {
+		return fmt.Errorf("failed to start process: %w", err)
+	}
+
+	if localTerm {
+		if old, err := term.MakeRaw(int(inF.Fd())); err == nil {
+			defer func() { _ = term.Restore(int(inF.Fd()), old) }()
+		}
+	}
+
+	go func() {
+		_, _ = io.Copy(ptmx, stdin)
+	}()
+	outputDone := make(chan struct{})
+	go func() {
+		defer close(outputDone)
+		// reading fails once the process and its children have closed the pty
+		_, _ = io.Copy(stdout, ptmx)
+	}()
+
+	watchDone := make(chan struct{})
+	defer close(watchDone)
+	go func() {
+		resizeCh := opts.Resize
+		for {
+			select {
+			case <-ctx.Done():
+				_ = terminate(proc)
+				return
+			case <-watchDone:
+				return
+			case size, ok := <-resizeCh:
+				if !ok {
+					resizeCh = nil
+					continue
+				}
+				resize(size)
+			}
+		}
+	}()
+	go relaySignals(proc, opts.Signals, watchDone)
+
+	if _, err := proc.Wait(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err() //nolint:wrapcheck // context error is the real cause
+		}
+		return fmt.Errorf("process wait: %w", err)
+	}
+	<-outputDone
+	return nil
+}
@@ -0,0 +1,43 @@
+//go:build !windows
+
+package localhost
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/k0sproject/rig/v2/protocol"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecInteractiveSessionPTY(t *testing.T) {
+	c, err := NewConnection()
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var out bytes.Buffer
+	opts := protocol.NewSessionOptions(
+		protocol.WithPTY(protocol.PTYForce),
+		protocol.WithTerm("vt100"),
+		protocol.WithWindowSize(100, 30),
+	)
+	require.NoError(t, c.ExecInteractiveSession(ctx, `sh -c 'stty size; echo "$TERM"; test -t 0 && echo tty'`, strings.NewReader(""), &out, nil, opts))
+	require.Equal(t, "30 100\r\nvt100\r\ntty\r\n", out.String())
+}
+
+func TestExecInteractiveSessionSignals(t *testing.T) {
+	c, err := NewConnection()
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	signals := make(chan protocol.Signal, 1)
+	signals <- protocol.SIGTERM
+	started := time.Now()
+	require.NoError(t, c.ExecInteractiveSession(ctx, "sleep 30", strings.NewReader(""), &bytes.Buffer{}, &bytes.Buffer{}, protocol.SessionOptions{Signals: signals}))
+	require.Less(t, time.Since(started), 10*time.Second)
+}
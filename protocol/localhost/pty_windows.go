@@ -0,0 +1,36 @@
+//go:build windows
+
+package localhost
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/k0sproject/rig/v2/protocol"
+)
+
+// ptySupported is false, ConPTY is not implemented.
+const ptySupported = false
+
+var supportedSignals = []protocol.Signal{protocol.SIGKILL}
+
+var errPTYUnsupported = errors.New("pty is not supported on windows")
+
+func osSignal(sig protocol.Signal) (os.Signal, bool) {
+	if sig == protocol.SIGKILL {
+		return os.Kill, true
+	}
+	return nil, false
+}
+
+// exitSignal returns an empty string, processes are not terminated by signals
+// on windows.
+func exitSignal(*os.ProcessState) protocol.Signal {
+	return ""
+}
+
+func execPTY(context.Context, string, string, []string, io.Reader, io.Writer, protocol.SessionOptions) error {
+	return errPTYUnsupported
+}
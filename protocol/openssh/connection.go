@@ -378,6 +378,20 @@ func (c *Connection) closeControl() error {
 
 // StartProcess executes a command on the remote host, streaming stdin, stdout and stderr.
 func (c *Connection) StartProcess(ctx context.Context, cmdStr string, stdin io.Reader, stdout, stderr io.Writer) (protocol.Waiter, error) {
+	cmd, err := c.sshCommand(ctx, cmdStr)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	return startProcess(cmd, stdin)
+}
+
+// sshCommand returns the ssh command that runs cmdStr on the host. The extra
+// args are passed to ssh before the destination.
+func (c *Connection) sshCommand(ctx context.Context, cmdStr string, extra ...string) (*exec.Cmd, error) {
 	c.controlMutex.Lock()
 	connected := c.isConnected
 	c.controlMutex.Unlock()
@@ -387,28 +401,85 @@ func (c *Connection) StartProcess(ctx context.Context, cmdStr string, stdin io.R
 
 	args := c.Options.ToArgs()
 	args = append(args, "-o", "BatchMode=yes")
+	args = append(args, extra...)
 	args = append(args, c.args()...)
 	args = append(args, "--", cmdStr)
-	cmd := exec.CommandContext(ctx, "ssh", args...)
-
-	cmd.Stdin = stdin
-	cmd.Stdout = stdout
-	cmd.Stderr = stderr
-
-	if err := cmd.Start(); err != nil {
-		return nil, fmt.Errorf("start command: %w", err)
-	}
-
-	return cmd, nil
+	return exec.CommandContext(ctx, "ssh", args...), nil
 }
 
 // ExecInteractive executes a command on the host and passes stdin/stdout/stderr as-is to the session.
 // The session is terminated when ctx is cancelled.
 func (c *Connection) ExecInteractive(ctx context.Context, cmdStr string, stdin io.Reader, stdout, stderr io.Writer) error {
-	cmd, err := c.StartProcess(ctx, cmdStr, stdin, stdout, stderr)
+	return c.ExecInteractiveSession(ctx, cmdStr, stdin, stdout, stderr, protocol.SessionOptions{})
+}
+
+// ptyControlChars are the control characters that the remote line discipline
+// of a PTY turns into signals.
+var ptyControlChars = map[protocol.Signal]byte{
+	protocol.SIGINT:  0x03,
+	protocol.SIGQUIT: 0x1c,
+}
+
+// SessionSupport reports the session options the ssh client can honor. The
+// terminal size, modes and resizing are handled by the ssh client itself
+// from the terminal it runs in. Signals are delivered as control characters,
+// which only works when a PTY is allocated.
+func (c *Connection) SessionSupport() protocol.SessionSupport {
+	return protocol.SessionSupport{
+		PTY:     true,
+		Term:    true,
+		Signals: []protocol.Signal{protocol.SIGINT, protocol.SIGQUIT},
+	}
+}
+
+// ExecInteractiveSession is like ExecInteractive but runs ssh with -tt for
+// PTYForce and -T for PTYNever. The terminal type is passed to ssh in the
+// TERM environment variable.
+func (c *Connection) ExecInteractiveSession(ctx context.Context, cmdStr string, stdin io.Reader, stdout, stderr io.Writer, opts protocol.SessionOptions) error {
+	var extra []string
+	switch opts.PTY {
+	case protocol.PTYForce:
+		extra = append(extra, "-tt")
+	case protocol.PTYNever:
+		extra = append(extra, "-T")
+	case protocol.PTYAuto:
+	}
+	cmd, err := c.sshCommand(ctx, cmdStr, extra...)
 	if err != nil {
 		return err
 	}
+	if opts.Term != "" {
+		cmd.Env = append(os.Environ(), "TERM="+opts.Term)
+	}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	var stdinPipe io.WriteCloser
+	if opts.Signals != nil && opts.PTY != protocol.PTYNever {
+		// the control characters are written into the input stream
+		stdinPipe, err = cmd.StdinPipe()
+		if err != nil {
+			return fmt.Errorf("get stdin pipe: %w", err)
+		}
+	} else {
+		cmd.Stdin = stdin
+	}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("start command: %w", err)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	if stdinPipe != nil {
+		if stdin != nil {
+			go func() {
+				_, _ = io.Copy(stdinPipe, stdin)
+				_ = stdinPipe.Close()
+			}()
+		}
+		go relayControlChars(stdinPipe, opts.Signals, done)
+	}
 	if err := cmd.Wait(); err != nil {
 		if ctx.Err() != nil {
 			return ctx.Err() //nolint:wrapcheck // context error is the real cause
@@ -418,6 +489,25 @@ func (c *Connection) ExecInteractive(ctx context.Context, cmdStr string, stdin i
 	return nil
 }
 
+// relayControlChars writes the control character of each signal received
+// from signals to w until done is closed. Signals without a control character
+// are dropped.
+func relayControlChars(w io.Writer, signals <-chan protocol.Signal, done <-chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case sig, ok := <-signals:
+			if !ok {
+				return
+			}
+			if char, ok := ptyControlChars[sig]; ok {
+				_, _ = w.Write([]byte{char})
+			}
+		}
+	}
+}
+
 func (c *Connection) String() string {
 	if c.name != "" {
 		return c.name
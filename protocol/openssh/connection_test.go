@@ -3,6 +3,7 @@ package openssh
 import (
 	"context"
 	"errors"
+	"io"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -272,3 +273,55 @@ func TestConnectDoesNotWaitForControlMaster(t *testing.T) {
 	require.Less(t, elapsed, connectBudget, "Connect waited for the backgrounded control master to exit")
 	require.True(t, conn.IsConnected(), "connection should report as established after Connect")
 }
+
+// fakeInteractiveSSH prints its arguments, the terminal type and what it reads
+// from stdin as hex.
+const fakeInteractiveSSH = `#!/bin/sh
+echo "args: $*"
+echo "term: $TERM"
+echo "stdin: $(od -An -tx1 | tr -d ' \n')"
+`
+
+func TestExecInteractiveSession(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake ssh client is a POSIX shell script")
+	}
+
+	binDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(binDir, "ssh"), []byte(fakeInteractiveSSH), 0o755)) //nolint:gosec // the fake client has to be executable
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	conn, err := NewConnection(Config{Address: "127.0.0.1", DisableMultiplexing: true})
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	t.Run("pty and terminal type", func(t *testing.T) {
+		signals := make(chan protocol.Signal, 2)
+		signals <- protocol.SIGINT
+		signals <- protocol.SIGTERM // no control character, dropped
+		stdin, stdinW := io.Pipe()
+		go func() {
+			// let the signals through before the input ends
+			time.Sleep(300 * time.Millisecond)
+			_, _ = stdinW.Write([]byte("q"))
+			_ = stdinW.Close()
+		}()
+		var out strings.Builder
+		opts := protocol.NewSessionOptions(protocol.WithPTY(protocol.PTYForce), protocol.WithTerm("vt100"), protocol.WithSignals(signals))
+		require.NoError(t, conn.ExecInteractiveSession(ctx, "top", stdin, &out, nil, opts))
+		require.Contains(t, out.String(), "args: ")
+		require.Contains(t, out.String(), " -tt ")
+		require.Contains(t, out.String(), "-- top\n")
+		require.Contains(t, out.String(), "term: vt100\n")
+		require.Contains(t, out.String(), "stdin: 0371\n")
+	})
+
+	t.Run("no pty", func(t *testing.T) {
+		var out strings.Builder
+		opts := protocol.NewSessionOptions(protocol.WithPTY(protocol.PTYNever))
+		require.NoError(t, conn.ExecInteractiveSession(ctx, "top", strings.NewReader("q"), &out, nil, opts))
+		require.Contains(t, out.String(), " -T ")
+		require.Contains(t, out.String(), "stdin: 71\n")
+	})
+}
@@ -0,0 +1,81 @@
+package openssh
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+
+	"github.com/k0sproject/rig/v2/protocol"
+)
+
+var (
+	_ protocol.StdinCloser  = (*process)(nil)
+	_ protocol.ExitStatuser = (*process)(nil)
+)
+
+// process is a command running through the ssh client. The ssh client can't
+// deliver signals or report the remote process id, so process implements
+// neither.
+type process struct {
+	cmd       *exec.Cmd
+	stdin     io.WriteCloser
+	closeOnce sync.Once
+}
+
+// startProcess starts the ssh client, copying stdin to it through a pipe that
+// can be closed with CloseStdin.
+func startProcess(cmd *exec.Cmd, stdin io.Reader) (*process, error) {
+	proc := &process{cmd: cmd}
+	if stdin != nil {
+		pipe, err := cmd.StdinPipe()
+		if err != nil {
+			return nil, fmt.Errorf("stdin pipe: %w", err)
+		}
+		proc.stdin = pipe
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start command: %w", err)
+	}
+	if stdin != nil {
+		go func() {
+			_, _ = io.Copy(proc.stdin, stdin)
+			_ = proc.CloseStdin()
+		}()
+	}
+	return proc, nil
+}
+
+// Wait waits for the ssh client to exit.
+func (p *process) Wait() error {
+	return p.cmd.Wait() //nolint:wrapcheck // the exit error is inspected by callers
+}
+
+// CloseStdin closes the stdin of the ssh client, which closes the stdin of the
+// remote process.
+func (p *process) CloseStdin() error {
+	if p.stdin == nil {
+		return nil
+	}
+	var err error
+	p.closeOnce.Do(func() { err = p.stdin.Close() })
+	if err != nil {
+		return fmt.Errorf("close stdin: %w", err)
+	}
+	return nil
+}
+
+// ExitCode returns the exit code of the ssh client, which is the exit code of
+// the remote command or 255 when the ssh client itself failed.
+func (p *process) ExitCode() int {
+	if p.cmd.ProcessState == nil {
+		return -1
+	}
+	return p.cmd.ProcessState.ExitCode()
+}
+
+// ExitSignal returns an empty string, the ssh client does not report the
+// signal that terminated the remote process.
+func (p *process) ExitSignal() protocol.Signal {
+	return ""
+}
@@ -0,0 +1,38 @@
+package protocol
+
+import "errors"
+
+// ErrUnsupported is returned when a process started on a connection does not
+// support an operation, such as delivering a particular signal.
+var ErrUnsupported = errors.New("not supported by the connection")
+
+// The interfaces below are optional extensions of the Waiter returned by
+// ProcessStarter.StartProcess. The built-in connections implement the ones
+// their protocol allows.
+
+// Signaler is a process that can be sent a signal. Implementations return an
+// error wrapping ErrUnsupported for signals they can not deliver.
+type Signaler interface {
+	Signal(sig Signal) error
+}
+
+// StdinCloser is a process whose stdin can be closed before its input reader
+// is exhausted, to signal the end of input to the remote process.
+type StdinCloser interface {
+	CloseStdin() error
+}
+
+// PIDReporter is a process that knows its process id on the host.
+type PIDReporter interface {
+	PID() int
+}
+
+// ExitStatuser is a process that reports how it exited once Wait has returned.
+type ExitStatuser interface {
+	// ExitCode returns the exit code of the process, or -1 if the process
+	// has not exited or was terminated by a signal.
+	ExitCode() int
+	// ExitSignal returns the signal that terminated the process, or an empty
+	// string if it exited normally or the signal is not known.
+	ExitSignal() Signal
+}
@@ -0,0 +1,202 @@
+package protocol
+
+import (
+	"context"
+	"errors"
+	"io"
+	"slices"
+)
+
+// ErrUnsupportedSessionOption is returned when strict session options request
+// a feature the connection can not provide.
+var ErrUnsupportedSessionOption = errors.New("unsupported session option")
+
+// PTYMode selects whether an interactive session gets a pseudo terminal.
+type PTYMode int
+
+const (
+	// PTYAuto allocates a pseudo terminal when stdin is a terminal.
+	PTYAuto PTYMode = iota
+	// PTYForce allocates a pseudo terminal even when stdin is not a terminal,
+	// like ssh -tt.
+	PTYForce
+	// PTYNever never allocates a pseudo terminal, like ssh -T.
+	PTYNever
+)
+
+// Signal is the name of a signal without the "SIG" prefix, as defined for the
+// SSH "signal" channel request in RFC 4254 section 6.10.
+type Signal string
+
+// The signals defined in RFC 4254.
+const (
+	SIGABRT Signal = "ABRT"
+	SIGALRM Signal = "ALRM"
+	SIGFPE  Signal = "FPE"
+	SIGHUP  Signal = "HUP"
+	SIGILL  Signal = "ILL"
+	SIGINT  Signal = "INT"
+	SIGKILL Signal = "KILL"
+	SIGPIPE Signal = "PIPE"
+	SIGQUIT Signal = "QUIT"
+	SIGSEGV Signal = "SEGV"
+	SIGTERM Signal = "TERM"
+	SIGUSR1 Signal = "USR1"
+	SIGUSR2 Signal = "USR2"
+)
+
+// AllSignals lists the signals defined in RFC 4254.
+var AllSignals = []Signal{SIGABRT, SIGALRM, SIGFPE, SIGHUP, SIGILL, SIGINT, SIGKILL, SIGPIPE, SIGQUIT, SIGSEGV, SIGTERM, SIGUSR1, SIGUSR2}
+
+// WindowSize is the size of a terminal in character cells.
+type WindowSize struct {
+	Width  int
+	Height int
+}
+
+// TerminalModes are terminal modes keyed by the opcodes of RFC 4254 section
+// 8. It has the same representation as ssh.TerminalModes in
+// golang.org/x/crypto/ssh.
+type TerminalModes map[uint8]uint32
+
+// SessionOptions configure an interactive session. The zero value reproduces
+// the default behavior of ExecInteractive.
+type SessionOptions struct {
+	// PTY selects whether a pseudo terminal is allocated.
+	PTY PTYMode
+	// Term is the terminal type. Defaults to $TERM or "xterm".
+	Term string
+	// Size is the initial terminal size. Defaults to the size of the stdin
+	// terminal or 80x24.
+	Size WindowSize
+	// Modes are the terminal modes of the pseudo terminal. Defaults to a
+	// protocol specific set of modes.
+	Modes TerminalModes
+	// Resize delivers terminal size changes. When nil, the size changes of a
+	// stdin terminal are followed where the protocol supports it.
+	Resize <-chan WindowSize
+	// Signals delivers signals to the remote process. When nil, the local
+	// interrupt signal is relayed where the protocol supports it.
+	Signals <-chan Signal
+	// Strict makes ExecInteractive fail with ErrUnsupportedSessionOption when
+	// the connection can't honor an option instead of ignoring it.
+	Strict bool
+}
+
+// SessionOption is a functional option for SessionOptions.
+type SessionOption func(*SessionOptions)
+
+// NewSessionOptions creates SessionOptions with the given options applied.
+func NewSessionOptions(opts ...SessionOption) SessionOptions {
+	var options SessionOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+// WithPTY selects whether a pseudo terminal is allocated.
+func WithPTY(mode PTYMode) SessionOption {
+	return func(o *SessionOptions) {
+		o.PTY = mode
+	}
+}
+
+// WithTerm sets the terminal type, such as "xterm-256color".
+func WithTerm(term string) SessionOption {
+	return func(o *SessionOptions) {
+		o.Term = term
+	}
+}
+
+// WithWindowSize sets the initial terminal size.
+func WithWindowSize(width, height int) SessionOption {
+	return func(o *SessionOptions) {
+		o.Size = WindowSize{Width: width, Height: height}
+	}
+}
+
+// WithTerminalModes sets the terminal modes of the pseudo terminal.
+func WithTerminalModes(modes TerminalModes) SessionOption {
+	return func(o *SessionOptions) {
+		o.Modes = modes
+	}
+}
+
+// WithResize delivers terminal size changes from ch to the session.
+func WithResize(ch <-chan WindowSize) SessionOption {
+	return func(o *SessionOptions) {
+		o.Resize = ch
+	}
+}
+
+// WithSignals delivers signals from ch to the remote process.
+func WithSignals(ch <-chan Signal) SessionOption {
+	return func(o *SessionOptions) {
+		o.Signals = ch
+	}
+}
+
+// WithStrictSession makes requesting an option the connection can't honor an
+// error.
+func WithStrictSession() SessionOption {
+	return func(o *SessionOptions) {
+		o.Strict = true
+	}
+}
+
+// SessionSupport describes which SessionOptions a connection honors.
+type SessionSupport struct {
+	// PTY is true when a pseudo terminal can be allocated on request.
+	PTY bool
+	// Term is true when the terminal type can be set.
+	Term bool
+	// Size is true when the initial terminal size can be set.
+	Size bool
+	// Modes is true when terminal modes can be set.
+	Modes bool
+	// Resize is true when terminal size changes can be delivered.
+	Resize bool
+	// Signals lists the signals that can be delivered to the remote process.
+	Signals []Signal
+}
+
+// SupportsSignal returns true if sig can be delivered.
+func (s SessionSupport) SupportsSignal(sig Signal) bool {
+	return slices.Contains(s.Signals, sig)
+}
+
+// Unsupported returns the names of the options set in opts that s does not
+// support.
+func (s SessionSupport) Unsupported(opts SessionOptions) []string {
+	var unsupported []string
+	if opts.PTY == PTYForce && !s.PTY {
+		unsupported = append(unsupported, "pty")
+	}
+	if opts.Term != "" && !s.Term {
+		unsupported = append(unsupported, "terminal type")
+	}
+	if opts.Size != (WindowSize{}) && !s.Size {
+		unsupported = append(unsupported, "window size")
+	}
+	if opts.Modes != nil && !s.Modes {
+		unsupported = append(unsupported, "terminal modes")
+	}
+	if opts.Resize != nil && !s.Resize {
+		unsupported = append(unsupported, "resize")
+	}
+	if opts.Signals != nil && len(s.Signals) == 0 {
+		unsupported = append(unsupported, "signals")
+	}
+	return unsupported
+}
+
+// SessionExecer is a connection that can start an interactive session with
+// SessionOptions. Options the connection does not support, as reported by
+// SessionSupport, are ignored. Signals the connection can't deliver are
+// dropped.
+type SessionExecer interface {
+	InteractiveExecer
+	SessionSupport() SessionSupport
+	ExecInteractiveSession(ctx context.Context, cmd string, stdin io.Reader, stdout io.Writer, stderr io.Writer, opts SessionOptions) error
+}
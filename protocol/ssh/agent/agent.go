@@ -10,6 +10,7 @@ import (
 	"net"
 	"os"
 
+	"golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/agent"
 )
 
@@ -39,3 +40,28 @@ func NewClientFromSocket(socketPath string) (agent.Agent, io.Closer, error) {
 	}
 	return agent.NewClient(conn), conn, nil
 }
+
+// Forward makes the agent at socketPath, or the one in SSH_AUTH_SOCK when
+// socketPath is empty, available to the remote host of client. Sessions that
+// request agent forwarding get their agent channels connected to a new
+// connection to the agent. The caller must close the returned io.Closer when
+// the client is closed.
+func Forward(client *ssh.Client, socketPath string) (io.Closer, error) {
+	if socketPath == "" {
+		socketPath = os.Getenv("SSH_AUTH_SOCK")
+	}
+	if socketPath == "" {
+		return nil, fmt.Errorf("%w: SSH_AUTH_SOCK is not set", ErrSSHAgent)
+	}
+	// check that the agent is there so that a missing one is reported now
+	// instead of on every forwarded channel
+	conn, err := net.Dial("unix", socketPath) //nolint:noctx // no context available in this function
+	if err != nil {
+		return nil, fmt.Errorf("%w: can't connect to ssh agent at %q: %w", ErrSSHAgent, socketPath, err)
+	}
+	_ = conn.Close()
+	if err := agent.ForwardToRemote(client, socketPath); err != nil {
+		return nil, fmt.Errorf("%w: forward: %w", ErrSSHAgent, err)
+	}
+	return io.NopCloser(nil), nil
+}
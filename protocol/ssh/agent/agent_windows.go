@@ -10,6 +10,7 @@ import (
 
 	"github.com/Microsoft/go-winio"
 	"github.com/davidmz/go-pageant"
+	"golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/agent"
 )
 
@@ -38,3 +39,21 @@ func NewClient() (agent.Agent, io.Closer, error) {
 func NewClientFromSocket(_ string) (agent.Agent, io.Closer, error) {
 	return NewClient()
 }
+
+// Forward on Windows ignores the socket path and makes the agent returned by
+// NewClient available to the remote host of client. The caller must close the
+// returned io.Closer when the client is closed.
+func Forward(client *ssh.Client, _ string) (io.Closer, error) {
+	sshAgent, closer, err := NewClient()
+	if err != nil {
+		return nil, err
+	}
+	if closer == nil {
+		closer = io.NopCloser(nil)
+	}
+	if err := agent.ForwardToAgent(client, sshAgent); err != nil {
+		_ = closer.Close()
+		return nil, fmt.Errorf("%w: forward: %w", ErrSSHAgent, err)
+	}
+	return closer, nil
+}
@@ -0,0 +1,68 @@
+package ssh
+
+import (
+	"context"
+
+	"github.com/k0sproject/rig/v2/log"
+	"github.com/k0sproject/rig/v2/protocol/ssh/agent"
+	ssh "golang.org/x/crypto/ssh"
+	cryptoagent "golang.org/x/crypto/ssh/agent"
+)
+
+// agentForwardSocket returns whether the agent is to be forwarded and the
+// socket of the agent to forward. An empty socket means SSH_AUTH_SOCK. Like
+// ssh(1), a ForwardAgent socket takes precedence over IdentityAgent, and
+// IdentityAgent "none" disables forwarding unless ForwardAgent names a socket.
+func (c *Connection) agentForwardSocket() (string, bool) {
+	forward := c.sshConfig.ForwardAgent
+	if forward.IsSocket() {
+		return forward.Socket(), true
+	}
+	if !forward.IsTrue() {
+		return "", false
+	}
+	if string(c.sshConfig.IdentityAgent) == sshConfigNone {
+		return "", false
+	}
+	return c.sshConfig.IdentityAgent.Socket(), true
+}
+
+// startAgentForwarding sets up the client of a freshly established connection
+// to serve agent forwarding requests when ForwardAgent is enabled. A local
+// agent that can't be reached is logged and the connection is used without
+// forwarding, as ssh(1) does.
+func (c *Connection) startAgentForwarding(ctx context.Context) {
+	socket, ok := c.agentForwardSocket()
+	if !ok {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.client == nil {
+		return
+	}
+	closer, err := agent.Forward(c.client, socket)
+	if err != nil {
+		c.Log().Warn("ssh agent forwarding disabled", log.ErrorAttr(err))
+		return
+	}
+	log.Trace(ctx, "ssh agent forwarding enabled", "socket", socket)
+	c.agentCloser = closer
+}
+
+// requestAgentForwarding asks the server to forward the agent to the session
+// when forwarding was set up for the connection. A server that refuses it,
+// for example because AllowAgentForwarding is disabled in sshd_config, does
+// not prevent the session from running.
+func (c *Connection) requestAgentForwarding(session *ssh.Session) {
+	c.mu.Lock()
+	enabled := c.agentCloser != nil
+	c.mu.Unlock()
+	if !enabled {
+		return
+	}
+	if err := cryptoagent.RequestAgentForwarding(session); err != nil {
+		c.Log().Debug("ssh agent forwarding request refused", log.ErrorAttr(err))
+	}
+}
@@ -0,0 +1,195 @@
+//go:build !windows
+
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/k0sproject/rig/v2/sshconfig/options"
+	"github.com/stretchr/testify/require"
+	ssh "golang.org/x/crypto/ssh"
+	cryptoagent "golang.org/x/crypto/ssh/agent"
+)
+
+// startLocalAgent serves an agent holding one key with the given comment on a
+// unix socket and returns the socket path.
+func startLocalAgent(t *testing.T, comment string) string {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	keyring := cryptoagent.NewKeyring()
+	require.NoError(t, keyring.Add(cryptoagent.AddedKey{PrivateKey: priv, Comment: comment}))
+
+	// t.TempDir can exceed the maximum length of a unix socket path
+	dir, err := os.MkdirTemp("", "rig-agent")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	sock := filepath.Join(dir, "agent.sock")
+	ln, err := net.Listen("unix", sock)
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_ = cryptoagent.ServeAgent(keyring, conn)
+			}()
+		}
+	}()
+	return sock
+}
+
+// serveAgentSession accepts a session channel and runs an "exec" request by
+// listing the keys of the forwarded agent, if the client asked for agent
+// forwarding, and writing their comments to stdout.
+func serveAgentSession(sconn *ssh.ServerConn, newChan ssh.NewChannel) {
+	ch, reqs, err := newChan.Accept()
+	if err != nil {
+		return
+	}
+	defer ch.Close()
+	forwarded := false
+	for req := range reqs {
+		switch req.Type {
+		case "auth-agent-req@openssh.com":
+			forwarded = true
+			_ = req.Reply(true, nil)
+		case "exec":
+			_ = req.Reply(true, nil)
+			var out bytes.Buffer
+			if forwarded {
+				out.WriteString(listForwardedKeys(sconn))
+			} else {
+				out.WriteString("no agent")
+			}
+			_, _ = ch.Write(out.Bytes())
+			_, _ = ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+			return
+		default:
+			if req.WantReply {
+				_ = req.Reply(false, nil)
+			}
+		}
+	}
+}
+
+func listForwardedKeys(sconn *ssh.ServerConn) string {
+	agentCh, agentReqs, err := sconn.OpenChannel("auth-agent@openssh.com", nil)
+	if err != nil {
+		return "open agent channel: " + err.Error()
+	}
+	defer agentCh.Close()
+	go ssh.DiscardRequests(agentReqs)
+	keys, err := cryptoagent.NewClient(agentCh).List()
+	if err != nil {
+		return "list keys: " + err.Error()
+	}
+	var out bytes.Buffer
+	for _, key := range keys {
+		fmt.Fprintln(&out, key.Comment)
+	}
+	return out.String()
+}
+
+// startAgentSSHServer starts a server whose session channels are served by
+// serveAgentSession.
+func startAgentSSHServer(t *testing.T, hostSigner ssh.Signer) string {
+	t.Helper()
+	return startSSHServerWith(t, newTestServerConfig(hostSigner), sshServerHandler{
+		channel: func(sconn *ssh.ServerConn, newChan ssh.NewChannel) {
+			if newChan.ChannelType() != "session" {
+				newChan.Reject(ssh.UnknownChannelType, "not supported") //nolint:errcheck
+				return
+			}
+			serveAgentSession(sconn, newChan)
+		},
+	})
+}
+
+func runOutput(t *testing.T, conn *Connection) string {
+	t.Helper()
+	var out bytes.Buffer
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	waiter, err := conn.StartProcess(ctx, "ssh-add -l", nil, &out, nil)
+	require.NoError(t, err)
+	require.NoError(t, waiter.Wait())
+	return out.String()
+}
+
+func TestForwardAgent(t *testing.T) {
+	hostSigner := newHostSigner(t)
+	addr := startAgentSSHServer(t, hostSigner)
+	sock := startLocalAgent(t, "operator key")
+
+	t.Run("socket from ssh config", func(t *testing.T) {
+		conn := connectTestServer(t, addr, hostSigner, map[string]any{"ForwardAgent": sock})
+		require.Equal(t, "operator key\n", runOutput(t, conn))
+	})
+
+	t.Run("SSH_AUTH_SOCK", func(t *testing.T) {
+		conn := connectTestServer(t, addr, hostSigner, map[string]any{"ForwardAgent": true})
+		// connectTestServer clears SSH_AUTH_SOCK, the agent is looked up when
+		// connecting
+		t.Setenv("SSH_AUTH_SOCK", sock)
+		require.NoError(t, conn.Connect(context.Background()))
+		require.Equal(t, "operator key\n", runOutput(t, conn))
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		conn := connectTestServer(t, addr, hostSigner, nil)
+		require.Equal(t, "no agent", runOutput(t, conn))
+	})
+
+	t.Run("agent not running", func(t *testing.T) {
+		conn := connectTestServer(t, addr, hostSigner, map[string]any{"ForwardAgent": sock + ".missing"})
+		require.Equal(t, "no agent", runOutput(t, conn), "the connection is used without forwarding")
+	})
+}
+
+func TestForwardAgentNativeField(t *testing.T) {
+	withConfigParser(t, "Host *\n  ForwardAgent no\n")
+	c, err := NewConnection(Config{Address: "127.0.0.1", User: "test", ForwardAgent: true})
+	require.NoError(t, err)
+	require.Equal(t, options.ForwardAgentYes, c.sshConfig.ForwardAgent, "the native field wins over ~/.ssh/config")
+}
+
+func TestAgentForwardSocket(t *testing.T) {
+	tests := []struct {
+		name          string
+		forwardAgent  options.ForwardAgentOption
+		identityAgent options.IdentityAgentOption
+		wantSocket    string
+		wantForward   bool
+	}{
+		{name: "unset"},
+		{name: "no", forwardAgent: options.ForwardAgentNo},
+		{name: "yes", forwardAgent: options.ForwardAgentYes, wantForward: true},
+		{name: "yes with IdentityAgent", forwardAgent: options.ForwardAgentYes, identityAgent: "/run/agent.sock", wantSocket: "/run/agent.sock", wantForward: true},
+		{name: "yes with IdentityAgent none", forwardAgent: options.ForwardAgentYes, identityAgent: "none"},
+		{name: "socket", forwardAgent: "/run/fwd.sock", identityAgent: "none", wantSocket: "/run/fwd.sock", wantForward: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newTestConnection(t)
+			c.sshConfig.ForwardAgent = tc.forwardAgent
+			c.sshConfig.IdentityAgent = tc.identityAgent
+			socket, forward := c.agentForwardSocket()
+			require.Equal(t, tc.wantForward, forward)
+			require.Equal(t, tc.wantSocket, socket)
+		})
+	}
+}
@@ -25,6 +25,13 @@ type Config struct {
 	Bastion              *Config          `yaml:"bastion,omitempty" json:"bastion,omitempty" jsonschema:"description=Optional bastion host"`
 	PasswordCallback     PasswordCallback `yaml:"-" json:"-"`
 
+	// ForwardAgent makes the local ssh agent available to the commands run on
+	// the remote host, so that for example "git clone" over SSH can use the
+	// operator's keys. It has the same effect as the ForwardAgent ssh_config
+	// option, which can also name the agent socket to forward. When false, the
+	// ssh config decides.
+	ForwardAgent bool `yaml:"forwardAgent,omitempty" json:"forwardAgent,omitempty" jsonschema:"description=Forward the local SSH agent to the remote host"`
+
 	// SSHConfigOptions provides supplementary ssh_config options that fill gaps not
 	// covered by the native fields above. They take priority over ~/.ssh/config but
 	// yield to any native field that is explicitly set. Keys are ssh_config directive
@@ -36,6 +43,13 @@ type Config struct {
 	// YAML key: options.
 	SSHConfigOptions sshconfig.OptionArguments `yaml:"options,omitempty" json:"options,omitempty" jsonschema:"description=Additional SSH options as ssh_config key-value pairs"`
 
+	// LoginPasswordCallback returns the password of User. When set, password
+	// authentication is tried after public key authentication, unless
+	// AuthMethods is set, and the password is what the connection reports as
+	// its login password, which sudo.ConnectionPassword passes on to sudo. The
+	// callback is called at most once per connection.
+	LoginPasswordCallback PasswordCallback `yaml:"-" json:"-"`
+
 	// AuthMethods can be used to pass in a list of crypto/ssh.AuthMethod objects
 	// for example to use a private key from memory:
 	//   ssh.PublicKeys(privateKey)
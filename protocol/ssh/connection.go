@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"net"
 	"os"
 	"os/exec"
@@ -22,6 +23,7 @@ import (
 	"github.com/k0sproject/rig/v2/protocol/ssh/agent"
 	"github.com/k0sproject/rig/v2/protocol/ssh/hostkey"
 	"github.com/k0sproject/rig/v2/sshconfig"
+	sshoptions "github.com/k0sproject/rig/v2/sshconfig/options"
 	ssh "golang.org/x/crypto/ssh"
 	cryptoagent "golang.org/x/crypto/ssh/agent"
 	"golang.org/x/term"
@@ -97,6 +99,19 @@ type Connection struct {
 	done chan struct{}
 
 	keyPaths []string
+
+	tunnelMu   sync.Mutex
+	tunnels    map[*Tunnel]struct{}
+	noForwards bool
+
+	agentCloser io.Closer
+
+	hostKeyUpdate *hostKeyUpdate
+
+	envMu       sync.Mutex
+	envAccepted map[string]bool
+
+	loginPassword func() (string, error)
 }
 
 // wireProxyJumpBastion configures the bastion from ProxyJump when no explicit Bastion is set.
@@ -145,6 +160,9 @@ func NewConnection(cfg Config, opts ...Option) (*Connection, error) {
 	cfg.SetDefaults()
 
 	c := &Connection{Config: cfg, options: options} //nolint:varnamelen
+	if cfg.LoginPasswordCallback != nil {
+		c.loginPassword = sync.OnceValues(cfg.LoginPasswordCallback)
+	}
 	options.InjectLoggerTo(c, log.KeyProtocol, "ssh")
 	c.sshConfig = &sshconfig.Config{
 		User: c.User,
@@ -164,6 +182,11 @@ func NewConnection(cfg Config, opts ...Option) (*Connection, error) {
 		c.Log().Debug("propagating key path to ssh config", "key_path", *c.KeyPath)
 	}
 
+	if c.ForwardAgent {
+		c.sshConfig.ForwardAgent = sshoptions.ForwardAgentYes
+		c.Log().Debug("propagating agent forwarding to ssh config")
+	}
+
 	if len(c.SSHConfigOptions) > 0 {
 		c.Log().Debug("applying options to ssh config", "count", len(c.SSHConfigOptions))
 		setter, err := sshconfig.NewSetter(c.sshConfig)
@@ -337,8 +360,16 @@ func (c *Connection) disconnect() {
 		close(c.done)
 		c.done = nil
 	}
+	tunnels := c.detachTunnels()
 	c.client.Close()
 	c.client = nil
+	if c.agentCloser != nil {
+		_ = c.agentCloser.Close()
+		c.agentCloser = nil
+	}
+	for t := range tunnels {
+		_ = t.Close()
+	}
 	if c.proxyCmd != nil {
 		if c.proxyCmd.Process != nil {
 			buildKillFunc(c.proxyCmd)()
@@ -421,41 +452,50 @@ func (c *Connection) IsWindows() bool {
 	return c.detectWindows(ctx)
 }
 
-func knownhostsCallback(path string, permissive, hash, checkIP bool) (ssh.HostKeyCallback, error) {
-	var err error
-	var callback ssh.HostKeyCallback
-	if checkIP {
-		callback, err = hostkey.KnownHostsFileCallbackWithIPCheck(path, permissive, hash)
-	} else {
-		callback, err = hostkey.KnownHostsFileCallback(path, permissive, hash)
-	}
+func knownhostsCallback(path string, policy hostkey.Policy) (ssh.HostKeyCallback, error) {
+	callback, err := hostkey.KnownHostsCallback(path, policy)
 	if err != nil {
 		return nil, fmt.Errorf("%w: create host key validator: %w", protocol.ErrNonRetryable, err)
 	}
 	return callback, nil
 }
 
-func knownhostsGlobalCallback(path string, permissive, checkIP bool) (ssh.HostKeyCallback, error) {
-	var err error
-	var callback ssh.HostKeyCallback
-	if checkIP {
-		callback, err = hostkey.KnownHostsReadOnlyFileCallbackWithIPCheck(path, permissive)
-	} else {
-		callback, err = hostkey.KnownHostsReadOnlyFileCallback(path, permissive)
-	}
+func knownhostsGlobalCallback(path string, policy hostkey.Policy) (ssh.HostKeyCallback, error) {
+	policy.ReadOnly = true
+	callback, err := hostkey.KnownHostsCallback(path, policy)
 	if err != nil {
 		return nil, fmt.Errorf("create host key validator for %s: %w", path, err)
 	}
 	return callback, nil
 }
 
-func isPermissive(ctx context.Context, c *Connection) bool {
-	if c.sshConfig.StrictHostKeyChecking.IsFalse() {
-		log.Trace(ctx, "config StrictHostKeyChecking is set to 'no'", log.KeyHost, c)
-		return true
+func (c *Connection) hostKeyPrompt() hostkey.PromptFunc {
+	if c.options == nil {
+		return nil
 	}
+	return c.options.HostKeyPrompt
+}
 
-	return false
+// hostKeyPolicy returns the known_hosts policy for the StrictHostKeyChecking
+// and HashKnownHosts options. Unless a prompt has been set with
+// WithHostKeyPrompt, "ask" is treated as "accept-new": rig is not
+// interactive and has always added the keys of new hosts.
+func hostKeyPolicy(ctx context.Context, c *Connection) hostkey.Policy {
+	policy := hostkey.Policy{Hash: shouldHash(ctx, c)}
+	strict := c.sshConfig.StrictHostKeyChecking
+	switch {
+	case strict.IsFalse():
+		policy.Mode = hostkey.ModeNo
+	case strict.IsTrue():
+		policy.Mode = hostkey.ModeYes
+	case strict.IsAsk() && c.hostKeyPrompt() != nil:
+		policy.Mode = hostkey.ModeAsk
+		policy.Prompt = c.hostKeyPrompt()
+	default:
+		policy.Mode = hostkey.ModeAcceptNew
+	}
+	log.Trace(ctx, "host key checking", log.KeyHost, c, "mode", policy.Mode.String())
+	return policy
 }
 
 func shouldHash(ctx context.Context, c *Connection) bool {
@@ -466,49 +506,66 @@ func shouldHash(ctx context.Context, c *Connection) bool {
 	return false
 }
 
+// userKnownHostsFile returns the known_hosts file that the keys of new hosts
+// are added to: the file named by SSH_KNOWN_HOSTS or the first usable
+// UserKnownHostsFile. An empty path means that no user known_hosts file is
+// used. SSH_KNOWN_HOSTS set to an empty value disables host key checking.
+func (c *Connection) userKnownHostsFile(ctx context.Context) (path string, fromEnv bool) {
+	if path, ok := hostkey.KnownHostsPathFromEnv(); ok {
+		return path, true
+	}
+
+	// "none" anywhere in the list disables user known_hosts entirely; check
+	// the full list before committing to any path.
+	if slices.Contains(c.sshConfig.UserKnownHostsFile, sshConfigNone) {
+		return "", false
+	}
+	for _, f := range c.sshConfig.UserKnownHostsFile {
+		log.Trace(ctx, "trying known_hosts file from ssh config", log.KeyHost, c, log.KeyFile, f)
+		if exp, err := homedir.Expand(f); err == nil {
+			return exp, false
+		}
+	}
+	return "", false
+}
+
 func (c *Connection) hostkeyCallback(ctx context.Context, checkIP bool) (ssh.HostKeyCallback, error) {
 	knownHostsMU.Lock()
 	defer knownHostsMU.Unlock()
 
-	permissive := isPermissive(ctx, c)
-	hash := shouldHash(ctx, c)
+	policy := hostKeyPolicy(ctx, c)
+	policy.CheckHostIP = checkIP
 
 	if checkIP {
 		log.Trace(ctx, "CheckHostIP enabled, IP verification active", log.KeyHost, c)
 	}
 
-	if path, ok := hostkey.KnownHostsPathFromEnv(); ok {
-		if path == "" {
+	khPath, fromEnv := c.userKnownHostsFile(ctx)
+	if fromEnv {
+		if khPath == "" {
 			return hostkey.InsecureIgnoreHostKeyCallback, nil
 		}
-		c.Log().Debug("using known_hosts file from SSH_KNOWN_HOSTS", log.HostAttr(c), log.KeyFile, path)
-		return knownhostsCallback(path, permissive, hash, checkIP)
+		c.Log().Debug("using known_hosts file from SSH_KNOWN_HOSTS", log.HostAttr(c), log.KeyFile, khPath)
+		return knownhostsCallback(khPath, policy)
 	}
 
-	var khPath string
-
-	// "none" anywhere in the list disables user known_hosts entirely; check
-	// the full list before committing to any path.
-	if !slices.Contains(c.sshConfig.UserKnownHostsFile, sshConfigNone) {
-		for _, f := range c.sshConfig.UserKnownHostsFile {
-			log.Trace(ctx, "trying known_hosts file from ssh config", log.KeyHost, c, log.KeyFile, f)
-			exp, err := homedir.Expand(f)
-			if err == nil {
-				khPath = exp
-				break
-			}
+	// like ssh(1), the CA and revocation lines of the system-wide files apply
+	// to the user file as well
+	for _, f := range c.sshConfig.GlobalKnownHostsFile {
+		if exp, err := homedir.Expand(f); err == nil {
+			policy.AuthorityFiles = append(policy.AuthorityFiles, exp)
 		}
 	}
 
 	if khPath != "" {
 		log.Trace(ctx, "using known_hosts file", log.KeyHost, c, log.KeyFile, khPath)
-		return knownhostsCallback(khPath, permissive, hash, checkIP)
+		return knownhostsCallback(khPath, policy)
 	}
 
-	return globalKnownHostsCallback(ctx, c.sshConfig.GlobalKnownHostsFile, permissive, checkIP)
+	return globalKnownHostsCallback(ctx, c.sshConfig.GlobalKnownHostsFile, policy)
 }
 
-func globalKnownHostsCallback(ctx context.Context, paths []string, permissive, checkIP bool) (ssh.HostKeyCallback, error) {
+func globalKnownHostsCallback(ctx context.Context, paths []string, policy hostkey.Policy) (ssh.HostKeyCallback, error) {
 	var lastErr error
 	for _, f := range paths {
 		log.Trace(ctx, "trying global known_hosts file", log.KeyFile, f)
@@ -533,7 +590,7 @@ func globalKnownHostsCallback(ctx context.Context, paths []string, permissive, c
 				continue
 			}
 		}
-		cb, err := knownhostsGlobalCallback(exp, permissive, checkIP)
+		cb, err := knownhostsGlobalCallback(exp, policy)
 		if err != nil {
 			lastErr = err
 			log.Trace(ctx, "skipping unusable global known_hosts file", log.KeyFile, exp, log.KeyError, err)
@@ -750,6 +807,43 @@ func applySSHConfigOptions(sshCfg *sshconfig.Config, config *ssh.ClientConfig) {
 	}
 }
 
+// verifyHostKeyCallback returns the host key callback for the next connection:
+// the known_hosts callback, wrapped to honor HostKeyAlias and RevokedHostKeys
+// and to record the verified key for UpdateHostKeys.
+func (c *Connection) verifyHostKeyCallback(ctx context.Context, checkIP bool) (ssh.HostKeyCallback, error) {
+	hkc, err := c.hostkeyCallback(ctx, checkIP)
+	if err != nil {
+		return nil, err
+	}
+
+	update := c.newHostKeyUpdate(ctx)
+	if update != nil {
+		hkc = update.record(hkc)
+	}
+	c.mu.Lock()
+	c.hostKeyUpdate = update
+	c.mu.Unlock()
+
+	if c.sshConfig.HostKeyAlias != "" {
+		log.Trace(ctx, "using HostKeyAlias for known_hosts lookup", log.KeyHost, c, "alias", c.sshConfig.HostKeyAlias)
+		hkc = hostkey.WithAlias(hkc, c.sshConfig.HostKeyAlias)
+	}
+
+	if revoked := c.sshConfig.RevokedHostKeys; revoked != "" {
+		path, err := homedir.Expand(revoked)
+		if err != nil {
+			return nil, fmt.Errorf("%w: expand RevokedHostKeys path: %w", protocol.ErrNonRetryable, err)
+		}
+		log.Trace(ctx, "using revoked host keys", log.KeyHost, c, log.KeyFile, path)
+		hkc, err = hostkey.WithRevokedKeys(hkc, path)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", protocol.ErrNonRetryable, err)
+		}
+	}
+
+	return hkc, nil
+}
+
 func (c *Connection) clientConfig(ctx context.Context) (*ssh.ClientConfig, func(), error) {
 	config := &ssh.ClientConfig{
 		User: c.User,
@@ -759,23 +853,20 @@ func (c *Connection) clientConfig(ctx context.Context) (*ssh.ClientConfig, func(
 	// to the actual TCP address, so IP verification against known_hosts would
 	// give wrong results. This matches OpenSSH behaviour.
 	checkIP := c.sshConfig.CheckHostIP.IsTrue() && c.sshConfig.HostKeyAlias == ""
-	hkc, err := c.hostkeyCallback(ctx, checkIP)
+	hkc, err := c.verifyHostKeyCallback(ctx, checkIP)
 	if err != nil {
 		return nil, func() {}, err
 	}
-	if c.sshConfig.HostKeyAlias != "" {
-		log.Trace(ctx, "using HostKeyAlias for known_hosts lookup", log.KeyHost, c, "alias", c.sshConfig.HostKeyAlias)
-		hkc = hostkey.WithAlias(hkc, c.sshConfig.HostKeyAlias)
-	}
 	config.HostKeyCallback = hkc
 
 	applySSHConfigOptions(c.sshConfig, config)
 
 	// PubkeyAuthentication is honored from the ssh config. When set to "no", all
 	// public key authentication (ssh agent and identity files) is skipped.
-	// PasswordAuthentication from ssh_config is not honored: rig does not read
-	// passwords from config. Callers can still enable password auth by supplying
-	// ssh.Password(...) via AuthMethods.
+	// Password authentication is used when LoginPasswordCallback is set and
+	// PasswordAuthentication is not disabled in the ssh config. rig does not
+	// read passwords from config. Callers can also enable password auth by
+	// supplying ssh.Password(...) via AuthMethods.
 	pubkeyEnabled := !c.sshConfig.PubkeyAuthentication.IsFalse()
 
 	var agentSigners []ssh.Signer
@@ -807,6 +898,11 @@ func (c *Connection) clientConfig(ctx context.Context) (*ssh.ClientConfig, func(
 		config.Auth = append(config.Auth, ssh.PublicKeys(combined...))
 	}
 
+	if c.loginPassword != nil && !c.sshConfig.PasswordAuthentication.IsFalse() {
+		c.Log().Debug("using password authentication")
+		config.Auth = append(config.Auth, ssh.PasswordCallback(c.loginPassword))
+	}
+
 	if len(config.Auth) == 0 {
 		return nil, agentClose, fmt.Errorf("%w: no usable authentication method found", protocol.ErrNonRetryable)
 	}
@@ -873,6 +969,14 @@ func (c *Connection) connectViaBastion(ctx context.Context, dst string, config *
 	if !ok {
 		return fmt.Errorf("%w: bastion connection is not an SSH connection", protocol.ErrNonRetryable)
 	}
+	// Like the jump host connection of "ssh -J", the bastion only carries the
+	// connection to the destination and does not set up forwards of its own.
+	// The agent is forwarded to the destination, which is reached through the
+	// bastion's tunnel, so the bastion does not need to forward it.
+	bastionSSH.noForwards = true
+	if bastionSSH.options.HostKeyPrompt == nil {
+		bastionSSH.options.HostKeyPrompt = c.hostKeyPrompt()
+	}
 	c.Log().Debug("connecting to bastion", log.HostAttr(c), "bastion", net.JoinHostPort(c.Bastion.Address, strconv.Itoa(c.Bastion.Port)))
 	if err := bastionSSH.Connect(ctx); err != nil {
 		if errors.Is(err, hostkey.ErrHostKeyMismatch) {
@@ -905,13 +1009,27 @@ func (c *Connection) connectViaBastion(ctx context.Context, dst string, config *
 	}
 	connected = true
 	c.mu.Lock()
-	c.client = ssh.NewClient(client, chans, reqs)
+	c.client = c.newClient(client, chans, reqs)
 	c.bastion = bastionSSH
 	c.startKeepalive()
 	c.mu.Unlock()
 
+	return c.finishConnect(ctx)
+}
+
+// finishConnect runs the steps that follow a successful handshake: it sets
+// up agent forwarding, warms up the OS detection cache and starts the port
+// forwards defined in the ssh config. The connection is closed again if a forward fails and
+// ExitOnForwardFailure is set.
+func (c *Connection) finishConnect(ctx context.Context) error {
+	c.startAgentForwarding(ctx)
 	c.prewarmWindows(ctx)
 
+	if err := c.startConfiguredForwards(ctx); err != nil {
+		c.Disconnect()
+		return err
+	}
+
 	return nil
 }
 
@@ -1110,13 +1228,11 @@ func (c *Connection) Connect(ctx context.Context) error {
 	}
 	_ = conn.SetDeadline(time.Time{})
 	c.mu.Lock()
-	c.client = ssh.NewClient(ncc, chans, reqs)
+	c.client = c.newClient(ncc, chans, reqs)
 	c.startKeepalive()
 	c.mu.Unlock()
 
-	c.prewarmWindows(ctx)
-
-	return nil
+	return c.finishConnect(ctx)
 }
 
 func (c *Connection) pubkeySigner(agentSigners []ssh.Signer, key ssh.PublicKey) (ssh.Signer, error) {
@@ -1194,37 +1310,25 @@ func (c *Connection) pkeySigner(ctx context.Context, agentSigners []ssh.Signer,
 // StartProcess executes a command on the remote host and uses the passed in streams for stdin, stdout and stderr. It returns a Waiter with a .Wait() function that
 // blocks until the command finishes and returns an error if the exit code is not zero.
 func (c *Connection) StartProcess(ctx context.Context, cmd string, stdin io.Reader, stdout, stderr io.Writer) (protocol.Waiter, error) {
-	c.mu.Lock()
-	client := c.client
-	c.mu.Unlock()
+	return c.startProcess(ctx, cmd, nil, stdin, stdout, stderr)
+}
 
-	if client == nil {
-		return nil, errNotConnected
+// startProcess starts cmd in a new session after setting env through "env"
+// requests.
+func (c *Connection) startProcess(ctx context.Context, cmd string, env map[string]string, stdin io.Reader, stdout, stderr io.Writer) (protocol.Waiter, error) {
+	session, err := c.newSession(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	session, err := client.NewSession()
-	if err != nil {
-		log.Trace(ctx, "ssh session creation failed, attempting reconnect", log.HostAttr(c), log.KeyError, err)
-		c.mu.Lock()
-		c.disconnect()
-		c.mu.Unlock()
-		reconnErr := c.Connect(ctx)
-		if reconnErr != nil {
-			return nil, fmt.Errorf("reconnect after session creation failure: %w", reconnErr)
-		}
-		c.mu.Lock()
-		client = c.client
-		c.mu.Unlock()
-		if client == nil {
-			return nil, errNotConnected
-		}
-		session, err = client.NewSession()
-		if err != nil {
-			return nil, fmt.Errorf("create ssh session: %w", err)
+	for _, name := range slices.Sorted(maps.Keys(env)) {
+		if err := session.Setenv(name, env[name]); err != nil {
+			_ = session.Close()
+			return nil, fmt.Errorf("set environment variable %s: %w", name, err)
 		}
 	}
 
-	session.Stdin = stdin
+	c.requestAgentForwarding(session)
 	session.Stdout = stdout
 	session.Stderr = stderr
 
@@ -1236,54 +1340,158 @@ func (c *Connection) StartProcess(ctx context.Context, cmd string, stdin io.Read
 		}
 	}()
 
-	if err := session.Start(cmd); err != nil {
-		return nil, fmt.Errorf("start session: %w", err)
+	return startProcess(session, cmd, stdin)
+}
+
+// newSession opens a new session, reconnecting once if the session can't be
+// created on the current connection.
+func (c *Connection) newSession(ctx context.Context) (*ssh.Session, error) {
+	c.mu.Lock()
+	client := c.client
+	c.mu.Unlock()
+
+	if client == nil {
+		return nil, errNotConnected
 	}
 
+	session, err := client.NewSession()
+	if err == nil {
+		return session, nil
+	}
+
+	log.Trace(ctx, "ssh session creation failed, attempting reconnect", log.HostAttr(c), log.KeyError, err)
+	c.mu.Lock()
+	c.disconnect()
+	c.mu.Unlock()
+	reconnErr := c.Connect(ctx)
+	if reconnErr != nil {
+		return nil, fmt.Errorf("reconnect after session creation failure: %w", reconnErr)
+	}
+	c.mu.Lock()
+	client = c.client
+	c.mu.Unlock()
+	if client == nil {
+		return nil, errNotConnected
+	}
+	session, err = client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("create ssh session: %w", err)
+	}
 	return session, nil
 }
 
-// setupInteractivePTY configures a PTY on the session for a file-backed stdin
-// and returns the raw-mode restore function. It sets the local terminal to raw
-// mode so that keystrokes are forwarded unmodified.
-func setupInteractivePTY(session *ssh.Session, inF *os.File) (func(), error) {
-	stdinFD := int(inF.Fd())
-	old, err := term.MakeRaw(stdinFD)
-	if err != nil {
-		return nil, fmt.Errorf("make local terminal raw: %w", err)
+// defaultTerminalModes are the terminal modes requested for a PTY when the
+// session options don't set any.
+var defaultTerminalModes = ssh.TerminalModes{
+	ssh.ECHO:          1,
+	ssh.ICANON:        1,
+	ssh.ISIG:          1,
+	ssh.ICRNL:         1,
+	ssh.OPOST:         1,
+	ssh.ONLCR:         1,
+	ssh.TTY_OP_ISPEED: 14400,
+	ssh.TTY_OP_OSPEED: 14400,
+}
+
+// sessionTerminal describes the terminal setup of an interactive session.
+type sessionTerminal struct {
+	// fd is the local stdin terminal or -1 when stdin is not a terminal.
+	fd int
+	// pty is true when a PTY was allocated for the session.
+	pty     bool
+	restore func()
+}
+
+// requestPTY requests a PTY for the session as configured by opts. Defaults
+// are taken from the local terminal fd when it is not -1.
+func requestPTY(session *ssh.Session, fd int, opts protocol.SessionOptions) error {
+	size := opts.Size
+	if fd >= 0 && (size.Width <= 0 || size.Height <= 0) {
+		if width, height, err := term.GetSize(fd); err == nil {
+			size = protocol.WindowSize{Width: width, Height: height}
+		}
+	}
+	if size.Width <= 0 {
+		size.Width = 80
+	}
+	if size.Height <= 0 {
+		size.Height = 24
 	}
 
-	width, height, err := term.GetSize(stdinFD)
-	if err != nil {
-		_ = term.Restore(stdinFD, old)
-		return nil, fmt.Errorf("get terminal size: %w", err)
+	termType := opts.Term
+	if termType == "" {
+		termType = os.Getenv("TERM")
+	}
+	if termType == "" {
+		termType = "xterm"
 	}
 
-	modes := ssh.TerminalModes{ssh.ECHO: 1}
-	if err := session.RequestPty("xterm", height, width, modes); err != nil {
-		_ = term.Restore(stdinFD, old)
-		return nil, fmt.Errorf("request pty: %w", err)
+	modes := defaultTerminalModes
+	if opts.Modes != nil {
+		modes = ssh.TerminalModes(opts.Modes)
 	}
 
-	return func() { _ = term.Restore(stdinFD, old) }, nil
+	if err := session.RequestPty(termType, size.Height, size.Width, modes); err != nil {
+		return fmt.Errorf("request pty: %w", err)
+	}
+	return nil
 }
 
-// prepareSessionInput wires stdin to the session. If stdin is a terminal
-// *os.File a PTY is requested and a raw-mode restore function is returned;
-// otherwise the reader is used as-is and the restore is a no-op.
-func prepareSessionInput(session *ssh.Session, stdin io.Reader) (input io.Reader, restore func(), err error) {
-	restore = func() {}
-	inF, ok := stdin.(*os.File)
-	if !ok {
-		return stdin, restore, nil
+// prepareSessionInput allocates a PTY for the session as selected by
+// opts.PTY. With PTYAuto, a PTY is requested when stdin is a terminal
+// *os.File. When a PTY is allocated for a stdin terminal, the local terminal
+// is put into raw mode so that keystrokes are forwarded unmodified, and the
+// returned restore function puts it back.
+func prepareSessionInput(session *ssh.Session, stdin io.Reader, opts protocol.SessionOptions) (sessionTerminal, error) {
+	st := sessionTerminal{fd: -1, restore: func() {}}
+	if inF, ok := stdin.(*os.File); ok && term.IsTerminal(int(inF.Fd())) {
+		st.fd = int(inF.Fd())
 	}
-	if term.IsTerminal(int(inF.Fd())) {
-		restore, err = setupInteractivePTY(session, inF)
+	if opts.PTY == protocol.PTYNever || (opts.PTY == protocol.PTYAuto && st.fd < 0) {
+		return st, nil
+	}
+
+	if err := requestPTY(session, st.fd, opts); err != nil {
+		return st, err
+	}
+	st.pty = true
+
+	if st.fd >= 0 {
+		old, err := term.MakeRaw(st.fd)
 		if err != nil {
-			return nil, nil, err
+			return st, fmt.Errorf("make local terminal raw: %w", err)
+		}
+		st.restore = func() { _ = term.Restore(st.fd, old) }
+	}
+	return st, nil
+}
+
+// relaySessionEvents delivers the resize events and signals of the session
+// options to the session until done is closed.
+func (c *Connection) relaySessionEvents(session *ssh.Session, opts protocol.SessionOptions, done <-chan struct{}) {
+	resize, signals := opts.Resize, opts.Signals
+	for resize != nil || signals != nil {
+		select {
+		case <-done:
+			return
+		case size, ok := <-resize:
+			if !ok {
+				resize = nil
+				continue
+			}
+			if err := session.WindowChange(size.Height, size.Width); err != nil {
+				c.Log().Debug("failed to relay window change", log.HostAttr(c), log.ErrorAttr(err))
+			}
+		case sig, ok := <-signals:
+			if !ok {
+				signals = nil
+				continue
+			}
+			if err := session.Signal(ssh.Signal(sig)); err != nil {
+				c.Log().Debug("failed to relay signal", log.HostAttr(c), "signal", sig, log.ErrorAttr(err))
+			}
 		}
 	}
-	return inF, restore, nil
 }
 
 // defaultInteractiveStreams replaces nil streams with the process's standard
@@ -1305,6 +1513,26 @@ func defaultInteractiveStreams(stdin io.Reader, stdout, stderr io.Writer) (io.Re
 // ExecInteractive executes a command on the host and passes stdin/stdout/stderr as-is to the session.
 // The session is closed when ctx is cancelled. Nil streams default to os.Stdin/os.Stdout/os.Stderr.
 func (c *Connection) ExecInteractive(ctx context.Context, cmd string, stdin io.Reader, stdout, stderr io.Writer) error {
+	return c.ExecInteractiveSession(ctx, cmd, stdin, stdout, stderr, protocol.SessionOptions{})
+}
+
+// SessionSupport reports that native SSH sessions support all session
+// options. Servers that don't implement the signal request, such as OpenSSH
+// sshd before 7.9, ignore delivered signals.
+func (c *Connection) SessionSupport() protocol.SessionSupport {
+	return protocol.SessionSupport{
+		PTY:     true,
+		Term:    true,
+		Size:    true,
+		Modes:   true,
+		Resize:  true,
+		Signals: protocol.AllSignals,
+	}
+}
+
+// ExecInteractiveSession is like ExecInteractive but configures the PTY,
+// resize events and signal delivery of the session with opts.
+func (c *Connection) ExecInteractiveSession(ctx context.Context, cmd string, stdin io.Reader, stdout, stderr io.Writer, opts protocol.SessionOptions) error {
 	stdin, stdout, stderr = defaultInteractiveStreams(stdin, stdout, stderr)
 	c.mu.Lock()
 	client := c.client
@@ -1330,25 +1558,27 @@ func (c *Connection) ExecInteractive(ctx context.Context, cmd string, stdin io.R
 		}
 	}()
 
+	c.requestAgentForwarding(session)
 	session.Stdout = stdout
 	session.Stderr = stderr
 
-	input, restoreTerm, err := prepareSessionInput(session, stdin)
+	st, err := prepareSessionInput(session, stdin, opts)
+	defer st.restore()
 	if err != nil {
 		return err
 	}
-	defer restoreTerm()
 
 	stdinpipe, err := session.StdinPipe()
 	if err != nil {
 		return fmt.Errorf("get stdin pipe: %w", err)
 	}
 	go func() {
-		_, _ = io.Copy(stdinpipe, input)
+		_, _ = io.Copy(stdinpipe, stdin)
 	}()
 
-	cancel := captureSignals(stdinpipe, session)
+	cancel := captureSignals(stdinpipe, session, st, opts)
 	defer cancel()
+	go c.relaySessionEvents(session, opts, watchDone)
 
 	if cmd == "" {
 		err = session.Shell()
@@ -35,6 +35,27 @@ var errAuthRejected = errors.New("auth rejected")
 // channel-open request is rejected. The listener is closed by t.Cleanup.
 func startSSHServer(t *testing.T, cfg *ssh.ServerConfig) string {
 	t.Helper()
+	return startSSHServerWith(t, cfg, sshServerHandler{})
+}
+
+// sshServerHandler serves the connections of a server started with
+// startSSHServerWith. Channel-open requests are rejected and global requests
+// are declined where a function is not set.
+type sshServerHandler struct {
+	// connected is called after the handshake, before requests and channels
+	// are served.
+	connected func(sconn *ssh.ServerConn)
+	// request is called for every global request.
+	request func(sconn *ssh.ServerConn, req *ssh.Request)
+	// channel is called for every channel-open request, in a goroutine of
+	// its own.
+	channel func(sconn *ssh.ServerConn, newChan ssh.NewChannel)
+}
+
+// startSSHServerWith starts an in-process SSH server like startSSHServer that
+// serves its connections with handler.
+func startSSHServerWith(t *testing.T, cfg *ssh.ServerConfig, handler sshServerHandler) string {
+	t.Helper()
 
 	ln, err := net.Listen("tcp", "127.0.0.1:0")
 	require.NoError(t, err)
@@ -53,9 +74,24 @@ func startSSHServer(t *testing.T, cfg *ssh.ServerConfig) string {
 					return
 				}
 				defer sconn.Close()
-				go ssh.DiscardRequests(reqs)
+				if handler.request != nil {
+					go func() {
+						for req := range reqs {
+							handler.request(sconn, req)
+						}
+					}()
+				} else {
+					go ssh.DiscardRequests(reqs)
+				}
+				if handler.connected != nil {
+					handler.connected(sconn)
+				}
 				for newChan := range chans {
-					newChan.Reject(ssh.UnknownChannelType, "not supported") //nolint:errcheck
+					if handler.channel == nil {
+						newChan.Reject(ssh.UnknownChannelType, "not supported") //nolint:errcheck
+						continue
+					}
+					go handler.channel(sconn, newChan)
 				}
 			}(conn)
 		}
@@ -64,6 +100,19 @@ func startSSHServer(t *testing.T, cfg *ssh.ServerConfig) string {
 	return ln.Addr().String()
 }
 
+// newTestServerConfig returns the config of a test SSH server that presents
+// hostSigner and accepts any password.
+func newTestServerConfig(hostSigner ssh.Signer) *ssh.ServerConfig {
+	cfg := &ssh.ServerConfig{
+		ServerVersion: "SSH-2.0-test-linux",
+		PasswordCallback: func(_ ssh.ConnMetadata, _ []byte) (*ssh.Permissions, error) {
+			return &ssh.Permissions{}, nil
+		},
+	}
+	cfg.AddHostKey(hostSigner)
+	return cfg
+}
+
 // newHostSigner generates an ephemeral ed25519 host key for a test SSH server.
 func newHostSigner(t *testing.T) ssh.Signer {
 	t.Helper()
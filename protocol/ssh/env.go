@@ -0,0 +1,66 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/k0sproject/rig/v2/log"
+	"github.com/k0sproject/rig/v2/protocol"
+)
+
+var _ protocol.EnvStarter = (*Connection)(nil)
+
+// AcceptsEnv reports whether the server accepts setting all of the named
+// environment variables through "env" requests. OpenSSH only accepts the
+// names listed in its AcceptEnv setting. Names that haven't been seen
+// before are probed with a session that is closed without running anything,
+// the results are remembered for the lifetime of the connection.
+func (c *Connection) AcceptsEnv(ctx context.Context, names []string) bool {
+	c.envMu.Lock()
+	defer c.envMu.Unlock()
+
+	var unknown []string
+	for _, name := range names {
+		accepted, known := c.envAccepted[name]
+		if !known {
+			unknown = append(unknown, name)
+			continue
+		}
+		if !accepted {
+			return false
+		}
+	}
+	if len(unknown) == 0 {
+		return true
+	}
+
+	session, err := c.newSession(ctx)
+	if err != nil {
+		log.Trace(ctx, "can't open a session to probe env requests", log.HostAttr(c), log.KeyError, err)
+		return false
+	}
+	defer session.Close()
+
+	if c.envAccepted == nil {
+		c.envAccepted = make(map[string]bool)
+	}
+	result := true
+	for _, name := range unknown {
+		accepted := session.Setenv(name, "") == nil
+		log.Trace(ctx, "probed env request", log.HostAttr(c), "name", name, "accepted", accepted)
+		c.envAccepted[name] = accepted
+		result = result && accepted
+	}
+	return result
+}
+
+// StartProcessEnv is like StartProcess but sets env through "env" requests
+// before running cmd. It fails if the server rejects any of the variables.
+func (c *Connection) StartProcessEnv(ctx context.Context, cmd string, env map[string]string, stdin io.Reader, stdout, stderr io.Writer) (protocol.Waiter, error) {
+	waiter, err := c.startProcess(ctx, cmd, env, stdin, stdout, stderr)
+	if err != nil {
+		return nil, fmt.Errorf("start process with environment: %w", err)
+	}
+	return waiter, nil
+}
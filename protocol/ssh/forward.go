@@ -0,0 +1,423 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/k0sproject/rig/v2/log"
+)
+
+var errInvalidForwardSpec = errors.New("invalid forward specification")
+
+// ForwardOptions holds the options for a port forward.
+type ForwardOptions struct {
+	errorHandler func(error)
+}
+
+// ForwardOption is a functional option for [Connection.ListenLocal] and [Connection.Forward].
+type ForwardOption func(*ForwardOptions)
+
+// WithForwardErrorHandler sets a function that receives the errors of the
+// individual forwarded connections of a tunnel, such as a failure to reach
+// the target. The tunnel keeps running after such errors. Without a handler
+// the errors are logged at debug level. The handler may be called
+// concurrently from several goroutines.
+func WithForwardErrorHandler(fn func(error)) ForwardOption {
+	return func(o *ForwardOptions) {
+		o.errorHandler = fn
+	}
+}
+
+// closeWriter is implemented by connections that support half-closing, like
+// *net.TCPConn and the connections returned by [Connection.Dial].
+type closeWriter interface {
+	CloseWrite() error
+}
+
+// Tunnel is a port forward that accepts connections from a listener and hands
+// each of them to a handler, which connects it to the other end of the tunnel.
+// Tunnels started through a [Connection] are closed when the connection is
+// disconnected.
+type Tunnel struct {
+	listener net.Listener
+	handle   func(net.Conn) error
+	onError  func(error)
+	onClose  func(*Tunnel)
+
+	mu      sync.Mutex
+	conns   map[net.Conn]struct{}
+	closing bool
+	err     error
+
+	closeOnce sync.Once
+	closeErr  error
+
+	wg   sync.WaitGroup
+	done chan struct{}
+}
+
+func newTunnel(listener net.Listener, handle func(net.Conn) error, options *ForwardOptions, onClose func(*Tunnel)) *Tunnel {
+	return &Tunnel{
+		listener: listener,
+		handle:   handle,
+		onError:  options.errorHandler,
+		onClose:  onClose,
+		conns:    make(map[net.Conn]struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Addr returns the address the tunnel is listening on. This is useful when
+// the tunnel was started on port 0 and the port was picked by the system.
+func (t *Tunnel) Addr() net.Addr {
+	return t.listener.Addr()
+}
+
+// Done returns a channel that is closed once the tunnel has stopped accepting
+// connections.
+func (t *Tunnel) Done() <-chan struct{} {
+	return t.done
+}
+
+// Err returns the error that stopped the tunnel from accepting connections.
+// It is nil while the tunnel is running and after it was closed through
+// [Tunnel.Close] or by disconnecting the connection.
+func (t *Tunnel) Err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.err
+}
+
+// Close stops the listener and closes every connection that is currently
+// being forwarded. It waits for the forwarding goroutines to finish.
+func (t *Tunnel) Close() error {
+	t.markClosing()
+	t.closeOnce.Do(func() {
+		err := t.listener.Close()
+		if err != nil && !errors.Is(err, net.ErrClosed) {
+			t.closeErr = fmt.Errorf("close tunnel listener: %w", err)
+		}
+		t.mu.Lock()
+		for conn := range t.conns {
+			_ = conn.Close()
+		}
+		t.mu.Unlock()
+		<-t.done
+		t.wg.Wait()
+		if t.onClose != nil {
+			t.onClose(t)
+		}
+	})
+	return t.closeErr
+}
+
+// markClosing flags the tunnel as being torn down, so that the errors caused
+// by closing the transport underneath it are not reported.
+func (t *Tunnel) markClosing() {
+	t.mu.Lock()
+	t.closing = true
+	t.mu.Unlock()
+}
+
+func (t *Tunnel) serve() {
+	defer close(t.done)
+	for {
+		conn, err := t.listener.Accept()
+		if err != nil {
+			t.mu.Lock()
+			if !t.closing {
+				t.err = fmt.Errorf("tunnel accept: %w", err)
+			}
+			t.mu.Unlock()
+			return
+		}
+		if !t.track(conn) {
+			_ = conn.Close()
+			return
+		}
+		t.wg.Add(1)
+		go func() {
+			defer t.wg.Done()
+			defer t.untrack(conn)
+			if err := t.handle(conn); err != nil {
+				t.report(err)
+			}
+		}()
+	}
+}
+
+func (t *Tunnel) track(conn net.Conn) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closing {
+		return false
+	}
+	t.conns[conn] = struct{}{}
+	return true
+}
+
+func (t *Tunnel) untrack(conn net.Conn) {
+	t.mu.Lock()
+	delete(t.conns, conn)
+	t.mu.Unlock()
+	_ = conn.Close()
+}
+
+func (t *Tunnel) report(err error) {
+	t.mu.Lock()
+	closing := t.closing
+	t.mu.Unlock()
+	if closing {
+		// errors caused by tearing the tunnel down are not interesting
+		return
+	}
+	if t.onError != nil {
+		t.onError(err)
+	}
+}
+
+// pipe copies data in both directions between a and b until both directions
+// are done. When one side reaches EOF, the write half of the other side is
+// closed so that the EOF propagates through the tunnel.
+func pipe(a, b net.Conn) error {
+	errCh := make(chan error, 2)
+	cp := func(dst, src net.Conn) {
+		_, err := io.Copy(dst, src)
+		if cw, ok := dst.(closeWriter); ok {
+			_ = cw.CloseWrite()
+		} else {
+			_ = dst.Close()
+		}
+		errCh <- err
+	}
+	go cp(a, b)
+	go cp(b, a)
+	err := <-errCh
+	if err != nil {
+		// one direction failed, unblock the other one
+		_ = a.Close()
+		_ = b.Close()
+	}
+	if err2 := <-errCh; err == nil {
+		err = err2
+	}
+	if err != nil && !errors.Is(err, net.ErrClosed) && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("pipe: %w", err)
+	}
+	return nil
+}
+
+// startTunnel registers a tunnel on the connection and starts serving it.
+func (c *Connection) startTunnel(listener net.Listener, handle func(net.Conn) error, opts ...ForwardOption) *Tunnel {
+	options := &ForwardOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	if options.errorHandler == nil {
+		addr := listener.Addr().String()
+		options.errorHandler = func(err error) {
+			c.Log().Debug("port forward error", "listen", addr, log.ErrorAttr(err))
+		}
+	}
+	tunnel := newTunnel(listener, handle, options, c.forgetTunnel)
+
+	c.tunnelMu.Lock()
+	if c.tunnels == nil {
+		c.tunnels = make(map[*Tunnel]struct{})
+	}
+	c.tunnels[tunnel] = struct{}{}
+	c.tunnelMu.Unlock()
+
+	go tunnel.serve()
+	return tunnel
+}
+
+func (c *Connection) forgetTunnel(t *Tunnel) {
+	c.tunnelMu.Lock()
+	delete(c.tunnels, t)
+	c.tunnelMu.Unlock()
+}
+
+// detachTunnels removes every tunnel from the connection and marks them as
+// closing. The caller must close them with [Tunnel.Close] once the client has
+// been closed: remote listeners ask the server to cancel the forward when
+// closed, which would block on a connection that has stopped responding.
+func (c *Connection) detachTunnels() map[*Tunnel]struct{} {
+	c.tunnelMu.Lock()
+	tunnels := c.tunnels
+	c.tunnels = nil
+	c.tunnelMu.Unlock()
+	for t := range tunnels {
+		t.markClosing()
+	}
+	return tunnels
+}
+
+// Forward accepts connections from listener and forwards each of them through
+// the SSH connection to the given address on the remote side, where it is
+// dialed using network ("tcp" or "unix"). The tunnel is closed when the
+// connection is disconnected, which also happens when a broken connection is
+// re-established. The listener is owned by the tunnel from this point on.
+func (c *Connection) Forward(listener net.Listener, network, address string, opts ...ForwardOption) (*Tunnel, error) {
+	c.mu.Lock()
+	client := c.client
+	c.mu.Unlock()
+	if client == nil {
+		return nil, errNotConnected
+	}
+	target := network + "://" + address
+	// The tunnel is bound to the current client: it is closed along with it on
+	// disconnect, so it never needs to look up a newer one.
+	return c.startTunnel(listener, func(local net.Conn) error {
+		remote, err := client.Dial(network, address)
+		if err != nil {
+			return fmt.Errorf("forward %s to %s: %w", local.RemoteAddr(), target, err)
+		}
+		defer remote.Close()
+		if err := pipe(local, remote); err != nil {
+			return fmt.Errorf("forward %s to %s: %w", local.RemoteAddr(), target, err)
+		}
+		return nil
+	}, opts...), nil
+}
+
+// ListenLocal binds a TCP listener on localAddr and forwards every connection
+// it accepts through the SSH connection to remoteAddr, which is dialed from the
+// remote host. This is the equivalent of "ssh -L localAddr:remoteAddr". Use
+// port 0 in localAddr to have a free port picked and read it from
+// [Tunnel.Addr].
+func (c *Connection) ListenLocal(localAddr, remoteAddr string, opts ...ForwardOption) (*Tunnel, error) {
+	var lc net.ListenConfig
+	listener, err := lc.Listen(context.Background(), "tcp", localAddr)
+	if err != nil {
+		return nil, fmt.Errorf("listen local: %w", err)
+	}
+	tunnel, err := c.Forward(listener, "tcp", remoteAddr, opts...)
+	if err != nil {
+		_ = listener.Close()
+		return nil, err
+	}
+	c.Log().Debug("started local port forward", "listen", listener.Addr().String(), "remote", remoteAddr)
+	return tunnel, nil
+}
+
+// forwardEndpoint is one side of a port forward in ssh_config form.
+type forwardEndpoint struct {
+	network string
+	address string
+}
+
+func (e forwardEndpoint) String() string {
+	return e.address
+}
+
+// parseForwardListen parses the listen side of a LocalForward or RemoteForward
+// directive: [bind_address:]port or a unix socket path. defaultBind is used
+// when no bind address is given, and "*" or an empty bind address means all
+// interfaces.
+func parseForwardListen(spec, defaultBind string) (forwardEndpoint, error) {
+	if strings.Contains(spec, "/") {
+		return forwardEndpoint{network: "unix", address: spec}, nil
+	}
+	bind := defaultBind
+	port := spec
+	if host, p, err := net.SplitHostPort(spec); err == nil {
+		bind = host
+		port = p
+	}
+	if bind == "*" {
+		bind = ""
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		return forwardEndpoint{}, fmt.Errorf("%w: invalid port in %q", errInvalidForwardSpec, spec)
+	}
+	return forwardEndpoint{network: "tcp", address: net.JoinHostPort(bind, port)}, nil
+}
+
+// parseForwardTarget parses the destination side of a forward directive:
+// host:hostport or a unix socket path.
+func parseForwardTarget(spec string) (forwardEndpoint, error) {
+	if strings.Contains(spec, "/") {
+		return forwardEndpoint{network: "unix", address: spec}, nil
+	}
+	host, port, err := net.SplitHostPort(spec)
+	if err != nil {
+		return forwardEndpoint{}, fmt.Errorf("%w: %q: %w", errInvalidForwardSpec, spec, err)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+		return forwardEndpoint{}, fmt.Errorf("%w: invalid port in %q", errInvalidForwardSpec, spec)
+	}
+	return forwardEndpoint{network: "tcp", address: net.JoinHostPort(host, port)}, nil
+}
+
+// localForwardBind returns the bind address used for a local listener that
+// was configured without one, following the GatewayPorts option.
+func (c *Connection) localForwardBind() string {
+	if c.sshConfig.GatewayPorts.IsTrue() {
+		return ""
+	}
+	return "localhost"
+}
+
+// startLocalForward starts one LocalForward directive from the ssh config.
+func (c *Connection) startLocalForward(listenSpec, targetSpec string) error {
+	listen, err := parseForwardListen(listenSpec, c.localForwardBind())
+	if err != nil {
+		return err
+	}
+	target, err := parseForwardTarget(targetSpec)
+	if err != nil {
+		return err
+	}
+	var lc net.ListenConfig
+	listener, err := lc.Listen(context.Background(), listen.network, listen.address)
+	if err != nil {
+		return fmt.Errorf("listen %s: %w", listen, err)
+	}
+	if _, err := c.Forward(listener, target.network, target.address); err != nil {
+		_ = listener.Close()
+		return err
+	}
+	c.Log().Debug("started local port forward from ssh config", "listen", listener.Addr().String(), "remote", target.String())
+	return nil
+}
+
+// startConfiguredForwards starts the LocalForward, RemoteForward and
+// DynamicForward port forwards defined in the ssh config.
+// A forward that can not be set up is logged and skipped, unless
+// ExitOnForwardFailure is set, in which case the error is returned.
+func (c *Connection) startConfiguredForwards(ctx context.Context) error {
+	if c.noForwards || c.sshConfig.ClearAllForwardings.IsTrue() {
+		return nil
+	}
+	var errs []error
+	for listen, target := range c.sshConfig.LocalForward {
+		if err := c.startLocalForward(listen, target); err != nil {
+			log.Trace(ctx, "failed to set up LocalForward", "listen", listen, "target", target, log.ErrorAttr(err))
+			errs = append(errs, fmt.Errorf("LocalForward %s %s: %w", listen, target, err))
+		}
+	}
+	errs = append(errs, c.startConfiguredRemoteForwards(ctx)...)
+	errs = append(errs, c.startConfiguredDynamicForwards(ctx)...)
+	return c.forwardFailure(errs)
+}
+
+// forwardFailure turns the errors from setting up configured forwards into
+// the error returned from Connect according to ExitOnForwardFailure.
+func (c *Connection) forwardFailure(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	err := errors.Join(errs...)
+	if c.sshConfig.ExitOnForwardFailure.IsTrue() {
+		return fmt.Errorf("port forwarding failed: %w", err)
+	}
+	c.Log().Warn("port forwarding failed", log.ErrorAttr(err))
+	return nil
+}
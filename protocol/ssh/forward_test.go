@@ -0,0 +1,357 @@
+package ssh
+
+import (
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/k0sproject/rig/v2/sshconfig/options"
+	"github.com/stretchr/testify/require"
+	ssh "golang.org/x/crypto/ssh"
+)
+
+// directTCPIPMsg is the payload of a "direct-tcpip" channel open request (RFC 4254 7.2).
+type directTCPIPMsg struct {
+	Host       string
+	Port       uint32
+	OriginHost string
+	OriginPort uint32
+}
+
+// startForwardingSSHServer starts an in-process SSH server that accepts any
+// password and serves "direct-tcpip" channels by dialing the requested target
+// from the test process. Global requests are passed to onRequest when it is
+// set and rejected otherwise. It returns the listen address.
+func startForwardingSSHServer(t *testing.T, hostSigner ssh.Signer, onRequest func(*ssh.ServerConn, *ssh.Request)) string {
+	t.Helper()
+	return startSSHServerWith(t, newTestServerConfig(hostSigner), sshServerHandler{
+		request: onRequest,
+		channel: func(_ *ssh.ServerConn, newChan ssh.NewChannel) {
+			switch newChan.ChannelType() {
+			case "session":
+				serveEchoSubsystem(newChan)
+			case "direct-tcpip":
+				serveDirectTCPIP(newChan)
+			default:
+				newChan.Reject(ssh.UnknownChannelType, "not supported") //nolint:errcheck
+			}
+		},
+	})
+}
+
+func serveDirectTCPIP(newChan ssh.NewChannel) {
+	var msg directTCPIPMsg
+	if err := ssh.Unmarshal(newChan.ExtraData(), &msg); err != nil {
+		newChan.Reject(ssh.ConnectionFailed, "bad payload") //nolint:errcheck
+		return
+	}
+	target, err := net.Dial("tcp", net.JoinHostPort(msg.Host, strconv.Itoa(int(msg.Port))))
+	if err != nil {
+		newChan.Reject(ssh.ConnectionFailed, err.Error()) //nolint:errcheck
+		return
+	}
+	ch, reqs, err := newChan.Accept()
+	if err != nil {
+		target.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	go func() {
+		_, _ = io.Copy(ch, target)
+		_ = ch.CloseWrite()
+	}()
+	_, _ = io.Copy(target, ch)
+	target.Close()
+	ch.Close()
+}
+
+// startEchoServer starts a TCP server that echoes back everything it reads.
+func startEchoServer(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// connectTestServer returns a Connection connected to the server at addr with
+// its host key pinned.
+func connectTestServer(t *testing.T, addr string, hostSigner ssh.Signer, opts map[string]any) *Connection {
+	t.Helper()
+	withConfigParser(t, "")
+	t.Setenv("SSH_AUTH_SOCK", "")
+	pinHostKey(t, addr, hostSigner)
+
+	host, portStr, err := net.SplitHostPort(addr)
+	require.NoError(t, err)
+	port, err := strconv.Atoi(portStr)
+	require.NoError(t, err)
+
+	conn, err := NewConnection(Config{
+		Address:          host,
+		Port:             port,
+		User:             "test",
+		AuthMethods:      []ssh.AuthMethod{ssh.Password("test")},
+		SSHConfigOptions: opts,
+	})
+	require.NoError(t, err)
+	t.Cleanup(conn.Disconnect)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	require.NoError(t, conn.Connect(ctx))
+	return conn
+}
+
+func requireEcho(t *testing.T, addr string) {
+	t.Helper()
+	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+	_, err = conn.Write([]byte("hello tunnel"))
+	require.NoError(t, err)
+	buf := make([]byte, len("hello tunnel"))
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	require.Equal(t, "hello tunnel", string(buf))
+}
+
+func TestListenLocal(t *testing.T) {
+	hostSigner := newHostSigner(t)
+	addr := startForwardingSSHServer(t, hostSigner, nil)
+	echo := startEchoServer(t)
+	conn := connectTestServer(t, addr, hostSigner, nil)
+
+	tunnel, err := conn.ListenLocal("127.0.0.1:0", echo)
+	require.NoError(t, err)
+
+	requireEcho(t, tunnel.Addr().String())
+	requireEcho(t, tunnel.Addr().String())
+
+	require.NoError(t, tunnel.Close())
+	<-tunnel.Done()
+	require.NoError(t, tunnel.Err())
+	_, err = net.DialTimeout("tcp", tunnel.Addr().String(), time.Second)
+	require.Error(t, err, "the listener must be closed")
+}
+
+func TestListenLocalNotConnected(t *testing.T) {
+	c := newTestConnection(t)
+	_, err := c.ListenLocal("127.0.0.1:0", "127.0.0.1:80")
+	require.ErrorIs(t, err, errNotConnected)
+}
+
+func TestListenLocalReportsErrors(t *testing.T) {
+	hostSigner := newHostSigner(t)
+	addr := startForwardingSSHServer(t, hostSigner, nil)
+	conn := connectTestServer(t, addr, hostSigner, nil)
+
+	// grab a port that nothing listens on
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	unreachable := ln.Addr().String()
+	ln.Close()
+
+	var mu sync.Mutex
+	var errs []error
+	reported := make(chan struct{}, 1)
+	tunnel, err := conn.ListenLocal("127.0.0.1:0", unreachable, WithForwardErrorHandler(func(err error) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+		select {
+		case reported <- struct{}{}:
+		default:
+		}
+	}))
+	require.NoError(t, err)
+
+	local, err := net.Dial("tcp", tunnel.Addr().String())
+	require.NoError(t, err)
+	defer local.Close()
+
+	select {
+	case <-reported:
+	case <-time.After(5 * time.Second):
+		t.Fatal("error handler was not called")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, errs, 1)
+	require.ErrorContains(t, errs[0], unreachable)
+
+	// the tunnel keeps running after a failed forward
+	select {
+	case <-tunnel.Done():
+		t.Fatal("tunnel stopped after a forwarding error")
+	default:
+	}
+}
+
+func TestDisconnectClosesTunnels(t *testing.T) {
+	hostSigner := newHostSigner(t)
+	addr := startForwardingSSHServer(t, hostSigner, nil)
+	echo := startEchoServer(t)
+	conn := connectTestServer(t, addr, hostSigner, nil)
+
+	tunnel, err := conn.ListenLocal("127.0.0.1:0", echo)
+	require.NoError(t, err)
+
+	// keep a forwarded connection open across the disconnect
+	active, err := net.Dial("tcp", tunnel.Addr().String())
+	require.NoError(t, err)
+	defer active.Close()
+	_, err = active.Write([]byte("x"))
+	require.NoError(t, err)
+	buf := make([]byte, 1)
+	_, err = io.ReadFull(active, buf)
+	require.NoError(t, err)
+
+	conn.Disconnect()
+
+	select {
+	case <-tunnel.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("tunnel was not closed on disconnect")
+	}
+	require.NoError(t, tunnel.Err())
+
+	require.NoError(t, active.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, err = active.Read(buf)
+	require.Error(t, err, "active forwarded connections must be closed")
+}
+
+func TestConnectStartsLocalForwardFromConfig(t *testing.T) {
+	hostSigner := newHostSigner(t)
+	addr := startForwardingSSHServer(t, hostSigner, nil)
+	echo := startEchoServer(t)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	local := ln.Addr().String()
+	ln.Close()
+
+	conn := connectTestServer(t, addr, hostSigner, map[string]any{
+		"LocalForward": []string{local, echo},
+	})
+	requireEcho(t, local)
+
+	conn.Disconnect()
+	_, err = net.DialTimeout("tcp", local, time.Second)
+	require.Error(t, err, "configured forwards must be closed on disconnect")
+}
+
+func TestConnectExitOnForwardFailure(t *testing.T) {
+	hostSigner := newHostSigner(t)
+	addr := startForwardingSSHServer(t, hostSigner, nil)
+
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { busy.Close() })
+
+	withConfigParser(t, "")
+	t.Setenv("SSH_AUTH_SOCK", "")
+	pinHostKey(t, addr, hostSigner)
+	host, portStr, err := net.SplitHostPort(addr)
+	require.NoError(t, err)
+	port, err := strconv.Atoi(portStr)
+	require.NoError(t, err)
+
+	newConn := func(exit bool) *Connection {
+		conn, err := NewConnection(Config{
+			Address:     host,
+			Port:        port,
+			User:        "test",
+			AuthMethods: []ssh.AuthMethod{ssh.Password("test")},
+			SSHConfigOptions: map[string]any{
+				"LocalForward":         []string{busy.Addr().String(), "127.0.0.1:1"},
+				"ExitOnForwardFailure": exit,
+			},
+		})
+		require.NoError(t, err)
+		t.Cleanup(conn.Disconnect)
+		return conn
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	lenient := newConn(false)
+	require.NoError(t, lenient.Connect(ctx), "a failed forward is only logged by default")
+	require.True(t, lenient.IsConnected())
+
+	strict := newConn(true)
+	err = strict.Connect(ctx)
+	require.ErrorContains(t, err, "port forwarding failed")
+	require.False(t, strict.IsConnected())
+}
+
+func TestParseForwardListen(t *testing.T) {
+	tests := []struct {
+		spec        string
+		defaultBind string
+		network     string
+		address     string
+		wantErr     bool
+	}{
+		{spec: "8080", defaultBind: "localhost", network: "tcp", address: "localhost:8080"},
+		{spec: "8080", defaultBind: "", network: "tcp", address: ":8080"},
+		{spec: "*:8080", defaultBind: "localhost", network: "tcp", address: ":8080"},
+		{spec: "10.0.0.1:8080", defaultBind: "localhost", network: "tcp", address: "10.0.0.1:8080"},
+		{spec: "[::1]:8080", defaultBind: "localhost", network: "tcp", address: "[::1]:8080"},
+		{spec: "/tmp/sock", defaultBind: "localhost", network: "unix", address: "/tmp/sock"},
+		{spec: "http", defaultBind: "localhost", wantErr: true},
+		{spec: "host:99999", defaultBind: "localhost", wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.spec, func(t *testing.T) {
+			got, err := parseForwardListen(tc.spec, tc.defaultBind)
+			if tc.wantErr {
+				require.ErrorIs(t, err, errInvalidForwardSpec)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.network, got.network)
+			require.Equal(t, tc.address, got.address)
+		})
+	}
+}
+
+func TestParseForwardTarget(t *testing.T) {
+	got, err := parseForwardTarget("example.com:443")
+	require.NoError(t, err)
+	require.Equal(t, forwardEndpoint{network: "tcp", address: "example.com:443"}, got)
+
+	got, err = parseForwardTarget("/run/app.sock")
+	require.NoError(t, err)
+	require.Equal(t, forwardEndpoint{network: "unix", address: "/run/app.sock"}, got)
+
+	_, err = parseForwardTarget("example.com")
+	require.ErrorIs(t, err, errInvalidForwardSpec)
+	_, err = parseForwardTarget("example.com:0")
+	require.ErrorIs(t, err, errInvalidForwardSpec)
+}
+
+func TestLocalForwardBindFollowsGatewayPorts(t *testing.T) {
+	c := newTestConnection(t)
+	require.Equal(t, "localhost", c.localForwardBind())
+	c.sshConfig.GatewayPorts = options.BooleanOptionYes
+	require.Empty(t, c.localForwardBind())
+}
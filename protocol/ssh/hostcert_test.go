@@ -0,0 +1,63 @@
+package ssh
+
+import (
+	"context"
+	"crypto/rand"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/k0sproject/rig/v2/protocol"
+	"github.com/k0sproject/rig/v2/protocol/ssh/hostkey"
+	"github.com/stretchr/testify/require"
+	ssh "golang.org/x/crypto/ssh"
+)
+
+func TestHostCertificate(t *testing.T) {
+	ca := newHostSigner(t)
+	hostSigner := newHostSigner(t)
+	cert := &ssh.Certificate{
+		Key:             hostSigner.PublicKey(),
+		CertType:        ssh.HostCert,
+		ValidPrincipals: []string{"127.0.0.1"},
+		ValidBefore:     ssh.CertTimeInfinity,
+	}
+	require.NoError(t, cert.SignCert(rand.Reader, ca))
+	certSigner, err := ssh.NewCertSigner(cert, hostSigner)
+	require.NoError(t, err)
+
+	cfg := &ssh.ServerConfig{
+		ServerVersion: "SSH-2.0-test-linux",
+		PasswordCallback: func(_ ssh.ConnMetadata, _ []byte) (*ssh.Permissions, error) {
+			return &ssh.Permissions{}, nil
+		},
+	}
+	cfg.AddHostKey(certSigner)
+	addr := startSSHServer(t, cfg)
+
+	connect := func(t *testing.T, trusted ssh.PublicKey) (string, error) {
+		t.Helper()
+		conn, khPath := newHostKeyTestConnection(t, addr, map[string]any{"StrictHostKeyChecking": "yes"})
+		line := "@cert-authority [127.0.0.1]:* " + string(ssh.MarshalAuthorizedKey(trusted))
+		require.NoError(t, os.WriteFile(khPath, []byte(line), 0o600))
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		err := conn.Connect(ctx)
+		data, readErr := os.ReadFile(khPath)
+		require.NoError(t, readErr)
+		return string(data), err
+	}
+
+	t.Run("trusted by the cert-authority line", func(t *testing.T) {
+		data, err := connect(t, ca.PublicKey())
+		require.NoError(t, err)
+		require.Equal(t, 1, strings.Count(data, "\n"), "nothing is added to known_hosts")
+	})
+
+	t.Run("untrusted ca", func(t *testing.T) {
+		_, err := connect(t, newHostSigner(t).PublicKey())
+		require.ErrorIs(t, err, hostkey.ErrHostKeyMismatch)
+		require.ErrorIs(t, err, protocol.ErrNonRetryable)
+	})
+}
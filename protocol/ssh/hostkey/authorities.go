@@ -0,0 +1,234 @@
+package hostkey
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1" //nolint:gosec // hashed known_hosts entries use HMAC-SHA1
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	markerCertAuthority = "@cert-authority"
+	markerRevoked       = "@revoked"
+)
+
+var errNoAuthority = errors.New("no trusted certificate authority for host")
+
+// authorities holds the @cert-authority and @revoked lines of known_hosts
+// files. Hosts presenting a certificate signed by a CA that a
+// @cert-authority line trusts for the host name are accepted without an
+// entry of their own. Keys on @revoked lines, including CA keys, are refused.
+type authorities struct {
+	cas     []authorityLine
+	revoked map[string]struct{}
+	// markers holds the "file:line" positions of the marker lines
+	markers map[string]struct{}
+}
+
+type authorityLine struct {
+	hosts string
+	key   ssh.PublicKey
+}
+
+// readAuthorities collects the marker lines of the given known_hosts files.
+// Files that don't exist or can't be read are skipped, like ssh(1) does.
+func readAuthorities(paths ...string) (*authorities, error) {
+	auth := &authorities{revoked: make(map[string]struct{}), markers: make(map[string]struct{})}
+	for _, path := range paths {
+		if path == "" || path == devNull {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if err := auth.parse(path, data); err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrCheckHostKey, path, err)
+		}
+	}
+	return auth, nil
+}
+
+func (a *authorities) parse(path string, data []byte) error {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || (fields[0] != markerCertAuthority && fields[0] != markerRevoked) {
+			continue
+		}
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(strings.Join(fields[2:], " ")))
+		if err != nil {
+			return fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		a.markers[markerPosition(path, lineNum)] = struct{}{}
+		if fields[0] == markerRevoked {
+			a.revoked[string(key.Marshal())] = struct{}{}
+			continue
+		}
+		a.cas = append(a.cas, authorityLine{hosts: fields[1], key: key})
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read: %w", err)
+	}
+	return nil
+}
+
+func markerPosition(path string, line int) string {
+	return path + ":" + strconv.Itoa(line)
+}
+
+// filter wraps a knownhosts callback to drop the @cert-authority lines from
+// the keys a KeyError lists as known for the host. The knownhosts package
+// reports them as host keys, which would make a plain key look like a
+// changed key when a CA is trusted for the host.
+func (a *authorities) filter(hkc ssh.HostKeyCallback) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := hkc(hostname, remote, key)
+		var keyErr *knownhosts.KeyError
+		if len(a.markers) == 0 || !errors.As(err, &keyErr) || len(keyErr.Want) == 0 {
+			return err
+		}
+		want := make([]knownhosts.KnownKey, 0, len(keyErr.Want))
+		for _, known := range keyErr.Want {
+			if _, ok := a.markers[markerPosition(known.Filename, known.Line)]; !ok {
+				want = append(want, known)
+			}
+		}
+		return &knownhosts.KeyError{Want: want}
+	}
+}
+
+// isRevoked returns true if the key, or for a certificate the certificate,
+// its key or the key of the signing CA, is on a @revoked line.
+func (a *authorities) isRevoked(key ssh.PublicKey) bool {
+	if _, ok := a.revoked[string(key.Marshal())]; ok {
+		return true
+	}
+	cert, ok := key.(*ssh.Certificate)
+	if !ok {
+		return false
+	}
+	return a.isRevoked(cert.Key) || a.isRevoked(cert.SignatureKey)
+}
+
+// isAuthority returns true if a @cert-authority line trusts ca for hostname.
+func (a *authorities) isAuthority(ca ssh.PublicKey, hostname string) bool {
+	blob := ca.Marshal()
+	for _, line := range a.cas {
+		if bytes.Equal(line.key.Marshal(), blob) && matchHosts(line.hosts, hostname) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkCertificate verifies a host certificate against the @cert-authority
+// lines: the signing CA must be trusted for hostname, and the certificate
+// must be a valid host certificate for the host name.
+func (a *authorities) checkCertificate(hostname string, cert *ssh.Certificate) error {
+	if !a.isAuthority(cert.SignatureKey, hostname) {
+		return fmt.Errorf("%w: %s", errNoAuthority, hostname)
+	}
+	if cert.CertType != ssh.HostCert {
+		return fmt.Errorf("certificate presented as a host key has type %d", cert.CertType)
+	}
+	host, _, err := net.SplitHostPort(hostname)
+	if err != nil {
+		host = hostname
+	}
+	checker := &ssh.CertChecker{
+		IsRevoked: func(cert *ssh.Certificate) bool { return a.isRevoked(cert) },
+	}
+	if err := checker.CheckCert(host, cert); err != nil {
+		return fmt.Errorf("check certificate: %w", err)
+	}
+	return nil
+}
+
+// matchHosts reports whether hostname ("host" or "host:port") matches the
+// comma-separated host patterns of a known_hosts line. Like ssh(1), patterns
+// are matched against "host" for port 22 and "[host]:port" for other ports,
+// may use the * and ? wildcards and may be negated with !. Hashed host names
+// are supported.
+func matchHosts(patterns, hostname string) bool {
+	host, port, err := net.SplitHostPort(hostname)
+	if err != nil {
+		host, port = hostname, "22"
+	}
+	normalized := knownhosts.Normalize(net.JoinHostPort(strings.ToLower(host), port))
+	matched := false
+	for _, pattern := range strings.Split(patterns, ",") {
+		negate := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(pattern, "!")
+		var ok bool
+		if strings.HasPrefix(pattern, "|1|") {
+			ok = matchHashedHost(pattern, normalized)
+		} else {
+			ok = wildcardMatch(strings.ToLower(pattern), normalized)
+		}
+		if ok {
+			if negate {
+				return false
+			}
+			matched = true
+		}
+	}
+	return matched
+}
+
+// wildcardMatch matches s against a pattern where * matches any number of
+// characters and ? matches exactly one.
+func wildcardMatch(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(s); i >= 0; i-- {
+				if wildcardMatch(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, s = pattern[1:], s[1:]
+	}
+	return len(s) == 0
+}
+
+// matchHashedHost matches an entry hashed by ssh-keygen -H ("|1|salt|hash").
+func matchHashedHost(entry, normalized string) bool {
+	parts := strings.Split(entry, "|")
+	if len(parts) != 4 {
+		return false
+	}
+	salt, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	want, err := base64.StdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte(normalized))
+	return hmac.Equal(mac.Sum(nil), want)
+}
@@ -0,0 +1,143 @@
+package hostkey_test
+
+import (
+	"crypto/rand"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/k0sproject/rig/v2/protocol/ssh/hostkey"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func signHostCert(t *testing.T, ca ssh.Signer, validBefore uint64, principals ...string) *ssh.Certificate {
+	t.Helper()
+	cert := &ssh.Certificate{
+		Key:             newTestSigner(t).PublicKey(),
+		CertType:        ssh.HostCert,
+		ValidPrincipals: principals,
+		ValidBefore:     validBefore,
+	}
+	require.NoError(t, cert.SignCert(rand.Reader, ca))
+	return cert
+}
+
+func authorityLine(marker, hosts string, key ssh.PublicKey) string {
+	return marker + " " + hosts + " " + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+}
+
+func TestKnownHostsCertAuthority(t *testing.T) {
+	ca := newTestSigner(t)
+	otherCA := newTestSigner(t)
+	addr, err := net.ResolveTCPAddr("tcp", "192.0.2.1:22")
+	require.NoError(t, err)
+	caLine := authorityLine("@cert-authority", "*.example.com,!bad.example.com", ca.PublicKey())
+
+	tests := []struct {
+		name     string
+		hostname string
+		cert     *ssh.Certificate
+		lines    []string
+		trusted  bool
+	}{
+		{name: "trusted ca", hostname: "web.example.com:22", cert: signHostCert(t, ca, ssh.CertTimeInfinity, "web.example.com"), trusted: true},
+		{name: "hashed host pattern", hostname: "web.example.com:22", cert: signHostCert(t, ca, ssh.CertTimeInfinity, "web.example.com"), lines: []string{authorityLine("@cert-authority", knownhosts.HashHostname("web.example.com"), ca.PublicKey())}, trusted: true},
+		{name: "non-standard port", hostname: "web.example.com:2222", cert: signHostCert(t, ca, ssh.CertTimeInfinity, "web.example.com"), lines: []string{authorityLine("@cert-authority", "[*.example.com]:2222", ca.PublicKey())}, trusted: true},
+		{name: "pattern needs the port", hostname: "web.example.com:2222", cert: signHostCert(t, ca, ssh.CertTimeInfinity, "web.example.com")},
+		{name: "negated host", hostname: "bad.example.com:22", cert: signHostCert(t, ca, ssh.CertTimeInfinity, "bad.example.com")},
+		{name: "unknown ca", hostname: "web.example.com:22", cert: signHostCert(t, otherCA, ssh.CertTimeInfinity, "web.example.com")},
+		{name: "wrong principal", hostname: "web.example.com:22", cert: signHostCert(t, ca, ssh.CertTimeInfinity, "db.example.com")},
+		{name: "expired", hostname: "web.example.com:22", cert: signHostCert(t, ca, uint64(time.Now().Add(-time.Hour).Unix()), "web.example.com")},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			lines := tc.lines
+			if lines == nil {
+				lines = []string{caLine}
+			}
+
+			khFile := writeKnownHostsFile(t, lines...)
+			cb, err := hostkey.KnownHostsCallback(khFile, hostkey.Policy{Mode: hostkey.ModeYes})
+			require.NoError(t, err)
+			err = cb(tc.hostname, addr, tc.cert)
+			if tc.trusted {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorIs(t, err, hostkey.ErrHostKeyMismatch)
+
+			// like ssh(1), an untrusted certificate is checked as its plain key
+			cb, err = hostkey.KnownHostsCallback(khFile, hostkey.Policy{Mode: hostkey.ModeAcceptNew})
+			require.NoError(t, err)
+			require.NoError(t, cb(tc.hostname, addr, tc.cert))
+			contents, err := os.ReadFile(khFile)
+			require.NoError(t, err)
+			require.Contains(t, string(contents), knownhosts.Line([]string{knownhosts.Normalize(addr.String())}, tc.cert.Key))
+			require.NotContains(t, string(contents), "-cert-v01@openssh.com", "certificates are never written to known_hosts")
+
+			// the plain key is recorded under the remote address
+			cb, err = hostkey.KnownHostsCallback(khFile, hostkey.Policy{Mode: hostkey.ModeYes})
+			require.NoError(t, err)
+			require.NoError(t, cb(addr.String(), addr, tc.cert), "the recorded plain key is accepted")
+		})
+	}
+}
+
+func TestKnownHostsCertAuthorityRevoked(t *testing.T) {
+	ca := newTestSigner(t)
+	addr, err := net.ResolveTCPAddr("tcp", "192.0.2.1:22")
+	require.NoError(t, err)
+	cert := signHostCert(t, ca, ssh.CertTimeInfinity, "web.example.com")
+
+	for name, revoked := range map[string]ssh.PublicKey{"ca": ca.PublicKey(), "certified key": cert.Key, "certificate": cert} {
+		t.Run(name, func(t *testing.T) {
+			khFile := writeKnownHostsFile(t,
+				authorityLine("@cert-authority", "*", ca.PublicKey()),
+				authorityLine("@revoked", "*", revoked),
+			)
+			cb, err := hostkey.KnownHostsCallback(khFile, hostkey.Policy{Mode: hostkey.ModeNo})
+			require.NoError(t, err)
+			require.ErrorIs(t, cb("web.example.com:22", addr, cert), hostkey.ErrHostKeyRevoked)
+		})
+	}
+}
+
+func TestKnownHostsAuthorityFiles(t *testing.T) {
+	ca := newTestSigner(t)
+	addr, err := net.ResolveTCPAddr("tcp", "192.0.2.1:22")
+	require.NoError(t, err)
+	cert := signHostCert(t, ca, ssh.CertTimeInfinity, "web.example.com")
+
+	khFile := writeKnownHostsFile(t)
+	global := writeKnownHostsFile(t, authorityLine("@cert-authority", "*.example.com", ca.PublicKey()))
+	policy := hostkey.Policy{Mode: hostkey.ModeYes, AuthorityFiles: []string{"/nonexistent/ssh_known_hosts", global}}
+	cb, err := hostkey.KnownHostsCallback(khFile, policy)
+	require.NoError(t, err)
+	require.NoError(t, cb("web.example.com:22", addr, cert))
+
+	revokedPlain := newTestSigner(t)
+	revoking := writeKnownHostsFile(t, authorityLine("@revoked", "*", revokedPlain.PublicKey()))
+	cb, err = hostkey.KnownHostsCallback(khFile, hostkey.Policy{Mode: hostkey.ModeNo, AuthorityFiles: []string{revoking}})
+	require.NoError(t, err)
+	require.ErrorIs(t, cb("web.example.com:22", addr, revokedPlain.PublicKey()), hostkey.ErrHostKeyRevoked)
+}
+
+func TestKnownHostsCertAuthorityPlainKey(t *testing.T) {
+	ca := newTestSigner(t)
+	known := newTestSigner(t)
+	addr, err := net.ResolveTCPAddr("tcp", "192.0.2.1:22")
+	require.NoError(t, err)
+	khFile := writeKnownHostsFile(t,
+		authorityLine("@cert-authority", "*", ca.PublicKey()),
+		knownhosts.Line([]string{knownhosts.Normalize(addr.String())}, known.PublicKey()),
+	)
+
+	cb, err := hostkey.KnownHostsCallback(khFile, hostkey.Policy{Mode: hostkey.ModeAcceptNew, CheckHostIP: true})
+	require.NoError(t, err)
+	require.NoError(t, cb(addr.String(), addr, known.PublicKey()), "a CA line is not a host key of its own")
+	require.ErrorIs(t, cb(addr.String(), addr, newTestSigner(t).PublicKey()), hostkey.ErrHostKeyMismatch)
+}
@@ -30,6 +30,10 @@ var (
 	// ErrHostKeyMismatch is returned when the host key does not match the host key or a key in known_hosts file.
 	ErrHostKeyMismatch = errors.New("host key mismatch")
 
+	// ErrHostKeyRevoked is returned when the host presents a revoked key. It
+	// wraps ErrHostKeyMismatch.
+	ErrHostKeyRevoked = fmt.Errorf("%w: host key is revoked", ErrHostKeyMismatch)
+
 	// ErrCheckHostKey is returned when the callback could not be created.
 	ErrCheckHostKey = errors.New("check hostkey")
 
@@ -56,17 +60,32 @@ var KnownHostsPathFromEnv = func() (string, bool) {
 	return os.LookupEnv("SSH_KNOWN_HOSTS")
 }
 
-// KnownHostsFileCallback returns a HostKeyCallback that uses a known hosts file to verify host keys.
-func KnownHostsFileCallback(path string, permissive, hash bool) (ssh.HostKeyCallback, error) {
+// KnownHostsCallback returns a HostKeyCallback that verifies host keys against
+// the known_hosts file at path, handling unknown hosts and changed host keys
+// as defined by policy. Unless the policy is read-only, the file and its
+// directory are created if they do not exist.
+func KnownHostsCallback(path string, policy Policy) (ssh.HostKeyCallback, error) {
 	if path == devNull {
 		return InsecureIgnoreHostKeyCallback, nil
 	}
 
+	if policy.ReadOnly {
+		stat, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrCheckHostKey, err)
+		}
+		if !stat.Mode().IsRegular() {
+			return nil, fmt.Errorf("%w: %s is not a regular file", ErrCheckHostKey, path)
+		}
+	}
+
 	mu.Lock()
 	defer mu.Unlock()
 
-	if err := ensureFile(path); err != nil {
-		return nil, err
+	if !policy.ReadOnly {
+		if err := ensureFile(path); err != nil {
+			return nil, err
+		}
 	}
 
 	hkc, err := knownhosts.New(path)
@@ -74,7 +93,31 @@ func KnownHostsFileCallback(path string, permissive, hash bool) (ssh.HostKeyCall
 		return nil, fmt.Errorf("%w: knownhosts callback: %w", ErrCheckHostKey, err)
 	}
 
-	return wrapCallback(hkc, path, permissive, hash), nil
+	auth, err := readAuthorities(append([]string{path}, policy.AuthorityFiles...)...)
+	if err != nil {
+		return nil, err
+	}
+	hkc = auth.filter(hkc)
+
+	callback := wrapCallback(hkc, auth, path, policy)
+	if policy.CheckHostIP {
+		callback = wrapCheckHostIP(callback, hkc, policy.Mode == ModeNo)
+	}
+	return callback, nil
+}
+
+// legacyMode returns the mode that corresponds to the permissive flag of the
+// callback constructors that predate Policy.
+func legacyMode(permissive bool) Mode {
+	if permissive {
+		return ModeNo
+	}
+	return ModeAcceptNew
+}
+
+// KnownHostsFileCallback returns a HostKeyCallback that uses a known hosts file to verify host keys.
+func KnownHostsFileCallback(path string, permissive, hash bool) (ssh.HostKeyCallback, error) {
+	return KnownHostsCallback(path, Policy{Mode: legacyMode(permissive), Hash: hash})
 }
 
 // KnownHostsReadOnlyFileCallback returns a HostKeyCallback that only reads from
@@ -82,162 +125,186 @@ func KnownHostsFileCallback(path string, permissive, hash bool) (ssh.HostKeyCall
 // This is appropriate for system-wide files such as /etc/ssh/ssh_known_hosts that
 // should not be modified by unprivileged users.
 func KnownHostsReadOnlyFileCallback(path string, permissive bool) (ssh.HostKeyCallback, error) {
-	if path == devNull {
-		return InsecureIgnoreHostKeyCallback, nil
-	}
-
-	stat, err := os.Stat(path)
-	if err != nil {
-		return nil, fmt.Errorf("%w: %w", ErrCheckHostKey, err)
-	}
-	if !stat.Mode().IsRegular() {
-		return nil, fmt.Errorf("%w: %s is not a regular file", ErrCheckHostKey, path)
-	}
-
-	mu.Lock()
-	defer mu.Unlock()
-
-	hkc, err := knownhosts.New(path)
-	if err != nil {
-		return nil, fmt.Errorf("%w: knownhosts callback: %w", ErrCheckHostKey, err)
-	}
-
-	return wrapReadOnlyCallback(hkc, permissive), nil
+	return KnownHostsCallback(path, Policy{Mode: legacyMode(permissive), ReadOnly: true})
 }
 
 // KnownHostsFileCallbackWithIPCheck is like KnownHostsFileCallback but also
 // verifies the connecting IP address. It parses the known_hosts file once,
 // sharing the checker between hostname and IP verification.
 func KnownHostsFileCallbackWithIPCheck(path string, permissive, hash bool) (ssh.HostKeyCallback, error) {
-	if path == devNull {
-		return InsecureIgnoreHostKeyCallback, nil
-	}
-
-	mu.Lock()
-	defer mu.Unlock()
-
-	if err := ensureFile(path); err != nil {
-		return nil, err
-	}
-
-	hkc, err := knownhosts.New(path)
-	if err != nil {
-		return nil, fmt.Errorf("%w: knownhosts callback: %w", ErrCheckHostKey, err)
-	}
-
-	return wrapCheckHostIP(wrapCallback(hkc, path, permissive, hash), hkc, permissive), nil
+	return KnownHostsCallback(path, Policy{Mode: legacyMode(permissive), Hash: hash, CheckHostIP: true})
 }
 
 // KnownHostsReadOnlyFileCallbackWithIPCheck is like KnownHostsReadOnlyFileCallback
 // but also verifies the connecting IP address. It parses the known_hosts file once,
 // sharing the checker between hostname and IP verification.
 func KnownHostsReadOnlyFileCallbackWithIPCheck(path string, permissive bool) (ssh.HostKeyCallback, error) {
-	if path == devNull {
-		return InsecureIgnoreHostKeyCallback, nil
-	}
+	return KnownHostsCallback(path, Policy{Mode: legacyMode(permissive), ReadOnly: true, CheckHostIP: true})
+}
 
-	stat, err := os.Stat(path)
-	if err != nil {
-		return nil, fmt.Errorf("%w: %w", ErrCheckHostKey, err)
-	}
-	if !stat.Mode().IsRegular() {
-		return nil, fmt.Errorf("%w: %s is not a regular file", ErrCheckHostKey, path)
-	}
+// wrapCallback extends a knownhosts callback to handle hosts that are not in
+// the known_hosts file and hosts that present a changed key according to
+// policy. Revoked keys are refused in every mode.
+//
+// A host certificate signed by a CA that a @cert-authority line trusts for
+// the host is accepted as is. Like ssh(1), any other certificate is checked
+// as the plain key it certifies, and that key is what gets added to the
+// known_hosts file.
+func wrapCallback(hkc ssh.HostKeyCallback, auth *authorities, path string, policy Policy) ssh.HostKeyCallback {
+	return ssh.HostKeyCallback(func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if auth.isRevoked(key) {
+			return fmt.Errorf("%w: %s %s", ErrHostKeyRevoked, key.Type(), ssh.FingerprintSHA256(key))
+		}
+		cert, ok := key.(*ssh.Certificate)
+		if !ok {
+			return checkKnownHost(hkc, path, policy, hostname, remote, key)
+		}
+		certErr := auth.checkCertificate(hostname, cert)
+		if certErr == nil {
+			return nil
+		}
+		if err := checkKnownHost(hkc, path, policy, hostname, remote, cert.Key); err != nil {
+			return fmt.Errorf("%w (host certificate: %w)", err, certErr)
+		}
+		return nil
+	})
+}
 
+// checkKnownHost verifies a plain host key against the known_hosts file.
+func checkKnownHost(hkc ssh.HostKeyCallback, path string, policy Policy, hostname string, remote net.Addr, key ssh.PublicKey) error {
 	mu.Lock()
 	defer mu.Unlock()
-
-	hkc, err := knownhosts.New(path)
-	if err != nil {
-		return nil, fmt.Errorf("%w: knownhosts callback: %w", ErrCheckHostKey, err)
+	err := hkc(hostname, remote, key)
+	if err == nil {
+		return nil
 	}
 
-	return wrapCheckHostIP(wrapReadOnlyCallback(hkc, permissive), hkc, permissive), nil
-}
+	var revokedErr *knownhosts.RevokedError
+	if errors.As(err, &revokedErr) {
+		return fmt.Errorf("%w: %w", ErrHostKeyRevoked, err)
+	}
 
-// extends a knownhosts callback to not return an error when the key
-// is not found in the known_hosts file but instead adds it to the file as new
-// entry.
-func wrapCallback(hkc ssh.HostKeyCallback, path string, permissive, hash bool) ssh.HostKeyCallback {
-	// TODO this should also support the "accept-new" of StrictHostKeyChecking and possibly some other options.
-	return ssh.HostKeyCallback(func(hostname string, remote net.Addr, key ssh.PublicKey) error {
-		mu.Lock()
-		defer mu.Unlock()
-		err := hkc(hostname, remote, key)
-		if err == nil {
+	var keyErr *knownhosts.KeyError
+	if !errors.As(err, &keyErr) {
+		// unexpected error unrelated to key matching (e.g. address parsing, IO)
+		if policy.Mode == ModeNo {
+			fmt.Fprintln(os.Stderr, "Ignored an SSH host key error for", remote, "because StrictHostKeyChecking is set to 'no' in ssh config")
 			return nil
 		}
-
-		var keyErr *knownhosts.KeyError
-		if !errors.As(err, &keyErr) || len(keyErr.Want) > 0 {
-			// keyErr.Want is empty if the host key is not in the known_hosts file
-			// non-empty is a mismatch
-			if permissive {
-				fmt.Fprintln(os.Stderr, "Ignored an SSH host key mismatch for", remote, "because StrictHostKeyChecking is set to 'no' in ssh config")
-				return nil
-			}
-			return fmt.Errorf("%w: %w", ErrHostKeyMismatch, err)
+		return fmt.Errorf("%w: %w", ErrHostKeyMismatch, err)
+	}
+	if len(keyErr.Want) > 0 {
+		// non-empty Want means a known host presented a different key
+		if policy.Mode == ModeNo {
+			fmt.Fprintln(os.Stderr, "Ignored an SSH host key mismatch for", remote, "because StrictHostKeyChecking is set to 'no' in ssh config")
+			return nil
 		}
+		return fmt.Errorf("%w: %w", ErrHostKeyMismatch, err)
+	}
 
-		dbFile, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
-		if err != nil {
-			return fmt.Errorf("failed to open ssh known_hosts file %s for writing: %w", path, err)
+	// keyErr.Want is empty if the host key is not in the known_hosts file
+	switch policy.Mode {
+	case ModeYes:
+		return fmt.Errorf("%w: unknown host: %w", ErrHostKeyMismatch, err)
+	case ModeAcceptNew:
+		if policy.ReadOnly {
+			// the key can't be recorded, so it would have to be accepted
+			// blindly on every connection
+			return fmt.Errorf("%w: unknown host: %w", ErrHostKeyMismatch, err)
 		}
+	case ModeAsk:
+		if policy.Prompt == nil {
+			return fmt.Errorf("%w: unknown host and no prompt to confirm the key: %w", ErrHostKeyMismatch, err)
+		}
+		// the prompt may wait for a user, don't block other connections
+		mu.Unlock()
+		ok, promptErr := policy.Prompt(hostname, remote, key)
+		mu.Lock()
+		if promptErr != nil {
+			return fmt.Errorf("%w: confirm host key: %w", ErrHostKeyMismatch, promptErr)
+		}
+		if !ok {
+			return fmt.Errorf("%w: host key was not accepted: %w", ErrHostKeyMismatch, err)
+		}
+	case ModeNo:
+	}
 
+	if policy.ReadOnly {
+		return nil
+	}
+	return appendKnownHosts(path, remote, []ssh.PublicKey{key}, policy.Hash)
+}
+
+// appendKnownHosts adds an entry for each of keys to the known_hosts file at
+// path. The entries are stored under the remote address. Must be called with
+// mu held.
+func appendKnownHosts(path string, remote net.Addr, keys []ssh.PublicKey, hash bool) error {
+	dbFile, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open ssh known_hosts file %s for writing: %w", path, err)
+	}
+
+	var rows strings.Builder
+	for _, key := range keys {
 		knownHostsEntry := knownhosts.Normalize(remote.String())
 		if hash {
 			knownHostsEntry = knownhosts.HashHostname(knownHostsEntry)
 		}
+		rows.WriteString(strings.TrimSpace(knownhosts.Line([]string{knownHostsEntry}, key)) + "\n")
+	}
 
-		row := knownhosts.Line([]string{knownHostsEntry}, key)
-		row = strings.TrimSpace(row) + "\n"
-
-		if _, err := dbFile.WriteString(row); err != nil {
-			return fmt.Errorf("failed to write to known hosts file %s: %w", path, err)
-		}
-		if err := dbFile.Close(); err != nil {
-			return fmt.Errorf("failed to close known_hosts file after writing: %w", err)
-		}
-		return nil
-	})
+	if _, err := dbFile.WriteString(rows.String()); err != nil {
+		_ = dbFile.Close()
+		return fmt.Errorf("failed to write to known hosts file %s: %w", path, err)
+	}
+	if err := dbFile.Close(); err != nil {
+		return fmt.Errorf("failed to close known_hosts file after writing: %w", err)
+	}
+	return nil
 }
 
-// wrapReadOnlyCallback wraps a knownhosts callback to reject unknown hosts
-// without writing to the file. When permissive is true, unknown hosts are
-// accepted silently instead of rejected.
-func wrapReadOnlyCallback(hkc ssh.HostKeyCallback, permissive bool) ssh.HostKeyCallback {
-	return ssh.HostKeyCallback(func(hostname string, remote net.Addr, key ssh.PublicKey) error {
-		mu.Lock()
-		defer mu.Unlock()
+// UnknownHostKeys returns those of keys that the known_hosts file at path
+// does not list for the host. Revoked keys are left out. Together with
+// AddHostKeys it is used to learn the additional host keys announced by a
+// server, like the UpdateHostKeys ssh_config option.
+func UnknownHostKeys(path, hostname string, remote net.Addr, keys []ssh.PublicKey) ([]ssh.PublicKey, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	hkc, err := knownhosts.New(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: knownhosts callback: %w", ErrCheckHostKey, err)
+	}
+
+	var unknown []ssh.PublicKey
+	for _, key := range keys {
 		err := hkc(hostname, remote, key)
 		if err == nil {
-			return nil
+			continue
+		}
+		var revokedErr *knownhosts.RevokedError
+		if errors.As(err, &revokedErr) {
+			continue
 		}
-
 		var keyErr *knownhosts.KeyError
 		if !errors.As(err, &keyErr) {
-			// unexpected error unrelated to key matching (e.g. address parsing, IO)
-			if permissive {
-				fmt.Fprintln(os.Stderr, "Ignored an SSH host key error for", remote, "because StrictHostKeyChecking is set to 'no' in ssh config")
-				return nil
-			}
-			return fmt.Errorf("%w: %w", ErrHostKeyMismatch, err)
-		}
-		if len(keyErr.Want) > 0 {
-			// non-empty Want means a known host presented a different key
-			if permissive {
-				fmt.Fprintln(os.Stderr, "Ignored an SSH host key mismatch for", remote, "because StrictHostKeyChecking is set to 'no' in ssh config")
-				return nil
-			}
-			return fmt.Errorf("%w: %w", ErrHostKeyMismatch, err)
+			return nil, fmt.Errorf("%w: %w", ErrCheckHostKey, err)
 		}
+		unknown = append(unknown, key)
+	}
+	return unknown, nil
+}
 
-		// host not found in file — read-only mode cannot append new entries
-		if permissive {
-			return nil
-		}
-		return fmt.Errorf("%w: unknown host: %w", ErrHostKeyMismatch, err)
-	})
+// AddHostKeys adds an entry for each of keys to the known_hosts file at path.
+// Like the entries added by the callbacks, they are stored under the remote
+// address and the host name is hashed when hash is true.
+func AddHostKeys(path string, remote net.Addr, keys []ssh.PublicKey, hash bool) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	return appendKnownHosts(path, remote, keys, hash)
 }
 
 // WithCheckHostIP wraps cb to also verify the connecting IP address in
@@ -299,6 +366,10 @@ func checkResolvedIP(rawChecker ssh.HostKeyCallback, addr, port string, remote n
 
 func wrapCheckHostIP(callback, rawChecker ssh.HostKeyCallback, permissive bool) ssh.HostKeyCallback {
 	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if _, ok := key.(*ssh.Certificate); ok {
+			// like ssh(1), certificates are not checked against IP addresses
+			return callback(hostname, remote, key)
+		}
 		host, port, err := net.SplitHostPort(hostname)
 		if err != nil {
 			// hostname has no port — use it as-is and derive the port from the remote address
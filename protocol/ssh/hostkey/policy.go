@@ -0,0 +1,74 @@
+package hostkey
+
+import (
+	"net"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Mode selects how a known_hosts callback treats hosts that are not in the
+// file and hosts that present a key different from the one on record. The
+// modes correspond to the values of the StrictHostKeyChecking ssh_config
+// option. Keys of known hosts are verified in every mode.
+type Mode int
+
+const (
+	// ModeAcceptNew adds the keys of unknown hosts to the known_hosts file and
+	// refuses hosts whose key has changed ("accept-new").
+	ModeAcceptNew Mode = iota
+	// ModeYes refuses unknown hosts and hosts whose key has changed. The
+	// known_hosts file is never modified ("yes").
+	ModeYes
+	// ModeAsk lets the Prompt of the policy decide whether the key of an
+	// unknown host is trusted and added to the known_hosts file. Without a
+	// Prompt, unknown hosts are refused. Hosts whose key has changed are
+	// refused ("ask").
+	ModeAsk
+	// ModeNo adds the keys of unknown hosts and accepts hosts whose key has
+	// changed with a warning ("no" or "off").
+	ModeNo
+)
+
+// String returns the StrictHostKeyChecking value of the mode.
+func (m Mode) String() string {
+	switch m {
+	case ModeAcceptNew:
+		return "accept-new"
+	case ModeYes:
+		return "yes"
+	case ModeAsk:
+		return "ask"
+	case ModeNo:
+		return "no"
+	default:
+		return "unknown"
+	}
+}
+
+// PromptFunc is called to confirm the key of a host that is not in the
+// known_hosts file. The key is trusted when it returns true. A returned error
+// refuses the key.
+type PromptFunc func(hostname string, remote net.Addr, key ssh.PublicKey) (bool, error)
+
+// Policy defines how a known_hosts callback created by KnownHostsCallback
+// treats unknown hosts and changed host keys.
+type Policy struct {
+	// Mode is the StrictHostKeyChecking mode. The zero value is ModeAcceptNew.
+	Mode Mode
+	// Prompt confirms the keys of unknown hosts in ModeAsk.
+	Prompt PromptFunc
+	// Hash stores the host names of new entries hashed, like the
+	// HashKnownHosts ssh_config option.
+	Hash bool
+	// ReadOnly never modifies the known_hosts file, for system-wide files such
+	// as /etc/ssh/ssh_known_hosts. An unknown host is then only accepted in
+	// ModeNo or when confirmed by the Prompt in ModeAsk, and only for the
+	// current connection.
+	ReadOnly bool
+	// CheckHostIP also verifies the connecting IP address, see WithCheckHostIP.
+	CheckHostIP bool
+	// AuthorityFiles are additional known_hosts files whose @cert-authority
+	// and @revoked lines apply, such as the system-wide files when the user
+	// file is checked. Files that don't exist or can't be read are skipped.
+	AuthorityFiles []string
+}
@@ -0,0 +1,114 @@
+package hostkey_test
+
+import (
+	"errors"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/k0sproject/rig/v2/protocol/ssh/hostkey"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestKnownHostsCallbackModes(t *testing.T) {
+	known := newTestSigner(t)
+	other := newTestSigner(t)
+	addr, err := net.ResolveTCPAddr("tcp", "192.0.2.1:22")
+	require.NoError(t, err)
+	knownLine := knownhosts.Line([]string{knownhosts.Normalize("192.0.2.1:22")}, known.PublicKey())
+
+	accept := func(string, net.Addr, ssh.PublicKey) (bool, error) { return true, nil }
+	reject := func(string, net.Addr, ssh.PublicKey) (bool, error) { return false, nil }
+	failing := func(string, net.Addr, ssh.PublicKey) (bool, error) { return false, errors.New("no terminal") }
+
+	tests := []struct {
+		name        string
+		policy      hostkey.Policy
+		unknownErr  bool
+		added       bool
+		mismatchErr bool
+	}{
+		{name: "accept-new", policy: hostkey.Policy{Mode: hostkey.ModeAcceptNew}, added: true, mismatchErr: true},
+		{name: "yes", policy: hostkey.Policy{Mode: hostkey.ModeYes}, unknownErr: true, mismatchErr: true},
+		{name: "ask accepted", policy: hostkey.Policy{Mode: hostkey.ModeAsk, Prompt: accept}, added: true, mismatchErr: true},
+		{name: "ask rejected", policy: hostkey.Policy{Mode: hostkey.ModeAsk, Prompt: reject}, unknownErr: true, mismatchErr: true},
+		{name: "ask failed", policy: hostkey.Policy{Mode: hostkey.ModeAsk, Prompt: failing}, unknownErr: true, mismatchErr: true},
+		{name: "ask without prompt", policy: hostkey.Policy{Mode: hostkey.ModeAsk}, unknownErr: true, mismatchErr: true},
+		{name: "no", policy: hostkey.Policy{Mode: hostkey.ModeNo}, added: true},
+		{name: "read-only accept-new", policy: hostkey.Policy{Mode: hostkey.ModeAcceptNew, ReadOnly: true}, unknownErr: true, mismatchErr: true},
+		{name: "read-only ask accepted", policy: hostkey.Policy{Mode: hostkey.ModeAsk, Prompt: accept, ReadOnly: true}, mismatchErr: true},
+		{name: "read-only no", policy: hostkey.Policy{Mode: hostkey.ModeNo, ReadOnly: true}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			khFile := writeKnownHostsFile(t)
+			cb, err := hostkey.KnownHostsCallback(khFile, tc.policy)
+			require.NoError(t, err)
+
+			err = cb("192.0.2.1:22", addr, known.PublicKey())
+			if tc.unknownErr {
+				require.ErrorIs(t, err, hostkey.ErrHostKeyMismatch)
+			} else {
+				require.NoError(t, err)
+			}
+			contents, err := os.ReadFile(khFile)
+			require.NoError(t, err)
+			if tc.added {
+				require.Contains(t, string(contents), knownLine)
+			} else {
+				require.Empty(t, contents)
+			}
+
+			khFile = writeKnownHostsFile(t, knownLine)
+			cb, err = hostkey.KnownHostsCallback(khFile, tc.policy)
+			require.NoError(t, err)
+			require.NoError(t, cb("192.0.2.1:22", addr, known.PublicKey()), "a known key is accepted in every mode")
+			err = cb("192.0.2.1:22", addr, other.PublicKey())
+			if tc.mismatchErr {
+				require.ErrorIs(t, err, hostkey.ErrHostKeyMismatch)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestKnownHostsCallbackRevokedMarker(t *testing.T) {
+	signer := newTestSigner(t)
+	line := "@revoked * " + string(ssh.MarshalAuthorizedKey(signer.PublicKey()))
+	khFile := writeKnownHostsFile(t, line)
+
+	cb, err := hostkey.KnownHostsCallback(khFile, hostkey.Policy{Mode: hostkey.ModeNo})
+	require.NoError(t, err)
+
+	addr, err := net.ResolveTCPAddr("tcp", "192.0.2.1:22")
+	require.NoError(t, err)
+	err = cb("192.0.2.1:22", addr, signer.PublicKey())
+	require.ErrorIs(t, err, hostkey.ErrHostKeyRevoked, "a revoked key is refused even when StrictHostKeyChecking is 'no'")
+	require.ErrorIs(t, err, hostkey.ErrHostKeyMismatch)
+}
+
+func TestUnknownAndAddHostKeys(t *testing.T) {
+	known := newTestSigner(t)
+	rotated := newTestSigner(t)
+	addr, err := net.ResolveTCPAddr("tcp", "192.0.2.1:22")
+	require.NoError(t, err)
+	khFile := writeKnownHostsFile(t, knownhosts.Line([]string{knownhosts.Normalize("192.0.2.1:22")}, known.PublicKey()))
+
+	keys := []ssh.PublicKey{known.PublicKey(), rotated.PublicKey()}
+	unknown, err := hostkey.UnknownHostKeys(khFile, "192.0.2.1:22", addr, keys)
+	require.NoError(t, err)
+	require.Len(t, unknown, 1)
+	require.Equal(t, rotated.PublicKey().Marshal(), unknown[0].Marshal())
+
+	require.NoError(t, hostkey.AddHostKeys(khFile, addr, unknown, true))
+	unknown, err = hostkey.UnknownHostKeys(khFile, "192.0.2.1:22", addr, keys)
+	require.NoError(t, err)
+	require.Empty(t, unknown)
+
+	contents, err := os.ReadFile(khFile)
+	require.NoError(t, err)
+	require.Contains(t, string(contents), "|1|", "the new entry is hashed")
+}
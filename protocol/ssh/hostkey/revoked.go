@@ -0,0 +1,326 @@
+package hostkey
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1" //nolint:gosec // KRLs identify keys by SHA1 fingerprint
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrInvalidKRL is returned when a key revocation list can't be parsed.
+var ErrInvalidKRL = errors.New("invalid key revocation list")
+
+// krlMagic starts a binary OpenSSH key revocation list, see PROTOCOL.krl in
+// the OpenSSH sources.
+const krlMagic = "SSHKRL\n\x00"
+
+const (
+	krlFormatVersion = 1
+
+	krlSectionCertificates      = 1
+	krlSectionExplicitKey       = 2
+	krlSectionFingerprintSHA1   = 3
+	krlSectionSignature         = 4
+	krlSectionFingerprintSHA256 = 5
+
+	krlCertSectionSerialList   = 0x20
+	krlCertSectionSerialRange  = 0x21
+	krlCertSectionSerialBitmap = 0x22
+	krlCertSectionKeyID        = 0x23
+)
+
+// WithRevokedKeys wraps callback to refuse the host keys listed in the file at
+// path, like the RevokedHostKeys ssh_config option. The file either lists one
+// public key per line in the authorized_keys format or is an OpenSSH key
+// revocation list (KRL) as generated by "ssh-keygen -k". A host certificate
+// is refused when the certificate, its key or the key of the signing CA is
+// revoked. As with ssh(1), a file that can't be read refuses all hosts, so
+// an error is returned. The signatures of a KRL are not verified.
+func WithRevokedKeys(callback ssh.HostKeyCallback, path string) (ssh.HostKeyCallback, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: revoked host keys: %w", ErrCheckHostKey, err)
+	}
+	revoked, err := parseRevokedKeys(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: revoked host keys %s: %w", ErrCheckHostKey, path, err)
+	}
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if revoked.isRevoked(key) {
+			return fmt.Errorf("%w: %s %s", ErrHostKeyRevoked, key.Type(), ssh.FingerprintSHA256(key))
+		}
+		return callback(hostname, remote, key)
+	}, nil
+}
+
+// revokedKeys is a set of revoked keys and certificates.
+type revokedKeys struct {
+	keys   map[string]struct{}
+	sha1   map[string]struct{}
+	sha256 map[string]struct{}
+	certs  []*revokedCerts
+}
+
+// revokedCerts lists the revoked certificates signed by a CA.
+type revokedCerts struct {
+	// ca is the wire format of the CA key, empty for any CA.
+	ca      []byte
+	ranges  [][2]uint64
+	bitmaps []serialBitmap
+	keyIDs  map[string]struct{}
+}
+
+type serialBitmap struct {
+	offset uint64
+	bits   *big.Int
+}
+
+func newRevokedKeys() *revokedKeys {
+	return &revokedKeys{
+		keys:   make(map[string]struct{}),
+		sha1:   make(map[string]struct{}),
+		sha256: make(map[string]struct{}),
+	}
+}
+
+func parseRevokedKeys(data []byte) (*revokedKeys, error) {
+	if bytes.HasPrefix(data, []byte(krlMagic)) {
+		return parseKRL(data)
+	}
+
+	revoked := newRevokedKeys()
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		key, _, _, _, err := ssh.ParseAuthorizedKey(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		revoked.keys[string(key.Marshal())] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read: %w", err)
+	}
+	return revoked, nil
+}
+
+func (r *revokedKeys) isRevoked(key ssh.PublicKey) bool {
+	if r.keyRevoked(key) {
+		return true
+	}
+	cert, ok := key.(*ssh.Certificate)
+	if !ok {
+		return false
+	}
+	return r.keyRevoked(cert.Key) || r.keyRevoked(cert.SignatureKey) || r.certRevoked(cert)
+}
+
+func (r *revokedKeys) keyRevoked(key ssh.PublicKey) bool {
+	blob := key.Marshal()
+	if _, ok := r.keys[string(blob)]; ok {
+		return true
+	}
+	sum1 := sha1.Sum(blob) //nolint:gosec // KRLs identify keys by SHA1 fingerprint
+	if _, ok := r.sha1[string(sum1[:])]; ok {
+		return true
+	}
+	sum256 := sha256.Sum256(blob)
+	_, ok := r.sha256[string(sum256[:])]
+	return ok
+}
+
+func (r *revokedKeys) certRevoked(cert *ssh.Certificate) bool {
+	ca := cert.SignatureKey.Marshal()
+	for _, rc := range r.certs {
+		if len(rc.ca) > 0 && !bytes.Equal(rc.ca, ca) {
+			continue
+		}
+		if _, ok := rc.keyIDs[cert.KeyId]; ok {
+			return true
+		}
+		for _, rng := range rc.ranges {
+			if cert.Serial >= rng[0] && cert.Serial <= rng[1] {
+				return true
+			}
+		}
+		for _, bm := range rc.bitmaps {
+			if cert.Serial < bm.offset {
+				continue
+			}
+			if pos := cert.Serial - bm.offset; pos < uint64(bm.bits.BitLen()) && bm.bits.Bit(int(pos)) == 1 { //nolint:gosec // bounded by BitLen
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// krlReader decodes the fields of a binary key revocation list.
+type krlReader struct {
+	data []byte
+	err  error
+}
+
+func (r *krlReader) empty() bool {
+	return r.err != nil || len(r.data) == 0
+}
+
+func (r *krlReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.data) < n {
+		r.err = fmt.Errorf("%w: truncated", ErrInvalidKRL)
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *krlReader) readByte() byte {
+	if b := r.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *krlReader) readUint32() uint32 {
+	if b := r.next(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *krlReader) readUint64() uint64 {
+	if b := r.next(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (r *krlReader) readString() []byte {
+	return r.next(int(r.readUint32()))
+}
+
+func parseKRL(data []byte) (*revokedKeys, error) {
+	r := &krlReader{data: data}
+	r.next(len(krlMagic))
+	if version := r.readUint32(); r.err == nil && version != krlFormatVersion {
+		return nil, fmt.Errorf("%w: unsupported format version %d", ErrInvalidKRL, version)
+	}
+	r.readUint64() // krl_version
+	r.readUint64() // generated_date
+	r.readUint64() // flags
+	r.readString() // reserved
+	r.readString() // comment
+
+	revoked := newRevokedKeys()
+	for !r.empty() {
+		sectionType := r.readByte()
+		section := &krlReader{data: r.readString()}
+		if r.err != nil {
+			break
+		}
+		switch sectionType {
+		case krlSectionCertificates:
+			certs, err := parseKRLCertificates(section)
+			if err != nil {
+				return nil, err
+			}
+			revoked.certs = append(revoked.certs, certs)
+		case krlSectionExplicitKey:
+			for !section.empty() {
+				blob := section.readString()
+				if section.err != nil {
+					break
+				}
+				key, err := ssh.ParsePublicKey(blob)
+				if err != nil {
+					return nil, fmt.Errorf("%w: revoked key: %w", ErrInvalidKRL, err)
+				}
+				revoked.keys[string(key.Marshal())] = struct{}{}
+			}
+		case krlSectionFingerprintSHA1:
+			for !section.empty() {
+				revoked.sha1[string(section.readString())] = struct{}{}
+			}
+		case krlSectionFingerprintSHA256:
+			for !section.empty() {
+				revoked.sha256[string(section.readString())] = struct{}{}
+			}
+		case krlSectionSignature:
+			// signatures follow all the other sections
+			return revoked, nil
+		default:
+			return nil, fmt.Errorf("%w: unknown section type %d", ErrInvalidKRL, sectionType)
+		}
+		if section.err != nil {
+			return nil, section.err
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return revoked, nil
+}
+
+func parseKRLCertificates(r *krlReader) (*revokedCerts, error) {
+	certs := &revokedCerts{ca: r.readString(), keyIDs: make(map[string]struct{})}
+	r.readString() // reserved
+	if r.err != nil {
+		return nil, r.err
+	}
+	if len(certs.ca) > 0 {
+		if _, err := ssh.ParsePublicKey(certs.ca); err != nil {
+			return nil, fmt.Errorf("%w: certificate authority: %w", ErrInvalidKRL, err)
+		}
+	}
+
+	for !r.empty() {
+		sectionType := r.readByte()
+		section := &krlReader{data: r.readString()}
+		if r.err != nil {
+			break
+		}
+		switch sectionType {
+		case krlCertSectionSerialList:
+			for !section.empty() {
+				serial := section.readUint64()
+				certs.ranges = append(certs.ranges, [2]uint64{serial, serial})
+			}
+		case krlCertSectionSerialRange:
+			certs.ranges = append(certs.ranges, [2]uint64{section.readUint64(), section.readUint64()})
+		case krlCertSectionSerialBitmap:
+			offset := section.readUint64()
+			bits := new(big.Int).SetBytes(section.readString())
+			certs.bitmaps = append(certs.bitmaps, serialBitmap{offset: offset, bits: bits})
+		case krlCertSectionKeyID:
+			for !section.empty() {
+				certs.keyIDs[string(section.readString())] = struct{}{}
+			}
+		default:
+			return nil, fmt.Errorf("%w: unknown certificate section type %d", ErrInvalidKRL, sectionType)
+		}
+		if section.err != nil {
+			return nil, section.err
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return certs, nil
+}
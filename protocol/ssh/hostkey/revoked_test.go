@@ -0,0 +1,138 @@
+package hostkey_test
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/k0sproject/rig/v2/protocol/ssh/hostkey"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// krlBuilder assembles a binary OpenSSH key revocation list.
+type krlBuilder struct {
+	buf []byte
+}
+
+func newKRL() *krlBuilder {
+	b := &krlBuilder{buf: []byte("SSHKRL\n\x00")}
+	b.buf = binary.BigEndian.AppendUint32(b.buf, 1) // format version
+	b.buf = binary.BigEndian.AppendUint64(b.buf, 1) // krl version
+	b.buf = binary.BigEndian.AppendUint64(b.buf, 0) // generated date
+	b.buf = binary.BigEndian.AppendUint64(b.buf, 0) // flags
+	b.buf = appendString(b.buf, nil)                // reserved
+	b.buf = appendString(b.buf, []byte("test"))     // comment
+	return b
+}
+
+func appendString(buf, s []byte) []byte {
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(s)))
+	return append(buf, s...)
+}
+
+func (b *krlBuilder) section(typ byte, data []byte) *krlBuilder {
+	b.buf = append(b.buf, typ)
+	b.buf = appendString(b.buf, data)
+	return b
+}
+
+func certSection(ca ssh.PublicKey, typ byte, data []byte) []byte {
+	var out []byte
+	if ca != nil {
+		out = appendString(out, ca.Marshal())
+	} else {
+		out = appendString(out, nil)
+	}
+	out = appendString(out, nil) // reserved
+	out = append(out, typ)
+	return appendString(out, data)
+}
+
+func newHostCert(t *testing.T, ca ssh.Signer, serial uint64, keyID string) *ssh.Certificate {
+	t.Helper()
+	cert := &ssh.Certificate{
+		Key:             newTestSigner(t).PublicKey(),
+		Serial:          serial,
+		CertType:        ssh.HostCert,
+		KeyId:           keyID,
+		ValidPrincipals: []string{"example.com"},
+		ValidBefore:     ssh.CertTimeInfinity,
+	}
+	require.NoError(t, cert.SignCert(rand.Reader, ca))
+	return cert
+}
+
+func writeRevokedFile(t *testing.T, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "revoked")
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	return path
+}
+
+func checkRevoked(t *testing.T, path string, key ssh.PublicKey) error {
+	t.Helper()
+	cb, err := hostkey.WithRevokedKeys(hostkey.InsecureIgnoreHostKeyCallback, path)
+	require.NoError(t, err)
+	addr, err := net.ResolveTCPAddr("tcp", "192.0.2.1:22")
+	require.NoError(t, err)
+	return cb("example.com:22", addr, key)
+}
+
+func TestWithRevokedKeysAuthorizedKeysFormat(t *testing.T) {
+	revoked := newTestSigner(t)
+	other := newTestSigner(t)
+	content := "# revoked after the incident\n\n" + string(ssh.MarshalAuthorizedKey(revoked.PublicKey()))
+	path := writeRevokedFile(t, []byte(content))
+
+	require.ErrorIs(t, checkRevoked(t, path, revoked.PublicKey()), hostkey.ErrHostKeyRevoked)
+	require.NoError(t, checkRevoked(t, path, other.PublicKey()))
+}
+
+func TestWithRevokedKeysKRL(t *testing.T) {
+	explicit := newTestSigner(t)
+	byHash := newTestSigner(t)
+	other := newTestSigner(t)
+	ca := newTestSigner(t)
+	otherCA := newTestSigner(t)
+
+	sum := sha256.Sum256(byHash.PublicKey().Marshal())
+	bitmap := new(big.Int).SetBit(new(big.Int), 3, 1) // serial 103
+	krl := newKRL().
+		section(2, appendString(nil, explicit.PublicKey().Marshal())).
+		section(5, appendString(nil, sum[:])).
+		section(1, certSection(ca.PublicKey(), 0x21, binary.BigEndian.AppendUint64(binary.BigEndian.AppendUint64(nil, 10), 20))).
+		section(1, certSection(ca.PublicKey(), 0x22, appendString(binary.BigEndian.AppendUint64(nil, 100), bitmap.Bytes()))).
+		section(1, certSection(nil, 0x23, appendString(nil, []byte("compromised")))).
+		section(4, appendString(nil, []byte("ignored signature")))
+	path := writeRevokedFile(t, krl.buf)
+
+	require.ErrorIs(t, checkRevoked(t, path, explicit.PublicKey()), hostkey.ErrHostKeyRevoked)
+	require.ErrorIs(t, checkRevoked(t, path, byHash.PublicKey()), hostkey.ErrHostKeyRevoked)
+	require.NoError(t, checkRevoked(t, path, other.PublicKey()))
+
+	require.ErrorIs(t, checkRevoked(t, path, newHostCert(t, ca, 15, "web")), hostkey.ErrHostKeyRevoked, "serial in a revoked range")
+	require.ErrorIs(t, checkRevoked(t, path, newHostCert(t, ca, 103, "web")), hostkey.ErrHostKeyRevoked, "serial in a revoked bitmap")
+	require.NoError(t, checkRevoked(t, path, newHostCert(t, ca, 102, "web")))
+	require.NoError(t, checkRevoked(t, path, newHostCert(t, otherCA, 15, "web")), "serials are revoked per CA")
+	require.ErrorIs(t, checkRevoked(t, path, newHostCert(t, otherCA, 1, "compromised")), hostkey.ErrHostKeyRevoked, "key id revoked for any CA")
+	require.ErrorIs(t, checkRevoked(t, path, newHostCert(t, explicit, 1, "web")), hostkey.ErrHostKeyRevoked, "signed by a revoked CA key")
+}
+
+func TestWithRevokedKeysErrors(t *testing.T) {
+	_, err := hostkey.WithRevokedKeys(hostkey.InsecureIgnoreHostKeyCallback, filepath.Join(t.TempDir(), "missing"))
+	require.ErrorIs(t, err, hostkey.ErrCheckHostKey, "a missing file refuses all hosts")
+
+	_, err = hostkey.WithRevokedKeys(hostkey.InsecureIgnoreHostKeyCallback, writeRevokedFile(t, []byte("not a key\n")))
+	require.ErrorIs(t, err, hostkey.ErrCheckHostKey)
+
+	truncated := newKRL().buf
+	truncated = append(truncated, 2, 0, 0, 1)
+	_, err = hostkey.WithRevokedKeys(hostkey.InsecureIgnoreHostKeyCallback, writeRevokedFile(t, truncated))
+	require.ErrorIs(t, err, hostkey.ErrInvalidKRL)
+}
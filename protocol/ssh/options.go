@@ -4,12 +4,14 @@ import (
 	"time"
 
 	"github.com/k0sproject/rig/v2/log"
+	"github.com/k0sproject/rig/v2/protocol/ssh/hostkey"
 )
 
 // Options for the SSH client.
 type Options struct {
 	log.LoggerInjectable
 	KeepAliveInterval *time.Duration
+	HostKeyPrompt     hostkey.PromptFunc
 }
 
 // Option is a function that sets some option on the Options struct.
@@ -37,3 +39,15 @@ func WithKeepAlive(d time.Duration) Option {
 		o.KeepAliveInterval = &d
 	}
 }
+
+// WithHostKeyPrompt sets a function that confirms the keys of hosts that are
+// not in the known_hosts file when StrictHostKeyChecking is "ask", and the
+// keys learned when UpdateHostKeys is "ask". Without a prompt, rig can't ask
+// anyone and treats StrictHostKeyChecking "ask", which is the ssh_config
+// default, like "accept-new" and does not learn keys when UpdateHostKeys is
+// "ask".
+func WithHostKeyPrompt(prompt hostkey.PromptFunc) Option {
+	return func(o *Options) {
+		o.HostKeyPrompt = prompt
+	}
+}
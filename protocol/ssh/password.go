@@ -0,0 +1,23 @@
+package ssh
+
+import (
+	"fmt"
+
+	"github.com/k0sproject/rig/v2/protocol"
+)
+
+var _ protocol.LoginPassworder = (*Connection)(nil)
+
+// LoginPassword returns the password from Config.LoginPasswordCallback, which
+// is only called the first time the password is needed. An error wrapping
+// [protocol.ErrUnsupported] is returned when no callback is set.
+func (c *Connection) LoginPassword() (string, error) {
+	if c.loginPassword == nil {
+		return "", fmt.Errorf("%w: no login password callback", protocol.ErrUnsupported)
+	}
+	password, err := c.loginPassword()
+	if err != nil {
+		return "", fmt.Errorf("get login password: %w", err)
+	}
+	return password, nil
+}
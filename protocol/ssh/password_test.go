@@ -0,0 +1,51 @@
+package ssh
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/k0sproject/rig/v2/protocol"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoginPassword(t *testing.T) {
+	hostSigner := newHostSigner(t)
+	addr := startSessionSSHServer(t, hostSigner, make(chan string, 10))
+	withConfigParser(t, "")
+	t.Setenv("SSH_AUTH_SOCK", "")
+	pinHostKey(t, addr, hostSigner)
+	host, portStr, err := net.SplitHostPort(addr)
+	require.NoError(t, err)
+	port, err := strconv.Atoi(portStr)
+	require.NoError(t, err)
+
+	calls := 0
+	conn, err := NewConnection(Config{
+		Address: host,
+		Port:    port,
+		User:    "test",
+		LoginPasswordCallback: func() (string, error) {
+			calls++
+			return "s3cret", nil
+		},
+	})
+	require.NoError(t, err)
+	t.Cleanup(conn.Disconnect)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	require.NoError(t, conn.Connect(ctx), "password authentication is used")
+
+	password, err := conn.LoginPassword()
+	require.NoError(t, err)
+	require.Equal(t, "s3cret", password)
+	require.Equal(t, 1, calls, "the callback is called once")
+
+	conn, err = NewConnection(Config{Address: host, Port: port, User: "test"})
+	require.NoError(t, err)
+	_, err = conn.LoginPassword()
+	require.ErrorIs(t, err, protocol.ErrUnsupported)
+}
@@ -0,0 +1,108 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/k0sproject/rig/v2/protocol"
+	ssh "golang.org/x/crypto/ssh"
+)
+
+var (
+	_ protocol.Signaler     = (*process)(nil)
+	_ protocol.StdinCloser  = (*process)(nil)
+	_ protocol.ExitStatuser = (*process)(nil)
+)
+
+// process is a command running in an SSH session. The SSH protocol does not
+// report the remote process id.
+type process struct {
+	session   *ssh.Session
+	stdin     io.WriteCloser
+	closeOnce sync.Once
+
+	mu         sync.Mutex
+	exitCode   int
+	exitSignal protocol.Signal
+}
+
+// startProcess starts cmd in session, copying stdin to it through a pipe that
+// can be closed with CloseStdin.
+func startProcess(session *ssh.Session, cmd string, stdin io.Reader) (*process, error) {
+	proc := &process{session: session, exitCode: -1}
+	if stdin != nil {
+		pipe, err := session.StdinPipe()
+		if err != nil {
+			return nil, fmt.Errorf("stdin pipe: %w", err)
+		}
+		proc.stdin = pipe
+	}
+	if err := session.Start(cmd); err != nil {
+		return nil, fmt.Errorf("start session: %w", err)
+	}
+	if stdin != nil {
+		go func() {
+			_, _ = io.Copy(proc.stdin, stdin)
+			_ = proc.CloseStdin()
+		}()
+	}
+	return proc, nil
+}
+
+// Wait waits for the remote process to exit.
+func (p *process) Wait() error {
+	err := p.session.Wait()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var exitErr *ssh.ExitError
+	switch {
+	case err == nil:
+		p.exitCode = 0
+	case errors.As(err, &exitErr):
+		// x/crypto/ssh reports -1 when the server sent an exit-signal
+		// instead of an exit-status.
+		p.exitCode = exitErr.ExitStatus()
+		p.exitSignal = protocol.Signal(exitErr.Signal())
+	}
+	return err //nolint:wrapcheck // the exit error is inspected by callers
+}
+
+// Signal sends sig to the remote process through the session's signal
+// channel. Servers that don't implement signal delivery, such as OpenSSH
+// before 7.9, ignore it.
+func (p *process) Signal(sig protocol.Signal) error {
+	if err := p.session.Signal(ssh.Signal(sig)); err != nil {
+		return fmt.Errorf("signal %s: %w", sig, err)
+	}
+	return nil
+}
+
+// CloseStdin sends EOF to the remote process.
+func (p *process) CloseStdin() error {
+	if p.stdin == nil {
+		return nil
+	}
+	var err error
+	p.closeOnce.Do(func() { err = p.stdin.Close() })
+	if err != nil {
+		return fmt.Errorf("close stdin: %w", err)
+	}
+	return nil
+}
+
+// ExitCode returns the exit status of the remote process.
+func (p *process) ExitCode() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.exitCode
+}
+
+// ExitSignal returns the signal reported by the server as having terminated
+// the remote process.
+func (p *process) ExitSignal() protocol.Signal {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.exitSignal
+}
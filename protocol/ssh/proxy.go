@@ -134,7 +134,7 @@ func (c *Connection) proxyCommandClientConfig(ctx context.Context, config *ssh.C
 	if !c.sshConfig.CheckHostIP.IsTrue() || c.sshConfig.HostKeyAlias != "" {
 		return config, nil
 	}
-	hkc, err := c.hostkeyCallback(ctx, false)
+	hkc, err := c.verifyHostKeyCallback(ctx, false)
 	if err != nil {
 		return nil, fmt.Errorf("%w: proxy host key callback: %w", protocol.ErrNonRetryable, err)
 	}
@@ -248,12 +248,10 @@ func (c *Connection) connectViaProxyCommand(ctx context.Context, dst string, con
 	}
 
 	c.mu.Lock()
-	c.client = ssh.NewClient(result.ncc, result.chans, result.reqs)
+	c.client = c.newClient(result.ncc, result.chans, result.reqs)
 	c.proxyCmd = proc
 	c.startKeepalive()
 	c.mu.Unlock()
 
-	c.prewarmWindows(ctx)
-
-	return nil
+	return c.finishConnect(ctx)
 }
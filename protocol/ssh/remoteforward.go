@@ -0,0 +1,108 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/k0sproject/rig/v2/log"
+)
+
+// remoteForwardBind is the bind address sent to the server when a remote
+// forward is configured without one. Like ssh(1), the listener is then only
+// bound to the loopback interface of the remote host.
+const remoteForwardBind = "localhost"
+
+// listenRemote asks the server to listen on address and returns a listener
+// for the connections it forwards back.
+func (c *Connection) listenRemote(network, address string) (net.Listener, error) {
+	c.mu.Lock()
+	client := c.client
+	c.mu.Unlock()
+	if client == nil {
+		return nil, errNotConnected
+	}
+	listener, err := client.Listen(network, address)
+	if err != nil {
+		return nil, fmt.Errorf("remote listen %s: %w", address, err)
+	}
+	return listener, nil
+}
+
+// ServeRemote asks the server to listen on remoteAddr (host:port) and hands
+// every connection made to it on the remote side to handler. The connection
+// is closed when handler returns, and an error returned by handler is
+// reported like any other tunnel error (see [WithForwardErrorHandler]). Use
+// port 0 to have the server pick a free port and read it from [Tunnel.Addr].
+//
+// Binding to anything but the loopback interface of the remote host requires
+// GatewayPorts to be enabled in the server's sshd_config. The tunnel is
+// closed when the connection is disconnected.
+func (c *Connection) ServeRemote(remoteAddr string, handler func(net.Conn) error, opts ...ForwardOption) (*Tunnel, error) {
+	if handler == nil {
+		return nil, fmt.Errorf("%w: nil handler", errInvalidForwardSpec)
+	}
+	listener, err := c.listenRemote("tcp", remoteAddr)
+	if err != nil {
+		return nil, err
+	}
+	c.Log().Debug("started remote port forward", "listen", remoteAddr)
+	return c.startTunnel(listener, handler, opts...), nil
+}
+
+// ListenRemote asks the server to listen on remoteAddr and forwards every
+// connection made to it on the remote side to localAddr, which is dialed from
+// the local host. This is the equivalent of "ssh -R remoteAddr:localAddr".
+// See [Connection.ServeRemote] for details about the remote listener.
+func (c *Connection) ListenRemote(remoteAddr, localAddr string, opts ...ForwardOption) (*Tunnel, error) {
+	return c.ServeRemote(remoteAddr, dialHandler("tcp", localAddr), opts...)
+}
+
+// dialHandler returns a tunnel handler that connects each forwarded
+// connection to address on the local host.
+func dialHandler(network, address string) func(net.Conn) error {
+	return func(remote net.Conn) error {
+		var dialer net.Dialer
+		local, err := dialer.DialContext(context.Background(), network, address)
+		if err != nil {
+			return fmt.Errorf("forward %s to local %s: %w", remote.RemoteAddr(), address, err)
+		}
+		defer local.Close()
+		if err := pipe(remote, local); err != nil {
+			return fmt.Errorf("forward %s to local %s: %w", remote.RemoteAddr(), address, err)
+		}
+		return nil
+	}
+}
+
+// startRemoteForward starts one RemoteForward directive from the ssh config.
+func (c *Connection) startRemoteForward(listenSpec, targetSpec string) error {
+	listen, err := parseForwardListen(listenSpec, remoteForwardBind)
+	if err != nil {
+		return err
+	}
+	target, err := parseForwardTarget(targetSpec)
+	if err != nil {
+		return err
+	}
+	listener, err := c.listenRemote(listen.network, listen.address)
+	if err != nil {
+		return err
+	}
+	c.startTunnel(listener, dialHandler(target.network, target.address))
+	c.Log().Debug("started remote port forward from ssh config", "listen", listen.String(), "local", target.String())
+	return nil
+}
+
+// startConfiguredRemoteForwards starts the RemoteForward directives from the
+// ssh config and returns the errors of the ones that failed.
+func (c *Connection) startConfiguredRemoteForwards(ctx context.Context) []error {
+	var errs []error
+	for listen, target := range c.sshConfig.RemoteForward {
+		if err := c.startRemoteForward(listen, target); err != nil {
+			log.Trace(ctx, "failed to set up RemoteForward", "listen", listen, "target", target, log.ErrorAttr(err))
+			errs = append(errs, fmt.Errorf("RemoteForward %s %s: %w", listen, target, err))
+		}
+	}
+	return errs
+}
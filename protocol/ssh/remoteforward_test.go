@@ -0,0 +1,221 @@
+package ssh
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	ssh "golang.org/x/crypto/ssh"
+)
+
+// tcpipForwardMsg is the payload of a "tcpip-forward" and a
+// "cancel-tcpip-forward" global request (RFC 4254 7.1).
+type tcpipForwardMsg struct {
+	Addr string
+	Port uint32
+}
+
+// forwardedTCPIPMsg is the payload of a "forwarded-tcpip" channel (RFC 4254 7.2).
+type forwardedTCPIPMsg struct {
+	Addr       string
+	Port       uint32
+	OriginAddr string
+	OriginPort uint32
+}
+
+// remoteForwarder implements the server side of remote port forwarding for
+// the test SSH server. It listens on loopback regardless of the requested bind
+// address and records the addresses it was asked to listen on.
+type remoteForwarder struct {
+	mu        sync.Mutex
+	listeners map[string]net.Listener
+	requested []string
+}
+
+func newRemoteForwarder(t *testing.T) *remoteForwarder {
+	t.Helper()
+	f := &remoteForwarder{listeners: make(map[string]net.Listener)}
+	t.Cleanup(func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		for _, ln := range f.listeners {
+			ln.Close()
+		}
+	})
+	return f
+}
+
+func (f *remoteForwarder) handle(sconn *ssh.ServerConn, req *ssh.Request) {
+	var msg tcpipForwardMsg
+	if err := ssh.Unmarshal(req.Payload, &msg); err != nil {
+		_ = req.Reply(false, nil)
+		return
+	}
+	key := net.JoinHostPort(msg.Addr, strconv.Itoa(int(msg.Port)))
+	switch req.Type {
+	case "tcpip-forward":
+		ln, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(int(msg.Port))))
+		if err != nil {
+			_ = req.Reply(false, nil)
+			return
+		}
+		port := uint32(ln.Addr().(*net.TCPAddr).Port) //nolint:gosec // test listener port
+		f.mu.Lock()
+		f.requested = append(f.requested, key)
+		f.listeners[net.JoinHostPort(msg.Addr, strconv.Itoa(int(port)))] = ln
+		f.mu.Unlock()
+		_ = req.Reply(true, ssh.Marshal(struct{ Port uint32 }{port}))
+		go func() {
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				go f.forward(sconn, conn, msg.Addr, port)
+			}
+		}()
+	case "cancel-tcpip-forward":
+		f.mu.Lock()
+		if ln, ok := f.listeners[key]; ok {
+			ln.Close()
+			delete(f.listeners, key)
+		}
+		f.mu.Unlock()
+		_ = req.Reply(true, nil)
+	default:
+		if req.WantReply {
+			_ = req.Reply(false, nil)
+		}
+	}
+}
+
+func (f *remoteForwarder) forward(sconn *ssh.ServerConn, conn net.Conn, addr string, port uint32) {
+	defer conn.Close()
+	origin := conn.RemoteAddr().(*net.TCPAddr) //nolint:forcetypeassert // tcp listener
+	ch, reqs, err := sconn.OpenChannel("forwarded-tcpip", ssh.Marshal(forwardedTCPIPMsg{
+		Addr:       addr,
+		Port:       port,
+		OriginAddr: origin.IP.String(),
+		OriginPort: uint32(origin.Port), //nolint:gosec // test listener port
+	}))
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	go func() {
+		_, _ = io.Copy(ch, conn)
+		_ = ch.CloseWrite()
+	}()
+	_, _ = io.Copy(conn, ch)
+	ch.Close()
+}
+
+func (f *remoteForwarder) requestedAddrs() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.requested...)
+}
+
+// remotePort returns the loopback port the forwarder listens on for the
+// forward that was requested with the given bind address.
+func (f *remoteForwarder) remotePort(t *testing.T, bind string) string {
+	t.Helper()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for key, ln := range f.listeners {
+		if host, _, _ := net.SplitHostPort(key); host == bind {
+			_, port, err := net.SplitHostPort(ln.Addr().String())
+			require.NoError(t, err)
+			return port
+		}
+	}
+	t.Fatalf("no remote forward for bind address %q", bind)
+	return ""
+}
+
+func TestListenRemote(t *testing.T) {
+	hostSigner := newHostSigner(t)
+	forwarder := newRemoteForwarder(t)
+	addr := startForwardingSSHServer(t, hostSigner, forwarder.handle)
+	echo := startEchoServer(t)
+	conn := connectTestServer(t, addr, hostSigner, nil)
+
+	tunnel, err := conn.ListenRemote("localhost:0", echo)
+	require.NoError(t, err)
+	_, port, err := net.SplitHostPort(tunnel.Addr().String())
+	require.NoError(t, err)
+	require.NotEqual(t, "0", port, "the server assigned port must be reported")
+
+	requireEcho(t, net.JoinHostPort("127.0.0.1", port))
+
+	require.NoError(t, tunnel.Close())
+	require.NoError(t, tunnel.Err())
+	_, err = net.DialTimeout("tcp", net.JoinHostPort("127.0.0.1", port), time.Second)
+	require.Error(t, err, "closing the tunnel must cancel the remote forward")
+}
+
+func TestServeRemote(t *testing.T) {
+	hostSigner := newHostSigner(t)
+	forwarder := newRemoteForwarder(t)
+	addr := startForwardingSSHServer(t, hostSigner, forwarder.handle)
+	conn := connectTestServer(t, addr, hostSigner, nil)
+
+	tunnel, err := conn.ServeRemote("localhost:0", func(c net.Conn) error {
+		_, err := fmt.Fprint(c, "served locally")
+		return err
+	})
+	require.NoError(t, err)
+	_, port, err := net.SplitHostPort(tunnel.Addr().String())
+	require.NoError(t, err)
+
+	remote, err := net.DialTimeout("tcp", net.JoinHostPort("127.0.0.1", port), 5*time.Second)
+	require.NoError(t, err)
+	defer remote.Close()
+	require.NoError(t, remote.SetReadDeadline(time.Now().Add(5*time.Second)))
+	got, err := io.ReadAll(remote)
+	require.NoError(t, err)
+	require.Equal(t, "served locally", string(got), "the connection is closed once the handler returns")
+}
+
+func TestServeRemoteNotConnected(t *testing.T) {
+	c := newTestConnection(t)
+	_, err := c.ListenRemote("localhost:0", "127.0.0.1:80")
+	require.ErrorIs(t, err, errNotConnected)
+	_, err = c.ServeRemote("localhost:0", nil)
+	require.ErrorIs(t, err, errInvalidForwardSpec)
+}
+
+func TestConnectStartsRemoteForwardFromConfig(t *testing.T) {
+	hostSigner := newHostSigner(t)
+	forwarder := newRemoteForwarder(t)
+	addr := startForwardingSSHServer(t, hostSigner, forwarder.handle)
+	echo := startEchoServer(t)
+
+	conn := connectTestServer(t, addr, hostSigner, map[string]any{
+		"RemoteForward": []string{"0", echo},
+	})
+	require.Equal(t, []string{"localhost:0"}, forwarder.requestedAddrs(),
+		"a forward without a bind address must only bind to the remote loopback")
+
+	port := forwarder.remotePort(t, "localhost")
+	requireEcho(t, net.JoinHostPort("127.0.0.1", port))
+
+	conn.Disconnect()
+}
+
+func TestConnectRemoteForwardFailure(t *testing.T) {
+	hostSigner := newHostSigner(t)
+	// without a request handler the server denies every tcpip-forward request
+	addr := startForwardingSSHServer(t, hostSigner, nil)
+	echo := startEchoServer(t)
+
+	conn := connectTestServer(t, addr, hostSigner, map[string]any{
+		"RemoteForward": []string{"8080", echo},
+	})
+	require.True(t, conn.IsConnected(), "a denied forward is only logged by default")
+}
@@ -0,0 +1,190 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/k0sproject/rig/v2/protocol"
+	"github.com/stretchr/testify/require"
+	ssh "golang.org/x/crypto/ssh"
+)
+
+// startSessionSSHServer starts a server that reports the requests it receives
+// on session channels to events. A session ends when it is sent SIGTERM. Only
+// environment variables named LC_* are accepted.
+func startSessionSSHServer(t *testing.T, hostSigner ssh.Signer, events chan<- string) string {
+	t.Helper()
+	return startSSHServerWith(t, newTestServerConfig(hostSigner), sshServerHandler{
+		channel: func(_ *ssh.ServerConn, newChan ssh.NewChannel) {
+			if newChan.ChannelType() != "session" {
+				newChan.Reject(ssh.UnknownChannelType, "not supported") //nolint:errcheck
+				return
+			}
+			serveRecordedSession(newChan, events)
+		},
+	})
+}
+
+func serveRecordedSession(newChan ssh.NewChannel, events chan<- string) {
+	ch, reqs, err := newChan.Accept()
+	if err != nil {
+		return
+	}
+	defer ch.Close()
+	for req := range reqs {
+		switch req.Type {
+		case "pty-req":
+			var p struct {
+				Term          string
+				Cols, Rows    uint32
+				Width, Height uint32
+				Modes         string
+			}
+			_ = ssh.Unmarshal(req.Payload, &p)
+			events <- fmt.Sprintf("pty-req %s %dx%d", p.Term, p.Cols, p.Rows)
+		case "window-change":
+			var p struct{ Cols, Rows, Width, Height uint32 }
+			_ = ssh.Unmarshal(req.Payload, &p)
+			events <- fmt.Sprintf("window-change %dx%d", p.Cols, p.Rows)
+		case "exec":
+			var p struct{ Command string }
+			_ = ssh.Unmarshal(req.Payload, &p)
+			events <- "exec " + p.Command
+		case "env":
+			var p struct{ Name, Value string }
+			_ = ssh.Unmarshal(req.Payload, &p)
+			if !strings.HasPrefix(p.Name, "LC_") {
+				_ = req.Reply(false, nil)
+				continue
+			}
+			events <- fmt.Sprintf("env %s=%s", p.Name, p.Value)
+		case "signal":
+			var p struct{ Signal string }
+			_ = ssh.Unmarshal(req.Payload, &p)
+			events <- "signal " + p.Signal
+			if p.Signal == string(ssh.SIGTERM) {
+				_, _ = ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+				return
+			}
+		}
+		if req.WantReply {
+			_ = req.Reply(true, nil)
+		}
+	}
+}
+
+func nextEvent(t *testing.T, events <-chan string) string {
+	t.Helper()
+	select {
+	case ev := <-events:
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a session request")
+		return ""
+	}
+}
+
+func TestExecInteractiveSession(t *testing.T) {
+	hostSigner := newHostSigner(t)
+	events := make(chan string, 10)
+	addr := startSessionSSHServer(t, hostSigner, events)
+	conn := connectTestServer(t, addr, hostSigner, nil)
+
+	t.Run("options", func(t *testing.T) {
+		resize := make(chan protocol.WindowSize)
+		signals := make(chan protocol.Signal)
+		opts := protocol.NewSessionOptions(
+			protocol.WithPTY(protocol.PTYForce),
+			protocol.WithTerm("vt220"),
+			protocol.WithWindowSize(100, 30),
+			protocol.WithResize(resize),
+			protocol.WithSignals(signals),
+		)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- conn.ExecInteractiveSession(ctx, "top", strings.NewReader(""), nil, nil, opts)
+		}()
+
+		require.Equal(t, "pty-req vt220 100x30", nextEvent(t, events))
+		require.Equal(t, "exec top", nextEvent(t, events))
+		resize <- protocol.WindowSize{Width: 120, Height: 40}
+		require.Equal(t, "window-change 120x40", nextEvent(t, events))
+		signals <- protocol.SIGINT
+		require.Equal(t, "signal INT", nextEvent(t, events))
+		signals <- protocol.SIGTERM
+		require.Equal(t, "signal TERM", nextEvent(t, events))
+		require.NoError(t, <-errCh)
+	})
+
+	t.Run("no pty for a non-terminal stdin", func(t *testing.T) {
+		signals := make(chan protocol.Signal)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- conn.ExecInteractiveSession(ctx, "top", strings.NewReader(""), nil, nil, protocol.SessionOptions{Signals: signals})
+		}()
+
+		require.Equal(t, "exec top", nextEvent(t, events))
+		signals <- protocol.SIGTERM
+		require.Equal(t, "signal TERM", nextEvent(t, events))
+		require.NoError(t, <-errCh)
+	})
+}
+
+func TestStartProcessSignal(t *testing.T) {
+	hostSigner := newHostSigner(t)
+	events := make(chan string, 10)
+	addr := startSessionSSHServer(t, hostSigner, events)
+	conn := connectTestServer(t, addr, hostSigner, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	waiter, err := conn.StartProcess(ctx, "k0s etcd backup", nil, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, "exec k0s etcd backup", nextEvent(t, events))
+
+	proc, ok := waiter.(*process)
+	require.True(t, ok)
+	require.Equal(t, -1, proc.ExitCode(), "no exit code before wait")
+	require.NoError(t, proc.CloseStdin())
+	require.NoError(t, proc.Signal(protocol.SIGTERM))
+	require.Equal(t, "signal TERM", nextEvent(t, events))
+	require.NoError(t, proc.Wait())
+	require.Equal(t, 0, proc.ExitCode())
+	require.Empty(t, proc.ExitSignal())
+}
+
+func TestStartProcessEnv(t *testing.T) {
+	hostSigner := newHostSigner(t)
+	events := make(chan string, 10)
+	addr := startSessionSSHServer(t, hostSigner, events)
+	conn := connectTestServer(t, addr, hostSigner, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	require.False(t, conn.AcceptsEnv(ctx, []string{"LC_ALL", "K0S_DEBUG"}))
+	require.Equal(t, "env LC_ALL=", nextEvent(t, events), "unknown names are probed")
+	require.True(t, conn.AcceptsEnv(ctx, []string{"LC_ALL"}), "probe results are remembered")
+	require.False(t, conn.AcceptsEnv(ctx, []string{"K0S_DEBUG"}))
+
+	waiter, err := conn.StartProcessEnv(ctx, "locale", map[string]string{"LC_ALL": "C", "LC_TIME": "C"}, nil, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, "env LC_ALL=C", nextEvent(t, events), "no new probe, variables are set in order")
+	require.Equal(t, "env LC_TIME=C", nextEvent(t, events))
+	require.Equal(t, "exec locale", nextEvent(t, events))
+	proc, ok := waiter.(*process)
+	require.True(t, ok)
+	require.NoError(t, proc.Signal(protocol.SIGTERM))
+	require.Equal(t, "signal TERM", nextEvent(t, events))
+	require.NoError(t, proc.Wait())
+
+	_, err = conn.StartProcessEnv(ctx, "k0s status", map[string]string{"K0S_DEBUG": "1"}, nil, nil, nil)
+	require.Error(t, err)
+}
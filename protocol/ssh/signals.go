@@ -3,37 +3,53 @@
 package ssh
 
 import (
-	"encoding/binary"
-	"fmt"
 	"io"
 	"os"
 	"os/signal"
 	"syscall"
 
+	"github.com/k0sproject/rig/v2/protocol"
 	ssh "golang.org/x/crypto/ssh"
 	"golang.org/x/term"
 )
 
-// TODO use session.WindowChange() instead of sending the request manually.
-// TODO use session.Signal() instead of writing control characters to the stdin.
+// captureSignals relays the local interrupt, suspend and resize signals to
+// the session unless the session options deliver signals or resize events
+// themselves. With a PTY, interrupt and suspend are sent as the control
+// characters the remote line discipline turns into signals.
+func captureSignals(stdin io.Writer, session *ssh.Session, st sessionTerminal, opts protocol.SessionOptions) func() {
+	var notify []os.Signal
+	if opts.Signals == nil {
+		notify = append(notify, os.Interrupt)
+		if st.pty {
+			notify = append(notify, syscall.SIGTSTP)
+		}
+	}
+	if opts.Resize == nil && st.pty && st.fd >= 0 {
+		notify = append(notify, syscall.SIGWINCH)
+	}
+	if len(notify) == 0 {
+		return func() {}
+	}
 
-// captureSignals intercepts interrupt / resize signals and sends them over to the writer.
-func captureSignals(stdin io.Writer, session *ssh.Session) func() {
 	stopCh := make(chan struct{})
 	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, os.Interrupt, syscall.SIGTSTP, syscall.SIGWINCH)
+	signal.Notify(sigCh, notify...)
 
 	go func() {
 		for sig := range sigCh {
 			switch sig {
 			case os.Interrupt:
-				fmt.Fprintf(stdin, "\x03")
+				if st.pty {
+					_, _ = stdin.Write([]byte{0x03})
+				} else {
+					_ = session.Signal(ssh.SIGINT)
+				}
 			case syscall.SIGTSTP:
-				fmt.Fprintf(stdin, "\x1a")
+				_, _ = stdin.Write([]byte{0x1a})
 			case syscall.SIGWINCH:
-				_, err := session.SendRequest("window-change", false, termSizeWNCH())
-				if err != nil {
-					println("failed to relay window-change event: " + err.Error())
+				if width, height, err := term.GetSize(st.fd); err == nil {
+					_ = session.WindowChange(height, width)
 				}
 			}
 		}
@@ -47,18 +63,3 @@ func captureSignals(stdin io.Writer, session *ssh.Session) func() {
 
 	return func() { close(stopCh) }
 }
-
-func termSizeWNCH() []byte {
-	size := make([]byte, 16)
-	fd := int(os.Stdin.Fd())
-	rows, cols, err := term.GetSize(fd)
-	if err != nil {
-		binary.BigEndian.PutUint32(size, 40)
-		binary.BigEndian.PutUint32(size[4:], 80)
-	} else {
-		binary.BigEndian.PutUint32(size, uint32(cols))     //nolint:gosec // G115: term.GetSize returns safe values
-		binary.BigEndian.PutUint32(size[4:], uint32(rows)) //nolint:gosec // G115: term.GetSize returns safe values
-	}
-
-	return size
-}
@@ -1,27 +1,36 @@
 //go:build windows
-// +build windows
 
 package ssh
 
 import (
-	"fmt"
 	"io"
 	"os"
 	"os/signal"
 
+	"github.com/k0sproject/rig/v2/protocol"
 	ssh "golang.org/x/crypto/ssh"
 )
 
-func captureSignals(stdin io.Writer, session *ssh.Session) func() {
+// captureSignals relays the local interrupt to the session unless the session
+// options deliver signals themselves. With a PTY, the interrupt is sent as the
+// control character the remote line discipline turns into a signal. Windows
+// has no resize signal, terminal size changes are only delivered through the
+// session options.
+func captureSignals(stdin io.Writer, session *ssh.Session, st sessionTerminal, opts protocol.SessionOptions) func() {
+	if opts.Signals != nil {
+		return func() {}
+	}
+
 	stopCh := make(chan struct{})
-	sigCh := make(chan os.Signal)
+	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, os.Interrupt)
 
 	go func() {
-		for sig := range sigCh {
-			switch sig {
-			case os.Interrupt:
-				fmt.Fprintf(stdin, "\x03")
+		for range sigCh {
+			if st.pty {
+				_, _ = stdin.Write([]byte{0x03})
+			} else {
+				_ = session.Signal(ssh.SIGINT)
 			}
 		}
 	}()
@@ -0,0 +1,243 @@
+package ssh
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/k0sproject/rig/v2/log"
+	ssh "golang.org/x/crypto/ssh"
+)
+
+// SOCKS5 protocol constants from RFC 1928.
+const (
+	socksVersion = 0x05
+
+	socksMethodNoAuth       = 0x00
+	socksMethodNoAcceptable = 0xff
+
+	socksCmdConnect = 0x01
+
+	socksAtypIPv4   = 0x01
+	socksAtypDomain = 0x03
+	socksAtypIPv6   = 0x04
+
+	socksReplySucceeded          = 0x00
+	socksReplyGeneralFailure     = 0x01
+	socksReplyNotAllowed         = 0x02
+	socksReplyHostUnreachable    = 0x04
+	socksReplyCommandUnsupported = 0x07
+	socksReplyAddressUnsupported = 0x08
+)
+
+// socksHandshakeTimeout limits how long a client may take to send its request.
+const socksHandshakeTimeout = 30 * time.Second
+
+var errSOCKSRequest = errors.New("unsupported socks request")
+
+// ServeSOCKS runs a SOCKS5 proxy on listener. Every CONNECT request it
+// receives is resolved and dialed on the remote side of the SSH connection,
+// so that hostnames and addresses that are only reachable from the remote
+// host can be used from the local host. Only the CONNECT command without
+// authentication is supported, which matches what "ssh -D" offers apart from
+// SOCKS4.
+//
+// When the connection goes through a bastion, the destinations are dialed
+// from the target host, not the bastion. The tunnel is closed when the
+// connection is disconnected. The listener is owned by the tunnel from this
+// point on.
+func (c *Connection) ServeSOCKS(listener net.Listener, opts ...ForwardOption) (*Tunnel, error) {
+	c.mu.Lock()
+	client := c.client
+	c.mu.Unlock()
+	if client == nil {
+		return nil, errNotConnected
+	}
+	return c.startTunnel(listener, func(local net.Conn) error {
+		return serveSOCKS(local, client.Dial)
+	}, opts...), nil
+}
+
+// ListenSOCKS binds a TCP listener on localAddr and serves a SOCKS5 proxy on
+// it that dials through the SSH connection. This is the equivalent of
+// "ssh -D localAddr". See [Connection.ServeSOCKS] for details.
+func (c *Connection) ListenSOCKS(localAddr string, opts ...ForwardOption) (*Tunnel, error) {
+	var lc net.ListenConfig
+	listener, err := lc.Listen(context.Background(), "tcp", localAddr)
+	if err != nil {
+		return nil, fmt.Errorf("listen local: %w", err)
+	}
+	tunnel, err := c.ServeSOCKS(listener, opts...)
+	if err != nil {
+		_ = listener.Close()
+		return nil, err
+	}
+	c.Log().Debug("started dynamic port forward", "listen", listener.Addr().String())
+	return tunnel, nil
+}
+
+// startDynamicForward starts one DynamicForward directive from the ssh config.
+func (c *Connection) startDynamicForward(listenSpec string) error {
+	listen, err := parseForwardListen(listenSpec, c.localForwardBind())
+	if err != nil {
+		return err
+	}
+	var lc net.ListenConfig
+	listener, err := lc.Listen(context.Background(), listen.network, listen.address)
+	if err != nil {
+		return fmt.Errorf("listen %s: %w", listen, err)
+	}
+	if _, err := c.ServeSOCKS(listener); err != nil {
+		_ = listener.Close()
+		return err
+	}
+	c.Log().Debug("started dynamic port forward from ssh config", "listen", listener.Addr().String())
+	return nil
+}
+
+// startConfiguredDynamicForwards starts the DynamicForward directives from the
+// ssh config and returns the errors of the ones that failed.
+func (c *Connection) startConfiguredDynamicForwards(ctx context.Context) []error {
+	var errs []error
+	for _, listen := range c.sshConfig.DynamicForward {
+		if err := c.startDynamicForward(listen); err != nil {
+			log.Trace(ctx, "failed to set up DynamicForward", "listen", listen, log.ErrorAttr(err))
+			errs = append(errs, fmt.Errorf("DynamicForward %s: %w", listen, err))
+		}
+	}
+	return errs
+}
+
+// serveSOCKS handles a single SOCKS5 client connection: it negotiates the
+// method, reads the CONNECT request, dials the destination using dial and
+// pipes the data until either side is done.
+func serveSOCKS(local net.Conn, dial func(network, address string) (net.Conn, error)) error {
+	_ = local.SetDeadline(time.Now().Add(socksHandshakeTimeout))
+	dst, err := socksHandshake(local)
+	if err != nil {
+		return fmt.Errorf("socks %s: %w", local.RemoteAddr(), err)
+	}
+
+	remote, err := dial("tcp", dst)
+	if err != nil {
+		_ = socksReply(local, socksDialFailureReply(err))
+		return fmt.Errorf("socks forward %s to %s: %w", local.RemoteAddr(), dst, err)
+	}
+	defer remote.Close()
+	if err := socksReply(local, socksReplySucceeded); err != nil {
+		return fmt.Errorf("socks %s: %w", local.RemoteAddr(), err)
+	}
+	_ = local.SetDeadline(time.Time{})
+
+	if err := pipe(local, remote); err != nil {
+		return fmt.Errorf("socks forward %s to %s: %w", local.RemoteAddr(), dst, err)
+	}
+	return nil
+}
+
+// socksHandshake performs the method negotiation and reads the request. It
+// returns the requested destination as host:port. Requests that can not be
+// served are answered with the matching reply code before returning an error.
+func socksHandshake(conn net.Conn) (string, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return "", fmt.Errorf("read greeting: %w", err)
+	}
+	if header[0] != socksVersion {
+		return "", fmt.Errorf("%w: protocol version %d", errSOCKSRequest, header[0])
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return "", fmt.Errorf("read methods: %w", err)
+	}
+	method := byte(socksMethodNoAcceptable)
+	for _, m := range methods {
+		if m == socksMethodNoAuth {
+			method = socksMethodNoAuth
+			break
+		}
+	}
+	if _, err := conn.Write([]byte{socksVersion, method}); err != nil {
+		return "", fmt.Errorf("write method: %w", err)
+	}
+	if method == socksMethodNoAcceptable {
+		return "", fmt.Errorf("%w: client requires authentication", errSOCKSRequest)
+	}
+
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(conn, request); err != nil {
+		return "", fmt.Errorf("read request: %w", err)
+	}
+	if request[0] != socksVersion {
+		return "", fmt.Errorf("%w: request version %d", errSOCKSRequest, request[0])
+	}
+
+	var host string
+	switch request[3] {
+	case socksAtypIPv4, socksAtypIPv6:
+		size := net.IPv4len
+		if request[3] == socksAtypIPv6 {
+			size = net.IPv6len
+		}
+		ip := make(net.IP, size)
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return "", fmt.Errorf("read address: %w", err)
+		}
+		host = ip.String()
+	case socksAtypDomain:
+		size := make([]byte, 1)
+		if _, err := io.ReadFull(conn, size); err != nil {
+			return "", fmt.Errorf("read address: %w", err)
+		}
+		name := make([]byte, size[0])
+		if _, err := io.ReadFull(conn, name); err != nil {
+			return "", fmt.Errorf("read address: %w", err)
+		}
+		host = string(name)
+	default:
+		_ = socksReply(conn, socksReplyAddressUnsupported)
+		return "", fmt.Errorf("%w: address type %d", errSOCKSRequest, request[3])
+	}
+
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(conn, port); err != nil {
+		return "", fmt.Errorf("read port: %w", err)
+	}
+	if request[1] != socksCmdConnect {
+		_ = socksReply(conn, socksReplyCommandUnsupported)
+		return "", fmt.Errorf("%w: command %d", errSOCKSRequest, request[1])
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), nil
+}
+
+// socksReply writes a reply with the given code. The bound address is not
+// known for a channel opened through the SSH connection, so it is always
+// reported as 0.0.0.0:0, like ssh(1) does.
+func socksReply(conn net.Conn, code byte) error {
+	if _, err := conn.Write([]byte{socksVersion, code, 0x00, socksAtypIPv4, 0, 0, 0, 0, 0, 0}); err != nil {
+		return fmt.Errorf("write reply: %w", err)
+	}
+	return nil
+}
+
+// socksDialFailureReply maps the error from opening a channel to the SOCKS
+// reply code sent to the client.
+func socksDialFailureReply(err error) byte {
+	openErr, ok := errors.AsType[*ssh.OpenChannelError](err)
+	if !ok {
+		return socksReplyGeneralFailure
+	}
+	switch openErr.Reason {
+	case ssh.Prohibited:
+		return socksReplyNotAllowed
+	case ssh.ConnectionFailed:
+		return socksReplyHostUnreachable
+	default:
+		return socksReplyGeneralFailure
+	}
+}
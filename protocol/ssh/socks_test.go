@@ -0,0 +1,162 @@
+package ssh
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	ssh "golang.org/x/crypto/ssh"
+)
+
+// socksConnect connects to the SOCKS5 proxy at proxyAddr and asks it to
+// connect to host:port using a domain name address. It returns the
+// connection and the reply code sent by the proxy.
+func socksConnect(t *testing.T, proxyAddr, host string, port int) (net.Conn, byte) {
+	t.Helper()
+	conn, err := net.DialTimeout("tcp", proxyAddr, 5*time.Second)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	require.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+
+	_, err = conn.Write([]byte{socksVersion, 1, socksMethodNoAuth})
+	require.NoError(t, err)
+	method := make([]byte, 2)
+	_, err = io.ReadFull(conn, method)
+	require.NoError(t, err)
+	require.Equal(t, []byte{socksVersion, socksMethodNoAuth}, method)
+
+	req := []byte{socksVersion, socksCmdConnect, 0x00, socksAtypDomain, byte(len(host))}
+	req = append(req, host...)
+	req = binary.BigEndian.AppendUint16(req, uint16(port)) //nolint:gosec // test port
+	_, err = conn.Write(req)
+	require.NoError(t, err)
+
+	reply := make([]byte, 10)
+	_, err = io.ReadFull(conn, reply)
+	require.NoError(t, err)
+	require.Equal(t, byte(socksVersion), reply[0])
+	return conn, reply[1]
+}
+
+func TestListenSOCKS(t *testing.T) {
+	hostSigner := newHostSigner(t)
+	addr := startForwardingSSHServer(t, hostSigner, nil)
+	echo := startEchoServer(t)
+	_, echoPort, err := net.SplitHostPort(echo)
+	require.NoError(t, err)
+	port, err := strconv.Atoi(echoPort)
+	require.NoError(t, err)
+	conn := connectTestServer(t, addr, hostSigner, nil)
+
+	tunnel, err := conn.ListenSOCKS("127.0.0.1:0")
+	require.NoError(t, err)
+
+	// the name is resolved on the remote side
+	proxied, code := socksConnect(t, tunnel.Addr().String(), "localhost", port)
+	require.Equal(t, byte(socksReplySucceeded), code)
+	_, err = proxied.Write([]byte("hello socks"))
+	require.NoError(t, err)
+	buf := make([]byte, len("hello socks"))
+	_, err = io.ReadFull(proxied, buf)
+	require.NoError(t, err)
+	require.Equal(t, "hello socks", string(buf))
+
+	require.NoError(t, tunnel.Close())
+	require.NoError(t, tunnel.Err())
+}
+
+func TestListenSOCKSDialFailure(t *testing.T) {
+	hostSigner := newHostSigner(t)
+	addr := startForwardingSSHServer(t, hostSigner, nil)
+	conn := connectTestServer(t, addr, hostSigner, nil)
+
+	errCh := make(chan error, 1)
+	tunnel, err := conn.ListenSOCKS("127.0.0.1:0", WithForwardErrorHandler(func(err error) {
+		errCh <- err
+	}))
+	require.NoError(t, err)
+
+	// a port that no longer has a listener makes the server reject the channel
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := ln.Addr().(*net.TCPAddr).Port //nolint:forcetypeassert // tcp listener
+	ln.Close()
+
+	_, code := socksConnect(t, tunnel.Addr().String(), "127.0.0.1", port)
+	require.Equal(t, byte(socksReplyHostUnreachable), code)
+	select {
+	case err := <-errCh:
+		openErr, ok := errors.AsType[*ssh.OpenChannelError](err)
+		require.True(t, ok, "expected an open channel error, got %v", err)
+		require.Equal(t, ssh.ConnectionFailed, openErr.Reason)
+	case <-time.After(5 * time.Second):
+		t.Fatal("error handler was not called")
+	}
+}
+
+func TestSOCKSRejectsUnsupportedRequests(t *testing.T) {
+	t.Run("authentication", func(t *testing.T) {
+		client, server := net.Pipe()
+		defer client.Close()
+		errCh := make(chan error, 1)
+		go func() { errCh <- serveSOCKS(server, nil) }()
+
+		_, err := client.Write([]byte{socksVersion, 1, 0x02})
+		require.NoError(t, err)
+		reply := make([]byte, 2)
+		_, err = io.ReadFull(client, reply)
+		require.NoError(t, err)
+		require.Equal(t, []byte{socksVersion, socksMethodNoAcceptable}, reply)
+		require.ErrorIs(t, <-errCh, errSOCKSRequest)
+	})
+
+	t.Run("bind command", func(t *testing.T) {
+		client, server := net.Pipe()
+		defer client.Close()
+		errCh := make(chan error, 1)
+		go func() { errCh <- serveSOCKS(server, nil) }()
+
+		_, err := client.Write([]byte{socksVersion, 1, socksMethodNoAuth})
+		require.NoError(t, err)
+		_, err = io.ReadFull(client, make([]byte, 2))
+		require.NoError(t, err)
+		_, err = client.Write([]byte{socksVersion, 0x02, 0x00, socksAtypIPv4, 127, 0, 0, 1, 0, 80})
+		require.NoError(t, err)
+		reply := make([]byte, 10)
+		_, err = io.ReadFull(client, reply)
+		require.NoError(t, err)
+		require.Equal(t, byte(socksReplyCommandUnsupported), reply[1])
+		require.ErrorIs(t, <-errCh, errSOCKSRequest)
+	})
+}
+
+func TestConnectStartsDynamicForwardFromConfig(t *testing.T) {
+	hostSigner := newHostSigner(t)
+	addr := startForwardingSSHServer(t, hostSigner, nil)
+	echo := startEchoServer(t)
+	_, echoPort, err := net.SplitHostPort(echo)
+	require.NoError(t, err)
+	port, err := strconv.Atoi(echoPort)
+	require.NoError(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	proxyAddr := ln.Addr().String()
+	ln.Close()
+
+	conn := connectTestServer(t, addr, hostSigner, map[string]any{
+		"DynamicForward": proxyAddr,
+	})
+
+	_, code := socksConnect(t, proxyAddr, "127.0.0.1", port)
+	require.Equal(t, byte(socksReplySucceeded), code)
+
+	conn.Disconnect()
+	_, err = net.DialTimeout("tcp", proxyAddr, time.Second)
+	require.Error(t, err, "disconnect must stop the proxy")
+}
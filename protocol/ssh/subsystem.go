@@ -0,0 +1,72 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/k0sproject/rig/v2/protocol"
+	ssh "golang.org/x/crypto/ssh"
+)
+
+var _ protocol.SubsystemOpener = (*Connection)(nil)
+
+// subsystemStream connects the standard streams of a subsystem session.
+type subsystemStream struct {
+	io.Reader
+	stdin   io.WriteCloser
+	session *ssh.Session
+}
+
+func (s *subsystemStream) Write(p []byte) (int, error) {
+	n, err := s.stdin.Write(p)
+	if err != nil {
+		return n, fmt.Errorf("write to subsystem: %w", err)
+	}
+	return n, nil
+}
+
+// Close closes the stdin of the subsystem and ends the session.
+func (s *subsystemStream) Close() error {
+	err := s.stdin.Close()
+	if cerr := s.session.Close(); cerr != nil && !errors.Is(cerr, io.EOF) {
+		err = errors.Join(err, cerr)
+	}
+	if err != nil {
+		return fmt.Errorf("close subsystem: %w", err)
+	}
+	return nil
+}
+
+// OpenSubsystem starts the named subsystem, such as "sftp", in a new session
+// and returns a stream connected to its stdin and stdout. Closing the stream
+// ends the session. The server may refuse the request, in which case an error
+// is returned.
+func (c *Connection) OpenSubsystem(name string) (io.ReadWriteCloser, error) {
+	c.mu.Lock()
+	client := c.client
+	c.mu.Unlock()
+	if client == nil {
+		return nil, errNotConnected
+	}
+
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("ssh new session: %w", err)
+	}
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		_ = session.Close()
+		return nil, fmt.Errorf("subsystem %s stdin: %w", name, err)
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		_ = session.Close()
+		return nil, fmt.Errorf("subsystem %s stdout: %w", name, err)
+	}
+	if err := session.RequestSubsystem(name); err != nil {
+		_ = session.Close()
+		return nil, fmt.Errorf("request subsystem %s: %w", name, err)
+	}
+	return &subsystemStream{Reader: stdout, stdin: stdin, session: session}, nil
+}
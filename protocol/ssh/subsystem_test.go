@@ -0,0 +1,66 @@
+package ssh
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	ssh "golang.org/x/crypto/ssh"
+)
+
+// serveEchoSubsystem accepts a session channel and serves an "echo" subsystem
+// on it, which writes back everything it reads. Any other request is refused.
+func serveEchoSubsystem(newChan ssh.NewChannel) {
+	ch, reqs, err := newChan.Accept()
+	if err != nil {
+		return
+	}
+	defer ch.Close()
+	for req := range reqs {
+		var msg struct{ Name string }
+		if req.Type != "subsystem" || ssh.Unmarshal(req.Payload, &msg) != nil || msg.Name != "echo" {
+			_ = req.Reply(false, nil)
+			continue
+		}
+		_ = req.Reply(true, nil)
+		go ssh.DiscardRequests(reqs)
+		_, _ = io.Copy(ch, ch)
+		return
+	}
+}
+
+func TestOpenSubsystem(t *testing.T) {
+	hostSigner := newHostSigner(t)
+	addr := startForwardingSSHServer(t, hostSigner, nil)
+	conn := connectTestServer(t, addr, hostSigner, nil)
+
+	stream, err := conn.OpenSubsystem("echo")
+	require.NoError(t, err)
+	defer stream.Close()
+
+	done := make(chan []byte, 1)
+	go func() {
+		buf := make([]byte, len("hello subsystem"))
+		_, _ = io.ReadFull(stream, buf)
+		done <- buf
+	}()
+	_, err = stream.Write([]byte("hello subsystem"))
+	require.NoError(t, err)
+	select {
+	case got := <-done:
+		require.Equal(t, "hello subsystem", string(got))
+	case <-time.After(5 * time.Second):
+		t.Fatal("no echo from the subsystem")
+	}
+	require.NoError(t, stream.Close())
+
+	_, err = conn.OpenSubsystem("sftp")
+	require.Error(t, err, "the server refuses unknown subsystems")
+}
+
+func TestOpenSubsystemNotConnected(t *testing.T) {
+	c := newTestConnection(t)
+	_, err := c.OpenSubsystem("sftp")
+	require.ErrorIs(t, err, errNotConnected)
+}
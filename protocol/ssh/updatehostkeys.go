@@ -0,0 +1,230 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/k0sproject/rig/v2/log"
+	"github.com/k0sproject/rig/v2/protocol/ssh/hostkey"
+	ssh "golang.org/x/crypto/ssh"
+)
+
+// The OpenSSH extension a server uses to announce all of its host keys after
+// authentication and the request the client uses to have the server prove
+// that it holds the private keys. See PROTOCOL in the OpenSSH sources.
+const (
+	hostKeysRequest      = "hostkeys-00@openssh.com"
+	hostKeysProveRequest = "hostkeys-prove-00@openssh.com"
+)
+
+var errHostKeysProof = errors.New("host key proof failed")
+
+// hostKeyUpdate learns the additional host keys a server announces, as with
+// the UpdateHostKeys ssh_config option. It records the host key the server
+// was authenticated with during the handshake.
+type hostKeyUpdate struct {
+	path   string
+	hash   bool
+	prompt hostkey.PromptFunc
+
+	mu       sync.Mutex
+	hostname string
+	remote   net.Addr
+	key      ssh.PublicKey
+}
+
+// record wraps callback to remember the host key it accepts.
+func (u *hostKeyUpdate) record(callback ssh.HostKeyCallback) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if err := callback(hostname, remote, key); err != nil {
+			return err
+		}
+		u.mu.Lock()
+		u.hostname, u.remote, u.key = hostname, remote, key
+		u.mu.Unlock()
+		return nil
+	}
+}
+
+// verifiedHost returns the host name, address and key recorded during the
+// handshake.
+func (u *hostKeyUpdate) verifiedHost() (string, net.Addr, ssh.PublicKey) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.hostname, u.remote, u.key
+}
+
+// newHostKeyUpdate returns the host key learning state for the next
+// connection or nil when UpdateHostKeys is disabled. Like ssh(1), keys are
+// only learned into the user known_hosts file and "ask" needs a prompt.
+func (c *Connection) newHostKeyUpdate(ctx context.Context) *hostKeyUpdate {
+	update := c.sshConfig.UpdateHostKeys
+	if !update.IsTrue() && !update.IsAsk() {
+		return nil
+	}
+	path, _ := c.userKnownHostsFile(ctx)
+	if path == "" || path == "/dev/null" {
+		log.Trace(ctx, "UpdateHostKeys disabled, no user known_hosts file", log.KeyHost, c)
+		return nil
+	}
+	u := &hostKeyUpdate{path: path, hash: shouldHash(ctx, c)}
+	if update.IsAsk() {
+		u.prompt = c.hostKeyPrompt()
+		if u.prompt == nil {
+			log.Trace(ctx, "UpdateHostKeys is 'ask' but no host key prompt is set", log.KeyHost, c)
+			return nil
+		}
+	}
+	return u
+}
+
+// newClient creates the client for an established connection. When
+// UpdateHostKeys is enabled, the host key announcements of the server are
+// handled before the remaining global requests reach the client. Caller must
+// hold c.mu.
+func (c *Connection) newClient(conn ssh.Conn, chans <-chan ssh.NewChannel, reqs <-chan *ssh.Request) *ssh.Client {
+	if c.hostKeyUpdate != nil {
+		reqs = c.interceptHostKeys(conn, reqs, c.hostKeyUpdate)
+	}
+	return ssh.NewClient(conn, chans, reqs)
+}
+
+func (c *Connection) interceptHostKeys(conn ssh.Conn, reqs <-chan *ssh.Request, update *hostKeyUpdate) <-chan *ssh.Request {
+	out := make(chan *ssh.Request)
+	go func() {
+		defer close(out)
+		for req := range reqs {
+			if req.Type != hostKeysRequest {
+				out <- req
+				continue
+			}
+			if req.WantReply {
+				_ = req.Reply(false, nil)
+			}
+			// the proof request is answered through the same connection, don't
+			// hold up the global requests while waiting for it
+			go c.updateHostKeys(conn, update, req.Payload)
+		}
+	}()
+	return out
+}
+
+// updateHostKeys adds the host keys announced by the server that are not yet
+// in the user known_hosts file, once the server has proven it holds them.
+// Keys are only learned from a server that was authenticated with a plain key
+// from the user known_hosts file. Unlike ssh(1), keys the server no longer
+// offers are not removed from the file.
+func (c *Connection) updateHostKeys(conn ssh.Conn, update *hostKeyUpdate, payload []byte) {
+	hostname, remote, key := update.verifiedHost()
+	if key == nil {
+		return
+	}
+	if _, ok := key.(*ssh.Certificate); ok {
+		c.Log().Debug("not learning host keys, host was authenticated with a certificate", log.HostAttr(c))
+		return
+	}
+	trusted, err := hostkey.UnknownHostKeys(update.path, hostname, remote, []ssh.PublicKey{key})
+	if err != nil || len(trusted) > 0 {
+		c.Log().Debug("not learning host keys, host key is not in the user known_hosts file", log.HostAttr(c))
+		return
+	}
+
+	newKeys, err := hostkey.UnknownHostKeys(update.path, hostname, remote, parseHostKeys(payload))
+	if err != nil {
+		c.Log().Warn("failed to check announced host keys", log.HostAttr(c), log.ErrorAttr(err))
+		return
+	}
+	if len(newKeys) == 0 {
+		return
+	}
+	if err := proveHostKeys(conn, newKeys); err != nil {
+		c.Log().Warn("not learning host keys", log.HostAttr(c), log.ErrorAttr(err))
+		return
+	}
+
+	if update.prompt != nil {
+		confirmed := newKeys[:0]
+		for _, k := range newKeys {
+			if ok, err := update.prompt(hostname, remote, k); err == nil && ok {
+				confirmed = append(confirmed, k)
+			}
+		}
+		newKeys = confirmed
+	}
+
+	if err := hostkey.AddHostKeys(update.path, remote, newKeys, update.hash); err != nil {
+		c.Log().Warn("failed to learn host keys", log.HostAttr(c), log.ErrorAttr(err))
+		return
+	}
+	for _, k := range newKeys {
+		c.Log().Debug("learned host key", log.HostAttr(c), "type", k.Type(), "fingerprint", ssh.FingerprintSHA256(k), log.KeyFile, update.path)
+	}
+}
+
+// parseHostKeys decodes the key blobs of a host key announcement. Keys of
+// unsupported types and certificates are skipped.
+func parseHostKeys(payload []byte) []ssh.PublicKey {
+	var keys []ssh.PublicKey
+	for len(payload) > 0 {
+		var blob struct {
+			Key  []byte
+			Rest []byte `ssh:"rest"`
+		}
+		if err := ssh.Unmarshal(payload, &blob); err != nil {
+			break
+		}
+		payload = blob.Rest
+		key, err := ssh.ParsePublicKey(blob.Key)
+		if err != nil {
+			continue
+		}
+		if _, ok := key.(*ssh.Certificate); ok {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// proveHostKeys asks the server to sign the session identifier with each of
+// keys and verifies the signatures.
+func proveHostKeys(conn ssh.Conn, keys []ssh.PublicKey) error {
+	var payload []byte
+	for _, k := range keys {
+		payload = append(payload, ssh.Marshal(struct{ Key []byte }{k.Marshal()})...)
+	}
+	ok, reply, err := conn.SendRequest(hostKeysProveRequest, true, payload)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errHostKeysProof, err)
+	}
+	if !ok {
+		return fmt.Errorf("%w: server refused the request", errHostKeysProof)
+	}
+
+	for _, k := range keys {
+		var blob struct {
+			Signature []byte
+			Rest      []byte `ssh:"rest"`
+		}
+		if err := ssh.Unmarshal(reply, &blob); err != nil {
+			return fmt.Errorf("%w: decode reply: %w", errHostKeysProof, err)
+		}
+		reply = blob.Rest
+		sig := new(ssh.Signature)
+		if err := ssh.Unmarshal(blob.Signature, sig); err != nil {
+			return fmt.Errorf("%w: decode signature: %w", errHostKeysProof, err)
+		}
+		data := ssh.Marshal(struct {
+			Request   string
+			SessionID []byte
+			Key       []byte
+		}{hostKeysProveRequest, conn.SessionID(), k.Marshal()})
+		if err := k.Verify(data, sig); err != nil {
+			return fmt.Errorf("%w: %s %s: %w", errHostKeysProof, k.Type(), ssh.FingerprintSHA256(k), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+package ssh
+
+import (
+	"context"
+	"crypto/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/k0sproject/rig/v2/protocol"
+	"github.com/k0sproject/rig/v2/protocol/ssh/hostkey"
+	"github.com/k0sproject/rig/v2/sshconfig"
+	"github.com/k0sproject/rig/v2/sshconfig/options"
+	"github.com/stretchr/testify/require"
+	ssh "golang.org/x/crypto/ssh"
+)
+
+// startHostKeysSSHServer starts a server that authenticates with hostSigner
+// and announces the public keys of announced after the handshake. Proof
+// requests are answered by signing with provers, keyed by the wire format of
+// the announced key. Handled proof requests are signaled on the returned
+// channel.
+func startHostKeysSSHServer(t *testing.T, hostSigner ssh.Signer, announced []ssh.PublicKey, provers map[string]ssh.Signer) (string, <-chan struct{}) {
+	t.Helper()
+	proved := make(chan struct{}, 10)
+	addr := startSSHServerWith(t, newTestServerConfig(hostSigner), sshServerHandler{
+		connected: func(sconn *ssh.ServerConn) {
+			var payload []byte
+			for _, key := range announced {
+				payload = append(payload, ssh.Marshal(struct{ Key []byte }{key.Marshal()})...)
+			}
+			_, _, _ = sconn.SendRequest(hostKeysRequest, false, payload)
+		},
+		request: func(sconn *ssh.ServerConn, req *ssh.Request) {
+			if req.Type != hostKeysProveRequest {
+				_ = req.Reply(false, nil)
+				return
+			}
+			var reply []byte
+			for _, key := range parseHostKeys(req.Payload) {
+				data := ssh.Marshal(struct {
+					Request   string
+					SessionID []byte
+					Key       []byte
+				}{hostKeysProveRequest, sconn.SessionID(), key.Marshal()})
+				sig, err := provers[string(key.Marshal())].Sign(rand.Reader, data)
+				if err != nil {
+					_ = req.Reply(false, nil)
+					continue
+				}
+				reply = append(reply, ssh.Marshal(struct{ Sig []byte }{ssh.Marshal(sig)})...)
+			}
+			_ = req.Reply(true, reply)
+			proved <- struct{}{}
+		},
+	})
+	return addr, proved
+}
+
+func knownHostsContains(t *testing.T, key ssh.PublicKey) bool {
+	t.Helper()
+	path, ok := hostkey.KnownHostsPathFromEnv()
+	require.True(t, ok)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return strings.Contains(string(data), strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key))))
+}
+
+func TestUpdateHostKeys(t *testing.T) {
+	hostSigner := newHostSigner(t)
+	rotated := newHostSigner(t)
+	announced := []ssh.PublicKey{hostSigner.PublicKey(), rotated.PublicKey()}
+
+	t.Run("learns proven keys", func(t *testing.T) {
+		addr, proved := startHostKeysSSHServer(t, hostSigner, announced, map[string]ssh.Signer{
+			string(rotated.PublicKey().Marshal()): rotated,
+		})
+		connectTestServer(t, addr, hostSigner, map[string]any{"UpdateHostKeys": "yes"})
+		<-proved
+		require.Eventually(t, func() bool { return knownHostsContains(t, rotated.PublicKey()) }, 5*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("failed proof", func(t *testing.T) {
+		addr, proved := startHostKeysSSHServer(t, hostSigner, announced, map[string]ssh.Signer{
+			string(rotated.PublicKey().Marshal()): hostSigner,
+		})
+		connectTestServer(t, addr, hostSigner, map[string]any{"UpdateHostKeys": "yes"})
+		<-proved
+		require.Never(t, func() bool { return knownHostsContains(t, rotated.PublicKey()) }, 200*time.Millisecond, 10*time.Millisecond)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		addr, proved := startHostKeysSSHServer(t, hostSigner, announced, map[string]ssh.Signer{
+			string(rotated.PublicKey().Marshal()): rotated,
+		})
+		connectTestServer(t, addr, hostSigner, map[string]any{"UpdateHostKeys": "no"})
+		select {
+		case <-proved:
+			t.Fatal("host keys must not be proven when UpdateHostKeys is disabled")
+		case <-time.After(200 * time.Millisecond):
+		}
+		require.False(t, knownHostsContains(t, rotated.PublicKey()))
+	})
+}
+
+func TestHostKeyPolicy(t *testing.T) {
+	prompt := hostkey.PromptFunc(func(string, net.Addr, ssh.PublicKey) (bool, error) { return true, nil })
+	tests := []struct {
+		strict options.StrictHostKeyCheckingOption
+		prompt hostkey.PromptFunc
+		want   hostkey.Mode
+	}{
+		{strict: "", want: hostkey.ModeAcceptNew},
+		{strict: options.StrictHostKeyCheckingOptionAcceptNew, want: hostkey.ModeAcceptNew},
+		{strict: options.StrictHostKeyCheckingOptionYes, want: hostkey.ModeYes},
+		{strict: options.StrictHostKeyCheckingOptionNo, want: hostkey.ModeNo},
+		{strict: options.StrictHostKeyCheckingOptionAsk, want: hostkey.ModeAcceptNew},
+		{strict: options.StrictHostKeyCheckingOptionAsk, prompt: prompt, want: hostkey.ModeAsk},
+	}
+	for _, tc := range tests {
+		t.Run(string(tc.strict)+"/prompt="+strconv.FormatBool(tc.prompt != nil), func(t *testing.T) {
+			c := &Connection{
+				sshConfig: &sshconfig.Config{StrictHostKeyChecking: tc.strict},
+				options:   NewOptions(WithHostKeyPrompt(tc.prompt)),
+			}
+			policy := hostKeyPolicy(context.Background(), c)
+			require.Equal(t, tc.want, policy.Mode)
+			require.Equal(t, tc.want == hostkey.ModeAsk, policy.Prompt != nil)
+		})
+	}
+}
+
+// newHostKeyTestConnection returns a connection to addr that verifies host
+// keys against an empty known_hosts file.
+func newHostKeyTestConnection(t *testing.T, addr string, sshOptions map[string]any, opts ...Option) (*Connection, string) {
+	t.Helper()
+	withConfigParser(t, "")
+	t.Setenv("SSH_AUTH_SOCK", "")
+	khPath := filepath.Join(t.TempDir(), "known_hosts")
+	t.Setenv("SSH_KNOWN_HOSTS", khPath)
+
+	host, portStr, err := net.SplitHostPort(addr)
+	require.NoError(t, err)
+	port, err := strconv.Atoi(portStr)
+	require.NoError(t, err)
+	conn, err := NewConnection(Config{
+		Address:          host,
+		Port:             port,
+		User:             "test",
+		AuthMethods:      []ssh.AuthMethod{ssh.Password("test")},
+		SSHConfigOptions: sshOptions,
+	}, opts...)
+	require.NoError(t, err)
+	t.Cleanup(conn.Disconnect)
+	return conn, khPath
+}
+
+func TestStrictHostKeyChecking(t *testing.T) {
+	hostSigner := newHostSigner(t)
+	addr := startSSHServer(t, newTestServerConfig(hostSigner))
+
+	connect := func(t *testing.T, sshOptions map[string]any, opts ...Option) (string, error) {
+		t.Helper()
+		conn, khPath := newHostKeyTestConnection(t, addr, sshOptions, opts...)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		err := conn.Connect(ctx)
+		data, readErr := os.ReadFile(khPath)
+		if readErr != nil && !os.IsNotExist(readErr) {
+			require.NoError(t, readErr)
+		}
+		return string(data), err
+	}
+
+	t.Run("yes refuses unknown host", func(t *testing.T) {
+		data, err := connect(t, map[string]any{"StrictHostKeyChecking": "yes"})
+		require.ErrorIs(t, err, hostkey.ErrHostKeyMismatch)
+		require.ErrorIs(t, err, protocol.ErrNonRetryable)
+		require.Empty(t, data)
+	})
+
+	t.Run("accept-new adds unknown host", func(t *testing.T) {
+		data, err := connect(t, map[string]any{"StrictHostKeyChecking": "accept-new"})
+		require.NoError(t, err)
+		require.Contains(t, data, strings.TrimSpace(string(ssh.MarshalAuthorizedKey(hostSigner.PublicKey()))))
+	})
+
+	t.Run("ask without prompt accepts new host", func(t *testing.T) {
+		data, err := connect(t, map[string]any{"StrictHostKeyChecking": "ask"})
+		require.NoError(t, err)
+		require.NotEmpty(t, data)
+	})
+
+	t.Run("ask with prompt", func(t *testing.T) {
+		var asked ssh.PublicKey
+		accept := false
+		prompt := WithHostKeyPrompt(func(_ string, _ net.Addr, key ssh.PublicKey) (bool, error) {
+			asked = key
+			return accept, nil
+		})
+		_, err := connect(t, map[string]any{"StrictHostKeyChecking": "ask"}, prompt)
+		require.ErrorIs(t, err, hostkey.ErrHostKeyMismatch)
+		require.Equal(t, hostSigner.PublicKey().Marshal(), asked.Marshal())
+
+		accept = true
+		data, err := connect(t, map[string]any{"StrictHostKeyChecking": "ask"}, prompt)
+		require.NoError(t, err)
+		require.NotEmpty(t, data)
+	})
+
+	t.Run("revoked host key", func(t *testing.T) {
+		revoked := filepath.Join(t.TempDir(), "revoked_keys")
+		require.NoError(t, os.WriteFile(revoked, ssh.MarshalAuthorizedKey(hostSigner.PublicKey()), 0o600))
+		data, err := connect(t, map[string]any{"StrictHostKeyChecking": "no", "RevokedHostKeys": revoked})
+		require.ErrorIs(t, err, hostkey.ErrHostKeyRevoked)
+		require.ErrorIs(t, err, protocol.ErrNonRetryable)
+		require.Empty(t, data)
+	})
+
+	t.Run("missing revoked host keys file", func(t *testing.T) {
+		_, err := connect(t, map[string]any{"RevokedHostKeys": filepath.Join(t.TempDir(), "missing")})
+		require.ErrorIs(t, err, hostkey.ErrCheckHostKey)
+		require.ErrorIs(t, err, protocol.ErrNonRetryable)
+	})
+}
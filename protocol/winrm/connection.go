@@ -277,6 +277,12 @@ func (c *Connection) Disconnect() {
 	}
 }
 
+var (
+	_ protocol.Signaler     = (*command)(nil)
+	_ protocol.StdinCloser  = (*command)(nil)
+	_ protocol.ExitStatuser = (*command)(nil)
+)
+
 type command struct {
 	sh  *winrm.Shell
 	cmd *winrm.Command
@@ -300,6 +306,34 @@ func (c *command) Wait() error {
 	return nil
 }
 
+// Signal terminates the command for SIGTERM and SIGKILL, the only signal
+// WinRM can deliver is a terminate.
+func (c *command) Signal(sig protocol.Signal) error {
+	if sig != protocol.SIGTERM && sig != protocol.SIGKILL {
+		return fmt.Errorf("%w: signal %s", protocol.ErrUnsupported, sig)
+	}
+	return c.Close()
+}
+
+// CloseStdin closes the stdin of the command.
+func (c *command) CloseStdin() error {
+	if err := c.cmd.Stdin.Close(); err != nil {
+		return fmt.Errorf("close stdin: %w", err)
+	}
+	return nil
+}
+
+// ExitCode returns the exit code of the command.
+func (c *command) ExitCode() int {
+	return c.cmd.ExitCode()
+}
+
+// ExitSignal returns an empty string, windows commands are not terminated by
+// signals.
+func (c *command) ExitSignal() protocol.Signal {
+	return ""
+}
+
 // Close terminates the command.
 func (c *command) Close() error {
 	if err := c.cmd.Close(); err != nil {
@@ -372,6 +406,18 @@ func (c *Connection) StartProcess(ctx context.Context, cmd string, stdin io.Read
 	return res, nil
 }
 
+// SessionSupport reports that WinRM sessions support none of the session
+// options. WinRM has no pseudo terminal or signal delivery.
+func (c *Connection) SessionSupport() protocol.SessionSupport {
+	return protocol.SessionSupport{}
+}
+
+// ExecInteractiveSession is ExecInteractive, the session options are not
+// supported and are ignored.
+func (c *Connection) ExecInteractiveSession(ctx context.Context, cmd string, stdin io.Reader, stdout, stderr io.Writer, _ protocol.SessionOptions) error {
+	return c.ExecInteractive(ctx, cmd, stdin, stdout, stderr)
+}
+
 // ExecInteractive executes a command on the host and passes stdin/stdout/stderr as-is to the session.
 // The session is terminated when ctx is cancelled.
 func (c *Connection) ExecInteractive(ctx context.Context, cmd string, stdin io.Reader, stdout, stderr io.Writer) error {
@@ -0,0 +1,107 @@
+package remotefs
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressedCopier is implemented by FS types that can compress file
+// contents for the transfer to and from the remote host.
+type compressedCopier interface {
+	// supportsCompression reports whether the remote host can handle c.
+	supportsCompression(c Compression) bool
+	// copyFromCompressed writes src to the file name starting at offset and
+	// returns the number of bytes read from src. The file is created when
+	// offset is 0 and expected to be offset bytes long otherwise.
+	copyFromCompressed(name string, offset int64, src io.Reader, c Compression) (int64, error)
+	// copyToCompressed writes the content of the file name to dst and
+	// returns the number of bytes written.
+	copyToCompressed(name string, dst io.Writer, c Compression) (int64, error)
+}
+
+// transferCompression returns the compressedCopier to use for transferring
+// files with c, or false when the transfer should be made uncompressed.
+func transferCompression(fsys FS, c Compression) (compressedCopier, bool) {
+	if c == CompressionNone {
+		return nil, false
+	}
+	cc, ok := fsys.(compressedCopier)
+	if !ok || !cc.supportsCompression(c) {
+		return nil, false
+	}
+	return cc, true
+}
+
+// newCompressWriter returns a writer that compresses what is written to it
+// into w. Closing it does not close w.
+func newCompressWriter(w io.Writer, c Compression) (io.WriteCloser, error) {
+	switch c {
+	case CompressionGzip:
+		return gzip.NewWriter(w), nil
+	case CompressionZstd:
+		zw, err := zstd.NewWriter(w)
+		if err != nil {
+			return nil, fmt.Errorf("create zstd writer: %w", err)
+		}
+		return zw, nil
+	default:
+		return nil, fmt.Errorf("%w: compression %s", errInvalid, c)
+	}
+}
+
+// decompressTo writes the content of the stream src compressed with c to dst.
+func decompressTo(dst io.Writer, src io.Reader, c Compression) (int64, error) {
+	zr, err := newDecompressReader(src, c)
+	if err != nil {
+		return 0, err
+	}
+	defer zr.Close()
+	n, err := io.Copy(dst, zr)
+	if err != nil {
+		return n, fmt.Errorf("decompress: %w", err)
+	}
+	return n, nil
+}
+
+// newDecompressReader returns a reader that decompresses r.
+func newDecompressReader(r io.Reader, c Compression) (io.ReadCloser, error) {
+	switch c {
+	case CompressionGzip:
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("read gzip header: %w", err)
+		}
+		return zr, nil
+	case CompressionZstd:
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("create zstd reader: %w", err)
+		}
+		return zr.IOReadCloser(), nil
+	default:
+		return nil, fmt.Errorf("%w: compression %s", errInvalid, c)
+	}
+}
+
+// compressedReader returns a reader of src compressed with c. It must be
+// closed to stop the compression when it is not read to the end.
+func compressedReader(src io.Reader, c Compression) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		zw, err := newCompressWriter(pw, c)
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		if _, err := io.Copy(zw, src); err != nil {
+			_ = zw.Close()
+			pw.CloseWithError(fmt.Errorf("compress: %w", err))
+			return
+		}
+		pw.CloseWithError(zw.Close())
+	}()
+	return pr
+}
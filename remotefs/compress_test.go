@@ -0,0 +1,102 @@
+package remotefs_test
+
+import (
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/k0sproject/rig/v2/cmd"
+	"github.com/k0sproject/rig/v2/protocol/localhost"
+	"github.com/k0sproject/rig/v2/remotefs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUploadCompression(t *testing.T) {
+	fsys := localPosixFS(t)
+	content := strings.Repeat("compressible content\n", 20000)
+	src := writeTempFile(t, content, 0o644)
+
+	for _, c := range []remotefs.Compression{remotefs.CompressionGzip, remotefs.CompressionZstd} {
+		t.Run(c.String(), func(t *testing.T) {
+			if _, err := osexec.LookPath(c.String()); err != nil {
+				t.Skipf("%s not installed", c)
+			}
+			dir := t.TempDir()
+			dst := filepath.Join(dir, "file")
+			require.NoError(t, remotefs.Upload(fsys, src, dst, remotefs.WithCompression(c)))
+			require.Equal(t, content, readFile(t, dst))
+
+			require.NoError(t, os.WriteFile(filepath.Join(dir, ".upload-file.partial"), []byte(content[:12345]), 0o600))
+			require.NoError(t, os.Remove(dst))
+			require.NoError(t, remotefs.Upload(fsys, src, dst, remotefs.WithCompression(c), remotefs.WithResume()))
+			require.Equal(t, content, readFile(t, dst), "a resumed upload is appended to the partial file")
+		})
+	}
+}
+
+func TestUploadCompressionFallback(t *testing.T) {
+	src := writeTempFile(t, "hello", 0o644)
+	mfs := &uploadFS{}
+
+	require.NoError(t, remotefs.Upload(mfs, src, "/remote/dst", remotefs.WithCompression(remotefs.CompressionGzip)))
+	require.Equal(t, "hello", string(mfs.written), "a filesystem without compression support gets the file as is")
+}
+
+func TestSyncDirCompression(t *testing.T) {
+	fsys := localPosixFS(t)
+	src := t.TempDir()
+	dst := t.TempDir()
+	back := t.TempDir()
+	writeTree(t, src, map[string]string{
+		"big":   strings.Repeat("a", 100000),
+		"small": "b",
+		"empty": "",
+	})
+	gzip := remotefs.SyncCompression(remotefs.CompressionGzip)
+
+	_, err := remotefs.SyncDir(fsys, src, dst, gzip)
+	require.NoError(t, err)
+	require.Equal(t, strings.Repeat("a", 100000), readFile(t, filepath.Join(dst, "big")))
+	require.Empty(t, readFile(t, filepath.Join(dst, "empty")))
+
+	report, err := remotefs.SyncDirFromRemote(fsys, dst, back, gzip)
+	require.NoError(t, err)
+	require.Len(t, report.Created, 3)
+	require.Equal(t, "b", readFile(t, filepath.Join(back, "small")))
+	require.Empty(t, readFile(t, filepath.Join(back, "empty")))
+}
+
+// lookupCounter counts the commands that look up a command on the host.
+type lookupCounter struct {
+	lookups atomic.Int32
+}
+
+func (c *lookupCounter) CommandFormatted(_, formatted string) {
+	if strings.Contains(formatted, "command -v") {
+		c.lookups.Add(1)
+	}
+}
+func (c *lookupCounter) ProcessStarted(_, _ string)                            {}
+func (c *lookupCounter) ProcessFinished(_, _ string, _ time.Duration, _ error) {}
+
+func TestSyncDirCompressionLookedUpOnce(t *testing.T) {
+	if _, err := osexec.LookPath("gzip"); err != nil {
+		t.Skip("gzip not installed")
+	}
+	conn, err := localhost.NewConnection()
+	require.NoError(t, err)
+	runner := cmd.NewExecutor(conn)
+	counter := &lookupCounter{}
+	runner.SetTracer(counter)
+	fsys := remotefs.NewPosixFS(runner)
+
+	src := t.TempDir()
+	writeTree(t, src, map[string]string{"a": "alpha", "b": "beta", "c": "gamma"})
+	_, err = remotefs.SyncDir(fsys, src, t.TempDir(), remotefs.SyncCompression(remotefs.CompressionGzip))
+	require.NoError(t, err)
+	require.EqualValues(t, 1, counter.lookups.Load(), "gzip is looked up once for all the files")
+}
@@ -40,8 +40,13 @@ func NewRegistry() *Registry {
 //
 // The factories are appended, so one of your own that has to take precedence over
 // them must be registered before this call, or with Registry.RegisterFirst.
+//
+// [RegisterSFTP] comes before [RegisterPosix], so that a runner whose connection
+// supports the SFTP subsystem gets an [SFTPFS]. Build a registry with
+// RegisterWindows and RegisterPosix only to always run commands instead.
 func RegisterDefaults(r *Registry) {
 	RegisterWindows(r)
+	RegisterSFTP(r)
 	RegisterPosix(r)
 }
 
@@ -0,0 +1,110 @@
+package remotefs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// DownloadOption is a functional option for Download.
+type DownloadOption func(*downloadOptions)
+
+type downloadOptions struct {
+	compression Compression
+}
+
+// DownloadCompression makes the download compress the file for the transfer
+// with c when the remote host supports it, see [WithCompression].
+func DownloadCompression(c Compression) DownloadOption {
+	return func(o *downloadOptions) {
+		o.compression = c
+	}
+}
+
+// Download a file from the remote host atomically. It is the reverse of
+// [Upload]: the content is written to a temporary file in the same directory
+// as the local file dst, verified against the SHA-256 checksum of the remote
+// file src, and then renamed into place. The mode and modification time of
+// dst are set to the ones of src. The temporary file is removed on any
+// failure.
+func Download(fsys FS, src, dst string, opts ...DownloadOption) error {
+	options := &downloadOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	info, err := fsys.Stat(src)
+	if err != nil {
+		return fmt.Errorf("stat remote file for download: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return PathErrorf("download", src, "%w: not a regular file", fs.ErrInvalid)
+	}
+	return download(fsys, src, dst, info, options.compression)
+}
+
+// download copies the remote file src to the local file dst atomically and
+// sets its mode and modification time from info.
+func download(fsys FS, src, dst string, info fs.FileInfo, c Compression) error {
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".download-")
+	if err != nil {
+		return fmt.Errorf("create temp file for download: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	localHash := sha256.New()
+	if err := copyFromRemote(fsys, src, io.MultiWriter(tmp, localHash), c); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close temp file after download: %w", err)
+	}
+
+	remoteSum, err := fsys.Sha256(src)
+	if err != nil {
+		return fmt.Errorf("get checksum of remote file: %w", err)
+	}
+	if remoteSum != hex.EncodeToString(localHash.Sum(nil)) {
+		return ErrChecksumMismatch
+	}
+
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return fmt.Errorf("chmod downloaded file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		return fmt.Errorf("rename downloaded file into place: %w", err)
+	}
+	if err := os.Chtimes(dst, info.ModTime(), info.ModTime()); err != nil {
+		return fmt.Errorf("set modification time: %w", err)
+	}
+	return nil
+}
+
+// copyFromRemote writes the content of the remote file src to w, compressed
+// with c for the transfer when the remote host supports it.
+func copyFromRemote(fsys FS, src string, w io.Writer, c Compression) error {
+	if cc, ok := transferCompression(fsys, c); ok {
+		if _, err := cc.copyToCompressed(src, w, c); err != nil {
+			return fmt.Errorf("copy file from remote host: %w", err)
+		}
+		return nil
+	}
+	f, err := fsys.Open(src)
+	if err != nil {
+		return fmt.Errorf("open remote file for download: %w", err)
+	}
+	defer f.Close()
+	if copier, ok := f.(Copier); ok {
+		_, err = copier.CopyTo(w)
+	} else {
+		_, err = io.Copy(w, f)
+	}
+	if err != nil {
+		return fmt.Errorf("copy file from remote host: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package remotefs_test
+
+import (
+	"io/fs"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/k0sproject/rig/v2/remotefs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownload(t *testing.T) {
+	fsys := localPosixFS(t)
+	content := strings.Repeat("downloaded content\n", 20000)
+	src := writeTempFile(t, content, 0o640)
+	mtime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, os.Chtimes(src, mtime, mtime))
+
+	for _, c := range []remotefs.Compression{remotefs.CompressionNone, remotefs.CompressionGzip, remotefs.CompressionZstd} {
+		t.Run(c.String(), func(t *testing.T) {
+			if c != remotefs.CompressionNone {
+				if _, err := osexec.LookPath(c.String()); err != nil {
+					t.Skipf("%s not installed", c)
+				}
+			}
+			dst := filepath.Join(t.TempDir(), "file")
+			require.NoError(t, remotefs.Download(fsys, src, dst, remotefs.DownloadCompression(c)))
+			require.Equal(t, content, readFile(t, dst))
+			info, err := os.Stat(dst)
+			require.NoError(t, err)
+			require.Equal(t, fs.FileMode(0o640), info.Mode().Perm())
+			require.True(t, mtime.Equal(info.ModTime()), "the modification time is kept")
+		})
+	}
+
+	t.Run("directory", func(t *testing.T) {
+		dst := filepath.Join(t.TempDir(), "file")
+		require.ErrorIs(t, remotefs.Download(fsys, t.TempDir(), dst), fs.ErrInvalid)
+		require.NoFileExists(t, dst)
+	})
+}
@@ -0,0 +1,216 @@
+package remotefs
+
+import (
+	"context"
+	"io"
+	"io/fs"
+)
+
+// TransferDirection tells which way the bytes reported to a [TransferFunc] went.
+type TransferDirection int
+
+const (
+	// TransferUpload is data written to the remote host.
+	TransferUpload TransferDirection = iota
+	// TransferDownload is data read from the remote host.
+	TransferDownload
+)
+
+// String returns "upload" or "download".
+func (d TransferDirection) String() string {
+	if d == TransferDownload {
+		return "download"
+	}
+	return "upload"
+}
+
+// TransferFunc receives the number of file content bytes moved in a single
+// operation on a filesystem returned by [ObserveTransfers].
+type TransferFunc func(dir TransferDirection, n int64)
+
+// ObserveTransfers returns a filesystem that reports the file content read
+// from and written to fsys to fn: the reads, writes and copies on the files
+// it opens, the data of ReadFile and WriteFile and the archives streamed with
+// [UploadTar] and [DownloadTar]. Metadata operations and
+// checksums are not counted. fn may be called concurrently when fsys is
+// used from several goroutines.
+func ObserveTransfers(fsys FS, fn TransferFunc) FS {
+	return &observedFS{FS: fsys, fn: fn}
+}
+
+type observedFS struct {
+	FS
+	fn TransferFunc
+}
+
+func (o *observedFS) report(dir TransferDirection, n int64) {
+	if n > 0 {
+		o.fn(dir, n)
+	}
+}
+
+// Open opens the named file for reading.
+func (o *observedFS) Open(name string) (fs.File, error) {
+	f, err := o.FS.Open(name)
+	if err != nil {
+		return nil, err //nolint:wrapcheck // the underlying filesystem returns path errors
+	}
+	if file, ok := f.(File); ok {
+		return &observedFile{File: file, fs: o}, nil
+	}
+	return f, nil
+}
+
+// OpenFile opens the named file with the given flags and permissions.
+func (o *observedFS) OpenFile(path string, flag int, perm fs.FileMode) (File, error) {
+	f, err := o.FS.OpenFile(path, flag, perm)
+	if err != nil {
+		return nil, err //nolint:wrapcheck // the underlying filesystem returns path errors
+	}
+	return &observedFile{File: f, fs: o}, nil
+}
+
+// ReadFile reads the named file and returns its contents.
+func (o *observedFS) ReadFile(name string) ([]byte, error) {
+	data, err := o.FS.ReadFile(name)
+	o.report(TransferDownload, int64(len(data)))
+	return data, err //nolint:wrapcheck // the underlying filesystem returns path errors
+}
+
+// WriteFile writes data to the named file, creating it if necessary.
+func (o *observedFS) WriteFile(path string, data []byte, perm fs.FileMode) error {
+	if err := o.FS.WriteFile(path, data, perm); err != nil {
+		return err //nolint:wrapcheck // the underlying filesystem returns path errors
+	}
+	o.report(TransferUpload, int64(len(data)))
+	return nil
+}
+
+// httpStatusInsecure keeps [HTTPStatusInsecure] working through the wrapper.
+func (o *observedFS) httpStatusInsecure(ctx context.Context, url string) (int, error) {
+	p, ok := o.FS.(httpStatusProvider)
+	if !ok {
+		return 0, ErrHTTPStatusNotSupported
+	}
+	return p.httpStatusInsecure(ctx, url)
+}
+
+// uploadTar keeps [UploadTar] working through the wrapper, counting the
+// archive as it is sent.
+func (o *observedFS) uploadTar(src io.Reader, dst string, opts tarOptions) error {
+	t, ok := o.FS.(tarStreamer)
+	if !ok {
+		return ErrTarNotSupported
+	}
+	return t.uploadTar(&observedReader{r: src, fs: o}, dst, opts)
+}
+
+// downloadTar keeps [DownloadTar] working through the wrapper, counting the
+// archive as it is received.
+func (o *observedFS) downloadTar(src string, dst io.Writer, opts tarOptions) error {
+	t, ok := o.FS.(tarStreamer)
+	if !ok {
+		return ErrTarNotSupported
+	}
+	return t.downloadTar(src, &observedWriter{w: dst, fs: o}, opts)
+}
+
+// ownedRegularFile keeps resumable uploads working through the wrapper.
+func (o *observedFS) ownedRegularFile(name string) (bool, error) {
+	c, ok := o.FS.(partialFileChecker)
+	if !ok {
+		return false, nil
+	}
+	return c.ownedRegularFile(name) //nolint:wrapcheck // passthrough
+}
+
+// permMask keeps the sync comparing the modes the wrapped filesystem has.
+func (o *observedFS) permMask() fs.FileMode {
+	if m, ok := o.FS.(permMasker); ok {
+		return m.permMask()
+	}
+	return fs.ModePerm
+}
+
+// supportsCompression keeps compressed transfers working through the wrapper.
+func (o *observedFS) supportsCompression(c Compression) bool {
+	cc, ok := o.FS.(compressedCopier)
+	return ok && cc.supportsCompression(c)
+}
+
+// copyFromCompressed counts the file content as it is sent. The counts are
+// of the uncompressed bytes.
+func (o *observedFS) copyFromCompressed(name string, offset int64, src io.Reader, c Compression) (int64, error) {
+	cc, ok := o.FS.(compressedCopier)
+	if !ok {
+		return 0, PathErrorf(OpCopyFrom, name, "%w: compression %s", errInvalid, c)
+	}
+	return cc.copyFromCompressed(name, offset, &observedReader{r: src, fs: o}, c) //nolint:wrapcheck // passthrough
+}
+
+// copyToCompressed counts the file content as it is received. The counts are
+// of the uncompressed bytes.
+func (o *observedFS) copyToCompressed(name string, dst io.Writer, c Compression) (int64, error) {
+	cc, ok := o.FS.(compressedCopier)
+	if !ok {
+		return 0, PathErrorf(OpCopyTo, name, "%w: compression %s", errInvalid, c)
+	}
+	return cc.copyToCompressed(name, &observedWriter{w: dst, fs: o}, c) //nolint:wrapcheck // passthrough
+}
+
+// observedReader reports what is read from r as uploaded.
+type observedReader struct {
+	r  io.Reader
+	fs *observedFS
+}
+
+func (r *observedReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.fs.report(TransferUpload, int64(n))
+	return n, err //nolint:wrapcheck // passthrough
+}
+
+// observedWriter reports what is written to w as downloaded.
+type observedWriter struct {
+	w  io.Writer
+	fs *observedFS
+}
+
+func (w *observedWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.fs.report(TransferDownload, int64(n))
+	return n, err //nolint:wrapcheck // passthrough
+}
+
+type observedFile struct {
+	File
+	fs *observedFS
+}
+
+// Read reads from the remote file.
+func (f *observedFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	f.fs.report(TransferDownload, int64(n))
+	return n, err //nolint:wrapcheck // passthrough
+}
+
+// Write writes to the remote file.
+func (f *observedFile) Write(p []byte) (int, error) {
+	n, err := f.File.Write(p)
+	f.fs.report(TransferUpload, int64(n))
+	return n, err //nolint:wrapcheck // passthrough
+}
+
+// CopyFrom copies src to the remote file.
+func (f *observedFile) CopyFrom(src io.Reader) (int64, error) {
+	n, err := f.File.CopyFrom(src)
+	f.fs.report(TransferUpload, n)
+	return n, err //nolint:wrapcheck // passthrough
+}
+
+// CopyTo copies the remote file to dst.
+func (f *observedFile) CopyTo(dst io.Writer) (int64, error) {
+	n, err := f.File.CopyTo(dst)
+	f.fs.report(TransferDownload, n)
+	return n, err //nolint:wrapcheck // passthrough
+}
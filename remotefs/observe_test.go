@@ -0,0 +1,68 @@
+package remotefs_test
+
+import (
+	"context"
+	"io/fs"
+	"sync"
+	"testing"
+
+	"github.com/k0sproject/rig/v2/remotefs"
+	"github.com/stretchr/testify/require"
+)
+
+// transferFS adds ReadFile and WriteFile to the Upload stub.
+type transferFS struct {
+	uploadFS
+	files map[string][]byte
+}
+
+func (f *transferFS) ReadFile(name string) ([]byte, error) {
+	data, ok := f.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: remotefs.OpOpen, Path: name, Err: fs.ErrNotExist}
+	}
+	return data, nil
+}
+
+func (f *transferFS) WriteFile(name string, data []byte, _ fs.FileMode) error {
+	f.files[name] = data
+	return nil
+}
+
+type transferCounter struct {
+	mu    sync.Mutex
+	bytes map[remotefs.TransferDirection]int64
+}
+
+func (c *transferCounter) add(dir remotefs.TransferDirection, n int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.bytes[dir] += n
+}
+
+func TestObserveTransfers(t *testing.T) {
+	counter := &transferCounter{bytes: map[remotefs.TransferDirection]int64{}}
+	inner := &transferFS{files: map[string][]byte{"/etc/motd": []byte("welcome")}}
+	fsys := remotefs.ObserveTransfers(inner, counter.add)
+
+	data, err := fsys.ReadFile("/etc/motd")
+	require.NoError(t, err)
+	require.Equal(t, "welcome", string(data))
+	require.NoError(t, fsys.WriteFile("/tmp/greeting", []byte("hello"), 0o644))
+	_, err = fsys.ReadFile("/missing")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+
+	src := writeTempFile(t, "uploaded content", 0o644)
+	require.NoError(t, remotefs.Upload(fsys, src, "/remote/dst"))
+
+	require.Equal(t, int64(len("welcome")), counter.bytes[remotefs.TransferDownload])
+	require.Equal(t, int64(len("hello")+len("uploaded content")), counter.bytes[remotefs.TransferUpload])
+	require.Equal(t, "upload", remotefs.TransferUpload.String())
+	require.Equal(t, "download", remotefs.TransferDownload.String())
+}
+
+func TestObserveTransfersKeepsHTTPStatus(t *testing.T) {
+	fsys := remotefs.ObserveTransfers(&transferFS{}, func(remotefs.TransferDirection, int64) {})
+	_, err := remotefs.HTTPStatusInsecure(context.Background(), fsys, "https://example.com")
+	require.ErrorIs(t, err, remotefs.ErrHTTPStatusNotSupported)
+}
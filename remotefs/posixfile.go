@@ -185,11 +185,15 @@ func (f *PosixFile) CopyFrom(src io.Reader) (int64, error) {
 	}
 	counter := &iostream.ByteCounter{}
 
-	err := f.fs.Exec(
-		// "if=" is omitted so dd reads stdin, see the note in Write above.
-		sh.Command("dd", "of="+f.path, fmt.Sprintf("bs=%d", f.fsBlockSize()), fmt.Sprintf("seek=%d", f.pos), "conv=notrunc"),
-		cmd.Stdin(io.TeeReader(src, counter)),
-	)
+	// "if=" is omitted so dd reads stdin, see the note in Write above.
+	bs := f.fsBlockSize()
+	ddCmd := sh.Command("dd", "of="+f.path, fmt.Sprintf("bs=%d", bs), fmt.Sprintf("seek=%d", f.pos/int64(bs)), "conv=notrunc")
+	if f.pos%int64(bs) != 0 {
+		// dd seeks in blocks. The file was truncated at pos above, so
+		// appending to it writes at pos.
+		ddCmd = sh.CommandBuilder(sh.Command("dd", fmt.Sprintf("bs=%d", bs))).AppendOutToFile(f.path).String()
+	}
+	err := f.fs.Exec(ddCmd, cmd.Stdin(io.TeeReader(src, counter)))
 	if err != nil {
 		return 0, f.pathErr(OpCopyFrom, fmt.Errorf("exec dd: %w", err))
 	}
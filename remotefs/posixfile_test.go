@@ -70,3 +70,22 @@ func TestPosixFileCopyFrom(t *testing.T) {
 	require.Equal(t, "dd of=/tmp/file bs=4096 seek=0 conv=notrunc", mr.LastCommand())
 	require.NoError(t, mr.NotReceived(rigtest.Contains("/dev/stdin")))
 }
+
+func TestPosixFileCopyFromOffset(t *testing.T) {
+	mr := rigtest.NewMockRunner()
+	mr.AddCommandSuccess(rigtest.HasPrefix("truncate"))
+	mr.AddCommandSuccess(rigtest.HasPrefix("dd "))
+	f := openPosixFileForWriting(t, mr)
+
+	_, err := f.Seek(8192, io.SeekStart)
+	require.NoError(t, err)
+	_, err = f.CopyFrom(strings.NewReader("hello"))
+	require.NoError(t, err)
+	require.Equal(t, "dd of=/tmp/file bs=4096 seek=2 conv=notrunc", mr.LastCommand(), "dd seeks in blocks")
+
+	_, err = f.Seek(10000, io.SeekStart)
+	require.NoError(t, err)
+	_, err = f.CopyFrom(strings.NewReader("hello"))
+	require.NoError(t, err)
+	require.Equal(t, "dd bs=4096 >>/tmp/file", mr.LastCommand(), "an unaligned offset is appended to after the truncate")
+}
@@ -12,9 +12,11 @@ import (
 	"path"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/k0sproject/rig/v2/cmd"
+	"github.com/k0sproject/rig/v2/iostream"
 	"github.com/k0sproject/rig/v2/log"
 	"github.com/k0sproject/rig/v2/sh"
 	"github.com/k0sproject/rig/v2/sh/shellescape"
@@ -60,6 +62,9 @@ type PosixFS struct {
 	// TODO: these should probably be in some kind of "coreutils" package
 	statCmd   *string
 	chtimesFn func(name string, atime, mtime int64) error
+
+	compressMu  sync.Mutex
+	compressors map[Compression]bool
 }
 
 // NewPosixFS returns a fs.FS implementation for a remote filesystem that uses POSIX commands for access.
@@ -575,6 +580,123 @@ func (s *PosixFS) httpStatusInsecure(ctx context.Context, rawURL string) (int, e
 	return 0, fmt.Errorf("%w: neither curl nor wget found", ErrHTTPStatusNotSupported)
 }
 
+// uploadTar extracts the tar archive from src into dst with the remote tar.
+func (s *PosixFS) uploadTar(src io.Reader, dst string, opts tarOptions) error {
+	extract := sh.CommandBuilder(sh.Command("mkdir", "-p", "--", dst)).Raw("&&")
+	switch opts.compression {
+	case CompressionNone:
+		extract = extract.Raw(sh.Command("tar", "-x", "-p", "-f", "-", "-C", dst))
+	case CompressionGzip:
+		extract = extract.Raw(sh.Command("tar", "-x", "-z", "-p", "-f", "-", "-C", dst))
+	case CompressionZstd:
+		if !s.CommandExist("zstd") {
+			return fmt.Errorf("%w: zstd not found", ErrTarNotSupported)
+		}
+		extract = extract.Raw(sh.Command("zstd", "-d", "-c", "-q")).Pipe("tar", "-x", "-p", "-f", "-", "-C", dst)
+	}
+	if err := s.Exec(extract.String(), cmd.Stdin(src), cmd.LogInput(false)); err != nil {
+		return fmt.Errorf("extract archive: %w", err)
+	}
+	return nil
+}
+
+// downloadTar writes a tar archive of the contents of src to dst with the
+// remote tar.
+func (s *PosixFS) downloadTar(src string, dst io.Writer, opts tarOptions) error {
+	var create sh.CommandBuilder
+	switch opts.compression {
+	case CompressionNone:
+		create = sh.CommandBuilder(sh.Command("tar", "-c", "-f", "-", "-C", src, "."))
+	case CompressionGzip:
+		create = sh.CommandBuilder(sh.Command("tar", "-c", "-z", "-f", "-", "-C", src, "."))
+	case CompressionZstd:
+		if !s.CommandExist("zstd") {
+			return fmt.Errorf("%w: zstd not found", ErrTarNotSupported)
+		}
+		create = sh.CommandBuilder(sh.Command("tar", "-c", "-f", "-", "-C", src, ".")).Pipe("zstd", "-c", "-q")
+	}
+	if err := s.Exec(create.String(), cmd.Stdout(dst), cmd.HideOutput()); err != nil {
+		return fmt.Errorf("create archive: %w", err)
+	}
+	return nil
+}
+
+// supportsCompression reports whether the gzip or zstd command needed for
+// c is installed on the host.
+// The result is cached, so that a transfer of many files looks it up once.
+func (s *PosixFS) supportsCompression(c Compression) bool {
+	if c != CompressionGzip && c != CompressionZstd {
+		return false
+	}
+	s.compressMu.Lock()
+	defer s.compressMu.Unlock()
+	if ok, found := s.compressors[c]; found {
+		return ok
+	}
+	if s.compressors == nil {
+		s.compressors = make(map[Compression]bool)
+	}
+	s.compressors[c] = s.CommandExist(c.String())
+	return s.compressors[c]
+}
+
+// copyFromCompressed streams src compressed with c to the remote gzip or zstd
+// which decompresses it into the file name.
+func (s *PosixFS) copyFromCompressed(name string, offset int64, src io.Reader, c Compression) (int64, error) {
+	decompress := sh.CommandBuilder(sh.Command(c.String(), "-d", "-c"))
+	if offset > 0 {
+		decompress = decompress.AppendOutToFile(name)
+	} else {
+		decompress = decompress.OutToFile(name)
+	}
+	counter := &iostream.ByteCounter{}
+	compressed := compressedReader(io.TeeReader(src, counter), c)
+	defer compressed.Close()
+	if err := s.Exec(decompress.String(), cmd.Stdin(compressed), cmd.LogInput(false)); err != nil {
+		return counter.Count(), fmt.Errorf("decompress to %s: %w", name, err)
+	}
+	return counter.Count(), nil
+}
+
+// copyToCompressed writes the content of the file name to dst, compressed
+// with c by the remote gzip or zstd for the transfer.
+func (s *PosixFS) copyToCompressed(name string, dst io.Writer, c Compression) (int64, error) {
+	pr, pw := io.Pipe()
+	errCh := make(chan error, 1)
+	go func() {
+		err := s.Exec(sh.Command(c.String(), "-c", "--", name), cmd.Stdout(pw), cmd.HideOutput())
+		pw.CloseWithError(err)
+		errCh <- err
+	}()
+	n, copyErr := decompressTo(dst, pr, c)
+	// stops the remote command when the copy ended early
+	_ = pr.Close()
+	if err := <-errCh; err != nil && copyErr == nil {
+		return n, fmt.Errorf("compress %s: %w", name, err)
+	}
+	return n, copyErr
+}
+
+// ownedRegularFile reports whether name is a regular file owned by the user
+// the commands run as. A symbolic link is not followed and is never one.
+func (s *PosixFS) ownedRegularFile(name string) (bool, error) {
+	out, err := s.ExecOutput(
+		sh.Command("sh", "-c", `if [ -L "$1" ]; then echo other; elif [ ! -e "$1" ]; then echo none; elif [ -f "$1" ] && [ -O "$1" ]; then echo owned; else echo other; fi`, "sh", name),
+		cmd.HideOutput(),
+	)
+	if err != nil {
+		return false, PathError("lstat", name, err)
+	}
+	switch strings.TrimSpace(out) {
+	case "owned":
+		return true, nil
+	case "none":
+		return false, PathError("lstat", name, fs.ErrNotExist)
+	default:
+		return false, nil
+	}
+}
+
 // FileContains reports whether the file at path contains the given substring.
 // Returns a not-exist error if the file does not exist.
 func (s *PosixFS) FileContains(name, substr string) (bool, error) {
@@ -177,6 +177,54 @@ public static extern IntPtr GetStdHandle(int nStdHandle);
           $f.Flush()
           $buf=$null
         }
+        # write a gzip compressed chunk
+        'zw' {
+          if ($f -eq $null){ throw "file not open" }
+          $cnt=[int]$arg[1]
+          $o=@{
+             n=$cnt
+          }
+          Emit $out $o
+          $out.Flush()
+          $buf=NO byte[] $cnt
+          $b=0
+          while($b -lt $cnt){
+            $r=$in.Read($buf, $b, $cnt-$b)
+            if($r -eq 0){
+              throw "short read $b bytes instead of $cnt bytes"
+            }
+            $b+=$r
+          }
+          $ms=NO IO.MemoryStream(,$buf)
+          $gz=NO IO.Compression.GZipStream $ms, ([IO.Compression.CompressionMode]::Decompress)
+          $gz.CopyTo($f)
+          Close-Dispose $gz
+          $f.Flush()
+          $buf=$null
+        }
+        # read a gzip compressed chunk
+        'zr' {
+          if ($f -eq $null){ throw "file not open" }
+          $cnt=[int]$arg[1]
+          $buf=NO byte[] $cnt
+          $b=$f.Read($buf, 0, $cnt)
+          if($b -eq 0){
+            throw "eof"
+          }
+          $ms=NO IO.MemoryStream
+          $gz=NO IO.Compression.GZipStream $ms, ([IO.Compression.CompressionMode]::Compress)
+          $gz.Write($buf, 0, $b)
+          Close-Dispose $gz
+          $z=$ms.ToArray()
+          $o=@{
+             n=$z.Length
+          }
+          Emit $out $o
+          $out.Flush()
+          $out.Write($z, 0, $z.Length)
+          $out.Flush()
+          $buf=$null
+        }
         'c' {
           if ($f -eq $null){ throw "file not open" }
           Close-Dispose $f
@@ -0,0 +1,173 @@
+package remotefs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+
+	"github.com/pkg/sftp"
+)
+
+var (
+	_ fs.File        = (*SFTPFile)(nil)
+	_ File           = (*SFTPFile)(nil)
+	_ io.ReaderAt    = (*SFTPFile)(nil)
+	_ io.WriterAt    = (*SFTPFile)(nil)
+	_ fs.ReadDirFile = (*SFTPDir)(nil)
+	_ File           = (*SFTPDir)(nil)
+)
+
+// SFTPFile implements fs.File for a remote file accessed over SFTP.
+type SFTPFile struct {
+	withPath
+	fs   *SFTPFS
+	file *sftp.File
+}
+
+// Stat returns the FileInfo structure describing file.
+func (f *SFTPFile) Stat() (fs.FileInfo, error) {
+	info, err := f.file.Stat()
+	if err != nil {
+		return nil, f.pathErr(OpStat, unwrapPathError(err))
+	}
+	return f.fs.toFileInfo(f.path, info), nil
+}
+
+// Read reads up to len(p) bytes into p.
+func (f *SFTPFile) Read(p []byte) (int, error) {
+	n, err := f.file.Read(p)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return n, f.pathErr(OpRead, err)
+	}
+	return n, err //nolint:wrapcheck // io.EOF must be returned as is
+}
+
+// ReadAt reads len(p) bytes from the file starting at offset off without
+// moving the offset used by Read and Write.
+func (f *SFTPFile) ReadAt(p []byte, off int64) (int, error) {
+	n, err := f.file.ReadAt(p, off)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return n, f.pathErr(OpRead, err)
+	}
+	return n, err //nolint:wrapcheck // io.EOF must be returned as is
+}
+
+// Write writes len(p) bytes from p to the file.
+func (f *SFTPFile) Write(p []byte) (int, error) {
+	n, err := f.file.Write(p)
+	if err != nil {
+		return n, f.pathErr(OpWrite, err)
+	}
+	return n, nil
+}
+
+// WriteAt writes len(p) bytes to the file starting at offset off without
+// moving the offset used by Read and Write.
+func (f *SFTPFile) WriteAt(p []byte, off int64) (int, error) {
+	n, err := f.file.WriteAt(p, off)
+	if err != nil {
+		return n, f.pathErr(OpWrite, err)
+	}
+	return n, nil
+}
+
+// Seek sets the offset for the next Read or Write to offset, interpreted according to whence:
+// io.SeekStart means relative to the origin of the file,
+// io.SeekCurrent means relative to the current offset, and
+// io.SeekEnd means relative to the end.
+// Seek returns the new offset relative to the start of the file and an error, if any.
+func (f *SFTPFile) Seek(offset int64, whence int) (int64, error) {
+	pos, err := f.file.Seek(offset, whence)
+	if err != nil {
+		return pos, f.pathErr(OpSeek, err)
+	}
+	return pos, nil
+}
+
+// CopyTo copies the remote file from the current offset to the writer dst.
+// The data is requested with several concurrent reads.
+func (f *SFTPFile) CopyTo(dst io.Writer) (int64, error) {
+	n, err := f.file.WriteTo(dst)
+	if err != nil {
+		return n, f.pathErr(OpCopyTo, err)
+	}
+	return n, nil
+}
+
+// CopyFrom copies the local reader src to the remote file at the current
+// offset. The data is sent with several concurrent writes.
+func (f *SFTPFile) CopyFrom(src io.Reader) (int64, error) {
+	n, err := f.file.ReadFrom(src)
+	if err != nil {
+		return n, f.pathErr(OpCopyFrom, err)
+	}
+	return n, nil
+}
+
+// Close closes the file, rendering it unusable for I/O. It returns an error, if any.
+func (f *SFTPFile) Close() error {
+	if err := f.file.Close(); err != nil {
+		return f.pathErr(OpClose, err)
+	}
+	return nil
+}
+
+// SFTPDir implements fs.ReadDirFile for a remote directory accessed over SFTP.
+type SFTPDir struct {
+	withPath
+	fs     *SFTPFS
+	buffer *dirEntryBuffer
+	closed bool
+}
+
+// ReadDir returns a list of directory entries.
+func (d *SFTPDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if d.closed {
+		return nil, d.pathErr("read dir", fs.ErrClosed)
+	}
+	if d.buffer == nil {
+		entries, err := d.fs.ReadDir(d.path)
+		if err != nil {
+			return nil, err
+		}
+		d.buffer = newDirEntryBuffer(entries)
+	}
+	return d.buffer.Next(n)
+}
+
+// Stat returns the FileInfo structure describing the directory.
+func (d *SFTPDir) Stat() (fs.FileInfo, error) {
+	return d.fs.Stat(d.path)
+}
+
+// Read returns an error, directories can't be read.
+func (d *SFTPDir) Read(_ []byte) (int, error) {
+	return 0, d.pathErr(OpRead, fmt.Errorf("%w: is a directory", fs.ErrInvalid))
+}
+
+// Write returns an error, directories can't be written to.
+func (d *SFTPDir) Write(_ []byte) (int, error) {
+	return 0, d.pathErr(OpWrite, fmt.Errorf("%w: is a directory", fs.ErrInvalid))
+}
+
+// Seek returns an error, directories can't be seeked.
+func (d *SFTPDir) Seek(_ int64, _ int) (int64, error) {
+	return 0, d.pathErr(OpSeek, fmt.Errorf("%w: is a directory", fs.ErrInvalid))
+}
+
+// CopyTo returns an error, directories can't be read.
+func (d *SFTPDir) CopyTo(_ io.Writer) (int64, error) {
+	return 0, d.pathErr(OpCopyTo, fmt.Errorf("%w: is a directory", fs.ErrInvalid))
+}
+
+// CopyFrom returns an error, directories can't be written to.
+func (d *SFTPDir) CopyFrom(_ io.Reader) (int64, error) {
+	return 0, d.pathErr(OpCopyFrom, fmt.Errorf("%w: is a directory", fs.ErrInvalid))
+}
+
+// Close closes the directory.
+func (d *SFTPDir) Close() error {
+	d.closed = true
+	return nil
+}
@@ -0,0 +1,528 @@
+package remotefs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/k0sproject/rig/v2/cmd"
+	"github.com/k0sproject/rig/v2/log"
+	"github.com/k0sproject/rig/v2/protocol"
+	"github.com/pkg/sftp"
+)
+
+var (
+	_ fs.FS = (*SFTPFS)(nil)
+	_ FS    = (*SFTPFS)(nil)
+)
+
+// sftpSubsystem is the name of the SSH subsystem that serves SFTP.
+const sftpSubsystem = "sftp"
+
+// connectionRunner is implemented by runners that can hand out the
+// connection underneath them, like [cmd.Executor].
+type connectionRunner interface {
+	Connection() (protocol.ProcessStarter, bool)
+}
+
+// SFTPFS implements fs.FS for a remote filesystem that is accessed through the
+// SFTP subsystem of an SSH connection. File contents, stat, directory listings
+// and the other operations that have an SFTP request are served over a single
+// SFTP session, which gives random access reads and writes without having to
+// run commands for them. Operations that SFTP has no request for, such as
+// LookPath, Hostname, Sha256 or Chown by user name, are run as commands
+// through the embedded [PosixFS].
+//
+// The SFTP session runs as the user the connection is logged in as, so it
+// can't be used on a runner that elevates its commands through sudo or
+// similar. [SFTPProvider] takes care of that and falls back to [PosixFS].
+type SFTPFS struct {
+	*PosixFS
+
+	opener protocol.SubsystemOpener
+
+	mu     sync.Mutex
+	client *sftp.Client
+}
+
+// NewSFTPFS returns a fs.FS implementation for a remote filesystem that uses
+// the SFTP subsystem opened through opener for file access and conn for the
+// rest. The SFTP session is started on first use and restarted when the
+// connection has been re-established in between.
+func NewSFTPFS(conn cmd.Runner, opener protocol.SubsystemOpener) *SFTPFS {
+	return &SFTPFS{PosixFS: NewPosixFS(conn), opener: opener}
+}
+
+// SFTPProvider is a [FSProvider] that returns an [SFTPFS] when the runner's
+// connection supports the SFTP subsystem, which is the case for the native
+// SSH protocol when the server has SFTP enabled. Otherwise, and for runners
+// that use sudo or similar to run commands as another user, it returns the
+// implementation from [DefaultRegistry]. [DefaultRegistry] prefers SFTP the
+// same way, this is for selecting it explicitly with rig.WithRemoteFSProvider.
+func SFTPProvider(c cmd.Runner) (FS, error) {
+	if fsys, ok := newSFTPFSFor(c); ok {
+		return fsys, nil
+	}
+	return DefaultRegistry().Get(c) //nolint:wrapcheck // the registry error is the provider error
+}
+
+// RegisterSFTP registers the SFTP filesystem implementation. It has to take
+// precedence over the POSIX implementation, so register it before
+// [RegisterPosix], as [RegisterDefaults] does.
+func RegisterSFTP(r *Registry) {
+	r.Register(func(c cmd.Runner) (FS, bool) {
+		return newSFTPFSFor(c)
+	})
+}
+
+// newSFTPFSFor returns an SFTPFS for the runner when its connection can open
+// the SFTP subsystem. The session is started right away to find out whether
+// the server supports it.
+func newSFTPFSFor(c cmd.Runner) (*SFTPFS, bool) {
+	runner, ok := c.(connectionRunner)
+	if !ok {
+		return nil, false
+	}
+	conn, direct := runner.Connection()
+	if !direct {
+		return nil, false
+	}
+	opener, ok := conn.(protocol.SubsystemOpener)
+	if !ok || c.IsWindows() {
+		return nil, false
+	}
+	fsys := NewSFTPFS(c, opener)
+	if _, err := fsys.sftp(); err != nil {
+		fsys.Log().Debug("sftp subsystem not available", log.ErrorAttr(err))
+		return nil, false
+	}
+	return fsys, true
+}
+
+// sftp returns the SFTP client, starting a new session if there is none or the
+// previous one has ended.
+func (s *SFTPFS) sftp() (*sftp.Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client != nil {
+		return s.client, nil
+	}
+	stream, err := s.opener.OpenSubsystem(sftpSubsystem)
+	if err != nil {
+		return nil, fmt.Errorf("open sftp subsystem: %w", err)
+	}
+	client, err := sftp.NewClientPipe(stream, stream)
+	if err != nil {
+		_ = stream.Close()
+		return nil, fmt.Errorf("start sftp session: %w", err)
+	}
+	s.client = client
+	go func() {
+		_ = client.Wait()
+		s.mu.Lock()
+		if s.client == client {
+			s.client = nil
+		}
+		s.mu.Unlock()
+	}()
+	return client, nil
+}
+
+// Close ends the SFTP session. The next operation starts a new one.
+func (s *SFTPFS) Close() error {
+	s.mu.Lock()
+	client := s.client
+	s.client = nil
+	s.mu.Unlock()
+	if client == nil {
+		return nil
+	}
+	if err := client.Close(); err != nil {
+		return fmt.Errorf("close sftp session: %w", err)
+	}
+	return nil
+}
+
+// toFileInfo converts a file info from the SFTP client into a [FileInfo],
+// which is what the other implementations return.
+func (s *SFTPFS) toFileInfo(name string, info fs.FileInfo) *FileInfo {
+	return &FileInfo{
+		FName:    name,
+		FSize:    info.Size(),
+		FMode:    info.Mode(),
+		FModTime: info.ModTime(),
+		FIsDir:   info.IsDir(),
+		ModtimeS: info.ModTime().Unix(),
+		fs:       s,
+	}
+}
+
+// Stat returns the FileInfo structure describing file.
+func (s *SFTPFS) Stat(name string) (fs.FileInfo, error) {
+	client, err := s.sftp()
+	if err != nil {
+		return nil, PathError(OpStat, name, err)
+	}
+	info, err := client.Stat(name)
+	if err != nil {
+		return nil, PathError(OpStat, name, unwrapPathError(err))
+	}
+	return s.toFileInfo(name, info), nil
+}
+
+// unwrapPathError returns the error inside a *fs.PathError so that it does not
+// end up wrapped into a second one.
+func unwrapPathError(err error) error {
+	if pe, ok := errors.AsType[*fs.PathError](err); ok {
+		return pe.Err
+	}
+	return err
+}
+
+// Open opens the named file for reading.
+func (s *SFTPFS) Open(name string) (fs.File, error) {
+	return s.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// OpenFile is used to open a file with access/creation flags for reading or writing. For info on flags,
+// see https://pkg.go.dev/os#pkg-constants
+//
+// A file that is created gets the permission bits of perm, regardless of the
+// umask of the remote user. Directories can only be opened for reading.
+func (s *SFTPFS) OpenFile(name string, flags int, perm fs.FileMode) (File, error) {
+	if flags&^supportedFlags != 0 {
+		return nil, fmt.Errorf("%w: unsupported flags: %d", errInvalid, flags)
+	}
+	client, err := s.sftp()
+	if err != nil {
+		return nil, PathError(OpOpen, name, err)
+	}
+
+	info, err := client.Stat(name)
+	switch {
+	case err == nil && info.IsDir():
+		if flags&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_EXCL) != 0 {
+			return nil, PathErrorf(OpOpen, name, "%w: is a directory", fs.ErrInvalid)
+		}
+		return &SFTPDir{withPath: withPath{name}, fs: s}, nil
+	case err != nil && !errors.Is(err, fs.ErrNotExist):
+		return nil, PathError(OpOpen, name, unwrapPathError(err))
+	}
+	created := err != nil
+	// SFTP servers report a failure without a reason for O_EXCL on an
+	// existing file
+	if !created && flags&(os.O_CREATE|os.O_EXCL) == (os.O_CREATE|os.O_EXCL) {
+		return nil, PathError(OpOpen, name, fs.ErrExist)
+	}
+
+	file, err := client.OpenFile(name, flags&^os.O_SYNC)
+	if err != nil {
+		return nil, PathError(OpOpen, name, unwrapPathError(err))
+	}
+	if created {
+		if err := file.Chmod(perm); err != nil {
+			_ = file.Close()
+			return nil, PathError(OpOpen, name, err)
+		}
+	}
+	if flags&os.O_APPEND != 0 {
+		if _, err := file.Seek(0, io.SeekEnd); err != nil {
+			_ = file.Close()
+			return nil, PathError(OpSeek, name, err)
+		}
+	}
+	return &SFTPFile{withPath: withPath{name}, fs: s, file: file}, nil
+}
+
+// ReadDir reads the directory named by dirname and returns a list of directory entries
+// sorted by filename.
+func (s *SFTPFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if name == "" {
+		name = "."
+	}
+	client, err := s.sftp()
+	if err != nil {
+		return nil, PathError("read dir", name, err)
+	}
+	infos, err := client.ReadDir(name)
+	if err != nil {
+		return nil, PathError("read dir", name, unwrapPathError(err))
+	}
+	entries := make([]fs.DirEntry, 0, len(infos))
+	for _, info := range infos {
+		entries = append(entries, s.toFileInfo(path.Join(name, info.Name()), info))
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+	return entries, nil
+}
+
+// ReadFile reads the file named by filename and returns the contents.
+func (s *SFTPFS) ReadFile(filename string) ([]byte, error) {
+	client, err := s.sftp()
+	if err != nil {
+		return nil, fmt.Errorf("read file %s: %w", filename, err)
+	}
+	file, err := client.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("read file %s: %w", filename, err)
+	}
+	defer file.Close()
+	var buf bytes.Buffer
+	if _, err := file.WriteTo(&buf); err != nil {
+		return nil, fmt.Errorf("read file %s: %w", filename, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteFile writes data to a file named by filename. Any missing parent
+// directories are created with the remote default mode.
+//
+// The permission bits of perm are applied to the file before the data is
+// written, so that a newly created file is never more permissive than perm,
+// and perm is applied again afterwards along with its setuid, setgid and
+// sticky bits, also to a file that already existed.
+func (s *SFTPFS) WriteFile(filename string, data []byte, perm fs.FileMode) error {
+	client, err := s.sftp()
+	if err != nil {
+		return fmt.Errorf("write file %s: %w", filename, err)
+	}
+	if err := client.MkdirAll(path.Dir(filename)); err != nil {
+		return fmt.Errorf("write file %s: %w", filename, err)
+	}
+	file, err := client.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return fmt.Errorf("write file %s: %w", filename, err)
+	}
+	defer file.Close()
+	if err := file.Chmod(perm.Perm()); err != nil {
+		return fmt.Errorf("write file %s: %w", filename, err)
+	}
+	if _, err := file.ReadFrom(bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("write file %s: %w", filename, err)
+	}
+	if err := file.Chmod(perm); err != nil {
+		return fmt.Errorf("write file %s: %w", filename, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("write file %s: %w", filename, err)
+	}
+	return nil
+}
+
+// FileExist checks if a regular file exists on the host.
+func (s *SFTPFS) FileExist(name string) bool {
+	info, err := s.Stat(name)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// Remove deletes the named file or (empty) directory. A file that does not
+// exist is not an error.
+func (s *SFTPFS) Remove(name string) error {
+	client, err := s.sftp()
+	if err != nil {
+		return fmt.Errorf("delete %s: %w", name, err)
+	}
+	if err := client.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("delete %s: %w", name, err)
+	}
+	return nil
+}
+
+// RemoveAll removes path and any children it contains.
+func (s *SFTPFS) RemoveAll(name string) error {
+	client, err := s.sftp()
+	if err != nil {
+		return fmt.Errorf("remove all %s: %w", name, err)
+	}
+	if err := client.RemoveAll(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("remove all %s: %w", name, err)
+	}
+	return nil
+}
+
+// Rename renames (moves) oldpath to newpath. An existing newpath is replaced.
+func (s *SFTPFS) Rename(oldpath, newpath string) error {
+	client, err := s.sftp()
+	if err != nil {
+		return fmt.Errorf("rename %s -> %s: %w", oldpath, newpath, err)
+	}
+	if _, ok := client.HasExtension("posix-rename@openssh.com"); ok {
+		if err := client.PosixRename(oldpath, newpath); err != nil {
+			return fmt.Errorf("rename %s -> %s: %w", oldpath, newpath, err)
+		}
+		return nil
+	}
+	// a plain SFTP rename refuses to replace an existing file
+	if err := client.Remove(newpath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("rename %s -> %s: %w", oldpath, newpath, err)
+	}
+	if err := client.Rename(oldpath, newpath); err != nil {
+		return fmt.Errorf("rename %s -> %s: %w", oldpath, newpath, err)
+	}
+	return nil
+}
+
+// Mkdir creates a new directory with the specified name and permission bits.
+//
+// The permission bits and the setgid, setuid and sticky bits of perm are
+// applied; the file type bits are ignored.
+func (s *SFTPFS) Mkdir(name string, perm fs.FileMode) error {
+	client, err := s.sftp()
+	if err != nil {
+		return PathError("mkdir", name, err)
+	}
+	if err := client.Mkdir(name); err != nil {
+		return PathError("mkdir", name, unwrapPathError(err))
+	}
+	if err := client.Chmod(name, perm); err != nil {
+		return PathError("mkdir", name, unwrapPathError(err))
+	}
+	return nil
+}
+
+// MkdirAll creates a new directory structure with the specified name and permission bits.
+// If the directory already exists, MkDirAll does nothing and returns nil.
+//
+// The permission bits of perm are applied to every directory that is created,
+// like os.MkdirAll does; directories that already exist are left alone. The
+// setgid, setuid and sticky bits of perm are applied to the last directory of
+// the path only. The file type bits are ignored.
+func (s *SFTPFS) MkdirAll(name string, perm fs.FileMode) error {
+	client, err := s.sftp()
+	if err != nil {
+		return fmt.Errorf("mkdir %s: %w", name, err)
+	}
+
+	var missing []string
+	for dir := path.Clean(name); ; dir = path.Dir(dir) {
+		info, err := client.Stat(dir)
+		if err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("mkdir %s: %w", name, fs.ErrExist)
+			}
+			break
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("mkdir %s: %w", name, err)
+		}
+		missing = append(missing, dir)
+		if parent := path.Dir(dir); parent == dir {
+			break
+		}
+	}
+
+	for i := len(missing) - 1; i >= 0; i-- {
+		dir := missing[i]
+		if err := client.Mkdir(dir); err != nil {
+			return fmt.Errorf("mkdir %s: %w", name, err)
+		}
+		mode := perm.Perm()
+		if i == 0 {
+			mode = perm
+		}
+		if err := client.Chmod(dir, mode); err != nil {
+			return fmt.Errorf("mkdir %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Chmod changes the mode of the named file to mode. The permission bits and
+// the setuid, setgid and sticky bits are applied; the file type bits are
+// ignored.
+func (s *SFTPFS) Chmod(name string, mode fs.FileMode) error {
+	client, err := s.sftp()
+	if err != nil {
+		return fmt.Errorf("chmod %s: %w", name, err)
+	}
+	if err := client.Chmod(name, mode); err != nil {
+		return fmt.Errorf("chmod %s: %w", name, err)
+	}
+	return nil
+}
+
+// ChownInt changes the numeric uid and gid of the named file.
+func (s *SFTPFS) ChownInt(name string, uid, gid int) error {
+	client, err := s.sftp()
+	if err != nil {
+		return fmt.Errorf("chown %s: %w", name, err)
+	}
+	if err := client.Chown(name, uid, gid); err != nil {
+		return fmt.Errorf("chown %s: %w", name, err)
+	}
+	return nil
+}
+
+// Chtimes changes the access and modification times of the named file.
+// SFTP carries the timestamps in whole seconds, so times with a fraction of
+// a second are set through the embedded [PosixFS] instead.
+func (s *SFTPFS) Chtimes(name string, atime, mtime int64) error {
+	if !sftpTime(atime) || !sftpTime(mtime) {
+		return s.PosixFS.Chtimes(name, atime, mtime)
+	}
+	client, err := s.sftp()
+	if err != nil {
+		return fmt.Errorf("chtimes %s: %w", name, err)
+	}
+	if err := client.Chtimes(name, int64ToTime(atime), int64ToTime(mtime)); err != nil {
+		return fmt.Errorf("chtimes %s: %w", name, err)
+	}
+	return nil
+}
+
+// sftpTime reports whether the nanosecond timestamp can be sent over SFTP,
+// which uses unsigned 32-bit seconds.
+func sftpTime(ns int64) bool {
+	return ns >= 0 && ns%1e9 == 0 && ns/1e9 <= math.MaxUint32
+}
+
+// Touch creates a new empty file at path or updates the timestamps of an existing file.
+// Without ts, both access and modification times are set to the current time of the
+// remote host. When ts is supplied, both times are set to the first timestamp provided.
+func (s *SFTPFS) Touch(name string, ts ...time.Time) error {
+	if len(ts) == 0 {
+		// the current time has to come from the remote clock
+		return s.PosixFS.Touch(name)
+	}
+	client, err := s.sftp()
+	if err != nil {
+		return fmt.Errorf("touch %s: %w", name, err)
+	}
+	file, err := client.OpenFile(name, os.O_WRONLY|os.O_CREATE)
+	if err != nil {
+		return fmt.Errorf("touch %s: %w", name, err)
+	}
+	_ = file.Close()
+	if err := s.Chtimes(name, ts[0].UnixNano(), ts[0].UnixNano()); err != nil {
+		return fmt.Errorf("touch %s: %w", name, err)
+	}
+	return nil
+}
+
+// Truncate changes the size of the named file or creates a new file if it doesn't exist.
+func (s *SFTPFS) Truncate(name string, size int64) error {
+	client, err := s.sftp()
+	if err != nil {
+		return fmt.Errorf("truncate %s: %w", name, err)
+	}
+	file, err := client.OpenFile(name, os.O_WRONLY|os.O_CREATE)
+	if err != nil {
+		return fmt.Errorf("truncate %s: %w", name, err)
+	}
+	defer file.Close()
+	if err := file.Truncate(size); err != nil {
+		return fmt.Errorf("truncate %s: %w", name, err)
+	}
+	return nil
+}
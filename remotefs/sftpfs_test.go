@@ -0,0 +1,259 @@
+package remotefs_test
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/k0sproject/rig/v2/cmd"
+	"github.com/k0sproject/rig/v2/remotefs"
+	"github.com/k0sproject/rig/v2/rigtest"
+	"github.com/k0sproject/rig/v2/sudo"
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/require"
+)
+
+var errNoSubsystem = errors.New("subsystem request failed")
+
+// sftpConnection is a mock connection that serves the SFTP subsystem from
+// the local filesystem.
+type sftpConnection struct {
+	*rigtest.MockConnection
+	disabled bool
+}
+
+func (c *sftpConnection) OpenSubsystem(name string) (io.ReadWriteCloser, error) {
+	if c.disabled || name != "sftp" {
+		return nil, errNoSubsystem
+	}
+	client, server := net.Pipe()
+	srv, err := sftp.NewServer(server)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		_ = srv.Serve()
+		_ = srv.Close()
+	}()
+	return client, nil
+}
+
+func newSFTPFS(t *testing.T) (*remotefs.SFTPFS, string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the test sftp server uses posix paths")
+	}
+	conn := &sftpConnection{MockConnection: rigtest.NewMockConnection()}
+	fsys := remotefs.NewSFTPFS(cmd.NewExecutor(conn), conn)
+	t.Cleanup(func() { _ = fsys.Close() })
+	return fsys, t.TempDir()
+}
+
+func TestSFTPWriteReadFile(t *testing.T) {
+	fsys, dir := newSFTPFS(t)
+	name := filepath.Join(dir, "sub", "file.txt")
+
+	require.NoError(t, fsys.WriteFile(name, []byte("hello sftp"), 0o640))
+	data, err := fsys.ReadFile(name)
+	require.NoError(t, err)
+	require.Equal(t, "hello sftp", string(data))
+
+	info, err := fsys.Stat(name)
+	require.NoError(t, err)
+	require.Equal(t, fs.FileMode(0o640), info.Mode().Perm())
+	require.Equal(t, int64(len("hello sftp")), info.Size())
+	require.True(t, info.Mode().IsRegular())
+	require.True(t, fsys.FileExist(name))
+	require.False(t, fsys.FileExist(filepath.Join(dir, "sub")), "a directory is not a file")
+
+	_, err = fsys.Stat(filepath.Join(dir, "missing"))
+	require.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestSFTPOpenFile(t *testing.T) {
+	fsys, dir := newSFTPFS(t)
+	name := filepath.Join(dir, "file.bin")
+
+	f, err := fsys.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o600)
+	require.NoError(t, err)
+	_, err = f.Write([]byte("0123456789"))
+	require.NoError(t, err)
+
+	file, ok := f.(*remotefs.SFTPFile)
+	require.True(t, ok)
+	_, err = file.WriteAt([]byte("ab"), 4)
+	require.NoError(t, err)
+	buf := make([]byte, 4)
+	_, err = file.ReadAt(buf, 3)
+	require.NoError(t, err)
+	require.Equal(t, "3ab6", string(buf))
+
+	pos, err := f.Seek(-2, io.SeekEnd)
+	require.NoError(t, err)
+	require.Equal(t, int64(8), pos)
+	rest, err := io.ReadAll(f)
+	require.NoError(t, err)
+	require.Equal(t, "89", string(rest))
+	require.NoError(t, f.Close())
+
+	info, err := fsys.Stat(name)
+	require.NoError(t, err)
+	require.Equal(t, fs.FileMode(0o600), info.Mode().Perm())
+
+	_, err = fsys.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	require.ErrorIs(t, err, fs.ErrExist)
+
+	f, err = fsys.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = f.CopyFrom(strings.NewReader("!"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	data, err := fsys.ReadFile(name)
+	require.NoError(t, err)
+	require.Equal(t, "0123ab6789!", string(data))
+
+	_, err = fsys.OpenFile(dir, os.O_WRONLY, 0)
+	require.ErrorIs(t, err, fs.ErrInvalid)
+}
+
+func TestSFTPDirectories(t *testing.T) {
+	fsys, dir := newSFTPFS(t)
+	nested := filepath.Join(dir, "a", "b", "c")
+
+	require.NoError(t, fsys.MkdirAll(nested, 0o750))
+	require.NoError(t, fsys.MkdirAll(nested, 0o700), "an existing directory is not an error")
+	for _, d := range []string{filepath.Join(dir, "a"), filepath.Join(dir, "a", "b"), nested} {
+		info, err := fsys.Stat(d)
+		require.NoError(t, err)
+		require.True(t, info.IsDir())
+		require.Equal(t, fs.FileMode(0o750), info.Mode().Perm(), d)
+	}
+	require.NoError(t, fsys.Mkdir(filepath.Join(dir, "a", "m"), 0o711))
+	require.NoError(t, fsys.WriteFile(filepath.Join(dir, "a", "z.txt"), []byte("z"), 0o644))
+
+	entries, err := fsys.ReadDir(filepath.Join(dir, "a"))
+	require.NoError(t, err)
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	require.Equal(t, []string{"b", "m", "z.txt"}, names)
+	info, ok := entries[2].(*remotefs.FileInfo)
+	require.True(t, ok)
+	require.Equal(t, filepath.Join(dir, "a", "z.txt"), info.FullPath())
+
+	var walked []string
+	require.NoError(t, fs.WalkDir(fsys, filepath.Join(dir, "a"), func(p string, _ fs.DirEntry, err error) error {
+		walked = append(walked, p)
+		return err
+	}))
+	require.Len(t, walked, 5)
+
+	require.NoError(t, fsys.RemoveAll(filepath.Join(dir, "a")))
+	require.NoError(t, fsys.RemoveAll(filepath.Join(dir, "a")), "removing a missing tree is not an error")
+	_, err = fsys.Stat(filepath.Join(dir, "a"))
+	require.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestSFTPFileOperations(t *testing.T) {
+	fsys, dir := newSFTPFS(t)
+	src := filepath.Join(dir, "src")
+	dst := filepath.Join(dir, "dst")
+
+	require.NoError(t, fsys.WriteFile(src, []byte("new"), 0o644))
+	require.NoError(t, fsys.WriteFile(dst, []byte("old"), 0o644))
+	require.NoError(t, fsys.Rename(src, dst))
+	data, err := fsys.ReadFile(dst)
+	require.NoError(t, err)
+	require.Equal(t, "new", string(data))
+	require.False(t, fsys.FileExist(src))
+
+	require.NoError(t, fsys.Chmod(dst, 0o600))
+	info, err := fsys.Stat(dst)
+	require.NoError(t, err)
+	require.Equal(t, fs.FileMode(0o600), info.Mode().Perm())
+
+	ts := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, fsys.Touch(dst, ts))
+	info, err = fsys.Stat(dst)
+	require.NoError(t, err)
+	require.True(t, ts.Equal(info.ModTime()), "got %s", info.ModTime())
+
+	truncated := filepath.Join(dir, "truncated")
+	require.NoError(t, fsys.Truncate(truncated, 5))
+	info, err = fsys.Stat(truncated)
+	require.NoError(t, err)
+	require.Equal(t, int64(5), info.Size())
+
+	require.NoError(t, fsys.Remove(dst))
+	require.NoError(t, fsys.Remove(dst), "removing a missing file is not an error")
+}
+
+func TestSFTPProvider(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test sftp server uses posix paths")
+	}
+
+	t.Run("subsystem available", func(t *testing.T) {
+		conn := &sftpConnection{MockConnection: rigtest.NewMockConnection()}
+		fsys, err := remotefs.SFTPProvider(cmd.NewExecutor(conn))
+		require.NoError(t, err)
+		require.IsType(t, &remotefs.SFTPFS{}, fsys)
+	})
+
+	t.Run("subsystem refused", func(t *testing.T) {
+		conn := &sftpConnection{MockConnection: rigtest.NewMockConnection(), disabled: true}
+		fsys, err := remotefs.SFTPProvider(cmd.NewExecutor(conn))
+		require.NoError(t, err)
+		require.IsType(t, &remotefs.PosixFS{}, fsys)
+	})
+
+	t.Run("sudo runner", func(t *testing.T) {
+		conn := &sftpConnection{MockConnection: rigtest.NewMockConnection()}
+		runner := cmd.NewExecutor(cmd.NewExecutor(conn), sudo.Sudo)
+		fsys, err := remotefs.SFTPProvider(runner)
+		require.NoError(t, err)
+		require.IsType(t, &remotefs.PosixFS{}, fsys, "sftp can't elevate")
+	})
+
+	t.Run("no subsystem support", func(t *testing.T) {
+		fsys, err := remotefs.SFTPProvider(rigtest.NewMockRunner())
+		require.NoError(t, err)
+		require.IsType(t, &remotefs.PosixFS{}, fsys)
+	})
+
+	t.Run("windows", func(t *testing.T) {
+		conn := &sftpConnection{MockConnection: rigtest.NewMockConnection()}
+		conn.Windows = true
+		fsys, err := remotefs.SFTPProvider(cmd.NewExecutor(conn))
+		require.NoError(t, err)
+		require.IsType(t, &remotefs.WinFS{}, fsys)
+	})
+}
+
+func TestDefaultRegistrySFTP(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test sftp server uses posix paths")
+	}
+
+	t.Run("subsystem available", func(t *testing.T) {
+		conn := &sftpConnection{MockConnection: rigtest.NewMockConnection()}
+		fsys, err := remotefs.DefaultRegistry().Get(cmd.NewExecutor(conn))
+		require.NoError(t, err)
+		require.IsType(t, &remotefs.SFTPFS{}, fsys)
+	})
+
+	t.Run("subsystem refused", func(t *testing.T) {
+		conn := &sftpConnection{MockConnection: rigtest.NewMockConnection(), disabled: true}
+		fsys, err := remotefs.DefaultRegistry().Get(cmd.NewExecutor(conn))
+		require.NoError(t, err)
+		require.IsType(t, &remotefs.PosixFS{}, fsys)
+	})
+}
@@ -0,0 +1,461 @@
+package remotefs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrSyncConflict is returned by [SyncDir] and [SyncDirFromRemote] when a
+	// file would replace a directory or the other way around and [SyncDelete]
+	// was not given.
+	ErrSyncConflict = errors.New("sync: file and directory conflict")
+	// ErrNotDir is returned when a path that should be a directory is not.
+	ErrNotDir = errors.New("not a directory")
+)
+
+// SyncOption is a functional option for [SyncDir] and [SyncDirFromRemote].
+type SyncOption func(*syncOptions)
+
+type syncOptions struct {
+	checksum    bool
+	sizeOnly    bool
+	delete      bool
+	compression Compression
+}
+
+// SyncChecksum makes the sync compare the SHA-256 checksums of files of the
+// same size instead of their modification times. It is slower, as every file
+// has to be read on both sides, but does not trust the clocks.
+func SyncChecksum() SyncOption {
+	return func(o *syncOptions) {
+		o.checksum = true
+		o.sizeOnly = false
+	}
+}
+
+// SyncSizeOnly makes the sync consider files of the same size unchanged.
+func SyncSizeOnly() SyncOption {
+	return func(o *syncOptions) {
+		o.sizeOnly = true
+		o.checksum = false
+	}
+}
+
+// SyncDelete makes the sync delete the files and directories in the
+// destination that are not in the source, like rsync --delete. It also lets a
+// file replace a directory and the other way around.
+func SyncDelete() SyncOption {
+	return func(o *syncOptions) {
+		o.delete = true
+	}
+}
+
+// SyncCompression makes the sync compress the files for the transfer with c
+// when the remote host supports it, see [WithCompression].
+func SyncCompression(c Compression) SyncOption {
+	return func(o *syncOptions) {
+		o.compression = c
+	}
+}
+
+// SyncReport lists what a sync did. The paths are relative to the synced
+// directories and use forward slashes.
+type SyncReport struct {
+	// Created are the files and directories that did not exist in the destination.
+	Created []string
+	// Updated are the files that were copied over a differing one and the
+	// files and directories whose mode was changed to the one of the source.
+	Updated []string
+	// Unchanged are the files that were found to be the same and not copied.
+	Unchanged []string
+	// Deleted are the files and directories removed with [SyncDelete]. The
+	// contents of a deleted directory are not listed.
+	Deleted []string
+	// Skipped are the entries in the source that are neither regular files
+	// nor directories, such as symlinks.
+	Skipped []string
+}
+
+// Changed reports whether the sync modified the destination.
+func (r *SyncReport) Changed() bool {
+	return len(r.Created) > 0 || len(r.Updated) > 0 || len(r.Deleted) > 0
+}
+
+// SyncDir makes the remote directory dst a copy of the local directory src.
+// Files that differ in size or modification time (see [SyncChecksum] and
+// [SyncSizeOnly] for other comparisons) are uploaded with [Upload], so each
+// of them is replaced atomically and verified. Missing directories are
+// created. The modes and modification times of the files and directories it
+// creates or copies are set to the ones of the source, as far as the remote
+// filesystem supports them: on Windows only the read-only attribute follows
+// the mode. The mode of an existing file or directory that is otherwise up to
+// date is changed when it differs, but the mode of dst itself is left as is.
+//
+// On error, the returned report lists what was done before it.
+func SyncDir(fsys FS, src, dst string, opts ...SyncOption) (*SyncReport, error) {
+	local := localSyncTree{root: src}
+	remote := remoteSyncTree{fsys: fsys, root: dst}
+	compression := newSyncOptions(opts).compression
+	return syncTrees(local, remote, func(rel string, info fs.FileInfo) error {
+		target := remote.path(rel)
+		if err := Upload(fsys, local.path(rel), target, WithPermissions(info.Mode().Perm()), WithCompression(compression)); err != nil {
+			return err
+		}
+		mtime := info.ModTime().UnixNano()
+		if err := fsys.Chtimes(target, mtime, mtime); err != nil {
+			return fmt.Errorf("set modification time: %w", err)
+		}
+		return nil
+	}, opts...)
+}
+
+// SyncDirFromRemote makes the local directory dst a copy of the remote
+// directory src. It is the reverse of [SyncDir] and works the same way: each
+// downloaded file is written to a temporary file, verified against the SHA-256
+// checksum of the remote file and renamed into place.
+func SyncDirFromRemote(fsys FS, src, dst string, opts ...SyncOption) (*SyncReport, error) {
+	remote := remoteSyncTree{fsys: fsys, root: src}
+	local := localSyncTree{root: dst}
+	compression := newSyncOptions(opts).compression
+	return syncTrees(remote, local, func(rel string, info fs.FileInfo) error {
+		return download(fsys, remote.path(rel), local.path(rel), info, compression)
+	}, opts...)
+}
+
+// syncTree is one side of a sync. The paths it takes are relative to its
+// root and use forward slashes, "" being the root itself.
+type syncTree interface {
+	path(rel string) string
+	stat(rel string) (fs.FileInfo, error)
+	readDir(rel string) ([]fs.FileInfo, error)
+	sha256(rel string) (string, error)
+	mkdir(rel string, perm fs.FileMode) error
+	chmod(rel string, perm fs.FileMode) error
+	removeAll(rel string) error
+	// permMask returns the permission bits the tree can represent.
+	permMask() fs.FileMode
+}
+
+// permMasker is implemented by the filesystems that can only represent some
+// of the permission bits.
+type permMasker interface {
+	permMask() fs.FileMode
+}
+
+type localSyncTree struct {
+	root string
+}
+
+func (t localSyncTree) path(rel string) string {
+	return filepath.Join(t.root, filepath.FromSlash(rel))
+}
+
+func (t localSyncTree) stat(rel string) (fs.FileInfo, error) {
+	return os.Stat(t.path(rel)) //nolint:wrapcheck // a path error
+}
+
+func (t localSyncTree) readDir(rel string) ([]fs.FileInfo, error) {
+	entries, err := os.ReadDir(t.path(rel))
+	if err != nil {
+		return nil, err //nolint:wrapcheck // a path error
+	}
+	return entryInfos(entries)
+}
+
+func (t localSyncTree) sha256(rel string) (string, error) {
+	f, err := os.Open(t.path(rel))
+	if err != nil {
+		return "", err //nolint:wrapcheck // a path error
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("checksum %s: %w", f.Name(), err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (t localSyncTree) mkdir(rel string, perm fs.FileMode) error {
+	p := t.path(rel)
+	if err := os.MkdirAll(p, perm); err != nil {
+		return err //nolint:wrapcheck // a path error
+	}
+	return os.Chmod(p, perm) //nolint:wrapcheck // a path error
+}
+
+func (t localSyncTree) chmod(rel string, perm fs.FileMode) error {
+	return os.Chmod(t.path(rel), perm) //nolint:wrapcheck // a path error
+}
+
+func (t localSyncTree) removeAll(rel string) error {
+	return os.RemoveAll(t.path(rel)) //nolint:wrapcheck // a path error
+}
+
+func (t localSyncTree) permMask() fs.FileMode {
+	if runtime.GOOS == "windows" {
+		// only the read-only attribute follows the owner write bit
+		return 0o200
+	}
+	return fs.ModePerm
+}
+
+type remoteSyncTree struct {
+	fsys FS
+	root string
+}
+
+func (t remoteSyncTree) path(rel string) string {
+	if rel == "" {
+		return t.root
+	}
+	return t.fsys.Join(append([]string{t.root}, strings.Split(rel, "/")...)...)
+}
+
+func (t remoteSyncTree) stat(rel string) (fs.FileInfo, error) {
+	return t.fsys.Stat(t.path(rel)) //nolint:wrapcheck // a path error
+}
+
+func (t remoteSyncTree) readDir(rel string) ([]fs.FileInfo, error) {
+	entries, err := t.fsys.ReadDir(t.path(rel))
+	if err != nil {
+		return nil, err //nolint:wrapcheck // a path error
+	}
+	return entryInfos(entries)
+}
+
+func (t remoteSyncTree) sha256(rel string) (string, error) {
+	return t.fsys.Sha256(t.path(rel)) //nolint:wrapcheck // a path error
+}
+
+func (t remoteSyncTree) mkdir(rel string, perm fs.FileMode) error {
+	p := t.path(rel)
+	if err := t.fsys.MkdirAll(p, perm); err != nil {
+		return err //nolint:wrapcheck // a path error
+	}
+	return t.fsys.Chmod(p, perm) //nolint:wrapcheck // a path error
+}
+
+func (t remoteSyncTree) chmod(rel string, perm fs.FileMode) error {
+	return t.fsys.Chmod(t.path(rel), perm) //nolint:wrapcheck // a path error
+}
+
+func (t remoteSyncTree) removeAll(rel string) error {
+	return t.fsys.RemoveAll(t.path(rel)) //nolint:wrapcheck // a path error
+}
+
+func (t remoteSyncTree) permMask() fs.FileMode {
+	if m, ok := t.fsys.(permMasker); ok {
+		return m.permMask()
+	}
+	return fs.ModePerm
+}
+
+// entryInfos returns the file infos of entries sorted by name.
+func entryInfos(entries []fs.DirEntry) ([]fs.FileInfo, error) {
+	infos := make([]fs.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			return nil, fmt.Errorf("stat %s: %w", entry.Name(), err)
+		}
+		infos = append(infos, info)
+	}
+	slices.SortFunc(infos, func(a, b fs.FileInfo) int { return strings.Compare(a.Name(), b.Name()) })
+	return infos, nil
+}
+
+func newSyncOptions(opts []SyncOption) syncOptions {
+	var o syncOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// syncer walks the source tree and brings the destination tree up to date.
+type syncer struct {
+	src, dst syncTree
+	copyFile func(rel string, info fs.FileInfo) error
+	opts     syncOptions
+	report   *SyncReport
+}
+
+func syncTrees(src, dst syncTree, copyFile func(rel string, info fs.FileInfo) error, opts ...SyncOption) (*SyncReport, error) {
+	s := &syncer{src: src, dst: dst, copyFile: copyFile, opts: newSyncOptions(opts), report: &SyncReport{}}
+
+	root, err := src.stat("")
+	if err != nil {
+		return s.report, fmt.Errorf("sync: stat source: %w", err)
+	}
+	if !root.IsDir() {
+		return s.report, fmt.Errorf("sync: source: %w", &fs.PathError{Op: OpStat, Path: src.path(""), Err: ErrNotDir})
+	}
+
+	dstRoot, err := dst.stat("")
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		if err := dst.mkdir("", root.Mode().Perm()); err != nil {
+			return s.report, fmt.Errorf("sync: create destination: %w", err)
+		}
+		return s.report, s.syncDir("", false)
+	case err != nil:
+		return s.report, fmt.Errorf("sync: stat destination: %w", err)
+	case !dstRoot.IsDir():
+		return s.report, fmt.Errorf("sync: destination: %w", &fs.PathError{Op: OpStat, Path: dst.path(""), Err: ErrNotDir})
+	}
+	return s.report, s.syncDir("", true)
+}
+
+// syncDir syncs the entries of the directory rel. dstExists is false when the
+// directory was just created in the destination, which saves listing it.
+func (s *syncer) syncDir(rel string, dstExists bool) error {
+	entries, err := s.src.readDir(rel)
+	if err != nil {
+		return fmt.Errorf("sync: read source directory: %w", err)
+	}
+	existing := map[string]fs.FileInfo{}
+	if dstExists {
+		dstEntries, err := s.dst.readDir(rel)
+		if err != nil {
+			return fmt.Errorf("sync: read destination directory: %w", err)
+		}
+		for _, entry := range dstEntries {
+			existing[entry.Name()] = entry
+		}
+	}
+
+	for _, info := range entries {
+		childRel := path.Join(rel, info.Name())
+		current, ok := existing[info.Name()]
+		delete(existing, info.Name())
+
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			s.report.Skipped = append(s.report.Skipped, childRel)
+			continue
+		}
+		if ok && info.IsDir() != current.IsDir() {
+			if !s.opts.delete {
+				return fmt.Errorf("%w: %s", ErrSyncConflict, childRel)
+			}
+			if err := s.remove(childRel); err != nil {
+				return err
+			}
+			ok = false
+		}
+
+		if info.IsDir() {
+			if !ok {
+				if err := s.dst.mkdir(childRel, info.Mode().Perm()); err != nil {
+					return fmt.Errorf("sync: create directory %s: %w", childRel, err)
+				}
+				s.report.Created = append(s.report.Created, childRel)
+			} else if err := s.syncMode(childRel, info, current); err != nil {
+				return err
+			}
+			if err := s.syncDir(childRel, ok); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if ok {
+			same, err := s.same(childRel, info, current)
+			if err != nil {
+				return err
+			}
+			if same {
+				if err := s.syncMode(childRel, info, current); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if err := s.copyFile(childRel, info); err != nil {
+			return fmt.Errorf("sync: copy %s: %w", childRel, err)
+		}
+		if ok {
+			s.report.Updated = append(s.report.Updated, childRel)
+		} else {
+			s.report.Created = append(s.report.Created, childRel)
+		}
+	}
+
+	if !s.opts.delete {
+		return nil
+	}
+	extraneous := make([]string, 0, len(existing))
+	for name := range existing {
+		extraneous = append(extraneous, name)
+	}
+	slices.Sort(extraneous)
+	for _, name := range extraneous {
+		if err := s.remove(path.Join(rel, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *syncer) remove(rel string) error {
+	if err := s.dst.removeAll(rel); err != nil {
+		return fmt.Errorf("sync: delete %s: %w", rel, err)
+	}
+	s.report.Deleted = append(s.report.Deleted, rel)
+	return nil
+}
+
+// syncMode gives the existing destination entry rel the permission bits of
+// src that both of the trees can represent and reports it as updated when
+// they differed, or as unchanged when rel is a file and they did not.
+func (s *syncer) syncMode(rel string, src, dst fs.FileInfo) error {
+	mask := s.src.permMask() & s.dst.permMask()
+	perm := dst.Mode().Perm()&^mask | src.Mode().Perm()&mask
+	if perm == dst.Mode().Perm() {
+		if !src.IsDir() {
+			s.report.Unchanged = append(s.report.Unchanged, rel)
+		}
+		return nil
+	}
+	if err := s.dst.chmod(rel, perm); err != nil {
+		return fmt.Errorf("sync: chmod %s: %w", rel, err)
+	}
+	s.report.Updated = append(s.report.Updated, rel)
+	return nil
+}
+
+// same reports whether the destination file is the same as the source file
+// by the comparison chosen with the options.
+func (s *syncer) same(rel string, src, dst fs.FileInfo) (bool, error) {
+	if src.Size() != dst.Size() {
+		return false, nil
+	}
+	switch {
+	case s.opts.sizeOnly:
+		return true, nil
+	case s.opts.checksum:
+		srcSum, err := s.src.sha256(rel)
+		if err != nil {
+			return false, fmt.Errorf("sync: checksum source %s: %w", rel, err)
+		}
+		dstSum, err := s.dst.sha256(rel)
+		if err != nil {
+			return false, fmt.Errorf("sync: checksum destination %s: %w", rel, err)
+		}
+		return srcSum == dstSum, nil
+	default:
+		// not all of the filesystems keep sub-second modification times
+		return src.ModTime().Truncate(time.Second).Equal(dst.ModTime().Truncate(time.Second)), nil
+	}
+}
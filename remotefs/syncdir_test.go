@@ -0,0 +1,394 @@
+package remotefs_test
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/k0sproject/rig/v2/cmd"
+	"github.com/k0sproject/rig/v2/protocol/localhost"
+	"github.com/k0sproject/rig/v2/remotefs"
+	"github.com/k0sproject/rig/v2/rigtest"
+	"github.com/stretchr/testify/require"
+)
+
+// localPosixFS returns a PosixFS on the local host. The sync tests use the
+// local filesystem as both sides of the sync.
+func localPosixFS(t *testing.T) remotefs.FS {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("PosixFS is never paired with a Windows host")
+	}
+	conn, err := localhost.NewConnection()
+	require.NoError(t, err)
+	return remotefs.NewPosixFS(cmd.NewExecutor(conn))
+}
+
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+		require.NoError(t, os.WriteFile(p, []byte(content), 0o644))
+	}
+}
+
+func readFile(t *testing.T, p string) string {
+	t.Helper()
+	data, err := os.ReadFile(p)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestSyncDir(t *testing.T) {
+	fsys := localPosixFS(t)
+	src := t.TempDir()
+	dst := filepath.Join(t.TempDir(), "dst")
+	writeTree(t, src, map[string]string{
+		"a.txt":       "alpha",
+		"sub/b.sh":    "#!/bin/sh\n",
+		"sub/deep/c":  "charlie",
+		"empty/.keep": "",
+	})
+	require.NoError(t, os.Chmod(filepath.Join(src, "sub", "b.sh"), 0o755))
+	require.NoError(t, os.Symlink("a.txt", filepath.Join(src, "link")))
+
+	report, err := remotefs.SyncDir(fsys, src, dst)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a.txt", "empty", "empty/.keep", "sub", "sub/b.sh", "sub/deep", "sub/deep/c"}, report.Created)
+	require.Equal(t, []string{"link"}, report.Skipped)
+	require.True(t, report.Changed())
+	require.Equal(t, "charlie", readFile(t, filepath.Join(dst, "sub", "deep", "c")))
+
+	stat, err := os.Stat(filepath.Join(dst, "sub", "b.sh"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o755), stat.Mode().Perm(), "the mode is preserved")
+	srcStat, err := os.Stat(filepath.Join(src, "sub", "b.sh"))
+	require.NoError(t, err)
+	require.Equal(t, srcStat.ModTime().Unix(), stat.ModTime().Unix(), "the modification time is preserved")
+
+	report, err = remotefs.SyncDir(fsys, src, dst)
+	require.NoError(t, err)
+	require.False(t, report.Changed(), "nothing to do on the second run: %+v", report)
+	require.Len(t, report.Unchanged, 4)
+
+	writeTree(t, src, map[string]string{"a.txt": "alpha, changed"})
+	writeTree(t, dst, map[string]string{"extra/file": "remove me"})
+	report, err = remotefs.SyncDir(fsys, src, dst)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a.txt"}, report.Updated)
+	require.Empty(t, report.Deleted)
+	require.FileExists(t, filepath.Join(dst, "extra", "file"), "extraneous files are kept without SyncDelete")
+
+	report, err = remotefs.SyncDir(fsys, src, dst, remotefs.SyncDelete())
+	require.NoError(t, err)
+	require.Equal(t, []string{"extra"}, report.Deleted)
+	require.NoDirExists(t, filepath.Join(dst, "extra"))
+	require.Equal(t, "alpha, changed", readFile(t, filepath.Join(dst, "a.txt")))
+}
+
+func TestSyncDirCompare(t *testing.T) {
+	fsys := localPosixFS(t)
+	src := t.TempDir()
+	dst := t.TempDir()
+	writeTree(t, src, map[string]string{"f": "aaaa"})
+	writeTree(t, dst, map[string]string{"f": "bbbb"})
+	mtime := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(src, "f"), mtime, mtime))
+	require.NoError(t, os.Chtimes(filepath.Join(dst, "f"), mtime, mtime))
+
+	report, err := remotefs.SyncDir(fsys, src, dst)
+	require.NoError(t, err)
+	require.Equal(t, []string{"f"}, report.Unchanged, "same size and modification time")
+
+	report, err = remotefs.SyncDir(fsys, src, dst, remotefs.SyncSizeOnly())
+	require.NoError(t, err)
+	require.Equal(t, []string{"f"}, report.Unchanged)
+
+	report, err = remotefs.SyncDir(fsys, src, dst, remotefs.SyncChecksum())
+	require.NoError(t, err)
+	require.Equal(t, []string{"f"}, report.Updated)
+	require.Equal(t, "aaaa", readFile(t, filepath.Join(dst, "f")))
+}
+
+func TestSyncDirMode(t *testing.T) {
+	fsys := localPosixFS(t)
+	src := t.TempDir()
+	dst := t.TempDir()
+	writeTree(t, src, map[string]string{"run": "#!/bin/sh\n", "sub/f": "x"})
+	writeTree(t, dst, map[string]string{"run": "#!/bin/sh\n", "sub/f": "x"})
+	mtime := time.Now().Add(-time.Hour)
+	for _, root := range []string{src, dst} {
+		require.NoError(t, os.Chtimes(filepath.Join(root, "run"), mtime, mtime))
+		require.NoError(t, os.Chtimes(filepath.Join(root, "sub", "f"), mtime, mtime))
+	}
+	require.NoError(t, os.Chmod(filepath.Join(src, "run"), 0o755))
+	require.NoError(t, os.Chmod(filepath.Join(src, "sub"), 0o700))
+
+	report, err := remotefs.SyncDir(fsys, src, dst)
+	require.NoError(t, err)
+	require.Equal(t, []string{"run", "sub"}, report.Updated, "the content is the same but the mode is not")
+	require.Equal(t, []string{"sub/f"}, report.Unchanged)
+	stat, err := os.Stat(filepath.Join(dst, "run"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o755), stat.Mode().Perm())
+	stat, err = os.Stat(filepath.Join(dst, "sub"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o700), stat.Mode().Perm())
+
+	report, err = remotefs.SyncDir(fsys, src, dst)
+	require.NoError(t, err)
+	require.False(t, report.Changed(), "nothing to do on the second run: %+v", report)
+}
+
+func TestSyncDirConflict(t *testing.T) {
+	fsys := localPosixFS(t)
+	src := t.TempDir()
+	dst := t.TempDir()
+	writeTree(t, src, map[string]string{"conf": "file now"})
+	writeTree(t, dst, map[string]string{"conf/old": "was a directory"})
+
+	_, err := remotefs.SyncDir(fsys, src, dst)
+	require.ErrorIs(t, err, remotefs.ErrSyncConflict)
+
+	report, err := remotefs.SyncDir(fsys, src, dst, remotefs.SyncDelete())
+	require.NoError(t, err)
+	require.Equal(t, []string{"conf"}, report.Deleted)
+	require.Equal(t, []string{"conf"}, report.Created)
+	require.Equal(t, "file now", readFile(t, filepath.Join(dst, "conf")))
+
+	_, err = remotefs.SyncDir(fsys, filepath.Join(dst, "conf"), t.TempDir())
+	require.ErrorIs(t, err, remotefs.ErrNotDir)
+}
+
+func TestSyncDirFromRemote(t *testing.T) {
+	fsys := localPosixFS(t)
+	src := t.TempDir()
+	dst := filepath.Join(t.TempDir(), "dst")
+	writeTree(t, src, map[string]string{
+		"etc/app.conf": "port=80",
+		"bin/run":      "#!/bin/sh\n",
+	})
+	require.NoError(t, os.Chmod(filepath.Join(src, "bin", "run"), 0o750))
+
+	report, err := remotefs.SyncDirFromRemote(fsys, src, dst)
+	require.NoError(t, err)
+	require.Equal(t, []string{"bin", "bin/run", "etc", "etc/app.conf"}, report.Created)
+	require.Equal(t, "port=80", readFile(t, filepath.Join(dst, "etc", "app.conf")))
+	stat, err := os.Stat(filepath.Join(dst, "bin", "run"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o750), stat.Mode().Perm())
+
+	report, err = remotefs.SyncDirFromRemote(fsys, src, dst)
+	require.NoError(t, err)
+	require.False(t, report.Changed(), "nothing to do on the second run: %+v", report)
+
+	writeTree(t, dst, map[string]string{"local-only": "x"})
+	require.NoError(t, os.Remove(filepath.Join(src, "etc", "app.conf")))
+	report, err = remotefs.SyncDirFromRemote(fsys, src, dst, remotefs.SyncDelete())
+	require.NoError(t, err)
+	require.Equal(t, []string{"etc/app.conf", "local-only"}, report.Deleted)
+	require.NoFileExists(t, filepath.Join(dst, "local-only"))
+}
+
+// fakeWinNode is a file or a directory on a fakeWinHost.
+type fakeWinNode struct {
+	dir      bool
+	data     []byte
+	readOnly bool
+	mtime    time.Time
+}
+
+// fakeWinHost plays the PowerShell scripts of WinFS that a sync runs against
+// an in-memory filesystem keyed by Windows paths.
+type fakeWinHost struct {
+	mu    sync.Mutex
+	nodes map[string]*fakeWinNode
+}
+
+var (
+	winStatRe     = regexp.MustCompile(`Test-Path -LiteralPath "([^"]+)"`)
+	winReadDirRe  = regexp.MustCompile(`Get-ChildItem -LiteralPath (\S+)`)
+	winChmodRe    = regexp.MustCompile(`Get-Item -LiteralPath '([^']+)'`)
+	winChtimesRe  = regexp.MustCompile(`Get-Item "([^"]+)"; \$file.LastWriteTime = '([^']+)'`)
+	winSha256Re   = regexp.MustCompile(`OpenRead\("([^"]+)"\)`)
+	winTempRe     = regexp.MustCompile(`\$dir = "([^"]+)"`)
+	winRenameRe   = regexp.MustCompile(`-LiteralPath "([^"]+)" -Destination "([^"]+)"`)
+	errFakeWinCmd = errors.New("unexpected command")
+)
+
+func (h *fakeWinHost) info(name string, n *fakeWinNode) map[string]any {
+	mode := "-a----"
+	if n.dir {
+		mode = "d-----"
+	}
+	return map[string]any{
+		"Name":          name[strings.LastIndex(name, `\`)+1:],
+		"FullName":      name,
+		"Length":        len(n.data),
+		"IsReadOnly":    n.readOnly,
+		"Mode":          mode,
+		"LastWriteTime": fmt.Sprintf("/Date(%d)/", n.mtime.UnixMilli()),
+	}
+}
+
+func (h *fakeWinHost) emit(a *rigtest.A, v any) error {
+	return json.NewEncoder(a.Stdout).Encode(v)
+}
+
+func (h *fakeWinHost) handle(a *rigtest.A) error {
+	script, ok := decodePSScript(a.Command)
+	if !ok {
+		return errFakeWinCmd
+	}
+	if strings.Contains(script, `$z="`) {
+		return h.serveRcp(a)
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	switch {
+	case strings.Contains(script, "Get-ChildItem"):
+		dir := winReadDirRe.FindStringSubmatch(script)[1]
+		var items []map[string]any
+		for name, n := range h.nodes {
+			if strings.HasPrefix(name, dir+`\`) && !strings.Contains(name[len(dir)+1:], `\`) {
+				items = append(items, h.info(name, n))
+			}
+		}
+		return h.emit(a, items)
+	case strings.Contains(script, "Test-Path -LiteralPath") && strings.Contains(script, "ConvertTo-Json"):
+		name := winStatRe.FindStringSubmatch(script)[1]
+		n, ok := h.nodes[name]
+		if !ok {
+			return h.emit(a, map[string]string{"Err": "does not exist"})
+		}
+		return h.emit(a, h.info(name, n))
+	case strings.Contains(script, "$a.Attributes="):
+		n, ok := h.nodes[winChmodRe.FindStringSubmatch(script)[1]]
+		if !ok {
+			return fs.ErrNotExist
+		}
+		n.readOnly = strings.Contains(script, "-bor")
+	case strings.Contains(script, "$file.LastWriteTime"):
+		m := winChtimesRe.FindStringSubmatch(script)
+		mtime, err := time.Parse("2006-01-02T15:04:05.999", m[2])
+		if err != nil {
+			return err
+		}
+		h.nodes[m[1]].mtime = mtime
+	case strings.Contains(script, "SHA256"):
+		sum := sha256.Sum256(h.nodes[winSha256Re.FindStringSubmatch(script)[1]].data)
+		_, err := fmt.Fprint(a.Stdout, hex.EncodeToString(sum[:]))
+		return err
+	case strings.Contains(script, "GetRandomFileName"):
+		name := winTempRe.FindStringSubmatch(script)[1] + `\.upload-1.tmp`
+		h.nodes[name] = &fakeWinNode{}
+		_, err := fmt.Fprint(a.Stdout, name)
+		return err
+	case strings.Contains(script, "Move-Item"):
+		m := winRenameRe.FindStringSubmatch(script)
+		h.nodes[m[2]] = h.nodes[m[1]]
+		delete(h.nodes, m[1])
+	default:
+		return errFakeWinCmd
+	}
+	return nil
+}
+
+// serveRcp plays the open, write and close commands of rigrcp.ps1.
+func (h *fakeWinHost) serveRcp(a *rigtest.A) error {
+	in := bufio.NewReader(a.Stdin)
+	var n *fakeWinNode
+	for {
+		line, err := in.ReadString('\n')
+		if err != nil {
+			return nil //nolint:nilerr // the client went away
+		}
+		args := strings.Fields(line)
+		switch args[0] {
+		case "o":
+			h.mu.Lock()
+			n = h.nodes[strings.Join(args[3:], " ")]
+			n.data = nil
+			h.mu.Unlock()
+			_, err = fmt.Fprint(a.Stdout, `{"pos":0}`+"\x00")
+		case "w":
+			cnt, _ := strconv.Atoi(args[1])
+			if _, err := fmt.Fprintf(a.Stdout, `{"n":%d}`+"\x00", cnt); err != nil {
+				return err
+			}
+			buf := make([]byte, cnt)
+			_, err = io.ReadFull(in, buf)
+			h.mu.Lock()
+			n.data = append(n.data, buf...)
+			h.mu.Unlock()
+		case "c":
+			_, err = fmt.Fprint(a.Stdout, `{"pos":-1}`+"\x00")
+		case "q":
+			return nil
+		default:
+			return errFakeWinCmd
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func TestSyncDirWindows(t *testing.T) {
+	mtime := time.Unix(1700000000, 0)
+	src := t.TempDir()
+	writeTree(t, src, map[string]string{"a.txt": "alpha", "new.txt": "new", "sub/b.txt": "bravo"})
+	for _, name := range []string{"a.txt", "sub/b.txt"} {
+		require.NoError(t, os.Chtimes(filepath.Join(src, filepath.FromSlash(name)), mtime, mtime))
+	}
+	require.NoError(t, os.Chmod(filepath.Join(src, "a.txt"), 0o444))
+	require.NoError(t, os.Chmod(filepath.Join(src, "sub"), 0o555))
+	t.Cleanup(func() { _ = os.Chmod(filepath.Join(src, "sub"), 0o755) })
+	newStat, err := os.Stat(filepath.Join(src, "new.txt"))
+	require.NoError(t, err)
+
+	host := &fakeWinHost{nodes: map[string]*fakeWinNode{
+		`C:\dst`:           {dir: true, mtime: mtime},
+		`C:\dst\a.txt`:     {data: []byte("alpha"), mtime: mtime},
+		`C:\dst\sub`:       {dir: true, mtime: mtime},
+		`C:\dst\sub\b.txt`: {data: []byte("bravo"), mtime: mtime},
+	}}
+	mr := rigtest.NewMockRunner()
+	mr.Windows = true
+	mr.AddCommand(rigtest.HasPrefix("powershell.exe"), host.handle)
+	fsys := remotefs.NewWindowsFS(mr)
+
+	report, err := remotefs.SyncDir(fsys, src, `C:\dst`)
+	require.NoError(t, err)
+	require.Equal(t, []string{"new.txt"}, report.Created)
+	require.Equal(t, []string{"a.txt", "sub"}, report.Updated, "the read-only attribute follows the mode")
+	require.Equal(t, []string{"sub/b.txt"}, report.Unchanged)
+
+	require.True(t, host.nodes[`C:\dst\a.txt`].readOnly)
+	require.True(t, host.nodes[`C:\dst\sub`].readOnly)
+	created := host.nodes[`C:\dst\new.txt`]
+	require.NotNil(t, created)
+	require.Equal(t, "new", string(created.data))
+	require.False(t, created.readOnly)
+	require.Equal(t, newStat.ModTime().UnixMilli(), created.mtime.UnixMilli(), "the modification time is preserved")
+
+	report, err = remotefs.SyncDir(fsys, src, `C:\dst`)
+	require.NoError(t, err)
+	require.False(t, report.Changed(), "nothing to do on the second run: %+v", report)
+	require.Equal(t, []string{"a.txt", "new.txt", "sub/b.txt"}, report.Unchanged)
+}
@@ -0,0 +1,113 @@
+package remotefs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrTarNotSupported is returned by [UploadTar] and [DownloadTar] when the
+// filesystem or the remote host can not stream tar archives with the
+// requested compression.
+var ErrTarNotSupported = errors.New("tar transfer not supported")
+
+// Compression is a compression format for data streamed to or from the
+// remote host.
+type Compression int
+
+const (
+	// CompressionNone is uncompressed data.
+	CompressionNone Compression = iota
+	// CompressionGzip is gzip compressed data.
+	CompressionGzip
+	// CompressionZstd is zstd compressed data.
+	CompressionZstd
+)
+
+// String returns the name of the compression format.
+func (c Compression) String() string {
+	switch c {
+	case CompressionGzip:
+		return "gzip"
+	case CompressionZstd:
+		return "zstd"
+	default:
+		return "none"
+	}
+}
+
+// TarOption is a functional option for [UploadTar] and [DownloadTar].
+type TarOption func(*tarOptions)
+
+type tarOptions struct {
+	compression Compression
+}
+
+// TarCompression sets the compression of the archive stream. The default is
+// [CompressionNone]. zstd needs the zstd command on POSIX hosts.
+func TarCompression(c Compression) TarOption {
+	return func(o *tarOptions) {
+		o.compression = c
+	}
+}
+
+// tarStreamer is implemented by FS types that can stream tar archives.
+type tarStreamer interface {
+	uploadTar(src io.Reader, dst string, opts tarOptions) error
+	downloadTar(src string, dst io.Writer, opts tarOptions) error
+}
+
+// UploadTar extracts the tar archive read from src into the remote directory
+// dst, creating it when needed. The archive is streamed to a single remote
+// command, which is much faster than copying many small files one by one.
+//
+// On POSIX hosts the remote tar is used. Permissions are preserved and so is
+// ownership when the runner is root, such as one using sudo. On Windows the
+// tar.exe shipped with the system is used when available and the .NET
+// System.Formats.Tar classes of PowerShell 7 (pwsh) otherwise, which do not
+// support zstd. Ownership is not restored on Windows.
+func UploadTar(fsys FS, src io.Reader, dst string, opts ...TarOption) error {
+	t, ok := fsys.(tarStreamer)
+	if !ok {
+		return ErrTarNotSupported
+	}
+	o, err := newTarOptions(opts)
+	if err != nil {
+		return err
+	}
+	if err := t.uploadTar(src, dst, o); err != nil {
+		return fmt.Errorf("upload tar to %s: %w", dst, err)
+	}
+	return nil
+}
+
+// DownloadTar writes a tar archive of the contents of the remote directory
+// src to dst. The paths in the archive are relative to src. See [UploadTar]
+// for the tools used on the remote host.
+func DownloadTar(fsys FS, src string, dst io.Writer, opts ...TarOption) error {
+	t, ok := fsys.(tarStreamer)
+	if !ok {
+		return ErrTarNotSupported
+	}
+	o, err := newTarOptions(opts)
+	if err != nil {
+		return err
+	}
+	if err := t.downloadTar(src, dst, o); err != nil {
+		return fmt.Errorf("download tar from %s: %w", src, err)
+	}
+	return nil
+}
+
+func newTarOptions(opts []TarOption) (tarOptions, error) {
+	var o tarOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	switch o.compression {
+	case CompressionNone, CompressionGzip, CompressionZstd:
+		return o, nil
+	default:
+		return o, fmt.Errorf("%w: unknown compression %d", ErrTarNotSupported, o.compression)
+	}
+}
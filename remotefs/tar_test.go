@@ -0,0 +1,183 @@
+package remotefs_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/k0sproject/rig/v2/remotefs"
+	"github.com/k0sproject/rig/v2/rigtest"
+	"github.com/stretchr/testify/require"
+)
+
+type tarEntry struct {
+	name    string
+	mode    int64
+	content string
+}
+
+func buildTar(t *testing.T, entries []tarEntry) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: e.mode, Size: int64(len(e.content)), Typeflag: tar.TypeReg}
+		if strings.HasSuffix(e.name, "/") {
+			hdr.Typeflag = tar.TypeDir
+			hdr.Size = 0
+		}
+		require.NoError(t, tw.WriteHeader(hdr))
+		_, err := io.WriteString(tw, e.content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	return buf.Bytes()
+}
+
+// readTar returns the regular files in the archive by their name, without
+// the leading "./".
+func readTar(t *testing.T, r io.Reader) map[string]tarEntry {
+	t.Helper()
+	files := map[string]tarEntry{}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		name := strings.TrimPrefix(hdr.Name, "./")
+		files[name] = tarEntry{name: name, mode: hdr.Mode & 0o777, content: string(data)}
+	}
+	return files
+}
+
+var tarFixture = []tarEntry{
+	{name: "bin/", mode: 0o755},
+	{name: "bin/tool", mode: 0o750, content: "#!/bin/sh\necho tool\n"},
+	{name: "etc/app.conf", mode: 0o640, content: "port=80\n"},
+}
+
+func TestUploadTar(t *testing.T) {
+	fsys := localPosixFS(t)
+	dst := filepath.Join(t.TempDir(), "deep", "dst")
+
+	require.NoError(t, remotefs.UploadTar(fsys, bytes.NewReader(buildTar(t, tarFixture)), dst))
+	require.Equal(t, "port=80\n", readFile(t, filepath.Join(dst, "etc", "app.conf")))
+	stat, err := os.Stat(filepath.Join(dst, "bin", "tool"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o750), stat.Mode().Perm(), "permissions are preserved")
+
+	gzipped := &bytes.Buffer{}
+	gz := gzip.NewWriter(gzipped)
+	_, err = gz.Write(buildTar(t, []tarEntry{{name: "gz.txt", mode: 0o644, content: "compressed"}}))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	require.NoError(t, remotefs.UploadTar(fsys, gzipped, dst, remotefs.TarCompression(remotefs.CompressionGzip)))
+	require.Equal(t, "compressed", readFile(t, filepath.Join(dst, "gz.txt")))
+}
+
+func TestDownloadTar(t *testing.T) {
+	fsys := localPosixFS(t)
+	src := t.TempDir()
+	require.NoError(t, remotefs.UploadTar(fsys, bytes.NewReader(buildTar(t, tarFixture)), src))
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, remotefs.DownloadTar(fsys, src, buf))
+	files := readTar(t, buf)
+	require.Len(t, files, 2)
+	require.Equal(t, "#!/bin/sh\necho tool\n", files["bin/tool"].content)
+	require.EqualValues(t, 0o750, files["bin/tool"].mode)
+
+	buf.Reset()
+	require.NoError(t, remotefs.DownloadTar(fsys, src, buf, remotefs.TarCompression(remotefs.CompressionGzip)))
+	gz, err := gzip.NewReader(buf)
+	require.NoError(t, err)
+	require.Equal(t, "port=80\n", readTar(t, gz)["etc/app.conf"].content)
+}
+
+func TestTarZstdRoundTrip(t *testing.T) {
+	fsys := localPosixFS(t)
+	if _, err := osexec.LookPath("zstd"); err != nil {
+		t.Skip("zstd not installed")
+	}
+	src := t.TempDir()
+	dst := t.TempDir()
+	require.NoError(t, remotefs.UploadTar(fsys, bytes.NewReader(buildTar(t, tarFixture)), src))
+
+	buf := &bytes.Buffer{}
+	zstd := remotefs.TarCompression(remotefs.CompressionZstd)
+	require.NoError(t, remotefs.DownloadTar(fsys, src, buf, zstd))
+	require.NoError(t, remotefs.UploadTar(fsys, buf, dst, zstd))
+	require.Equal(t, "port=80\n", readFile(t, filepath.Join(dst, "etc", "app.conf")))
+}
+
+func TestTarUnknownCompression(t *testing.T) {
+	fsys := remotefs.NewPosixFS(rigtest.NewMockRunner())
+	err := remotefs.UploadTar(fsys, &bytes.Buffer{}, "/tmp", remotefs.TarCompression(remotefs.Compression(42)))
+	require.ErrorIs(t, err, remotefs.ErrTarNotSupported)
+}
+
+// psScriptContains matches a PowerShell command whose decoded script
+// contains substr.
+func psScriptContains(substr string) rigtest.CommandMatcher {
+	return func(cmd string) bool {
+		script, ok := decodePSScript(cmd)
+		return ok && strings.Contains(script, substr)
+	}
+}
+
+func TestWindowsTar(t *testing.T) {
+	t.Run("tar.exe", func(t *testing.T) {
+		mr := rigtest.NewMockRunner()
+		mr.Windows = true
+		mr.AddCommandOutput(psScriptContains(`Get-Command "tar.exe"`), `C:\Windows\System32\tar.exe`)
+		mr.AddCommandSuccess(psScriptContains("New-Item -ItemType Directory"))
+		mr.AddCommandSuccess(rigtest.Contains("tar.exe -x"))
+		mr.AddCommandOutput(rigtest.Contains("tar.exe -c"), "archive")
+		fsys := remotefs.NewWindowsFS(mr)
+
+		require.NoError(t, remotefs.UploadTar(fsys, strings.NewReader("archive"), `C:\app\`))
+		rigtest.ReceivedContains(t, mr, `tar.exe -x -f - -C "C:\app\."`)
+
+		buf := &bytes.Buffer{}
+		require.NoError(t, remotefs.DownloadTar(fsys, `C:\app`, buf, remotefs.TarCompression(remotefs.CompressionZstd)))
+		rigtest.ReceivedContains(t, mr, `tar.exe -c --zstd -f - -C "C:\app" .`)
+		require.Equal(t, "archive", buf.String())
+	})
+
+	t.Run("System.Formats.Tar fallback", func(t *testing.T) {
+		mr := rigtest.NewMockRunner()
+		mr.Windows = true
+		mr.AddCommandOutput(psScriptContains(`Get-Command "tar.exe"`), "")
+		mr.AddCommandOutput(psScriptContains(`Get-Command "pwsh"`), `C:\Program Files\PowerShell\7\pwsh.exe`)
+		mr.AddCommandSuccess(psScriptContains("New-Item -ItemType Directory"))
+		mr.AddCommandSuccess(rigtest.HasPrefix("pwsh.exe"))
+		fsys := remotefs.NewWindowsFS(mr)
+
+		require.NoError(t, remotefs.UploadTar(fsys, strings.NewReader("archive"), `C:\app`, remotefs.TarCompression(remotefs.CompressionGzip)))
+		var script string
+		for _, c := range mr.Commands() {
+			if strings.HasPrefix(c, "pwsh.exe") {
+				script, _ = decodePSScript(c)
+			}
+		}
+		require.Contains(t, script, "GZipStream")
+		require.Contains(t, script, `[System.Formats.Tar.TarFile]::ExtractToDirectory($s,'C:\app',$true)`)
+
+		err := remotefs.DownloadTar(fsys, `C:\app`, io.Discard, remotefs.TarCompression(remotefs.CompressionZstd))
+		require.ErrorIs(t, err, remotefs.ErrTarNotSupported, "zstd is not available in .NET")
+	})
+}
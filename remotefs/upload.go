@@ -5,6 +5,7 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"io/fs"
 	"os"
@@ -17,8 +18,11 @@ var ErrChecksumMismatch = errors.New("checksum mismatch")
 type UploadOption func(*uploadOptions)
 
 type uploadOptions struct {
-	perm    fs.FileMode
-	hasPerm bool
+	perm        fs.FileMode
+	hasPerm     bool
+	progress    func(done, total int64)
+	resume      bool
+	compression Compression
 }
 
 // WithPermissions sets the file mode for the uploaded file. If not set, the local
@@ -30,22 +34,175 @@ func WithPermissions(mode fs.FileMode) UploadOption {
 	}
 }
 
-// copyAndVerifyUpload copies src to tmpPath via a hash writer and verifies remote checksum.
-func copyAndVerifyUpload(fsys FS, tmpPath string, src io.Reader) error {
-	localHash := sha256.New()
-	reader := io.TeeReader(src, localHash)
+// WithProgress sets a function that is called as the upload proceeds with the
+// number of bytes sent so far, including the ones an upload resumed with
+// WithResume could skip, and the size of the file.
+func WithProgress(fn func(done, total int64)) UploadOption {
+	return func(o *uploadOptions) {
+		o.progress = fn
+	}
+}
+
+// WithResume makes an interrupted upload continue where it left off. The
+// temporary file is named after dst and kept when the upload fails. The next
+// upload to dst with WithResume checks that the SHA-256 of the partial file
+// matches the beginning of the local file and only sends the rest. When it
+// does not match, the upload starts over. Concurrent uploads to the same dst
+// must not use it.
+//
+// Only a regular file owned by the user the commands run as is resumed. When
+// something else, such as a symbolic link, is in place of the partial file,
+// or the filesystem can't tell, the upload goes to a temporary file with a
+// random name as without WithResume.
+func WithResume() UploadOption {
+	return func(o *uploadOptions) {
+		o.resume = true
+	}
+}
+
+// WithCompression makes the upload compress the file for the transfer with
+// c when the remote host can decompress it, and transfer it as is otherwise.
+// POSIX hosts need the gzip or zstd command. Windows hosts support gzip,
+// which is handled by .NET. Compression pays off for large files that are not
+// compressed already, such as binaries and uncompressed container images,
+// especially over WinRM.
+func WithCompression(c Compression) UploadOption {
+	return func(o *uploadOptions) {
+		o.compression = c
+	}
+}
+
+// progressReader reports the bytes read through it to fn.
+type progressReader struct {
+	r     io.Reader
+	done  int64
+	total int64
+	fn    func(done, total int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.done += int64(n)
+		p.fn(p.done, p.total)
+	}
+	return n, err //nolint:wrapcheck // passthrough
+}
 
-	remote, err := fsys.OpenFile(tmpPath, os.O_WRONLY|os.O_TRUNC, 0o600)
+// partialFileChecker is implemented by FS types that can tell whether the
+// partial file of an interrupted upload can be trusted to resume it.
+type partialFileChecker interface {
+	// ownedRegularFile reports whether name is a regular file owned by the
+	// user the commands run as, without following a symbolic link. The error
+	// wraps fs.ErrNotExist when there is nothing at name.
+	ownedRegularFile(name string) (bool, error)
+}
+
+// usablePartial reports whether the partial file at tmpPath can be used for
+// a resumable upload, creating it when it does not exist. A file that the
+// user did not create, which may have been placed in a shared directory by
+// another one, is never written to.
+func usablePartial(fsys FS, tmpPath string) (bool, error) {
+	checker, ok := fsys.(partialFileChecker)
+	if !ok {
+		return false, nil
+	}
+	owned, err := checker.ownedRegularFile(tmpPath)
+	if err == nil {
+		return owned, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return false, fmt.Errorf("check partial upload file: %w", err)
+	}
+	f, err := fsys.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return false, nil
+		}
+		return false, fmt.Errorf("create temp file for upload: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return false, fmt.Errorf("close temp file for upload: %w", err)
+	}
+	return true, nil
+}
+
+// resumeOffset returns the offset to continue an interrupted upload from: the
+// size of the partial file at tmpPath when its checksum matches the same
+// number of bytes at the beginning of local. The matching bytes are written to
+// localHash and local is left at the offset. Otherwise the partial file is
+// emptied and 0 is returned.
+func resumeOffset(fsys FS, tmpPath string, local io.ReadSeeker, size int64, localHash hash.Hash) (int64, error) {
+	info, err := fsys.Stat(tmpPath)
+	if err != nil {
+		return 0, fmt.Errorf("stat partial upload file: %w", err)
+	}
+	if info.Size() == 0 {
+		return 0, nil
+	}
+	if info.Size() <= size {
+		if remoteSum, err := fsys.Sha256(tmpPath); err == nil {
+			if _, err := io.CopyN(localHash, local, info.Size()); err != nil {
+				return 0, fmt.Errorf("checksum local file for resume: %w", err)
+			}
+			if hex.EncodeToString(localHash.Sum(nil)) == remoteSum {
+				return info.Size(), nil
+			}
+			localHash.Reset()
+			if _, err := local.Seek(0, io.SeekStart); err != nil {
+				return 0, fmt.Errorf("rewind local file: %w", err)
+			}
+		}
+	}
+	f, err := fsys.OpenFile(tmpPath, os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return 0, fmt.Errorf("empty partial upload file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return 0, fmt.Errorf("close partial upload file: %w", err)
+	}
+	return 0, nil
+}
+
+// copyToRemote writes src to the remote file tmpPath from offset on.
+func copyToRemote(fsys FS, tmpPath string, src io.Reader, offset int64) error {
+	flags := os.O_WRONLY
+	if offset == 0 {
+		flags |= os.O_TRUNC
+	}
+	remote, err := fsys.OpenFile(tmpPath, flags, 0o600)
 	if err != nil {
 		return fmt.Errorf("open temp file for upload: %w", err)
 	}
-	if _, err := remote.CopyFrom(reader); err != nil {
+	if offset > 0 {
+		if _, err := remote.Seek(offset, io.SeekStart); err != nil {
+			_ = remote.Close()
+			return fmt.Errorf("seek temp file to resume upload: %w", err)
+		}
+	}
+	if _, err := remote.CopyFrom(src); err != nil {
 		_ = remote.Close()
 		return fmt.Errorf("copy file to remote host: %w", err)
 	}
 	if err := remote.Close(); err != nil {
 		return fmt.Errorf("close temp file after upload: %w", err)
 	}
+	return nil
+}
+
+// copyAndVerifyUpload copies src to tmpPath from offset on via a hash writer
+// and verifies remote checksum. localHash must already hold the part of the
+// file before offset.
+func copyAndVerifyUpload(fsys FS, tmpPath string, src io.Reader, offset int64, localHash hash.Hash, c Compression) error {
+	reader := io.TeeReader(src, localHash)
+
+	if cc, ok := transferCompression(fsys, c); ok {
+		if _, err := cc.copyFromCompressed(tmpPath, offset, reader, c); err != nil {
+			return fmt.Errorf("copy file to remote host: %w", err)
+		}
+	} else if err := copyToRemote(fsys, tmpPath, reader, offset); err != nil {
+		return err
+	}
 
 	remoteSum, err := fsys.Sha256(tmpPath)
 	if err != nil {
@@ -67,6 +224,9 @@ func copyAndVerifyUpload(fsys FS, tmpPath string, src io.Reader) error {
 // from the local file's mode. This means that overwriting an existing remote
 // file always sets its mode to perm — unlike a direct truncating write, which
 // would leave the remote file's existing mode unchanged.
+//
+// See WithProgress for following the progress of large uploads and
+// WithResume for continuing them after a failure.
 func Upload(fsys FS, src, dst string, opts ...UploadOption) error {
 	options := &uploadOptions{}
 	for _, opt := range opts {
@@ -79,23 +239,53 @@ func Upload(fsys FS, src, dst string, opts ...UploadOption) error {
 	}
 	defer local.Close()
 
+	stat, err := local.Stat()
+	if err != nil {
+		return fmt.Errorf("stat local file for upload: %w", err)
+	}
 	perm := options.perm
 	if !options.hasPerm {
-		stat, err := local.Stat()
-		if err != nil {
-			return fmt.Errorf("stat local file for upload: %w", err)
-		}
 		perm = stat.Mode()
 	}
 
 	dir := fsys.Dir(dst)
-	tmpPath, err := fsys.CreateTemp(dir, ".upload-")
-	if err != nil {
-		return fmt.Errorf("create temp file for upload: %w", err)
+	localHash := sha256.New()
+	var tmpPath string
+	var offset int64
+	resumable := false
+	keepPartial := false
+	if options.resume {
+		tmpPath = fsys.Join(dir, ".upload-"+fsys.Base(dst)+".partial")
+		resumable, err = usablePartial(fsys, tmpPath)
+		if err != nil {
+			return err
+		}
+	}
+	if resumable {
+		offset, err = resumeOffset(fsys, tmpPath, local, stat.Size(), localHash)
+		if err != nil {
+			return err
+		}
+	} else {
+		tmpPath, err = fsys.CreateTemp(dir, ".upload-")
+		if err != nil {
+			return fmt.Errorf("create temp file for upload: %w", err)
+		}
 	}
-	defer func() { _ = fsys.Remove(tmpPath) }()
+	defer func() {
+		if !keepPartial {
+			_ = fsys.Remove(tmpPath)
+		}
+	}()
 
-	if err := copyAndVerifyUpload(fsys, tmpPath, local); err != nil {
+	var reader io.Reader = local
+	if options.progress != nil {
+		options.progress(offset, stat.Size())
+		reader = &progressReader{r: local, done: offset, total: stat.Size(), fn: options.progress}
+	}
+	if err := copyAndVerifyUpload(fsys, tmpPath, reader, offset, localHash, options.compression); err != nil {
+		// a partial file that does not match is of no use to the next attempt
+		keepPartial = resumable && !errors.Is(err, ErrChecksumMismatch)
 		return err
 	}
 
@@ -9,6 +9,8 @@ import (
 	"io/fs"
 	"os"
 	"path"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -76,6 +78,9 @@ func (f *uploadFS) Remove(p string) error {
 	return nil
 }
 
+func (f *uploadFS) Join(elem ...string) string { return path.Join(elem...) }
+func (f *uploadFS) Base(p string) string       { return path.Base(p) }
+
 // FS interface stubs — not exercised by Upload.
 func (f *uploadFS) Open(_ string) (fs.File, error)                        { panic("not implemented") }
 func (f *uploadFS) Stat(_ string) (fs.FileInfo, error)                    { panic("not implemented") }
@@ -88,7 +93,6 @@ func (f *uploadFS) MkdirTemp(_, _ string) (string, error)                 { pani
 func (f *uploadFS) WriteFile(_ string, _ []byte, _ fs.FileMode) error     { panic("not implemented") }
 func (f *uploadFS) FileExist(_ string) bool                               { panic("not implemented") }
 func (f *uploadFS) LookPath(_ string) (string, error)                     { panic("not implemented") }
-func (f *uploadFS) Join(_ ...string) string                               { panic("not implemented") }
 func (f *uploadFS) Chown(_ string, _ string) error                        { panic("not implemented") }
 func (f *uploadFS) ChownInt(_ string, _, _ int) error                     { panic("not implemented") }
 func (f *uploadFS) ChownTree(_ string, _ string) error                    { panic("not implemented") }
@@ -109,7 +113,6 @@ func (f *uploadFS) TempDir() string                                       { pani
 func (f *uploadFS) UserCacheDir() string                                  { panic("not implemented") }
 func (f *uploadFS) UserConfigDir() string                                 { panic("not implemented") }
 func (f *uploadFS) UserHomeDir() string                                   { panic("not implemented") }
-func (f *uploadFS) Base(_ string) string                                  { panic("not implemented") }
 func (f *uploadFS) CommandExist(_ string) bool                            { panic("not implemented") }
 func (f *uploadFS) Reboot(_ context.Context) error                        { panic("not implemented") }
 func (f *uploadFS) NativePath(_ string) string                            { panic("not implemented") }
@@ -216,3 +219,93 @@ type corruptUploadFS struct {
 func (f *corruptUploadFS) Sha256(_ string) (string, error) {
 	return "deadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeef", nil
 }
+
+func TestUploadProgress(t *testing.T) {
+	src := writeTempFile(t, "hello", 0o644)
+	mfs := &uploadFS{}
+
+	var calls [][2]int64
+	require.NoError(t, remotefs.Upload(mfs, src, "/remote/dst", remotefs.WithProgress(func(done, total int64) {
+		calls = append(calls, [2]int64{done, total})
+	})))
+	require.Equal(t, [2]int64{0, 5}, calls[0], "progress is reported before the copy starts")
+	require.Equal(t, [2]int64{5, 5}, calls[len(calls)-1])
+}
+
+func TestUploadResume(t *testing.T) {
+	fsys := localPosixFS(t)
+	content := strings.Repeat("0123456789abcdef", 4096)
+	src := writeTempFile(t, content, 0o644)
+	dir := t.TempDir()
+	dst := filepath.Join(dir, "bundle.tar")
+	partial := filepath.Join(dir, ".upload-bundle.tar.partial")
+
+	t.Run("matching partial file", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(partial, []byte(content[:10000]), 0o600))
+		var first, last int64 = -1, -1
+		err := remotefs.Upload(fsys, src, dst, remotefs.WithResume(), remotefs.WithProgress(func(done, _ int64) {
+			if first < 0 {
+				first = done
+			}
+			last = done
+		}))
+		require.NoError(t, err)
+		require.EqualValues(t, 10000, first, "the upload continues after the partial file")
+		require.EqualValues(t, len(content), last)
+		require.Equal(t, content, readFile(t, dst))
+		require.NoFileExists(t, partial)
+	})
+
+	t.Run("differing partial file", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(partial, []byte("not the same start"), 0o600))
+		var first int64 = -1
+		err := remotefs.Upload(fsys, src, dst, remotefs.WithResume(), remotefs.WithProgress(func(done, _ int64) {
+			if first < 0 {
+				first = done
+			}
+		}))
+		require.NoError(t, err)
+		require.Zero(t, first, "the upload starts over")
+		require.Equal(t, content, readFile(t, dst))
+		require.NoFileExists(t, partial)
+	})
+
+	t.Run("no partial file", func(t *testing.T) {
+		require.NoError(t, os.Remove(dst))
+		require.NoError(t, remotefs.Upload(fsys, src, dst, remotefs.WithResume()))
+		require.Equal(t, content, readFile(t, dst))
+	})
+
+	t.Run("symlink in place of the partial file", func(t *testing.T) {
+		target := writeTempFile(t, content[:10000], 0o644)
+		require.NoError(t, os.Symlink(target, partial))
+		var first int64 = -1
+		err := remotefs.Upload(fsys, src, dst, remotefs.WithResume(), remotefs.WithProgress(func(done, _ int64) {
+			if first < 0 {
+				first = done
+			}
+		}))
+		require.NoError(t, err)
+		require.Zero(t, first, "the upload does not resume from a symlink")
+		require.Equal(t, content, readFile(t, dst))
+
+		dstInfo, err := os.Lstat(dst)
+		require.NoError(t, err)
+		require.True(t, dstInfo.Mode().IsRegular(), "the symlink is not renamed into place")
+		linkInfo, err := os.Lstat(partial)
+		require.NoError(t, err)
+		require.Equal(t, fs.ModeSymlink, linkInfo.Mode().Type(), "the symlink is left alone")
+		targetInfo, err := os.Stat(target)
+		require.NoError(t, err)
+		require.Equal(t, content[:10000], readFile(t, target), "the target of the symlink is not written to")
+		require.Equal(t, fs.FileMode(0o644), targetInfo.Mode().Perm(), "the target of the symlink is not chmodded")
+	})
+}
+
+func TestUploadResumeUnsupported(t *testing.T) {
+	src := writeTempFile(t, "hello", 0o644)
+	mfs := &uploadFS{}
+
+	require.NoError(t, remotefs.Upload(mfs, src, "/remote/dst", remotefs.WithResume()))
+	require.Equal(t, "hello", string(mfs.written), "a filesystem that can't check the partial file gets a fresh temp file")
+}
@@ -2,6 +2,8 @@ package remotefs
 
 import (
 	"bufio"
+	"bytes"
+	"compress/gzip"
 	"context"
 	_ "embed"
 	"encoding/json"
@@ -27,6 +29,10 @@ var (
 	errRemote         = errors.New("remote error")
 )
 
+// winGzipChunkSize is the size of the chunks of file content that are gzip
+// compressed separately for transfers to and from Windows hosts.
+const winGzipChunkSize = 1 << 20
+
 type rcpResponse struct {
 	Err string `json:"error"`
 	N   int64  `json:"n"`
@@ -150,6 +156,72 @@ func (f *winFile) CopyFrom(src io.Reader) (int64, error) {
 	return n, nil
 }
 
+// copyFromGzip copies src to the remote file in chunks that are gzip
+// compressed for the transfer and decompressed by rigrcp.
+func (f *winFile) copyFromGzip(src io.Reader) (int64, error) {
+	if f.closed {
+		return 0, f.pathErr(OpCopyFrom, fs.ErrClosed)
+	}
+	buf := make([]byte, winGzipChunkSize)
+	compressed := &bytes.Buffer{}
+	zw := gzip.NewWriter(compressed)
+	var total int64
+	for {
+		n, readErr := io.ReadFull(src, buf)
+		if n > 0 {
+			compressed.Reset()
+			zw.Reset(compressed)
+			if _, err := zw.Write(buf[:n]); err != nil {
+				return total, f.pathErr(OpCopyFrom, fmt.Errorf("compress: %w", err))
+			}
+			if err := zw.Close(); err != nil {
+				return total, f.pathErr(OpCopyFrom, fmt.Errorf("compress: %w", err))
+			}
+			if _, err := f.command(fmt.Sprintf("zw %d", compressed.Len())); err != nil {
+				return total, f.pathErr(OpCopyFrom, err)
+			}
+			if _, err := f.stdin.Write(compressed.Bytes()); err != nil {
+				return total, f.pathErr(OpCopyFrom, fmt.Errorf("write: %w", err))
+			}
+			total += int64(n)
+		}
+		switch {
+		case errors.Is(readErr, io.EOF), errors.Is(readErr, io.ErrUnexpectedEOF):
+			return total, nil
+		case readErr != nil:
+			return total, f.pathErr(OpCopyFrom, fmt.Errorf("read: %w", readErr))
+		}
+	}
+}
+
+// copyToGzip copies the remote file to dst in chunks that are gzip
+// compressed by rigrcp for the transfer.
+func (f *winFile) copyToGzip(dst io.Writer) (int64, error) {
+	if f.closed {
+		return 0, f.pathErr(OpCopyTo, fs.ErrClosed)
+	}
+	var total int64
+	for {
+		resp, err := f.command(fmt.Sprintf("zr %d", winGzipChunkSize))
+		if errors.Is(err, io.EOF) {
+			return total, nil
+		}
+		if err != nil {
+			return total, f.pathErr(OpCopyTo, fmt.Errorf("read: %w", err))
+		}
+		chunk := io.LimitReader(f.stdout, resp.N)
+		n, err := decompressTo(dst, chunk, CompressionGzip)
+		total += n
+		if err != nil {
+			return total, f.pathErr(OpCopyTo, err)
+		}
+		// the gzip trailer may be left unread
+		if _, err := io.Copy(io.Discard, chunk); err != nil {
+			return total, f.pathErr(OpCopyTo, fmt.Errorf("read: %w", err))
+		}
+	}
+}
+
 func fAccess(flags int) string {
 	switch {
 	case flags&(os.O_WRONLY|os.O_TRUNC|os.O_APPEND) != 0:
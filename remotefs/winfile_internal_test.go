@@ -0,0 +1,111 @@
+package remotefs
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRcp plays the gzip chunk commands of rigrcp.ps1 for a winFile.
+type fakeRcp struct {
+	in      *bufio.Reader
+	out     io.Writer
+	content []byte
+	written bytes.Buffer
+}
+
+func (r *fakeRcp) emit(format string, args ...any) {
+	_, _ = fmt.Fprintf(r.out, format+"\x00", args...)
+}
+
+func (r *fakeRcp) serve(t *testing.T) {
+	t.Helper()
+	for {
+		line, err := r.in.ReadString('\n')
+		if err != nil {
+			return
+		}
+		args := strings.Fields(line)
+		cnt, err := strconv.Atoi(args[1])
+		if !assert.NoError(t, err) {
+			return
+		}
+		switch args[0] {
+		case "zw":
+			r.emit(`{"n":%d}`, cnt)
+			chunk := make([]byte, cnt)
+			if _, err := io.ReadFull(r.in, chunk); !assert.NoError(t, err) {
+				return
+			}
+			zr, err := gzip.NewReader(bytes.NewReader(chunk))
+			if !assert.NoError(t, err) {
+				return
+			}
+			_, err = io.Copy(&r.written, zr)
+			assert.NoError(t, err)
+		case "zr":
+			if len(r.content) == 0 {
+				r.emit(`{"error":"eof"}`)
+				continue
+			}
+			n := min(cnt, len(r.content))
+			compressed := &bytes.Buffer{}
+			zw := gzip.NewWriter(compressed)
+			_, _ = zw.Write(r.content[:n])
+			assert.NoError(t, zw.Close())
+			r.content = r.content[n:]
+			r.emit(`{"n":%d}`, compressed.Len())
+			_, _ = r.out.Write(compressed.Bytes())
+		}
+	}
+}
+
+func newFakeRcpFile(t *testing.T, content []byte) (*winFile, *fakeRcp) {
+	t.Helper()
+	stdinR, stdinW := io.Pipe()
+	stdoutR, stdoutW := io.Pipe()
+	t.Cleanup(func() {
+		_ = stdinW.Close()
+		_ = stdoutW.Close()
+	})
+	rcp := &fakeRcp{in: bufio.NewReader(stdinR), out: stdoutW, content: content}
+	go rcp.serve(t)
+	f := &winFile{
+		winFileDirBase: winFileDirBase{withPath: withPath{`C:\file`}},
+		stdin:          stdinW,
+		stdout:         bufio.NewReader(stdoutR),
+		done:           make(chan struct{}),
+	}
+	return f, rcp
+}
+
+func TestWinFileGzipChunks(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789", winGzipChunkSize/4))
+
+	t.Run("copy from", func(t *testing.T) {
+		f, rcp := newFakeRcpFile(t, nil)
+		n, err := f.copyFromGzip(bytes.NewReader(content))
+		require.NoError(t, err)
+		require.EqualValues(t, len(content), n)
+		_, err = f.command("zr 1") // waits for the fake to handle the last chunk
+		require.ErrorIs(t, err, io.EOF)
+		require.Equal(t, content, rcp.written.Bytes())
+	})
+
+	t.Run("copy to", func(t *testing.T) {
+		f, _ := newFakeRcpFile(t, content)
+		buf := &bytes.Buffer{}
+		n, err := f.copyToGzip(buf)
+		require.NoError(t, err)
+		require.EqualValues(t, len(content), n)
+		require.Equal(t, content, buf.Bytes())
+	})
+}
@@ -281,6 +281,29 @@ func (s *WinFS) WriteFile(name string, data []byte, mode fs.FileMode) error {
 	return nil
 }
 
+// ownedRegularFile reports whether name is a regular file owned by the user
+// the commands run as, or by the Administrators group for a user whose
+// session is elevated. A symbolic link or junction is never one.
+func (s *WinFS) ownedRegularFile(name string) (bool, error) {
+	out, err := s.ExecOutput(fmt.Sprintf(`$i = Get-Item -LiteralPath %s -Force -ErrorAction SilentlyContinue
+if ($null -eq $i) { 'none'; exit 0 }
+if ($i.PSIsContainer -or ($i.Attributes -band [IO.FileAttributes]::ReparsePoint)) { 'other'; exit 0 }
+$o = (Get-Acl -LiteralPath $i.FullName).GetOwner([Security.Principal.SecurityIdentifier]).Value
+$me = [Security.Principal.WindowsIdentity]::GetCurrent()
+if ($o -eq $me.User.Value -or ($o -eq 'S-1-5-32-544' -and (New-Object Security.Principal.WindowsPrincipal($me)).IsInRole([Security.Principal.WindowsBuiltInRole]::Administrator))) { 'owned' } else { 'other' }`, ps.DoubleQuotePath(name)), cmd.PS(), cmd.HideOutput())
+	if err != nil {
+		return false, PathError("lstat", name, err)
+	}
+	switch strings.TrimSpace(out) {
+	case "owned":
+		return true, nil
+	case "none":
+		return false, PathError("lstat", name, fs.ErrNotExist)
+	default:
+		return false, nil
+	}
+}
+
 // FileExist checks if a file exists on the host. It is a more efficient shortcut for something like:
 //
 //		if _, err := fs.Stat(name); os.IsNotExist(err) { ... }
@@ -429,6 +452,11 @@ func (s *WinFS) Chmod(name string, mode fs.FileMode) error {
 	return nil
 }
 
+// permMask tells the sync that only the owner write bit survives a Chmod.
+func (s *WinFS) permMask() fs.FileMode {
+	return 0o200
+}
+
 // Chown changes the ownership of the named file. On Windows it returns an error.
 func (s *WinFS) Chown(name string, _ string) error {
 	return fmt.Errorf("chown %s: %w", name, ErrNotSupported)
@@ -490,6 +518,151 @@ try{
 	return code, nil
 }
 
+// uploadTar extracts the tar archive from src into dst with tar.exe, which
+// detects the compression by itself, or with System.Formats.Tar in pwsh when
+// tar.exe is not available.
+func (s *WinFS) uploadTar(src io.Reader, dst string, opts tarOptions) error {
+	if err := s.MkdirAll(dst, 0o755); err != nil {
+		return err
+	}
+	if s.CommandExist("tar.exe") {
+		if err := s.Exec("tar.exe -x -f - -C "+winArgQuote(s.NativePath(dst)), cmd.Stdin(src), cmd.LogInput(false)); err != nil {
+			return fmt.Errorf("extract archive: %w", err)
+		}
+		return nil
+	}
+	script, err := s.dotnetTarScript(opts, `$s=[Console]::OpenStandardInput()
+%[1]s
+[System.Formats.Tar.TarFile]::ExtractToDirectory($s,%[2]s,$true)`,
+		"$s=New-Object IO.Compression.GZipStream($s,[IO.Compression.CompressionMode]::Decompress)", dst)
+	if err != nil {
+		return err
+	}
+	if err := s.Exec(script, cmd.Stdin(src), cmd.LogInput(false)); err != nil {
+		return fmt.Errorf("extract archive: %w", err)
+	}
+	return nil
+}
+
+// downloadTar writes a tar archive of the contents of src to dst with tar.exe
+// or with System.Formats.Tar in pwsh when tar.exe is not available.
+func (s *WinFS) downloadTar(src string, dst io.Writer, opts tarOptions) error {
+	if s.CommandExist("tar.exe") {
+		var flag string
+		switch opts.compression {
+		case CompressionGzip:
+			flag = " -z"
+		case CompressionZstd:
+			flag = " --zstd"
+		case CompressionNone:
+		}
+		if err := s.Exec("tar.exe -c"+flag+" -f - -C "+winArgQuote(s.NativePath(src))+" .", cmd.Stdout(dst), cmd.HideOutput()); err != nil {
+			return fmt.Errorf("create archive: %w", err)
+		}
+		return nil
+	}
+	script, err := s.dotnetTarScript(opts, `$s=[Console]::OpenStandardOutput()
+%[1]s
+[System.Formats.Tar.TarFile]::CreateFromDirectory(%[2]s,$s,$false)
+$s.Dispose()`,
+		"$s=New-Object IO.Compression.GZipStream($s,[IO.Compression.CompressionLevel]::Optimal)", src)
+	if err != nil {
+		return err
+	}
+	if err := s.Exec(script, cmd.Stdout(dst), cmd.HideOutput()); err != nil {
+		return fmt.Errorf("create archive: %w", err)
+	}
+	return nil
+}
+
+// supportsCompression reports whether c can be used for transfers. The
+// files are compressed in chunks with the GZipStream of .NET, so gzip is
+// always available and zstd never.
+func (s *WinFS) supportsCompression(c Compression) bool {
+	return c == CompressionGzip
+}
+
+// copyFromCompressed writes src to the file name starting at offset with
+// the gzip compressed chunks of rigrcp.
+func (s *WinFS) copyFromCompressed(name string, offset int64, src io.Reader, c Compression) (int64, error) {
+	if !s.supportsCompression(c) {
+		return 0, PathErrorf(OpCopyFrom, name, "%w: compression %s", errInvalid, c)
+	}
+	flags := os.O_WRONLY
+	if offset == 0 {
+		flags |= os.O_CREATE | os.O_TRUNC
+	}
+	f, err := s.OpenFile(name, flags, 0)
+	if err != nil {
+		return 0, err
+	}
+	wf, ok := f.(*winFile)
+	if !ok {
+		_ = f.Close()
+		return 0, PathErrorf(OpCopyFrom, name, "%w: not a file", errInvalid)
+	}
+	if offset > 0 {
+		if _, err := wf.Seek(offset, io.SeekStart); err != nil {
+			_ = f.Close()
+			return 0, err
+		}
+	}
+	n, err := wf.copyFromGzip(src)
+	if err != nil {
+		_ = f.Close()
+		return n, err
+	}
+	if err := f.Close(); err != nil {
+		return n, err //nolint:wrapcheck // a path error
+	}
+	return n, nil
+}
+
+// copyToCompressed writes the content of the file name to dst with the gzip
+// compressed chunks of rigrcp.
+func (s *WinFS) copyToCompressed(name string, dst io.Writer, c Compression) (int64, error) {
+	if !s.supportsCompression(c) {
+		return 0, PathErrorf(OpCopyTo, name, "%w: compression %s", errInvalid, c)
+	}
+	f, err := s.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	wf, ok := f.(*winFile)
+	if !ok {
+		return 0, PathErrorf(OpCopyTo, name, "%w: not a file", errInvalid)
+	}
+	return wf.copyToGzip(dst)
+}
+
+// dotnetTarScript returns a pwsh command line running the script template,
+// which gets the gzip statement when gzip compression is used and the quoted
+// path. System.Formats.Tar needs .NET 7, which Windows PowerShell 5.1 does
+// not have.
+func (s *WinFS) dotnetTarScript(opts tarOptions, template, gzip, path string) (string, error) {
+	if opts.compression == CompressionZstd {
+		return "", fmt.Errorf("%w: zstd needs tar.exe on windows", ErrTarNotSupported)
+	}
+	if !s.CommandExist("pwsh") {
+		return "", fmt.Errorf("%w: neither tar.exe nor pwsh found", ErrTarNotSupported)
+	}
+	if opts.compression != CompressionGzip {
+		gzip = ""
+	}
+	script := "$ErrorActionPreference='Stop'\n" + fmt.Sprintf(template, gzip, ps.SingleQuote(s.NativePath(path)))
+	return "pwsh.exe -NonInteractive -NoProfile -E " + ps.EncodeCmd(script), nil
+}
+
+// winArgQuote quotes a path for a command line parsed by the C runtime, where
+// a backslash before the closing quote would escape it.
+func winArgQuote(p string) string {
+	if strings.HasSuffix(p, `\`) {
+		p += "."
+	}
+	return `"` + p + `"`
+}
+
 // FileContains reports whether the file at path contains the given substring.
 // Returns a not-exist error if the file does not exist.
 func (s *WinFS) FileContains(name, substr string) (bool, error) {
@@ -23,6 +23,7 @@ type Options struct {
 	backoffFactor float64
 	maxRetries    int
 	continueOnErr func(error) bool
+	onRetry       func(attempt int, err error)
 }
 
 // NewOptions returns a new Options with the given options applied.
@@ -85,6 +86,15 @@ func If(f func(error) bool) Option {
 	}
 }
 
+// OnRetry is a functional option that sets a function to call when an attempt
+// has failed and another one is going to be made, after the delay. attempt is
+// the number of the failed attempt, starting from 1.
+func OnRetry(f func(attempt int, err error)) Option {
+	return func(o *Options) {
+		o.onRetry = f
+	}
+}
+
 type retrier struct {
 	fn    func() error
 	ctxFn func(context.Context) error
@@ -191,5 +201,9 @@ func (r *retrier) do(ctx context.Context) error {
 		case <-ctx.Done():
 			return fmt.Errorf("retry: context done after %d attempts: %w: %w", attempt, ctx.Err(), err)
 		}
+
+		if r.opts.onRetry != nil {
+			r.opts.onRetry(attempt, err)
+		}
 	}
 }
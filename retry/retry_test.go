@@ -143,6 +143,23 @@ func TestRetryDoWithIf(t *testing.T) {
 	assert.Equal(t, 3, attempts, "Expected 3 attempts for success")
 }
 
+func TestRetryDoWithOnRetry(t *testing.T) {
+	ctx := context.Background()
+	var attempts int
+	var retried []int
+	err := retry.DoWithContext(ctx, func(context.Context) error {
+		attempts++
+		return errors.New("fail")
+	}, retry.MaxRetries(3), retry.Delay(time.Millisecond), retry.OnRetry(func(attempt int, err error) {
+		assert.EqualError(t, err, "fail")
+		retried = append(retried, attempt)
+	}))
+
+	require.Error(t, err)
+	assert.Equal(t, 3, attempts)
+	assert.Equal(t, []int{1, 2}, retried, "Expected a callback before each retry but not after the last attempt")
+}
+
 func TestRetryDoWithBackoff(t *testing.T) {
 	ctx := context.Background()
 	var attempts int
@@ -0,0 +1,277 @@
+// Package rigotel provides a tracer for rig that emits OpenTelemetry spans
+// and metrics: a span for every command and connection attempt, and metrics
+// for command latency, the bytes transferred through remotefs and retries.
+//
+// It lives in a module of its own so that rig itself does not depend on
+// OpenTelemetry. Install it on a client with [rig.WithTracer]:
+//
+//	tracer, err := rigotel.New()
+//	if err != nil {
+//		return err
+//	}
+//	client, err := rig.NewClient(rig.WithConnection(conn), rig.WithTracer(tracer))
+package rigotel
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/k0sproject/rig/v2"
+	"github.com/k0sproject/rig/v2/cmd"
+	"github.com/k0sproject/rig/v2/protocol"
+	"github.com/k0sproject/rig/v2/remotefs"
+	"github.com/k0sproject/rig/v2/retry"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	_ cmd.CommandTracer  = (*Tracer)(nil)
+	_ rig.ConnectTracer  = (*Tracer)(nil)
+	_ rig.TransferTracer = (*Tracer)(nil)
+)
+
+// ScopeName is the instrumentation scope of the spans and metrics.
+const ScopeName = "github.com/k0sproject/rig/v2/rigotel"
+
+// Span names.
+const (
+	SpanCommand = "rig.command"
+	SpanConnect = "rig.connect"
+)
+
+// Metric names.
+const (
+	MetricCommandDuration = "rig.command.duration"
+	MetricTransferred     = "rig.remotefs.transferred"
+	MetricRetries         = "rig.retries"
+)
+
+// Attribute keys set on the spans and metrics.
+const (
+	AttrHost      = attribute.Key("rig.host")
+	AttrProtocol  = attribute.Key("rig.protocol")
+	AttrCommand   = attribute.Key("rig.command")
+	AttrExitCode  = attribute.Key("rig.command.exit_code")
+	AttrSignal    = attribute.Key("rig.command.signal")
+	AttrAttempt   = attribute.Key("rig.connect.attempt")
+	AttrDirection = attribute.Key("rig.transfer.direction")
+	AttrOperation = attribute.Key("rig.retry.operation")
+)
+
+// OperationConnect is the [AttrOperation] of the retries of [rig.Client.Connect].
+const OperationConnect = "connect"
+
+// Option is a functional option for [New].
+type Option func(*options)
+
+type options struct {
+	tracerProvider trace.TracerProvider
+	meterProvider  metric.MeterProvider
+}
+
+// WithTracerProvider sets the provider of the tracer the spans are created
+// with. The default is the global one from [otel.GetTracerProvider].
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(o *options) {
+		o.tracerProvider = tp
+	}
+}
+
+// WithMeterProvider sets the provider of the meter the metrics are recorded
+// with. The default is the global one from [otel.GetMeterProvider].
+func WithMeterProvider(mp metric.MeterProvider) Option {
+	return func(o *options) {
+		o.meterProvider = mp
+	}
+}
+
+// Tracer is a [cmd.CommandTracer], a [rig.ConnectTracer] and a
+// [rig.TransferTracer] that reports to OpenTelemetry.
+//
+// A command span is a child of the span in the context the command was
+// started with and carries the host, the protocol, the command as it is
+// logged and its exit code. Commands run with [cmd.HideCommand] or
+// [cmd.Sensitive] get no command attribute and the output of commands is
+// never recorded. A connection attempt span is a child of the span in the
+// context given to [rig.Client.Connect].
+type Tracer struct {
+	tracer      trace.Tracer
+	duration    metric.Float64Histogram
+	transferred metric.Int64Counter
+	retries     metric.Int64Counter
+}
+
+// New returns a new [Tracer].
+func New(opts ...Option) (*Tracer, error) {
+	o := options{
+		tracerProvider: otel.GetTracerProvider(),
+		meterProvider:  otel.GetMeterProvider(),
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	meter := o.meterProvider.Meter(ScopeName)
+	t := &Tracer{tracer: o.tracerProvider.Tracer(ScopeName)}
+	var err error
+	t.duration, err = meter.Float64Histogram(MetricCommandDuration,
+		metric.WithDescription("Duration of the commands run on hosts."),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("create %s histogram: %w", MetricCommandDuration, err)
+	}
+	t.transferred, err = meter.Int64Counter(MetricTransferred,
+		metric.WithDescription("File content transferred to and from hosts through remotefs."),
+		metric.WithUnit("By"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("create %s counter: %w", MetricTransferred, err)
+	}
+	t.retries, err = meter.Int64Counter(MetricRetries,
+		metric.WithDescription("Operations retried after a failed attempt."),
+		metric.WithUnit("{retry}"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("create %s counter: %w", MetricRetries, err)
+	}
+	return t, nil
+}
+
+// CommandFormatted implements [cmd.Tracer]. The tracer uses
+// [Tracer.TraceCommand] instead.
+func (t *Tracer) CommandFormatted(string, string) {}
+
+// ProcessStarted implements [cmd.Tracer]. The tracer uses
+// [Tracer.TraceCommand] instead.
+func (t *Tracer) ProcessStarted(string, string) {}
+
+// ProcessFinished implements [cmd.Tracer]. The tracer uses
+// [Tracer.TraceCommand] instead.
+func (t *Tracer) ProcessFinished(string, string, time.Duration, error) {}
+
+// TraceCommand implements [cmd.CommandTracer] by starting a command span.
+func (t *Tracer) TraceCommand(ctx context.Context, info cmd.CommandInfo) cmd.CommandTrace {
+	attrs := []attribute.KeyValue{AttrHost.String(info.Host)}
+	if info.Protocol != "" {
+		attrs = append(attrs, AttrProtocol.String(info.Protocol))
+	}
+	spanAttrs := attrs
+	if !info.CommandHidden {
+		spanAttrs = append(spanAttrs[:len(attrs):len(attrs)], AttrCommand.String(info.Command))
+	}
+	ctx, span := t.tracer.Start(ctx, SpanCommand,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithTimestamp(info.Started),
+		trace.WithAttributes(spanAttrs...),
+	)
+	return &commandTrace{tracer: t, ctx: ctx, span: span, attrs: attrs, outputHidden: info.OutputHidden}
+}
+
+type commandTrace struct {
+	tracer *Tracer
+	ctx    context.Context //nolint:containedctx // the metrics are recorded in the context of the command
+	span   trace.Span
+	attrs  []attribute.KeyValue
+
+	outputHidden bool
+}
+
+// StdoutLine implements [cmd.CommandTrace]. Output is not recorded.
+func (c *commandTrace) StdoutLine(string) {}
+
+// StderrLine implements [cmd.CommandTrace]. Output is not recorded.
+func (c *commandTrace) StderrLine(string) {}
+
+// Finished implements [cmd.CommandTrace] by ending the span and recording the
+// duration of the command.
+func (c *commandTrace) Finished(exitCode int, signal protocol.Signal, duration time.Duration, err error) {
+	if exitCode >= 0 {
+		c.span.SetAttributes(AttrExitCode.Int(exitCode))
+	}
+	if signal != "" {
+		c.span.SetAttributes(AttrSignal.String(string(signal)))
+	}
+	if err != nil {
+		c.span.SetStatus(codes.Error, c.failure(exitCode, signal, err))
+	}
+	c.span.End()
+
+	if duration == 0 && exitCode < 0 {
+		// the command could not be started
+		return
+	}
+	attrs := c.attrs
+	if exitCode >= 0 {
+		attrs = append(attrs[:len(attrs):len(attrs)], AttrExitCode.Int(exitCode))
+	}
+	c.tracer.duration.Record(c.ctx, duration.Seconds(), metric.WithAttributes(attrs...))
+}
+
+// failure describes why a command failed by its signal or exit code. The
+// error, which rig strips of the output of the command and redacts, is only
+// used when neither is known, and not at all when the output is hidden.
+func (c *commandTrace) failure(exitCode int, signal protocol.Signal, err error) string {
+	switch {
+	case signal != "":
+		return "terminated by signal " + string(signal)
+	case exitCode > 0:
+		return "exit code " + strconv.Itoa(exitCode)
+	case c.outputHidden:
+		return "command failed"
+	default:
+		return err.Error()
+	}
+}
+
+// TraceConnect implements [rig.ConnectTracer] by starting a connection attempt
+// span. Attempts after the first one are counted as retries of
+// [OperationConnect].
+func (t *Tracer) TraceConnect(ctx context.Context, info rig.ConnectInfo) (context.Context, rig.ConnectTrace) {
+	if info.Attempt > 1 {
+		t.retries.Add(ctx, 1, metric.WithAttributes(AttrOperation.String(OperationConnect), AttrHost.String(info.Host)))
+	}
+	ctx, span := t.tracer.Start(ctx, SpanConnect,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			AttrHost.String(info.Host),
+			AttrProtocol.String(info.Protocol),
+			AttrAttempt.Int(info.Attempt),
+		),
+	)
+	return ctx, connectTrace{span: span}
+}
+
+type connectTrace struct {
+	span trace.Span
+}
+
+// Finished implements [rig.ConnectTrace] by ending the span.
+func (c connectTrace) Finished(err error) {
+	if err != nil {
+		c.span.RecordError(err)
+		c.span.SetStatus(codes.Error, err.Error())
+	}
+	c.span.End()
+}
+
+// BytesTransferred implements [rig.TransferTracer] by adding n to the
+// transferred bytes of host in direction dir.
+func (t *Tracer) BytesTransferred(host string, dir remotefs.TransferDirection, n int64) {
+	t.transferred.Add(context.Background(), n, metric.WithAttributes(AttrHost.String(host), AttrDirection.String(dir.String())))
+}
+
+// RetryOption returns an option for the functions of the retry package, such
+// as [retry.DoWithContext], that counts the retries they make under the given
+// operation name.
+func (t *Tracer) RetryOption(operation string) retry.Option {
+	return retry.OnRetry(func(int, error) {
+		t.retries.Add(context.Background(), 1, metric.WithAttributes(AttrOperation.String(operation)))
+	})
+}
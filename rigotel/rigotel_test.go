@@ -0,0 +1,226 @@
+package rigotel_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/k0sproject/rig/v2"
+	"github.com/k0sproject/rig/v2/cmd"
+	"github.com/k0sproject/rig/v2/retry"
+	"github.com/k0sproject/rig/v2/rigotel"
+	"github.com/k0sproject/rig/v2/rigtest"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+type harness struct {
+	tracer *rigotel.Tracer
+	spans  *tracetest.SpanRecorder
+	reader *sdkmetric.ManualReader
+	tp     *sdktrace.TracerProvider
+}
+
+func newHarness(t *testing.T) *harness {
+	t.Helper()
+	h := &harness{spans: tracetest.NewSpanRecorder(), reader: sdkmetric.NewManualReader()}
+	h.tp = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(h.spans))
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(h.reader))
+	var err error
+	h.tracer, err = rigotel.New(rigotel.WithTracerProvider(h.tp), rigotel.WithMeterProvider(mp))
+	require.NoError(t, err)
+	return h
+}
+
+func (h *harness) metric(t *testing.T, name string) metricdata.Aggregation {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, h.reader.Collect(context.Background(), &rm))
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name == name {
+				return m.Data
+			}
+		}
+	}
+	t.Fatalf("metric %s not recorded", name)
+	return nil
+}
+
+func spanAttr(attrs []attribute.KeyValue, key attribute.Key) (attribute.Value, bool) {
+	for _, kv := range attrs {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func TestCommandSpans(t *testing.T) {
+	h := newHarness(t)
+	mr := rigtest.NewMockRunner()
+	mr.AddCommandSuccess(rigtest.HasPrefix("login"))
+	mr.AddCommandFailure(rigtest.Equal("false"), errors.New("exit status 1"))
+
+	ctx, parent := h.tp.Tracer("test").Start(context.Background(), "deploy")
+	require.NoError(t, mr.ExecContext(ctx, "login hunter2", cmd.Trace(h.tracer), cmd.Redact("hunter2")))
+	require.Error(t, mr.Exec("false", cmd.Trace(h.tracer)))
+	require.NoError(t, mr.Exec("login secret", cmd.Trace(h.tracer), cmd.Sensitive()))
+	parent.End()
+
+	var commands []sdktrace.ReadOnlySpan
+	for _, span := range h.spans.Ended() {
+		if span.Name() == rigotel.SpanCommand {
+			commands = append(commands, span)
+		}
+	}
+	require.Len(t, commands, 3)
+
+	login := commands[0]
+	require.Equal(t, parent.SpanContext().SpanID(), login.Parent().SpanID(), "the command span is a child of the span in the context")
+	value, ok := spanAttr(login.Attributes(), rigotel.AttrCommand)
+	require.True(t, ok)
+	require.Equal(t, "login [REDACTED]", value.AsString())
+	value, ok = spanAttr(login.Attributes(), rigotel.AttrHost)
+	require.True(t, ok)
+	require.Equal(t, "mockclient", value.AsString())
+	value, ok = spanAttr(login.Attributes(), rigotel.AttrProtocol)
+	require.True(t, ok)
+	require.Equal(t, "mock", value.AsString())
+	value, ok = spanAttr(login.Attributes(), rigotel.AttrExitCode)
+	require.True(t, ok)
+	require.EqualValues(t, 0, value.AsInt64())
+	require.Equal(t, codes.Unset, login.Status().Code)
+
+	require.Equal(t, codes.Error, commands[1].Status().Code)
+
+	_, ok = spanAttr(commands[2].Attributes(), rigotel.AttrCommand)
+	require.False(t, ok, "a sensitive command is not recorded")
+
+	hist, ok := h.metric(t, rigotel.MetricCommandDuration).(metricdata.Histogram[float64])
+	require.True(t, ok)
+	var count uint64
+	for _, dp := range hist.DataPoints {
+		_, hasCommand := dp.Attributes.Value(rigotel.AttrCommand)
+		require.False(t, hasCommand, "the command is not a metric attribute")
+		count += dp.Count
+	}
+	require.EqualValues(t, 3, count)
+}
+
+type exitError struct{ code int }
+
+func (e exitError) Error() string { return fmt.Sprintf("exit status %d", e.code) }
+func (e exitError) ExitCode() int { return e.code }
+
+func TestCommandSpanErrors(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	tracer, err := rigotel.New(rigotel.WithTracerProvider(tp), rigotel.WithMeterProvider(sdkmetric.NewMeterProvider()))
+	require.NoError(t, err)
+
+	mr := rigtest.NewMockRunner()
+	mr.AddCommand(rigtest.HasPrefix("login"), func(a *rigtest.A) error {
+		fmt.Fprintln(a.Stderr, "bad token hunter2")
+		return exitError{code: 1}
+	})
+	mr.AddCommandFailure(rigtest.HasPrefix("token"), errors.New("token hunter2 rejected"))
+	mr.AddCommandFailure(rigtest.HasPrefix("secret"), errors.New("secret hunter2 rejected"))
+
+	require.Error(t, mr.Exec("login", cmd.Trace(tracer), cmd.Redact("hunter2")))
+	require.Error(t, mr.Exec("login", cmd.Trace(tracer), cmd.Sensitive()))
+	require.Error(t, mr.Exec("token", cmd.Trace(tracer), cmd.Redact("hunter2")))
+	require.Error(t, mr.Exec("secret", cmd.Trace(tracer), cmd.Sensitive()))
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 4)
+	descriptions := make([]string, 0, len(spans))
+	for _, span := range spans {
+		require.Equal(t, codes.Error, span.Status.Code)
+		require.Empty(t, span.Events, "the error is not recorded as an event")
+		descriptions = append(descriptions, span.Status.Description)
+	}
+	require.Equal(t, []string{"exit code 1", "exit code 1", "token [REDACTED] rejected", "command failed"}, descriptions)
+}
+
+var errConnRefused = errors.New("connection refused")
+
+type flakyConn struct {
+	*rigtest.MockConnection
+	failures int
+}
+
+func (c *flakyConn) Connect(ctx context.Context) error {
+	if c.failures > 0 {
+		c.failures--
+		return errConnRefused
+	}
+	return c.MockConnection.Connect(ctx)
+}
+
+func TestConnectSpansAndTransfers(t *testing.T) {
+	h := newHarness(t)
+	conn := &flakyConn{MockConnection: rigtest.NewMockConnection(), failures: 1}
+	conn.AddCommandSuccess(rigtest.Match("."))
+
+	client, err := rig.NewClient(rig.WithConnection(conn), rig.WithTracer(h.tracer))
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	require.NoError(t, client.Connect(ctx))
+
+	var attempts []sdktrace.ReadOnlySpan
+	for _, span := range h.spans.Ended() {
+		if span.Name() == rigotel.SpanConnect {
+			attempts = append(attempts, span)
+		}
+	}
+	require.Len(t, attempts, 2)
+	require.Equal(t, codes.Error, attempts[0].Status().Code)
+	require.Equal(t, codes.Unset, attempts[1].Status().Code)
+	value, ok := spanAttr(attempts[1].Attributes(), rigotel.AttrAttempt)
+	require.True(t, ok)
+	require.EqualValues(t, 2, value.AsInt64())
+
+	retries, ok := h.metric(t, rigotel.MetricRetries).(metricdata.Sum[int64])
+	require.True(t, ok)
+	require.Len(t, retries.DataPoints, 1)
+	require.EqualValues(t, 1, retries.DataPoints[0].Value)
+	operation, _ := retries.DataPoints[0].Attributes.Value(rigotel.AttrOperation)
+	require.Equal(t, rigotel.OperationConnect, operation.AsString())
+
+	require.NoError(t, client.FS().WriteFile("/tmp/greeting", []byte("hello"), 0o644))
+	transferred, ok := h.metric(t, rigotel.MetricTransferred).(metricdata.Sum[int64])
+	require.True(t, ok)
+	require.Len(t, transferred.DataPoints, 1)
+	require.EqualValues(t, 5, transferred.DataPoints[0].Value)
+	direction, _ := transferred.DataPoints[0].Attributes.Value(rigotel.AttrDirection)
+	require.Equal(t, "upload", direction.AsString())
+}
+
+func TestRetryOption(t *testing.T) {
+	h := newHarness(t)
+	var attempts int
+	err := retry.DoWithContext(context.Background(), func(context.Context) error {
+		attempts++
+		if attempts < 3 {
+			return errors.New("not yet")
+		}
+		return nil
+	}, retry.Delay(time.Millisecond), h.tracer.RetryOption("wait-for-api"))
+	require.NoError(t, err)
+
+	retries, ok := h.metric(t, rigotel.MetricRetries).(metricdata.Sum[int64])
+	require.True(t, ok)
+	require.Len(t, retries.DataPoints, 1)
+	require.EqualValues(t, 2, retries.DataPoints[0].Value)
+	operation, _ := retries.DataPoints[0].Attributes.Value(rigotel.AttrOperation)
+	require.Equal(t, "wait-for-api", operation.AsString())
+}
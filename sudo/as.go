@@ -0,0 +1,157 @@
+package sudo
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/k0sproject/rig/v2/cmd"
+	"github.com/k0sproject/rig/v2/plumbing"
+	"github.com/k0sproject/rig/v2/sh"
+	"github.com/k0sproject/rig/v2/sh/shellescape"
+)
+
+var (
+	// ErrNoUserSwitch is returned when no supported method is found for running
+	// commands as another user.
+	ErrNoUserSwitch = errors.New("no supported method for running commands as another user found")
+	// DefaultUserRegistry is the default repository of methods for running
+	// commands as another user.
+	DefaultUserRegistry = sync.OnceValue(func() *UserRegistry {
+		provider := NewUserRegistry()
+		RegisterUserDefaults(provider)
+		return provider
+	})
+)
+
+// Target is a runner and the user the commands it runs should be run as.
+type Target struct {
+	Runner cmd.Runner
+	User   string
+}
+
+// UserRunnerProvider is a function that returns a cmd.Runner that runs
+// commands as the given user, given a runner.
+type UserRunnerProvider func(runner cmd.Runner, user string) (cmd.Runner, error)
+
+// UserFactory is a factory for runners that run commands as another user.
+type UserFactory = plumbing.Factory[Target, cmd.Runner]
+
+// UserRegistry is a repository for factories of runners that run commands as
+// another user.
+type UserRegistry = plumbing.Provider[Target, cmd.Runner]
+
+// NewUserRegistry returns a new repository for factories of runners that run
+// commands as another user.
+func NewUserRegistry() *UserRegistry {
+	return plumbing.NewProvider[Target, cmd.Runner](ErrNoUserSwitch)
+}
+
+// RegisterUserDefaults registers the methods for running commands as another
+// user that rig ships with, which is what DefaultUserRegistry holds.
+//
+// As with [RegisterDefaults], the order is part of what this registers: a host
+// where the connection already is the target user runs the commands
+// unmodified, sudo and doas come before runuser and su, which only work for
+// root without a password.
+func RegisterUserDefaults(provider *UserRegistry) {
+	RegisterSameUserNoop(provider)
+	RegisterSudoAs(provider)
+	RegisterDoasAs(provider)
+	RegisterRunuser(provider)
+	RegisterSuAs(provider)
+}
+
+// GetUserRunner returns a runner from DefaultUserRegistry that runs the
+// commands of runner as user. It is a [UserRunnerProvider].
+func GetUserRunner(runner cmd.Runner, user string) (cmd.Runner, error) {
+	return DefaultUserRegistry().Get(Target{Runner: runner, User: user}) //nolint:wrapcheck // the registry error is a sentinel
+}
+
+// SudoAs returns a DecorateFunc that will wrap the given command in a sudo call
+// that runs it as user. The command runs through an explicit POSIX shell as in
+// [Sudo].
+func SudoAs(user string) cmd.DecorateFunc {
+	return func(cmd string) string {
+		return "sudo -n -u " + shellescape.QuoteForLoginShell(user) + " -- " + sh.Shell(cmd)
+	}
+}
+
+// DoasAs returns a DecorateFunc that will wrap the given command in a doas call
+// that runs it as user. The command runs through an explicit POSIX shell as in
+// [Sudo].
+func DoasAs(user string) cmd.DecorateFunc {
+	return func(cmd string) string {
+		return "doas -n -u " + shellescape.QuoteForLoginShell(user) + " -- " + sh.Shell(cmd)
+	}
+}
+
+// Runuser returns a DecorateFunc that will wrap the given command in a
+// runuser call that runs it as user. runuser is part of util-linux and can
+// only be used by root.
+func Runuser(user string) cmd.DecorateFunc {
+	return func(cmd string) string {
+		return "runuser -u " + shellescape.QuoteForLoginShell(user) + " -- " + sh.Shell(cmd)
+	}
+}
+
+// SuAs returns a DecorateFunc that will wrap the given command in a su call
+// that runs it as user. The command is run by /bin/sh rather than the login
+// shell of user, which for service accounts often is nologin. Without a
+// terminal to ask for a password from, su only works for root.
+func SuAs(user string) cmd.DecorateFunc {
+	return func(cmd string) string {
+		return "su -s /bin/sh " + shellescape.QuoteForLoginShell(user) + " -c " + shellescape.QuoteForLoginShell(cmd)
+	}
+}
+
+// registerUserDecorator registers a factory that probes decorator with a
+// command that always succeeds and returns a runner using it when that works.
+func registerUserDecorator(repository *UserRegistry, decorator func(user string) cmd.DecorateFunc) {
+	repository.Register(func(t Target) (cmd.Runner, bool) {
+		if t.Runner.IsWindows() {
+			return nil, false
+		}
+		decorate := decorator(t.User)
+		// Ungated: a CommandGate that rejects this probe would silently
+		// disable the method rather than surface an error, so it must always run.
+		if t.Runner.Exec(decorate("true"), cmd.Ungated()) != nil {
+			return nil, false
+		}
+		return cmd.NewExecutor(t.Runner, decorate), true
+	})
+}
+
+// RegisterSameUserNoop registers a noop DecorateFunc with the given repository
+// which is used when the connection already is the target user.
+func RegisterSameUserNoop(repository *UserRegistry) {
+	repository.Register(func(t Target) (cmd.Runner, bool) {
+		if t.Runner.IsWindows() {
+			return nil, false
+		}
+		// Ungated: see registerUserDecorator.
+		if t.Runner.Exec(`[ "$(id -un)" = `+shellescape.QuoteForLoginShell(t.User)+` ]`, cmd.Ungated()) != nil {
+			return nil, false
+		}
+		return cmd.NewExecutor(t.Runner, Noop), true
+	})
+}
+
+// RegisterSudoAs registers a [SudoAs] DecorateFunc with the given repository.
+func RegisterSudoAs(repository *UserRegistry) {
+	registerUserDecorator(repository, SudoAs)
+}
+
+// RegisterDoasAs registers a [DoasAs] DecorateFunc with the given repository.
+func RegisterDoasAs(repository *UserRegistry) {
+	registerUserDecorator(repository, DoasAs)
+}
+
+// RegisterRunuser registers a [Runuser] DecorateFunc with the given repository.
+func RegisterRunuser(repository *UserRegistry) {
+	registerUserDecorator(repository, Runuser)
+}
+
+// RegisterSuAs registers a [SuAs] DecorateFunc with the given repository.
+func RegisterSuAs(repository *UserRegistry) {
+	registerUserDecorator(repository, SuAs)
+}
@@ -0,0 +1,76 @@
+package sudo_test
+
+import (
+	"testing"
+
+	"github.com/k0sproject/rig/v2/rigtest"
+	"github.com/k0sproject/rig/v2/sudo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserDecoratorsGolden(t *testing.T) {
+	require.Equal(t, `sudo -n -u k0s -- /bin/sh -c -- 'k0s status'`, sudo.SudoAs("k0s")("k0s status"))
+	require.Equal(t, `doas -n -u k0s -- /bin/sh -c -- 'k0s status'`, sudo.DoasAs("k0s")("k0s status"))
+	require.Equal(t, `runuser -u k0s -- /bin/sh -c -- 'k0s status'`, sudo.Runuser("k0s")("k0s status"))
+	require.Equal(t, `su -s /bin/sh k0s -c 'k0s status'`, sudo.SuAs("k0s")("k0s status"))
+	require.Equal(t, `sudo -n -u 'it'"'"'s me' -- /bin/sh -c -- id`, sudo.SudoAs("it's me")("id"))
+}
+
+func TestUserRegistry(t *testing.T) {
+	target := func(mr *rigtest.MockRunner) sudo.Target {
+		return sudo.Target{Runner: mr, User: "k0s"}
+	}
+
+	t.Run("same user runs commands unmodified", func(t *testing.T) {
+		mr := rigtest.NewMockRunner()
+		mr.ErrDefault = errProbe
+		mr.AddCommandSuccess(rigtest.Contains(`[ "$(id -un)" = k0s ]`))
+		mr.AddCommandSuccess(rigtest.Equal("whoami"))
+
+		runner, err := sudo.DefaultUserRegistry().Get(target(mr))
+		require.NoError(t, err)
+		require.NoError(t, runner.Exec("whoami"))
+		require.NoError(t, mr.NotReceived(rigtest.Contains("sudo")))
+	})
+
+	t.Run("sudo", func(t *testing.T) {
+		mr := rigtest.NewMockRunner()
+		mr.ErrDefault = errProbe
+		mr.AddCommandSuccess(rigtest.HasPrefix("sudo -n -u k0s"))
+
+		runner, err := sudo.DefaultUserRegistry().Get(target(mr))
+		require.NoError(t, err)
+		require.NoError(t, runner.Exec("whoami"))
+		rigtest.ReceivedEqual(t, mr, `sudo -n -u k0s -- /bin/sh -c -- whoami`)
+	})
+
+	t.Run("runuser for root", func(t *testing.T) {
+		mr := rigtest.NewMockRunner()
+		mr.ErrDefault = errProbe
+		mr.AddCommandSuccess(rigtest.HasPrefix("runuser"))
+
+		runner, err := sudo.DefaultUserRegistry().Get(target(mr))
+		require.NoError(t, err)
+		require.NoError(t, runner.Exec("whoami"))
+		rigtest.ReceivedEqual(t, mr, `runuser -u k0s -- /bin/sh -c -- whoami`)
+		require.NoError(t, mr.Received(rigtest.HasPrefix("doas -n -u k0s")), "doas is probed before runuser")
+	})
+
+	t.Run("nothing works", func(t *testing.T) {
+		mr := rigtest.NewMockRunner()
+		mr.ErrDefault = errProbe
+
+		_, err := sudo.DefaultUserRegistry().Get(target(mr))
+		require.ErrorIs(t, err, sudo.ErrNoUserSwitch)
+		require.NoError(t, mr.Received(rigtest.HasPrefix("su -s /bin/sh k0s")))
+	})
+
+	t.Run("skipped on windows", func(t *testing.T) {
+		mr := rigtest.NewMockRunner()
+		mr.Windows = true
+
+		_, err := sudo.DefaultUserRegistry().Get(target(mr))
+		require.ErrorIs(t, err, sudo.ErrNoUserSwitch)
+		require.Empty(t, mr.Commands())
+	})
+}
@@ -44,10 +44,30 @@ func NewRegistry() *Registry {
 // first so such a host runs its commands unmodified.
 //
 // The factories are appended, so one of your own that has to take precedence over
-// them must be registered before this call, or with Registry.RegisterFirst.
+// them must be registered before this call, or with Registry.RegisterFirst. The
+// methods that need a password, may be slow to probe or are specific to a few
+// platforms, such as [RegisterSudoPassword], [RegisterSuPassword],
+// [RegisterRun0], [RegisterPfexec] and [RegisterPbrun], are not included.
 func RegisterDefaults(provider *Registry) {
 	RegisterWindowsNoop(provider)
+	RegisterWindowsTask(provider)
 	RegisterUID0Noop(provider)
 	RegisterSudo(provider)
 	RegisterDoas(provider)
 }
+
+// registerDecorator registers a factory that probes decorate with the probe
+// command and returns a runner using it when that works.
+func registerDecorator(repository *Registry, decorate cmd.DecorateFunc, probe string) {
+	repository.Register(func(c cmd.Runner) (cmd.Runner, bool) {
+		if c.IsWindows() {
+			return nil, false
+		}
+		// Ungated: a CommandGate that rejects this probe would silently
+		// disable the method rather than surface an error, so it must always run.
+		if c.Exec(decorate(probe), cmd.Ungated()) != nil {
+			return nil, false
+		}
+		return cmd.NewExecutor(c, decorate), true
+	})
+}
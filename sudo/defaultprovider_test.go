@@ -61,3 +61,18 @@ func TestDefaultRegistryPrefersNoopForRoot(t *testing.T) {
 	require.NoError(t, mr.NotReceived(rigtest.Contains("sudo -n")),
 		"root host was given the sudo decorator instead of noop")
 }
+
+// TestDefaultRegistrySkipsOptInMethods checks that the methods that have to be
+// asked for, like run0 and pfexec, are not probed on hosts that lack the
+// default ones.
+func TestDefaultRegistrySkipsOptInMethods(t *testing.T) {
+	mr := rigtest.NewMockRunner()
+	mr.ErrDefault = errProbe
+	mr.AddCommandSuccess(rigtest.HasPrefix("run0 "))
+	mr.AddCommandSuccess(rigtest.HasPrefix("pfexec "))
+
+	_, err := sudo.DefaultRegistry().Get(mr)
+	require.ErrorIs(t, err, sudo.ErrNoSudo)
+	require.NoError(t, mr.NotReceived(rigtest.HasPrefix("run0 ")))
+	require.NoError(t, mr.NotReceived(rigtest.HasPrefix("pfexec ")))
+}
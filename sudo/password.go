@@ -0,0 +1,149 @@
+package sudo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/k0sproject/rig/v2/cmd"
+	"github.com/k0sproject/rig/v2/log"
+	"github.com/k0sproject/rig/v2/protocol"
+	"github.com/k0sproject/rig/v2/sh"
+)
+
+var (
+	// ErrWrongPassword is returned when sudo, su or the Windows task
+	// scheduler does not accept the password given by a [PasswordProvider].
+	ErrWrongPassword = errors.New("incorrect password for privilege escalation")
+
+	errNoLoginPassword = errors.New("connection does not know the login password")
+)
+
+// PasswordProvider returns the password sudo asks for from the user of the
+// connection of runner, or the password of root for su.
+type PasswordProvider func(runner cmd.Runner) (string, error)
+
+// StaticPassword returns a PasswordProvider that always returns password.
+func StaticPassword(password string) PasswordProvider {
+	return func(cmd.Runner) (string, error) {
+		return password, nil
+	}
+}
+
+// PasswordCallback returns a PasswordProvider that gets the password from fn,
+// for example by asking the user for it.
+func PasswordCallback(fn func() (string, error)) PasswordProvider {
+	return func(cmd.Runner) (string, error) {
+		return fn() //nolint:wrapcheck // the callback error is returned as is
+	}
+}
+
+// connectionRunner is implemented by runners that can hand out the
+// connection underneath them, like [cmd.Executor].
+type connectionRunner interface {
+	Connection() (protocol.ProcessStarter, bool)
+}
+
+// ConnectionPassword is a PasswordProvider that returns the password the
+// connection of runner logged in with, such as the one from the
+// LoginPasswordCallback of an SSH connection.
+func ConnectionPassword(runner cmd.Runner) (string, error) {
+	cr, ok := runner.(connectionRunner)
+	if !ok {
+		return "", errNoLoginPassword
+	}
+	conn, _ := cr.Connection()
+	lp, ok := conn.(protocol.LoginPassworder)
+	if !ok {
+		return "", errNoLoginPassword
+	}
+	password, err := lp.LoginPassword()
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", errNoLoginPassword, err)
+	}
+	return password, nil
+}
+
+// authFailureMarker is written on stderr by [SudoPassword] when sudo does not
+// accept the password.
+const authFailureMarker = "rig-sudo: authentication failed"
+
+// SudoPassword is a DecorateFunc that will wrap the given command in a sudo call
+// that authenticates with a password. The password has to be the first line
+// of the command's input, which the runner from [RegisterSudoPassword] takes
+// care of.
+//
+// The password is read by the shell and piped to "sudo -S -v", which
+// validates it and primes the sudo timestamp, after which the command is run
+// with "sudo -n" as in [Sudo]. This way a command that has input of its own
+// gets all of it, whether sudo would have asked for the password or not. It
+// requires sudo to cache credentials, which it does unless timestamp_timeout
+// is set to 0. The timestamp is tied to the shell that runs both, which is
+// why the sudo call is not the last command of the script: a shell is free to
+// replace itself with its last command.
+func SudoPassword(cmd string) string {
+	return sh.Shell(`IFS= read -r p; if ! printf '%s\n' "$p" | LC_ALL=C sudo -S -p '' -v; then echo '` + authFailureMarker + `' >&2; exit 1; fi; unset p; ` + Sudo(cmd) + `; exit $?`)
+}
+
+// isWrongPassword reports whether stderr is the output of a [SudoPassword]
+// command where sudo did not accept the password, as opposed to failing for
+// another reason, such as the user not being allowed to use sudo. The sudo
+// messages are in English as the script runs it with LC_ALL=C.
+func isWrongPassword(stderr string) bool {
+	if !strings.Contains(stderr, authFailureMarker) {
+		return false
+	}
+	return strings.Contains(stderr, "Sorry, try again") || strings.Contains(stderr, "incorrect password attempt")
+}
+
+// RegisterSudoPassword registers a sudo method that authenticates with the
+// password from provider with the given repository. The password is piped to
+// the commands through stdin and redacted from the logs with [cmd.Redact], it
+// is never part of the commands. See [SudoPassword] for how it is passed to
+// sudo.
+//
+// The factory is skipped when provider returns an error. When sudo does not
+// accept the password, the factory returns a runner whose commands fail with
+// [ErrWrongPassword] instead of letting the registry move on to the next method,
+// as a host that was given a password for sudo presumably needs it.
+//
+// Register it after the methods that need no password, such as with
+// [RegisterDefaults], so that the password is only used when it is needed.
+func RegisterSudoPassword(repository *Registry, provider PasswordProvider) {
+	registerPasswordDecorator(repository, SudoPassword, provider, isWrongPassword)
+}
+
+// registerPasswordDecorator registers a factory for a runner that passes the
+// password from provider as the first line of the input of every command and
+// decorates them with decorate. The factory probes the runner with a command
+// that always succeeds and uses isWrong to tell from the stderr of a failed
+// probe whether the password was not accepted.
+func registerPasswordDecorator(repository *Registry, decorate cmd.DecorateFunc, provider PasswordProvider, isWrong func(stderr string) bool) {
+	repository.Register(func(c cmd.Runner) (cmd.Runner, bool) {
+		if c.IsWindows() {
+			return nil, false
+		}
+		password, err := provider(c)
+		if err != nil {
+			log.Trace(context.Background(), "password for privilege escalation not available", log.HostAttr(c), log.KeyError, err)
+			return nil, false
+		}
+		runner := cmd.NewExecutor(c, decorate)
+		opts := []cmd.ExecOption{cmd.StdinPrefix(password + "\n")}
+		if password != "" {
+			opts = append(opts, cmd.Redact(password))
+		}
+		runner.SetOptions(opts...)
+		// Ungated: a CommandGate that rejects this probe would silently
+		// disable the method rather than surface an error, so it must always run.
+		result, err := runner.Run(context.Background(), "true", cmd.Ungated())
+		if err == nil {
+			return runner, true
+		}
+		if result != nil && isWrong(result.Stderr) {
+			return cmd.NewErrorExecutor(ErrWrongPassword), true
+		}
+		return nil, false
+	})
+}
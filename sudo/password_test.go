@@ -0,0 +1,150 @@
+package sudo_test
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/k0sproject/rig/v2/cmd"
+	"github.com/k0sproject/rig/v2/protocol"
+	"github.com/k0sproject/rig/v2/rigtest"
+	"github.com/k0sproject/rig/v2/sudo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSudoPasswordGolden(t *testing.T) {
+	require.Equal(t,
+		`/bin/sh -c -- 'IFS= read -r p; if ! printf '"'"'%s'\\'n'"'"' "$p" | LC_ALL=C sudo -S -p '"'"''"'"' -v; then echo '"'"'rig-sudo: authentication failed'"'"' >&2; exit 1; fi; unset p; sudo -n -- /bin/sh -c -- '"'"'k0s status'"'"'; exit $?'`,
+		sudo.SudoPassword("k0s status"),
+	)
+}
+
+// passwordRegistry returns a registry where sudo without a password is not
+// available and sudo with the password from provider is tried next.
+func passwordRegistry(provider sudo.PasswordProvider) *sudo.Registry {
+	registry := sudo.NewRegistry()
+	sudo.RegisterSudo(registry)
+	sudo.RegisterSudoPassword(registry, provider)
+	return registry
+}
+
+// sudoHost handles the commands of a host where sudo accepts password and
+// records the input the commands that run after it get.
+func sudoHost(mr *rigtest.MockRunner, password string, inputs *[]string) {
+	mr.ErrDefault = errProbe
+	mr.AddCommand(rigtest.HasPrefix("/bin/sh -c -- 'IFS= read -r p;"), func(a *rigtest.A) error {
+		reader := bufio.NewReader(a.Stdin)
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		if strings.TrimSuffix(line, "\n") != password {
+			fmt.Fprintln(a.Stderr, "Sorry, try again.")
+			fmt.Fprintln(a.Stderr, "sudo: 1 incorrect password attempt")
+			fmt.Fprintln(a.Stderr, "rig-sudo: authentication failed")
+			return errProbe
+		}
+		rest, err := io.ReadAll(reader)
+		if err != nil {
+			return err
+		}
+		*inputs = append(*inputs, string(rest))
+		return nil
+	})
+}
+
+func TestRegisterSudoPassword(t *testing.T) {
+	t.Run("password is passed on stdin", func(t *testing.T) {
+		mr := rigtest.NewMockRunner()
+		var inputs []string
+		sudoHost(mr, "s3cret", &inputs)
+
+		runner, err := passwordRegistry(sudo.StaticPassword("s3cret")).Get(mr)
+		require.NoError(t, err)
+		require.NoError(t, runner.Exec("k0s status"))
+		require.NoError(t, runner.Exec("cat > /etc/k0s/k0s.yaml", cmd.StdinString("apiVersion: v1\n")))
+		require.Equal(t, []string{"", "", "apiVersion: v1\n"}, inputs, "the probe and the plain exec get no input, the command its own")
+		rigtest.ReceivedEqual(t, mr, sudo.SudoPassword("k0s status"))
+		require.NoError(t, mr.NotReceived(rigtest.Contains("s3cret")))
+	})
+
+	t.Run("password is redacted from the input log", func(t *testing.T) {
+		mr := rigtest.NewMockRunner()
+		var inputs []string
+		sudoHost(mr, "s3cret", &inputs)
+
+		runner, err := passwordRegistry(sudo.StaticPassword("s3cret")).Get(mr)
+		require.NoError(t, err)
+		logger := &rigtest.MockLogger{}
+		executor, ok := runner.(*cmd.Executor)
+		require.True(t, ok)
+		executor.SetLogger(logger)
+		require.NoError(t, runner.Exec("cat", cmd.LogInput(true), cmd.StdinString("hello\n")))
+		require.False(t, logger.ReceivedSubstring("s3cret"))
+		require.True(t, logger.ReceivedSubstring(cmd.DefaultRedactMask))
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		mr := rigtest.NewMockRunner()
+		var inputs []string
+		sudoHost(mr, "s3cret", &inputs)
+
+		runner, err := passwordRegistry(sudo.StaticPassword("guess")).Get(mr)
+		require.NoError(t, err, "the wrong password is reported by the commands")
+		require.ErrorIs(t, runner.Exec("k0s status"), sudo.ErrWrongPassword)
+		require.Len(t, mr.Commands(), 2, "nothing runs after the probes")
+	})
+
+	t.Run("not allowed to use sudo", func(t *testing.T) {
+		mr := rigtest.NewMockRunner()
+		mr.ErrDefault = errProbe
+		mr.AddCommand(rigtest.HasPrefix("/bin/sh -c -- 'IFS= read -r p;"), func(a *rigtest.A) error {
+			fmt.Fprintln(a.Stderr, "Sorry, user k0s may not run sudo on node-1.")
+			fmt.Fprintln(a.Stderr, "rig-sudo: authentication failed")
+			return errProbe
+		})
+
+		_, err := passwordRegistry(sudo.StaticPassword("s3cret")).Get(mr)
+		require.ErrorIs(t, err, sudo.ErrNoSudo)
+	})
+
+	t.Run("no password", func(t *testing.T) {
+		mr := rigtest.NewMockRunner()
+		mr.ErrDefault = errProbe
+		provider := sudo.PasswordCallback(func() (string, error) { return "", errors.New("cancelled") })
+
+		_, err := passwordRegistry(provider).Get(mr)
+		require.ErrorIs(t, err, sudo.ErrNoSudo)
+		require.Len(t, mr.Commands(), 1, "only sudo without a password is probed")
+	})
+}
+
+// passwordConnection is a mock connection that knows its login password.
+type passwordConnection struct {
+	*rigtest.MockConnection
+	password string
+}
+
+func (c *passwordConnection) LoginPassword() (string, error) {
+	if c.password == "" {
+		return "", protocol.ErrUnsupported
+	}
+	return c.password, nil
+}
+
+func TestConnectionPassword(t *testing.T) {
+	conn := &passwordConnection{MockConnection: rigtest.NewMockConnection(), password: "s3cret"}
+	password, err := sudo.ConnectionPassword(cmd.NewExecutor(conn))
+	require.NoError(t, err)
+	require.Equal(t, "s3cret", password)
+
+	conn.password = ""
+	_, err = sudo.ConnectionPassword(cmd.NewExecutor(conn))
+	require.ErrorIs(t, err, protocol.ErrUnsupported)
+
+	_, err = sudo.ConnectionPassword(cmd.NewExecutor(rigtest.NewMockConnection()))
+	require.Error(t, err)
+}
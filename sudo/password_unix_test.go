@@ -0,0 +1,70 @@
+//go:build !windows
+
+package sudo_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/k0sproject/rig/v2/cmd"
+	"github.com/k0sproject/rig/v2/protocol/localhost"
+	"github.com/k0sproject/rig/v2/sudo"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSudo validates the password "s3cret" like sudo -S -v does and keeps the
+// timestamp per parent process, like sudo does for a session without a
+// terminal. sudo -n runs the command when the timestamp is there.
+const fakeSudo = `#!/bin/sh
+stamp="$FAKE_SUDO_DIR/stamp.$PPID"
+case "$1" in
+-S)
+	IFS= read -r pw
+	if [ "$pw" != s3cret ]; then
+		echo "Sorry, try again." >&2
+		echo "sudo: 1 incorrect password attempt" >&2
+		exit 1
+	fi
+	touch "$stamp"
+	;;
+-n)
+	if [ ! -f "$stamp" ]; then
+		echo "sudo: a password is required" >&2
+		exit 1
+	fi
+	shift 2
+	exec "$@"
+	;;
+esac
+`
+
+func TestSudoPasswordScript(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sudo"), []byte(fakeSudo), 0o755)) //nolint:gosec // an executable script
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("FAKE_SUDO_DIR", dir)
+
+	conn, err := localhost.NewConnection()
+	require.NoError(t, err)
+
+	registry := sudo.NewRegistry()
+	sudo.RegisterSudo(registry)
+	sudo.RegisterSudoPassword(registry, sudo.StaticPassword("s3cret"))
+	runner, err := registry.Get(cmd.NewExecutor(conn))
+	require.NoError(t, err)
+
+	out, err := runner.ExecOutput("echo hello")
+	require.NoError(t, err)
+	require.Equal(t, "hello", out)
+
+	out, err = runner.ExecOutput("cat", cmd.StdinString("apiVersion: v1\n"))
+	require.NoError(t, err)
+	require.Equal(t, "apiVersion: v1", out, "the command gets its own input and not the password")
+
+	registry = sudo.NewRegistry()
+	sudo.RegisterSudoPassword(registry, sudo.StaticPassword("guess"))
+	runner, err = registry.Get(cmd.NewExecutor(conn))
+	require.NoError(t, err)
+	require.ErrorIs(t, runner.Exec("echo hello"), sudo.ErrWrongPassword)
+}
@@ -0,0 +1,44 @@
+package sudo
+
+import (
+	"github.com/k0sproject/rig/v2/sh"
+)
+
+// uid0Probe is the command that tells that a method actually runs commands as
+// root. pfexec and pbrun run the command even when the user has no privileges,
+// so they can't be probed with a command that merely succeeds.
+const uid0Probe = `[ "$(id -u)" = 0 ]`
+
+// Pfexec is a DecorateFunc that will wrap the given command in a pfexec call,
+// which runs it with the privileges of the user's RBAC profiles on Solaris
+// and illumos.
+//
+// The command runs through an explicit POSIX shell for the same reasons as in
+// [Sudo].
+func Pfexec(cmd string) string {
+	return "pfexec " + sh.Shell(cmd)
+}
+
+// RegisterPfexec registers a pfexec DecorateFunc with the given repository.
+// It is only used when the user's profiles make the commands run as root. Like
+// [RegisterRun0], it is not one of the defaults.
+func RegisterPfexec(repository *Registry) {
+	registerDecorator(repository, Pfexec, uid0Probe)
+}
+
+// Pbrun is a DecorateFunc that will wrap the given command in a pbrun call,
+// which runs it with the privileges granted by the PowerBroker policy.
+//
+// The command runs through an explicit POSIX shell for the same reasons as in
+// [Sudo].
+func Pbrun(cmd string) string {
+	return "pbrun " + sh.Shell(cmd)
+}
+
+// RegisterPbrun registers a pbrun DecorateFunc with the given repository. It
+// is only used when the policy makes the commands run as root without asking
+// for a password. It is not one of the defaults, as pbrun may consult a
+// policy server for every command.
+func RegisterPbrun(repository *Registry) {
+	registerDecorator(repository, Pbrun, uid0Probe)
+}
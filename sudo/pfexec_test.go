@@ -0,0 +1,40 @@
+package sudo_test
+
+import (
+	"testing"
+
+	"github.com/k0sproject/rig/v2/cmd"
+	"github.com/k0sproject/rig/v2/rigtest"
+	"github.com/k0sproject/rig/v2/sudo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPfexecAndPbrun(t *testing.T) {
+	require.Equal(t, `pfexec /bin/sh -c -- 'k0s status'`, sudo.Pfexec("k0s status"))
+	require.Equal(t, `pbrun /bin/sh -c -- 'k0s status'`, sudo.Pbrun("k0s status"))
+
+	for name, tc := range map[string]struct {
+		register func(*sudo.Registry)
+		decorate cmd.DecorateFunc
+	}{
+		"pfexec": {sudo.RegisterPfexec, sudo.Pfexec},
+		"pbrun":  {sudo.RegisterPbrun, sudo.Pbrun},
+	} {
+		t.Run(name, func(t *testing.T) {
+			reg := sudo.NewRegistry()
+			tc.register(reg)
+			probe := tc.decorate(`[ "$(id -u)" = 0 ]`)
+
+			mr := rigtest.NewMockRunner()
+			mr.ErrDefault = errProbe
+			mr.AddCommandSuccess(rigtest.Equal(probe))
+			_, err := reg.Get(mr)
+			require.NoError(t, err, "used when the commands run as root")
+
+			mr = rigtest.NewMockRunner()
+			mr.AddCommandFailure(rigtest.Equal(probe), errProbe)
+			_, err = reg.Get(mr)
+			require.ErrorIs(t, err, sudo.ErrNoSudo, "not used when the commands run without privileges")
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package sudo
+
+import (
+	"github.com/k0sproject/rig/v2/sh"
+)
+
+// Run0 is a DecorateFunc that will wrap the given command in a run0 call.
+// run0 is the sudo replacement of systemd 256 and later, it asks polkit for
+// the permission. Asking for a password is disabled, so run0 only works when
+// polkit allows the user without one.
+//
+// The command runs through an explicit POSIX shell for the same reasons as in
+// [Sudo].
+func Run0(cmd string) string {
+	return "run0 --no-ask-password -- " + sh.Shell(cmd)
+}
+
+// RegisterRun0 registers a run0 DecorateFunc with the given repository. It is
+// not one of the defaults, use rig.WithSudoMethod or a registry of your own
+// to use it.
+func RegisterRun0(repository *Registry) {
+	registerDecorator(repository, Run0, "true")
+}
@@ -0,0 +1,29 @@
+package sudo_test
+
+import (
+	"testing"
+
+	"github.com/k0sproject/rig/v2/rigtest"
+	"github.com/k0sproject/rig/v2/sudo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun0(t *testing.T) {
+	require.Equal(t, `run0 --no-ask-password -- /bin/sh -c -- 'k0s status'`, sudo.Run0("k0s status"))
+
+	reg := sudo.NewRegistry()
+	sudo.RegisterRun0(reg)
+
+	mr := rigtest.NewMockRunner()
+	mr.ErrDefault = errProbe
+	mr.AddCommandSuccess(rigtest.HasPrefix("run0 "))
+	runner, err := reg.Get(mr)
+	require.NoError(t, err)
+	require.NoError(t, runner.Exec("whoami"))
+	rigtest.ReceivedEqual(t, mr, `run0 --no-ask-password -- /bin/sh -c -- whoami`)
+
+	mr = rigtest.NewMockRunner()
+	mr.ErrDefault = errProbe
+	_, err = reg.Get(mr)
+	require.ErrorIs(t, err, sudo.ErrNoSudo)
+}
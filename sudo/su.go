@@ -0,0 +1,40 @@
+package sudo
+
+import (
+	"strings"
+
+	"github.com/k0sproject/rig/v2/sh"
+)
+
+// SuPassword is a DecorateFunc that will wrap the given command in a su call
+// that runs it as root, authenticating with the root password. The password
+// has to be the first line of the command's input, which the runner from
+// [RegisterSuPassword] takes care of.
+//
+// su reads the password in chunks and could take some of the command's own
+// input along with it, so the shell reads the password line and pipes it to su
+// alone, and the command gets the rest of the input through another file
+// descriptor. As in [SuAs], the command is run by /bin/sh rather than the
+// login shell of root.
+func SuPassword(cmd string) string {
+	return sh.Shell(`IFS= read -r p; exec 3<&0; printf '%s\n' "$p" | LC_ALL=C ` + SuAs("root")("exec 0<&3 3<&-; "+cmd))
+}
+
+// isWrongSuPassword reports whether stderr is the output of a [SuPassword]
+// command where su did not accept the password. The messages are in English
+// as the script runs su with LC_ALL=C.
+func isWrongSuPassword(stderr string) bool {
+	return strings.Contains(stderr, "Authentication failure") || strings.Contains(stderr, "incorrect password")
+}
+
+// RegisterSuPassword registers a method that runs the commands as root through
+// su with the root password from provider with the given repository. As with
+// [RegisterSudoPassword], the password is piped to the commands through stdin
+// and redacted from the logs, and a password su does not accept makes the
+// commands fail with [ErrWrongPassword].
+//
+// su implementations that only read the password from a terminal fail the
+// probe and are skipped.
+func RegisterSuPassword(repository *Registry, provider PasswordProvider) {
+	registerPasswordDecorator(repository, SuPassword, provider, isWrongSuPassword)
+}
@@ -0,0 +1,64 @@
+package sudo_test
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/k0sproject/rig/v2/rigtest"
+	"github.com/k0sproject/rig/v2/sudo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSuPasswordGolden(t *testing.T) {
+	require.Equal(t,
+		`/bin/sh -c -- 'IFS= read -r p; exec 3<&0; printf '"'"'%s'\\'n'"'"' "$p" | LC_ALL=C su -s /bin/sh root -c '"'"'exec 0<&3 3<&-; k0s status'"'"''`,
+		sudo.SuPassword("k0s status"),
+	)
+}
+
+func TestRegisterSuPassword(t *testing.T) {
+	newHost := func() *rigtest.MockRunner {
+		mr := rigtest.NewMockRunner()
+		mr.ErrDefault = errProbe
+		mr.AddCommand(rigtest.Contains("su -s /bin/sh root"), func(a *rigtest.A) error {
+			line, err := bufio.NewReader(a.Stdin).ReadString('\n')
+			if err != nil {
+				return err
+			}
+			if line != "r00t\n" {
+				fmt.Fprintln(a.Stderr, "Password: su: Authentication failure")
+				return errProbe
+			}
+			return nil
+		})
+		return mr
+	}
+	registry := func(password string) *sudo.Registry {
+		r := sudo.NewRegistry()
+		sudo.RegisterSuPassword(r, sudo.StaticPassword(password))
+		return r
+	}
+
+	mr := newHost()
+	runner, err := registry("r00t").Get(mr)
+	require.NoError(t, err)
+	require.NoError(t, runner.Exec("whoami"))
+	rigtest.ReceivedEqual(t, mr, sudo.SuPassword("whoami"))
+
+	runner, err = registry("guess").Get(newHost())
+	require.NoError(t, err)
+	require.ErrorIs(t, runner.Exec("whoami"), sudo.ErrWrongPassword)
+
+	mr = rigtest.NewMockRunner()
+	mr.AddCommand(rigtest.Contains("su -s /bin/sh root"), func(a *rigtest.A) error {
+		_, _ = io.Copy(io.Discard, a.Stdin)
+		fmt.Fprintln(a.Stderr, "su: must be run from a terminal")
+		return errProbe
+	})
+	_, err = registry("r00t").Get(mr)
+	require.ErrorIs(t, err, sudo.ErrNoSudo)
+	require.True(t, strings.HasPrefix(mr.Commands()[0], "/bin/sh -c -- 'IFS= read -r p;"))
+}
@@ -0,0 +1,51 @@
+//go:build !windows
+
+package sudo_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/k0sproject/rig/v2/cmd"
+	"github.com/k0sproject/rig/v2/protocol/localhost"
+	"github.com/k0sproject/rig/v2/sudo"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSu accepts the password "r00t" and reads all of its input like a su
+// that reads the password in chunks would, before running the command given
+// as "su -s /bin/sh root -c <command>".
+const fakeSu = `#!/bin/sh
+IFS= read -r pw
+cat >/dev/null
+if [ "$pw" != r00t ]; then
+	echo "su: Authentication failure" >&2
+	exit 1
+fi
+exec "$2" -c "$5"
+`
+
+func TestSuPasswordScript(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "su"), []byte(fakeSu), 0o755)) //nolint:gosec // an executable script
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	conn, err := localhost.NewConnection()
+	require.NoError(t, err)
+
+	registry := sudo.NewRegistry()
+	sudo.RegisterSuPassword(registry, sudo.StaticPassword("r00t"))
+	runner, err := registry.Get(cmd.NewExecutor(conn))
+	require.NoError(t, err)
+
+	out, err := runner.ExecOutput("cat", cmd.StdinString("apiVersion: v1\n"))
+	require.NoError(t, err)
+	require.Equal(t, "apiVersion: v1", out, "the command gets its own input and not the password")
+
+	registry = sudo.NewRegistry()
+	sudo.RegisterSuPassword(registry, sudo.StaticPassword("guess"))
+	runner, err = registry.Get(cmd.NewExecutor(conn))
+	require.NoError(t, err)
+	require.ErrorIs(t, runner.Exec("echo hello"), sudo.ErrWrongPassword)
+}
@@ -0,0 +1,214 @@
+package sudo
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/k0sproject/rig/v2/cmd"
+	"github.com/k0sproject/rig/v2/log"
+	"github.com/k0sproject/rig/v2/powershell"
+)
+
+// windowsTaskRunScript is run by the scheduled task of [WindowsTask]. It runs
+// the command from the file next to it through cmd.exe and leaves its output
+// and exit code in files for the script that started the task. The exit code
+// file is renamed into place so it is never read half written.
+const windowsTaskRunScript = `$d = $PSScriptRoot
+try {
+	$psi = New-Object System.Diagnostics.ProcessStartInfo
+	$psi.FileName = 'cmd.exe'
+	$psi.Arguments = '/C ' + [IO.File]::ReadAllText((Join-Path $d 'command'))
+	$psi.UseShellExecute = $false
+	$psi.RedirectStandardOutput = $true
+	$psi.RedirectStandardError = $true
+	$p = [Diagnostics.Process]::Start($psi)
+	$o = $p.StandardOutput.ReadToEndAsync()
+	$e = $p.StandardError.ReadToEndAsync()
+	$p.WaitForExit()
+	[IO.File]::WriteAllText((Join-Path $d 'stdout'), $o.Result)
+	[IO.File]::WriteAllText((Join-Path $d 'stderr'), $e.Result)
+	$c = $p.ExitCode
+} catch {
+	[IO.File]::WriteAllText((Join-Path $d 'stderr'), [string]$_)
+	$c = 1
+}
+[IO.File]::WriteAllText((Join-Path $d 'exitcode.tmp'), [string]$c)
+Move-Item -LiteralPath (Join-Path $d 'exitcode.tmp') -Destination (Join-Path $d 'exitcode')`
+
+// psVerbatimQuotes doubles the characters PowerShell accepts as single quotes,
+// which is the only escape there is in a verbatim string.
+var psVerbatimQuotes = strings.NewReplacer("'", "''", "\u2018", "\u2018\u2018", "\u2019", "\u2019\u2019", "\u201a", "\u201a\u201a", "\u201b", "\u201b\u201b")
+
+// psVerbatim returns s as a single-quoted PowerShell string that keeps its
+// content, line breaks included, exactly as is.
+func psVerbatim(s string) string {
+	return "'" + psVerbatimQuotes.Replace(s) + "'"
+}
+
+// ErrWindowsTaskInput is returned for commands that are given input on a
+// runner that elevates them through [WindowsTask], which can't pass it on.
+var ErrWindowsTaskInput = errors.New("commands elevated through a scheduled task can't be given input")
+
+// windowsTaskNotRun is the LastTaskResult of a scheduled task that has not
+// run yet (SCHED_S_TASK_HAS_NOT_RUN).
+const windowsTaskNotRun = "267011"
+
+// WindowsTask is a DecorateFunc that will wrap the given command in a
+// PowerShell script that runs it elevated through a one-shot scheduled task.
+//
+// The task runs as the current user with the highest privileges available to
+// it, which for a member of the Administrators group is the full token that
+// UAC withholds from a network logon, such as a WinRM session of a local
+// account. The script waits for the task to finish, writes out what the
+// command wrote to stdout and stderr and exits with its exit code. The task
+// and the directory in the user's temporary directory that holds the command
+// and its results are removed afterwards.
+//
+// The command does not get the input of the script, the runner registered
+// by [RegisterWindowsTask] fails commands that are given input with
+// [ErrWindowsTaskInput]. Stopping the script does not stop a command that
+// already runs in the task.
+func WindowsTask(command string) string {
+	return windowsTask(command, "", `$u = New-ScheduledTaskPrincipal -UserId ([Security.Principal.WindowsIdentity]::GetCurrent().Name) -LogonType S4U -RunLevel Highest
+	Register-ScheduledTask -TaskName $n -Action $a -Principal $u -Settings $s | Out-Null`)
+}
+
+// windowsWrongPassword is the HRESULT of the error Register-ScheduledTask
+// fails with when the password of the user is not accepted
+// (ERROR_LOGON_FAILURE).
+const windowsWrongPassword = "0x8007052e"
+
+// WindowsTaskAs returns a DecorateFunc that works like [WindowsTask], but
+// runs the command in a task of user, with the highest privileges available
+// to that user. The password of user has to be the first line of the
+// command's input, which the runner from [RegisterWindowsTaskAs] takes care
+// of. It is only kept by the task scheduler for the task, which is removed
+// when the command has finished.
+//
+// The task writes the results to the temporary directory of the user that
+// runs the script, so user needs access to it, which an elevated
+// administrator has.
+func WindowsTaskAs(user string) cmd.DecorateFunc {
+	return func(command string) string {
+		return windowsTask(command, `$p = [Console]::In.ReadLine()
+`, `try {
+		Register-ScheduledTask -TaskName $n -Action $a -Settings $s -User `+psVerbatim(user)+` -Password $p -RunLevel Highest | Out-Null
+	} catch {
+		if ($_.FullyQualifiedErrorId -like '*`+windowsWrongPassword+`*') { [Console]::Error.WriteLine('`+authFailureMarker+`'); exit 1 }
+		throw
+	} finally {
+		Remove-Variable p
+	}`)
+	}
+}
+
+// windowsTask returns the script of [WindowsTask] for command, with prelude
+// run first and register registering the task $n that runs action $a with
+// settings $s.
+func windowsTask(command, prelude, register string) string {
+	return powershell.Cmd(`$ErrorActionPreference = 'Stop'
+` + prelude + `$n = 'rig-sudo-' + [guid]::NewGuid().ToString('N')
+$d = Join-Path ([IO.Path]::GetTempPath()) $n
+New-Item -ItemType Directory -Path $d | Out-Null
+try {
+	[IO.File]::WriteAllText((Join-Path $d 'command'), ` + psVerbatim(command) + `)
+	[IO.File]::WriteAllText((Join-Path $d 'run.ps1'), ` + psVerbatim(windowsTaskRunScript) + `)
+	$a = New-ScheduledTaskAction -Execute 'powershell.exe' -Argument ('-NoProfile -NonInteractive -ExecutionPolicy Bypass -File "' + (Join-Path $d 'run.ps1') + '"')
+	$s = New-ScheduledTaskSettingsSet -AllowStartIfOnBatteries -DontStopIfGoingOnBatteries -ExecutionTimeLimit ([TimeSpan]::Zero)
+	` + register + `
+	Start-ScheduledTask -TaskName $n
+	$x = Join-Path $d 'exitcode'
+	while (-not (Test-Path -LiteralPath $x)) {
+		Start-Sleep -Milliseconds 100
+		if ((Get-ScheduledTask -TaskName $n).State -eq 'Ready' -and -not (Test-Path -LiteralPath $x)) {
+			$r = (Get-ScheduledTaskInfo -TaskName $n).LastTaskResult
+			if ($r -ne ` + windowsTaskNotRun + `) { throw "elevated task finished with result $r without running the command" }
+		}
+	}
+	[Console]::Out.Write([IO.File]::ReadAllText((Join-Path $d 'stdout')))
+	[Console]::Error.Write([IO.File]::ReadAllText((Join-Path $d 'stderr')))
+	$c = [int][IO.File]::ReadAllText($x)
+} finally {
+	Unregister-ScheduledTask -TaskName $n -Confirm:$false -ErrorAction SilentlyContinue
+	Remove-Item -LiteralPath $d -Recurse -Force -ErrorAction SilentlyContinue
+}
+exit $c`)
+}
+
+// windowsAdminProbe succeeds when the user is a member of the Administrators
+// group, which is listed for a session that is not elevated too, but only for
+// deny.
+const windowsAdminProbe = `whoami.exe /groups | findstr.exe /c:"S-1-5-32-544" >nul`
+
+// windowsElevatedProbe succeeds when it runs with a high integrity level,
+// which is what an elevated token has.
+const windowsElevatedProbe = `whoami.exe /groups | findstr.exe /c:"S-1-16-12288" >nul`
+
+// RegisterWindowsTask registers a [WindowsTask] DecorateFunc with the given
+// repository. It is used when a command run through the task is elevated,
+// which is the case for members of the Administrators group whose session is
+// not. Other users are told apart by their groups first, so that no task is
+// registered for them; use [RegisterWindowsTaskAs] to elevate their commands
+// as an administrator. Register it after [RegisterWindowsNoop], so that
+// sessions that are already elevated run their commands directly.
+//
+// Commands of the runner that are given input fail with [ErrWindowsTaskInput].
+func RegisterWindowsTask(repository *Registry) {
+	repository.Register(func(runner cmd.Runner) (cmd.Runner, bool) {
+		if !runner.IsWindows() {
+			return nil, false
+		}
+		// Ungated: a CommandGate that rejects these probes would silently
+		// change privilege detection, so they must always run.
+		if runner.Exec(windowsAdminProbe, cmd.Ungated()) != nil {
+			return nil, false
+		}
+		if runner.Exec(WindowsTask(windowsElevatedProbe), cmd.Ungated()) != nil {
+			return nil, false
+		}
+		elevated := cmd.NewExecutor(runner, WindowsTask)
+		elevated.SetOptions(cmd.RejectStdin(ErrWindowsTaskInput))
+		return elevated, true
+	})
+}
+
+// RegisterWindowsTaskAs registers a [WindowsTaskAs] DecorateFunc for user
+// with the given repository, for accounts that can't elevate their commands
+// themselves. The password of user from provider is piped to the commands
+// through stdin and redacted from the logs, as with [RegisterSudoPassword].
+//
+// It is used when a command run as user through the task is elevated. The
+// factory is skipped when provider returns an error, and when the task
+// scheduler does not accept the password, the factory returns a runner whose
+// commands fail with [ErrWrongPassword]. Commands of the runner that are
+// given input fail with [ErrWindowsTaskInput].
+func RegisterWindowsTaskAs(repository *Registry, user string, provider PasswordProvider) {
+	decorate := WindowsTaskAs(user)
+	repository.Register(func(runner cmd.Runner) (cmd.Runner, bool) {
+		if !runner.IsWindows() {
+			return nil, false
+		}
+		password, err := provider(runner)
+		if err != nil {
+			log.Trace(context.Background(), "password for privilege escalation not available", log.HostAttr(runner), log.KeyError, err)
+			return nil, false
+		}
+		elevated := cmd.NewExecutor(runner, decorate)
+		opts := []cmd.ExecOption{cmd.StdinPrefix(password + "\n"), cmd.RejectStdin(ErrWindowsTaskInput)}
+		if password != "" {
+			opts = append(opts, cmd.Redact(password))
+		}
+		elevated.SetOptions(opts...)
+		// Ungated: a CommandGate that rejects this probe would silently
+		// change privilege detection, so it must always run.
+		result, err := elevated.Run(context.Background(), windowsElevatedProbe, cmd.Ungated())
+		if err == nil {
+			return elevated, true
+		}
+		if result != nil && strings.Contains(result.Stderr, authFailureMarker) {
+			return cmd.NewErrorExecutor(ErrWrongPassword), true
+		}
+		return nil, false
+	})
+}
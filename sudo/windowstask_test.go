@@ -0,0 +1,149 @@
+package sudo_test
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/k0sproject/rig/v2/cmd"
+	"github.com/k0sproject/rig/v2/rigtest"
+	"github.com/k0sproject/rig/v2/sudo"
+	"github.com/stretchr/testify/require"
+)
+
+const adminProbe = `whoami.exe /groups | findstr.exe /c:"S-1-5-32-544" >nul`
+
+func TestRegisterWindowsTask(t *testing.T) {
+	t.Run("used when the task runs elevated", func(t *testing.T) {
+		mr := rigtest.NewMockRunner()
+		mr.Windows = true
+		mr.AddCommandSuccess(rigtest.Equal(adminProbe))
+		mr.AddCommandSuccess(rigtest.HasPrefix("powershell.exe"))
+
+		registry := sudo.NewRegistry()
+		sudo.RegisterWindowsTask(registry)
+		runner, err := registry.Get(mr)
+		require.NoError(t, err)
+		rigtest.ReceivedEqual(t, mr, sudo.WindowsTask(`whoami.exe /groups | findstr.exe /c:"S-1-16-12288" >nul`), "the probe checks for a high integrity level")
+
+		decoded := runner.Explain(`sc.exe start "it's"`).Decoded
+		require.Contains(t, decoded, `[IO.File]::WriteAllText((Join-Path $d 'command'), 'sc.exe start "it''s"')`, "the command is passed in a file")
+		require.Contains(t, decoded, "-LogonType S4U -RunLevel Highest")
+		require.Contains(t, decoded, "Unregister-ScheduledTask -TaskName $n")
+		require.Contains(t, decoded, "exit $c")
+	})
+
+	t.Run("commands with input fail", func(t *testing.T) {
+		mr := rigtest.NewMockRunner()
+		mr.Windows = true
+		mr.AddCommandSuccess(rigtest.Equal(adminProbe))
+		mr.AddCommandSuccess(rigtest.HasPrefix("powershell.exe"))
+
+		registry := sudo.NewRegistry()
+		sudo.RegisterWindowsTask(registry)
+		runner, err := registry.Get(mr)
+		require.NoError(t, err)
+		mr.Reset()
+
+		require.ErrorIs(t, runner.Exec("sort.exe", cmd.StdinString("b\na\n")), sudo.ErrWindowsTaskInput)
+		require.Empty(t, mr.Commands(), "the command is not run without its input")
+		require.NoError(t, runner.Exec("hostname.exe"))
+	})
+
+	t.Run("skipped without a task for non-administrators", func(t *testing.T) {
+		mr := rigtest.NewMockRunner()
+		mr.Windows = true
+		mr.AddCommandFailure(rigtest.Equal(adminProbe), errors.New("exit status 1"))
+		mr.AddCommandSuccess(rigtest.HasPrefix("powershell.exe"))
+
+		registry := sudo.NewRegistry()
+		sudo.RegisterWindowsTask(registry)
+		_, err := registry.Get(mr)
+		require.ErrorIs(t, err, sudo.ErrNoSudo)
+		require.NoError(t, mr.NotReceived(rigtest.HasPrefix("powershell.exe")), "no task is registered")
+	})
+
+	t.Run("skipped when the task does not run elevated", func(t *testing.T) {
+		mr := rigtest.NewMockRunner()
+		mr.Windows = true
+		mr.AddCommandSuccess(rigtest.Equal(adminProbe))
+		mr.AddCommandFailure(rigtest.HasPrefix("powershell.exe"), errors.New("exit status 1"))
+
+		registry := sudo.NewRegistry()
+		sudo.RegisterWindowsTask(registry)
+		_, err := registry.Get(mr)
+		require.ErrorIs(t, err, sudo.ErrNoSudo)
+	})
+
+	t.Run("skipped on non-windows", func(t *testing.T) {
+		mr := rigtest.NewMockRunner()
+
+		registry := sudo.NewRegistry()
+		sudo.RegisterWindowsTask(registry)
+		_, err := registry.Get(mr)
+		require.ErrorIs(t, err, sudo.ErrNoSudo)
+		require.Empty(t, mr.Commands())
+	})
+}
+
+// taskHost handles the task commands of a host where the task scheduler
+// accepts password for the user the tasks run as.
+func taskHost(mr *rigtest.MockRunner, password string) {
+	mr.Windows = true
+	mr.AddCommandFailure(rigtest.Equal(adminProbe), errors.New("exit status 1"))
+	mr.AddCommand(rigtest.HasPrefix("powershell.exe"), func(a *rigtest.A) error {
+		line, err := bufio.NewReader(a.Stdin).ReadString('\n')
+		if err != nil {
+			return err
+		}
+		if strings.TrimSuffix(line, "\n") != password {
+			fmt.Fprintln(a.Stderr, "rig-sudo: authentication failed")
+			return errProbe
+		}
+		return nil
+	})
+}
+
+func TestRegisterWindowsTaskAs(t *testing.T) {
+	t.Run("elevates a user that is not an administrator", func(t *testing.T) {
+		mr := rigtest.NewMockRunner()
+		taskHost(mr, "s3cret")
+
+		registry := sudo.NewRegistry()
+		sudo.RegisterWindowsTask(registry)
+		sudo.RegisterWindowsTaskAs(registry, "ops-admin", sudo.StaticPassword("s3cret"))
+		runner, err := registry.Get(mr)
+		require.NoError(t, err)
+		require.NoError(t, mr.NotReceived(rigtest.Contains("-LogonType S4U")), "the current user is not an administrator, so no task is registered for it")
+
+		require.NoError(t, runner.Exec("sc.exe start svc"))
+		decoded := runner.Explain("sc.exe start svc").Decoded
+		require.Contains(t, decoded, "$p = [Console]::In.ReadLine()")
+		require.Contains(t, decoded, "-User 'ops-admin' -Password $p -RunLevel Highest")
+		require.NotContains(t, decoded, "s3cret", "the password is passed on stdin")
+		require.ErrorIs(t, runner.Exec("sort.exe", cmd.StdinString("b\na\n")), sudo.ErrWindowsTaskInput)
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		mr := rigtest.NewMockRunner()
+		taskHost(mr, "s3cret")
+
+		registry := sudo.NewRegistry()
+		sudo.RegisterWindowsTaskAs(registry, "ops-admin", sudo.StaticPassword("wrong"))
+		runner, err := registry.Get(mr)
+		require.NoError(t, err)
+		require.ErrorIs(t, runner.Exec("sc.exe start svc"), sudo.ErrWrongPassword)
+	})
+
+	t.Run("skipped on non-windows", func(t *testing.T) {
+		mr := rigtest.NewMockRunner()
+
+		registry := sudo.NewRegistry()
+		sudo.RegisterWindowsTaskAs(registry, "ops-admin", sudo.StaticPassword("s3cret"))
+		_, err := registry.Get(mr)
+		require.ErrorIs(t, err, sudo.ErrNoSudo)
+		require.Empty(t, mr.Commands())
+	})
+}
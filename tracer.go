@@ -0,0 +1,46 @@
+package rig
+
+import (
+	"context"
+
+	"github.com/k0sproject/rig/v2/cmd"
+	"github.com/k0sproject/rig/v2/remotefs"
+)
+
+// ConnectInfo describes a connection attempt to a [ConnectTracer].
+type ConnectInfo struct {
+	// Host is the host being connected to.
+	Host string
+	// Protocol is the protocol family of the connection, such as "SSH".
+	Protocol string
+	// Attempt is the number of the attempt, starting from 1. Anything above
+	// 1 is a retry.
+	Attempt int
+}
+
+// ConnectTrace receives the outcome of a connection attempt from a
+// [ConnectTracer].
+type ConnectTrace interface {
+	// Finished fires when the attempt is over. err is nil on success.
+	Finished(err error)
+}
+
+// ConnectTracer extends [cmd.Tracer] for tracers that observe the connection
+// attempts made by [Client.Connect]. Configure one with [WithTracer].
+type ConnectTracer interface {
+	cmd.Tracer
+	// TraceConnect fires before each connection attempt. The returned
+	// context is the one the attempt is made with, which lets a tracer
+	// link whatever happens during the attempt to it.
+	TraceConnect(ctx context.Context, info ConnectInfo) (context.Context, ConnectTrace)
+}
+
+// TransferTracer extends [cmd.Tracer] for tracers that count the file content
+// moved to and from the host through [Client.FS]. Configure one with
+// [WithTracer]. See [remotefs.ObserveTransfers] for what is counted.
+type TransferTracer interface {
+	cmd.Tracer
+	// BytesTransferred fires after each read, write or copy that moved
+	// file content. It may be called concurrently.
+	BytesTransferred(host string, dir remotefs.TransferDirection, n int64)
+}
@@ -0,0 +1,142 @@
+package transcript
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/k0sproject/rig/v2/protocol"
+)
+
+// Terminal size written to the asciicast header when the session did not ask
+// for a specific one.
+const (
+	defaultCastWidth  = 80
+	defaultCastHeight = 24
+)
+
+// AsciicastDir returns a [CastFunc] that creates the recordings as files in
+// dir, named after the host and the time the session started.
+func AsciicastDir(dir string) CastFunc {
+	return func(host string) (io.WriteCloser, error) {
+		name := fmt.Sprintf("%s-%s.cast", safeName(host), time.Now().UTC().Format("20060102T150405.000000000"))
+		f, err := os.OpenFile(filepath.Join(dir, name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("create asciicast file: %w", err)
+		}
+		return f, nil
+	}
+}
+
+// safeName replaces the characters of host that do not belong in a file name.
+func safeName(host string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, host)
+}
+
+// castHeader is the first line of an asciicast v2 recording.
+type castHeader struct {
+	Version   int    `json:"version"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	Timestamp int64  `json:"timestamp"`
+	Command   string `json:"command,omitempty"`
+	Title     string `json:"title,omitempty"`
+}
+
+// castWriter writes an asciicast v2 recording: a header line followed by a
+// JSON array of [elapsed seconds, "o", data] for every chunk of output.
+type castWriter struct {
+	mu      sync.Mutex
+	w       io.WriteCloser
+	enc     *json.Encoder
+	start   time.Time
+	hdr     castHeader
+	partial []byte
+	err     error
+}
+
+func newCastWriter(w io.WriteCloser, start time.Time, command, host string, size protocol.WindowSize) *castWriter {
+	width, height := size.Width, size.Height
+	if width <= 0 || height <= 0 {
+		width, height = defaultCastWidth, defaultCastHeight
+	}
+	return &castWriter{
+		w:     w,
+		enc:   json.NewEncoder(w),
+		start: start,
+		hdr: castHeader{
+			Version:   2,
+			Width:     width,
+			Height:    height,
+			Timestamp: start.Unix(),
+			Command:   command,
+			Title:     host,
+		},
+	}
+}
+
+func (c *castWriter) header() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.enc.Encode(c.hdr); err != nil {
+		c.err = fmt.Errorf("write asciicast header: %w", err)
+	}
+	return c.err
+}
+
+// output records p as an output event. A multi-byte character split between
+// writes is held back until the rest of it arrives, as an event has to be a
+// valid string.
+func (c *castWriter) output(p []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	data := append(c.partial, p...)
+	cut := len(data)
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				cut = i
+			}
+			break
+		}
+	}
+	c.partial = append([]byte(nil), data[cut:]...)
+	c.event(data[:cut])
+}
+
+func (c *castWriter) event(data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	elapsed := time.Since(c.start).Seconds()
+	if err := c.enc.Encode([]any{elapsed, "o", string(data)}); err != nil {
+		c.err = fmt.Errorf("write asciicast event: %w", err)
+	}
+}
+
+func (c *castWriter) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.event(c.partial)
+	c.partial = nil
+	if err := c.w.Close(); err != nil && c.err == nil {
+		c.err = fmt.Errorf("close asciicast: %w", err)
+	}
+	return c.err
+}
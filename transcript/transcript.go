@@ -0,0 +1,246 @@
+// Package transcript provides a tracer that keeps an auditable record of what
+// rig did on hosts: every command with its output as JSON lines and, optionally,
+// interactive sessions as replayable asciicast recordings.
+package transcript
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/k0sproject/rig/v2/cmd"
+	"github.com/k0sproject/rig/v2/protocol"
+)
+
+var (
+	_ cmd.CommandTracer     = (*Transcript)(nil)
+	_ cmd.InteractiveTracer = (*Transcript)(nil)
+)
+
+// Entry types.
+const (
+	TypeCommand     = "command"
+	TypeInteractive = "interactive"
+)
+
+// Entry is a line of a transcript. A command entry is written when the
+// command has finished, an interactive entry when the session has ended.
+type Entry struct {
+	// Type is [TypeCommand] or [TypeInteractive].
+	Type string `json:"type"`
+	Host string `json:"host"`
+	// Command is the command as it is logged: decorated and redacted. It is
+	// empty when CommandHidden is set. For an interactive session it is the
+	// command as given, empty for a shell.
+	Command       string    `json:"command,omitempty"`
+	CommandHidden bool      `json:"command_hidden,omitempty"`
+	Start         time.Time `json:"start"`
+	// Duration is the duration of the command in seconds.
+	Duration float64 `json:"duration"`
+	// ExitCode is the exit code of the command, -1 when it is not known.
+	ExitCode int    `json:"exit_code"`
+	Signal   string `json:"signal,omitempty"`
+	// Error is how the command failed, such as its exit status. It does not
+	// include the output of the command and is not recorded when OutputHidden
+	// is set.
+	Error string `json:"error,omitempty"`
+	// Stdout and Stderr are the redacted output lines of a command. They are
+	// not recorded when OutputHidden is set.
+	Stdout       []string `json:"stdout,omitempty"`
+	Stderr       []string `json:"stderr,omitempty"`
+	OutputHidden bool     `json:"output_hidden,omitempty"`
+	// Asciicast is the name of the recording of an interactive session, when
+	// the writer it went to has one, such as a file created by [AsciicastDir].
+	Asciicast string `json:"asciicast,omitempty"`
+}
+
+// CastFunc returns the writer the asciicast recording of an interactive
+// session on host goes to. The writer is closed when the session ends.
+type CastFunc func(host string) (io.WriteCloser, error)
+
+// Option is a functional option for a [Transcript].
+type Option func(*Transcript)
+
+// WithAsciicast makes the transcript record the output of interactive
+// sessions in asciicast v2 format to the writers from fn. Input is not
+// recorded, as it can contain passwords typed at prompts.
+func WithAsciicast(fn CastFunc) Option {
+	return func(t *Transcript) {
+		t.cast = fn
+	}
+}
+
+// Transcript is a [cmd.CommandTracer] and a [cmd.InteractiveTracer] that
+// writes an [Entry] for every command and interactive session to a writer as
+// JSON lines. Use it client-wide with
+// [github.com/k0sproject/rig/v2.WithTracer] or for a single command with
+// [cmd.Trace].
+//
+// It records what the logs would show: secrets registered with [cmd.Redact]
+// are masked, and the command or output of commands run with
+// [cmd.HideCommand], [cmd.HideOutput] or [cmd.Sensitive] are left out.
+type Transcript struct {
+	mu   sync.Mutex
+	enc  *json.Encoder
+	err  error
+	cast CastFunc
+	now  func() time.Time
+}
+
+// New returns a new Transcript that writes to w.
+func New(w io.Writer, opts ...Option) *Transcript {
+	t := &Transcript{enc: json.NewEncoder(w), now: time.Now}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// Err returns the first error encountered while writing the transcript or
+// creating an asciicast recording.
+func (t *Transcript) Err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.err
+}
+
+func (t *Transcript) setErr(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.err == nil {
+		t.err = err
+	}
+}
+
+func (t *Transcript) write(entry *Entry) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.enc.Encode(entry); err != nil && t.err == nil {
+		t.err = fmt.Errorf("write transcript: %w", err)
+	}
+}
+
+// CommandFormatted implements [cmd.Tracer]. The transcript uses
+// [Transcript.TraceCommand] instead.
+func (t *Transcript) CommandFormatted(string, string) {}
+
+// ProcessStarted implements [cmd.Tracer]. The transcript uses
+// [Transcript.TraceCommand] instead.
+func (t *Transcript) ProcessStarted(string, string) {}
+
+// ProcessFinished implements [cmd.Tracer]. The transcript uses
+// [Transcript.TraceCommand] instead.
+func (t *Transcript) ProcessFinished(string, string, time.Duration, error) {}
+
+// TraceCommand implements [cmd.CommandTracer].
+func (t *Transcript) TraceCommand(_ context.Context, info cmd.CommandInfo) cmd.CommandTrace {
+	return &commandTrace{
+		transcript: t,
+		entry: Entry{
+			Type:          TypeCommand,
+			Host:          info.Host,
+			Command:       info.Command,
+			CommandHidden: info.CommandHidden,
+			Start:         info.Started,
+			OutputHidden:  info.OutputHidden,
+		},
+	}
+}
+
+type commandTrace struct {
+	transcript *Transcript
+	mu         sync.Mutex
+	entry      Entry
+}
+
+func (c *commandTrace) StdoutLine(line string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entry.Stdout = append(c.entry.Stdout, line)
+}
+
+func (c *commandTrace) StderrLine(line string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entry.Stderr = append(c.entry.Stderr, line)
+}
+
+func (c *commandTrace) Finished(exitCode int, signal protocol.Signal, duration time.Duration, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entry.Duration = duration.Seconds()
+	c.entry.ExitCode = exitCode
+	c.entry.Signal = string(signal)
+	if err != nil && !c.entry.OutputHidden {
+		c.entry.Error = err.Error()
+	}
+	c.transcript.write(&c.entry)
+}
+
+// TraceInteractive implements [cmd.InteractiveTracer].
+func (t *Transcript) TraceInteractive(host, command string, size protocol.WindowSize) cmd.InteractiveTrace {
+	trace := &interactiveTrace{
+		transcript: t,
+		entry: Entry{
+			Type:    TypeInteractive,
+			Host:    host,
+			Command: command,
+			Start:   t.now(),
+		},
+	}
+	if t.cast == nil {
+		return trace
+	}
+	w, err := t.cast(host)
+	if err != nil {
+		t.setErr(fmt.Errorf("create asciicast for %s: %w", host, err))
+		return trace
+	}
+	if named, ok := w.(interface{ Name() string }); ok {
+		trace.entry.Asciicast = named.Name()
+	}
+	trace.cast = newCastWriter(w, trace.entry.Start, command, host, size)
+	if err := trace.cast.header(); err != nil {
+		t.setErr(err)
+	}
+	return trace
+}
+
+type interactiveTrace struct {
+	transcript *Transcript
+	entry      Entry
+	cast       *castWriter
+}
+
+// Write records session output to the asciicast recording, if there is one.
+func (i *interactiveTrace) Write(p []byte) (int, error) {
+	if i.cast != nil {
+		i.cast.output(p)
+	}
+	return len(p), nil
+}
+
+// exitCoder is satisfied by errors that carry the exit code of a process.
+type exitCoder interface{ ExitCode() int }
+
+func (i *interactiveTrace) Finished(err error) {
+	i.entry.Duration = i.transcript.now().Sub(i.entry.Start).Seconds()
+	if err != nil {
+		i.entry.Error = err.Error()
+		i.entry.ExitCode = -1
+		var withCode exitCoder
+		if errors.As(err, &withCode) {
+			i.entry.ExitCode = withCode.ExitCode()
+		}
+	}
+	if i.cast != nil {
+		if err := i.cast.close(); err != nil {
+			i.transcript.setErr(err)
+		}
+	}
+	i.transcript.write(&i.entry)
+}
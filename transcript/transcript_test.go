@@ -0,0 +1,170 @@
+package transcript_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/k0sproject/rig/v2/cmd"
+	"github.com/k0sproject/rig/v2/protocol"
+	"github.com/k0sproject/rig/v2/rigtest"
+	"github.com/k0sproject/rig/v2/transcript"
+	"github.com/stretchr/testify/require"
+)
+
+func readEntries(t *testing.T, data []byte) []transcript.Entry {
+	t.Helper()
+	var entries []transcript.Entry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var entry transcript.Entry
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		entries = append(entries, entry)
+	}
+	require.NoError(t, scanner.Err())
+	return entries
+}
+
+func TestTranscriptCommands(t *testing.T) {
+	mr := rigtest.NewMockRunner()
+	mr.AddCommand(rigtest.HasPrefix("login"), func(a *rigtest.A) error {
+		fmt.Fprintln(a.Stdout, "logged in with hunter2")
+		fmt.Fprintln(a.Stderr, "warning: insecure")
+		return nil
+	})
+	mr.AddCommand(rigtest.Equal("false"), func(_ *rigtest.A) error { return errors.New("exit status 1") })
+
+	buf := &bytes.Buffer{}
+	tr := transcript.New(buf)
+	require.NoError(t, mr.Exec("login hunter2", cmd.Trace(tr), cmd.Redact("hunter2")))
+	require.Error(t, mr.Exec("false", cmd.Trace(tr)))
+	require.NoError(t, mr.Exec("login --quiet", cmd.Trace(tr), cmd.HideOutput()))
+	require.NoError(t, mr.Exec("login secret", cmd.Trace(tr), cmd.Sensitive()))
+	require.NoError(t, tr.Err())
+
+	entries := readEntries(t, buf.Bytes())
+	require.Len(t, entries, 4)
+
+	login := entries[0]
+	require.Equal(t, transcript.TypeCommand, login.Type)
+	require.Equal(t, "mockclient", login.Host)
+	require.Equal(t, "login [REDACTED]", login.Command)
+	require.Equal(t, []string{"logged in with [REDACTED]"}, login.Stdout)
+	require.Equal(t, []string{"warning: insecure"}, login.Stderr)
+	require.Equal(t, 0, login.ExitCode)
+	require.Empty(t, login.Error)
+	require.False(t, login.Start.IsZero())
+	require.NotContains(t, buf.String(), "hunter2")
+
+	require.Equal(t, "false", entries[1].Command)
+	require.Contains(t, entries[1].Error, "exit status 1")
+
+	require.Equal(t, "login --quiet", entries[2].Command)
+	require.True(t, entries[2].OutputHidden)
+	require.Empty(t, entries[2].Stdout)
+
+	require.Empty(t, entries[3].Command)
+	require.True(t, entries[3].CommandHidden)
+	require.True(t, entries[3].OutputHidden)
+	require.NotContains(t, buf.String(), "secret")
+}
+
+func TestTranscriptCommandErrors(t *testing.T) {
+	mr := rigtest.NewMockRunner()
+	mr.AddCommand(rigtest.HasPrefix("login"), func(a *rigtest.A) error {
+		fmt.Fprintln(a.Stderr, "bad token hunter2")
+		return exitError{code: 1}
+	})
+	mr.AddCommand(rigtest.HasPrefix("token"), func(_ *rigtest.A) error { return errors.New("token hunter2 rejected") })
+
+	buf := &bytes.Buffer{}
+	tr := transcript.New(buf)
+	err := mr.Exec("login --redacted", cmd.Trace(tr), cmd.Redact("hunter2"))
+	require.ErrorContains(t, err, "bad token", "the returned error keeps the stderr")
+	require.Error(t, mr.Exec("login --sensitive", cmd.Trace(tr), cmd.Sensitive(), cmd.Redact("hunter2")))
+	require.Error(t, mr.Exec("token", cmd.Trace(tr), cmd.Redact("hunter2")))
+	require.NoError(t, tr.Err())
+
+	entries := readEntries(t, buf.Bytes())
+	require.Len(t, entries, 3)
+	require.Equal(t, "exit status 1", entries[0].Error, "the error does not include stderr")
+	require.Equal(t, 1, entries[0].ExitCode)
+	require.True(t, entries[1].OutputHidden)
+	require.Empty(t, entries[1].Error)
+	require.Empty(t, entries[1].Stderr)
+	require.Equal(t, 1, entries[1].ExitCode)
+	require.Equal(t, "token [REDACTED] rejected", entries[2].Error)
+	require.NotContains(t, buf.String(), "hunter2")
+}
+
+func TestTranscriptInteractive(t *testing.T) {
+	dir := t.TempDir()
+	buf := &bytes.Buffer{}
+	tr := transcript.New(buf, transcript.WithAsciicast(transcript.AsciicastDir(dir)))
+
+	trace := tr.TraceInteractive("user@host:22", "bash", protocol.WindowSize{Width: 120, Height: 40})
+	euro := []byte("€")
+	_, _ = trace.Write([]byte("price: "))
+	_, _ = trace.Write(euro[:1])
+	_, _ = trace.Write(append(euro[1:], []byte("5\r\n")...))
+	trace.Finished(nil)
+	require.NoError(t, tr.Err())
+
+	entries := readEntries(t, buf.Bytes())
+	require.Len(t, entries, 1)
+	entry := entries[0]
+	require.Equal(t, transcript.TypeInteractive, entry.Type)
+	require.Equal(t, "user@host:22", entry.Host)
+	require.Equal(t, "bash", entry.Command)
+	require.Equal(t, 0, entry.ExitCode)
+	require.NotEmpty(t, entry.Asciicast)
+	require.True(t, strings.HasPrefix(entry.Asciicast, dir))
+	require.Contains(t, entry.Asciicast, "user_host_22-")
+
+	cast, err := os.ReadFile(entry.Asciicast)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(cast)), "\n")
+	require.Len(t, lines, 3)
+
+	var header map[string]any
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &header))
+	require.EqualValues(t, 2, header["version"])
+	require.EqualValues(t, 120, header["width"])
+	require.EqualValues(t, 40, header["height"])
+	require.Equal(t, "bash", header["command"])
+
+	var output strings.Builder
+	for _, line := range lines[1:] {
+		var event []any
+		require.NoError(t, json.Unmarshal([]byte(line), &event))
+		require.Len(t, event, 3)
+		require.Equal(t, "o", event[1])
+		output.WriteString(event[2].(string))
+	}
+	require.Equal(t, "price: €5\r\n", output.String(), "a character split between writes is kept intact")
+}
+
+type exitError struct{ code int }
+
+func (e exitError) Error() string { return fmt.Sprintf("exit status %d", e.code) }
+func (e exitError) ExitCode() int { return e.code }
+
+func TestTranscriptInteractiveWithoutAsciicast(t *testing.T) {
+	buf := &bytes.Buffer{}
+	tr := transcript.New(buf)
+	trace := tr.TraceInteractive("host", "", protocol.WindowSize{})
+	_, err := trace.Write([]byte("output"))
+	require.NoError(t, err)
+	trace.Finished(fmt.Errorf("session: %w", exitError{code: 130}))
+
+	entries := readEntries(t, buf.Bytes())
+	require.Len(t, entries, 1)
+	require.Empty(t, entries[0].Asciicast)
+	require.Equal(t, 130, entries[0].ExitCode)
+	require.Equal(t, "session: exit status 130", entries[0].Error)
+}